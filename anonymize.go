@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"net"
+	"strings"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/inventory"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// anonymizer replaces the MAC addresses, hostnames, and other client
+// identifiers in report output with -anonymize. Values are hashed with
+// HMAC-SHA256 keyed by -anonymize-key, so the same device gets the same
+// replacement in every report made with a key, and without the key
+// replacements cannot be reversed by hashing every possible MAC address.
+type anonymizer struct {
+	key []byte
+}
+
+// newAnonymizer returns the anonymizer for opts, or nil if -anonymize is not
+// set.
+func newAnonymizer(opts *options) *anonymizer {
+	if !opts.anonymize {
+		return nil
+	}
+	return &anonymizer{key: []byte(opts.anonymizeKey)}
+}
+
+// hash returns the keyed hash of value, with kind separating the hashes of
+// different fields.
+func (a *anonymizer) hash(kind string, value []byte) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write(value)
+	return mac.Sum(nil)
+}
+
+// hashBytes replaces all but the first keep bytes of value with hashed
+// bytes, keeping type prefixes such as those of client identifiers and
+// DUIDs.
+func (a *anonymizer) hashBytes(kind string, value []byte, keep int) []byte {
+	if len(value) <= keep {
+		return value
+	}
+	hashed := a.hash(kind, value)
+	anonymized := append([]byte(nil), value[:keep]...)
+	return append(anonymized, hashed[:min(len(value)-keep, len(hashed))]...)
+}
+
+// name replaces a hostname or device name with prefix and a hash, e.g.
+// host-1a2b3c4d.
+func (a *anonymizer) name(prefix string, name string) string {
+	if name == "" {
+		return ""
+	}
+	return prefix + "-" + hex.EncodeToString(a.hash(prefix, []byte(strings.ToLower(name)))[:4])
+}
+
+// dnsName anonymizes the first label of a DNS name, keeping the domain.
+func (a *anonymizer) dnsName(name string) string {
+	label, domain, found := strings.Cut(name, ".")
+	if !found {
+		return a.name("host", label)
+	}
+	return a.name("host", label) + "." + domain
+}
+
+// macAddress keeps the OUI of a MAC address, so organizations are still
+// shown, and hashes the rest. Randomized MACs have no OUI and are hashed
+// entirely, keeping only the locally administered and multicast bits.
+func (a *anonymizer) macAddress(macAddress net.HardwareAddr) net.HardwareAddr {
+	if len(macAddress) < 3 {
+		return macAddress
+	}
+	if leases.IsRandomizedMAC(macAddress) {
+		anonymized := net.HardwareAddr(a.hashBytes("mac", macAddress, 0))
+		anonymized[0] = anonymized[0]&^0x03 | macAddress[0]&0x03
+		return anonymized
+	}
+	return net.HardwareAddr(a.hashBytes("mac", macAddress, 3))
+}
+
+// clientID anonymizes a client identifier. Identifiers of hardware type 1
+// hold a MAC address, which is anonymized as one so they still match.
+func (a *anonymizer) clientID(uid []byte) []byte {
+	if len(uid) == 7 && uid[0] == 1 {
+		return append([]byte{1}, a.macAddress(uid[1:])...)
+	}
+	return a.hashBytes("uid", uid, 1)
+}
+
+// lease returns a copy of lease with its identifying fields anonymized.
+func (a *anonymizer) lease(lease *leases.Lease) *leases.Lease {
+	anonymized := *lease
+	anonymized.MACAddress = a.macAddress(lease.MACAddress)
+	anonymized.Hostname = a.name("host", lease.Hostname)
+	anonymized.UID = a.clientID(lease.UID)
+	// The first two bytes of a DUID are its type.
+	anonymized.DUID = a.hashBytes("duid", lease.DUID, 2)
+	anonymized.AgentCircuitID = a.hashBytes("circuit-id", lease.AgentCircuitID, 0)
+	anonymized.AgentRemoteID = a.hashBytes("remote-id", lease.AgentRemoteID, 0)
+
+	if lease.Variables != nil {
+		anonymized.Variables = make(map[string]string, len(lease.Variables))
+		for name, value := range lease.Variables {
+			switch name {
+			case "ddns-fwd-name", "ddns-client-fqdn":
+				value = a.dnsName(value)
+			}
+			anonymized.Variables[name] = value
+		}
+	}
+	return &anonymized
+}
+
+// device returns a copy of an inventory device with its MAC address and
+// hostname anonymized.
+func (a *anonymizer) device(device *inventory.Device) *inventory.Device {
+	anonymized := *device
+	anonymized.MACAddress = a.macAddress(device.MACAddress)
+	anonymized.Hostname = a.name("host", device.Hostname)
+	return &anonymized
+}
+
+// row anonymizes the lease and device name of row.
+func (a *anonymizer) row(row *leaseReportRow) {
+	row.lease = a.lease(row.lease)
+	row.deviceName = a.name("device", row.deviceName)
+}
+
+// rows anonymizes each of rows. It does nothing if a is nil.
+func (a *anonymizer) rows(rows []leaseReportRow) {
+	if a == nil {
+		return
+	}
+	for i := range rows {
+		a.row(&rows[i])
+	}
+}
+
+func registerAnonymizeFlags(flagSet *flag.FlagSet, opts *options) {
+	flagSet.BoolVar(&opts.anonymize, "anonymize", false, "replace MAC addresses, hostnames, client IDs, and device names with consistent hashes so output can be shared; OUIs are kept so organizations are still shown, and IP addresses are unchanged")
+	flagSet.StringVar(&opts.anonymizeKey, "anonymize-key", envOrDefault(flagEnvVars["anonymize-key"], ""), "secret key for -anonymize hashes; the same key gives the same replacements in every report, and without it hashes of MAC addresses can be reversed by brute force (env DHCP_LEASES_ANONYMIZE_KEY)")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// leaseQuery is the filtering and pagination of a /leases API request.
+type leaseQuery struct {
+	filters []leaseFilter
+	// limit is the maximum number of leases returned, or 0 for all.
+	limit  int
+	offset int
+	// cursor is the IP of the last lease of the previous page; leases
+	// after it are returned.
+	cursor net.IP
+}
+
+// queryList returns the values of the query parameter name, splitting
+// comma-separated lists.
+func queryList(values url.Values, name string) []string {
+	var list stringListFlag
+	for _, value := range values[name] {
+		list.Set(value)
+	}
+	return list
+}
+
+// parseSince parses a since parameter, an RFC 3339 time or a duration
+// before now such as 15m.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return time.Time{}, fmt.Errorf("invalid since '%v', expected an RFC 3339 time or a duration", value)
+	}
+	return now.Add(-duration), nil
+}
+
+// sinceFilter includes leases whose last transaction time, or start time if
+// they have none, is at or after since.
+func sinceFilter(since time.Time) leaseFilter {
+	return func(row *leaseReportRow) bool {
+		changed := row.lease.ClttTime
+		if changed.IsZero() {
+			changed = row.lease.StartTime
+		}
+		return !changed.Before(since)
+	}
+}
+
+// parseQueryInt parses the non-negative integer query parameter name, or
+// returns 0 if it is not set.
+func parseQueryInt(values url.Values, name string) (int, error) {
+	value := values.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %v '%v'", name, value)
+	}
+	return n, nil
+}
+
+// parseLeaseQuery parses the query parameters of a /leases request:
+//
+//	state     comma-separated lease states, as -filter
+//	cidr      subnets containing the leases, as -cidr
+//	mac       MAC address prefixes, as -mac-prefix
+//	vendor    OUI organization text or /regex/, as -vendor
+//	hostname  regular expression matching the hostname
+//	since     leases renewed at or after an RFC 3339 time, or within a
+//	          duration before now
+//	limit     maximum number of leases returned
+//	offset    number of matching leases skipped
+//	cursor    IP of the last lease of the previous page, from the next link
+func parseLeaseQuery(values url.Values, now time.Time) (*leaseQuery, error) {
+	query := &leaseQuery{}
+
+	addFilter := func(filter leaseFilter, err error) error {
+		if err != nil {
+			return err
+		}
+		query.filters = append(query.filters, filter)
+		return nil
+	}
+
+	if states := queryList(values, "state"); len(states) > 0 {
+		if err := addFilter(parseStateFilter(strings.Join(states, ","))); err != nil {
+			return nil, err
+		}
+	}
+	if cidrs := queryList(values, "cidr"); len(cidrs) > 0 {
+		if err := addFilter(parseCIDRFilter(cidrs)); err != nil {
+			return nil, err
+		}
+	}
+	if macPrefixes := queryList(values, "mac"); len(macPrefixes) > 0 {
+		if err := addFilter(parseMACPrefixFilter(macPrefixes)); err != nil {
+			return nil, err
+		}
+	}
+	if vendor := values.Get("vendor"); vendor != "" {
+		if err := addFilter(parseVendorFilter(vendor)); err != nil {
+			return nil, err
+		}
+	}
+	if hostname := values.Get("hostname"); hostname != "" {
+		if err := addFilter(parseHostnameFilter("/" + hostname + "/")); err != nil {
+			return nil, err
+		}
+	}
+	if value := values.Get("since"); value != "" {
+		since, err := parseSince(value, now)
+		if err != nil {
+			return nil, err
+		}
+		query.filters = append(query.filters, sinceFilter(since))
+	}
+
+	var err error
+	if query.limit, err = parseQueryInt(values, "limit"); err != nil {
+		return nil, err
+	}
+	if query.offset, err = parseQueryInt(values, "offset"); err != nil {
+		return nil, err
+	}
+	if value := values.Get("cursor"); value != "" {
+		if query.offset > 0 {
+			return nil, errors.New("offset and cursor cannot be used together")
+		}
+		if query.cursor = net.ParseIP(value); query.cursor == nil {
+			return nil, fmt.Errorf("invalid cursor '%v'", value)
+		}
+	}
+
+	return query, nil
+}
+
+func (query *leaseQuery) includeRow(row *leaseReportRow) bool {
+	for _, filter := range query.filters {
+		if !filter(row) {
+			return false
+		}
+	}
+	return true
+}
+
+// leasePage is the result of a leaseQuery.
+type leasePage struct {
+	rows []*leaseReportRow
+	// total is the number of leases matching the filters.
+	total int
+	// nextCursor is the cursor of the next page, or nil if this is the last
+	// page.
+	nextCursor net.IP
+}
+
+// apply returns the page of the rows of report selected by query. Report
+// rows are sorted by IP, so a cursor selects the rows after its IP.
+func (query *leaseQuery) apply(report *leaseReport) *leasePage {
+	page := &leasePage{}
+	skipped := 0
+	for i := range report.rows {
+		row := &report.rows[i]
+		if !query.includeRow(row) {
+			continue
+		}
+		page.total++
+
+		if query.cursor != nil && bytes.Compare(row.lease.IPAddress.To16(), query.cursor.To16()) <= 0 {
+			continue
+		}
+		if skipped < query.offset {
+			skipped++
+			continue
+		}
+		if query.limit > 0 && len(page.rows) == query.limit {
+			page.nextCursor = page.rows[len(page.rows)-1].lease.IPAddress
+			continue
+		}
+		page.rows = append(page.rows, row)
+	}
+	return page
+}
+
+// nextPageURL returns the URL of the page after page for the request URL
+// requestURL, or "" if page is the last one.
+func nextPageURL(requestURL *url.URL, page *leasePage) string {
+	if page.nextCursor == nil {
+		return ""
+	}
+	values := requestURL.Query()
+	values.Del("offset")
+	values.Set("cursor", page.nextCursor.String())
+	return requestURL.Path + "?" + values.Encode()
+}
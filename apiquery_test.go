@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// reportOfIPs returns a report with a row for each of ips, sorted by IP as
+// built reports are.
+func reportOfIPs(ips ...string) *leaseReport {
+	report := &leaseReport{}
+	for _, ip := range ips {
+		report.rows = append(report.rows, leaseReportRow{lease: &leases.Lease{IPAddress: net.ParseIP(ip)}})
+	}
+	slices.SortFunc(report.rows, func(a, b leaseReportRow) int {
+		return bytes.Compare(a.lease.IPAddress, b.lease.IPAddress)
+	})
+	return report
+}
+
+func pageIPs(page *leasePage) []string {
+	var ips []string
+	for _, row := range page.rows {
+		ips = append(ips, row.lease.IPAddress.String())
+	}
+	return ips
+}
+
+func TestLeaseQueryCursorPagination(t *testing.T) {
+	now := time.Now()
+	report := reportOfIPs("10.0.0.1", "10.0.0.2", "10.0.0.10", "10.0.0.20", "10.0.0.30")
+
+	query, err := parseLeaseQuery(url.Values{"limit": {"2"}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := query.apply(report)
+	if want := []string{"10.0.0.1", "10.0.0.2"}; !slices.Equal(pageIPs(page), want) {
+		t.Fatalf("first page = %v, want %v", pageIPs(page), want)
+	}
+	requestURL, err := url.Parse("/leases?limit=2&offset=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextURL := nextPageURL(requestURL, page)
+	if nextURL != "/leases?cursor=10.0.0.2&limit=2" {
+		t.Errorf("nextPageURL = %q", nextURL)
+	}
+
+	// Leases added before the cursor do not shift the next page, and leases
+	// added after it appear in order.
+	report = reportOfIPs("10.0.0.1", "10.0.0.2", "10.0.0.10", "10.0.0.20", "10.0.0.30", "10.0.0.0", "10.0.0.3", "10.0.0.25")
+
+	for _, test := range []struct {
+		cursor     string
+		wantIPs    []string
+		wantCursor string
+	}{
+		{"10.0.0.2", []string{"10.0.0.3", "10.0.0.10"}, "10.0.0.10"},
+		{"10.0.0.10", []string{"10.0.0.20", "10.0.0.25"}, "10.0.0.25"},
+		{"10.0.0.25", []string{"10.0.0.30"}, ""},
+		// A cursor lease that has since been removed still selects the
+		// leases after its IP.
+		{"10.0.0.15", []string{"10.0.0.20", "10.0.0.25"}, "10.0.0.25"},
+	} {
+		query, err := parseLeaseQuery(url.Values{"limit": {"2"}, "cursor": {test.cursor}}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := query.apply(report)
+		if !slices.Equal(pageIPs(page), test.wantIPs) {
+			t.Errorf("cursor %v page = %v, want %v", test.cursor, pageIPs(page), test.wantIPs)
+		}
+		var cursor string
+		if page.nextCursor != nil {
+			cursor = page.nextCursor.String()
+		}
+		if cursor != test.wantCursor {
+			t.Errorf("cursor %v next cursor = %q, want %q", test.cursor, cursor, test.wantCursor)
+		}
+		if page.total != len(report.rows) {
+			t.Errorf("cursor %v total = %v, want %v", test.cursor, page.total, len(report.rows))
+		}
+	}
+}
+
+func TestParseLeaseQueryErrors(t *testing.T) {
+	for _, values := range []url.Values{
+		{"cursor": {"10.0.0.1"}, "offset": {"1"}},
+		{"cursor": {"bogus"}},
+		{"limit": {"-1"}},
+		{"since": {"yesterday"}},
+	} {
+		if _, err := parseLeaseQuery(values, time.Now()); err == nil {
+			t.Errorf("parseLeaseQuery(%v) error = nil, want error", values)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"net/http"
+	"strings"
+)
+
+// authRealm is the realm of basic authentication challenges.
+const authRealm = "go-dhcp-leases"
+
+// httpAuth protects the JSON API and web UI with a bearer token, basic
+// authentication, or both, since lease data reveals every device on the
+// network.
+type httpAuth struct {
+	token    string
+	username string
+	password string
+}
+
+func registerAuthFlags(flagSet *flag.FlagSet, auth *httpAuth) {
+	flagSet.StringVar(&auth.token, "auth-token", envOrDefault(flagEnvVars["auth-token"], ""), "require this bearer token for the JSON API and web UI; /metrics, which has only aggregate counts, stays open (env DHCP_LEASES_AUTH_TOKEN)")
+	flagSet.StringVar(&auth.username, "auth-user", "", "require basic authentication with this user name and -auth-password for the JSON API and web UI")
+	flagSet.StringVar(&auth.password, "auth-password", envOrDefault(flagEnvVars["auth-password"], ""), "password for -auth-user (env DHCP_LEASES_AUTH_PASSWORD)")
+}
+
+func (auth *httpAuth) validate() error {
+	if (auth.username == "") != (auth.password == "") {
+		return errors.New("-auth-user and -auth-password must be set together")
+	}
+	return nil
+}
+
+func (auth *httpAuth) enabled() bool {
+	return auth.token != "" || auth.username != ""
+}
+
+// secretEqual compares a credential from a request with a configured one in
+// constant time. Both are hashed first so the time taken does not reveal
+// the configured length either.
+func secretEqual(given string, expected string) bool {
+	givenHash := sha256.Sum256([]byte(given))
+	expectedHash := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(givenHash[:], expectedHash[:]) == 1
+}
+
+// authorized reports whether r carries the configured bearer token or basic
+// authentication credentials.
+func (auth *httpAuth) authorized(r *http.Request) bool {
+	if auth.token != "" {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && secretEqual(token, auth.token) {
+			return true
+		}
+	}
+	if auth.username != "" {
+		if username, password, ok := r.BasicAuth(); ok {
+			// Compare both so a wrong user name takes as long as a wrong
+			// password.
+			usernameEqual := secretEqual(username, auth.username)
+			passwordEqual := secretEqual(password, auth.password)
+			if usernameEqual && passwordEqual {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wrap returns handler, requiring authorization first if auth is enabled.
+// Basic authentication challenges let browsers prompt for credentials for
+// the web UI.
+func (auth *httpAuth) wrap(handler http.Handler) http.Handler {
+	if !auth.enabled() {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.authorized(r) {
+			if auth.username != "" {
+				w.Header().Add("WWW-Authenticate", `Basic realm="`+authRealm+`", charset="UTF-8"`)
+			}
+			if auth.token != "" {
+				w.Header().Add("WWW-Authenticate", `Bearer realm="`+authRealm+`"`)
+			}
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// Modes of -color.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+var colorModes = []string{colorAuto, colorAlways, colorNever}
+
+const colorReset = "\x1b[0m"
+
+// stateColors are the ANSI colors of table rows by lease state. Rows in
+// other states are not colored.
+var stateColors = map[leases.LeaseState]string{
+	leases.Current:   "\x1b[32m",
+	leases.Past:      "\x1b[90m",
+	leases.Abandoned: "\x1b[31m",
+	leases.Future:    "\x1b[33m",
+}
+
+// useColor reports whether tables are colored in mode. Auto colors them when
+// stdout is a terminal and NO_COLOR is not set.
+func useColor(mode string) (bool, error) {
+	switch mode {
+	case colorAlways:
+		return true, nil
+	case colorNever, "":
+		// Commands without tables have no -color flag.
+		return false, nil
+	case colorAuto:
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		return term.IsTerminal(int(os.Stdout.Fd())), nil
+	}
+	return false, fmt.Errorf("unknown color mode '%v', expected one of %v", mode, strings.Join(colorModes, ", "))
+}
+
+// colorizeState returns line in the color of state.
+func colorizeState(line string, state leases.LeaseState) string {
+	if color, ok := stateColors[state]; ok {
+		return color + line + colorReset
+	}
+	return line
+}
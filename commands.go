@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// commandFunc runs a command after its flags have been parsed.
+type commandFunc func(ctx context.Context, flagSet *flag.FlagSet) error
+
+type command struct {
+	name        string
+	usage       string
+	description string
+	// setup registers the command's flags on flagSet and returns the
+	// function that runs the command.
+	setup func(flagSet *flag.FlagSet) commandFunc
+	// outputFormats are the values of the command's -output flag offered by
+	// shell completion, if they are not leaseOutputFormats.
+	outputFormats []string
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name:        "list",
+			usage:       "list [flags]",
+			description: "print a report of all leases (default command)",
+			setup:       setupListCommand,
+		},
+		{
+			name:        "createdb",
+			usage:       "createdb [flags]",
+			description: "create the OUI database from IEEE registry or Wireshark manuf files",
+			setup:       setupCreateDBCommand,
+		},
+		{
+			name:        "ouidb",
+			usage:       "ouidb [flags] compact|verify",
+			description: "reclaim free space in the OUI database, or check that its prefixes are valid",
+			setup:       setupOuiDBCommand,
+		},
+		{
+			name:        "serve",
+			usage:       "serve [flags]",
+			description: "serve the JSON API, web UI, and Prometheus metrics over HTTP",
+			setup:       setupServeCommand,
+		},
+		{
+			name:        "serve-metrics",
+			usage:       "serve-metrics [flags]",
+			description: "serve only Prometheus metrics over HTTP",
+			setup:       setupServeMetricsCommand,
+		},
+		{
+			name:        "lookup",
+			usage:       "lookup [flags] ip|mac <address>",
+			description: "print leases for one IP or MAC address",
+			setup:       setupLookupCommand,
+		},
+		{
+			name:        "history",
+			usage:       "history [flags] [ip-or-mac]\n       history query [flags] <ip-or-mac>",
+			description: "print every lease record as a timeline per IP or MAC, or query recorded snapshots",
+			setup:       setupHistoryCommand,
+		},
+		{
+			name:          "devices",
+			usage:         "devices [flags]",
+			description:   "print every MAC ever seen with first and last seen times",
+			setup:         setupDevicesCommand,
+			outputFormats: outputFormats,
+		},
+		{
+			name:        "record",
+			usage:       "record [flags]",
+			description: "record a snapshot of the leases for history query",
+			setup:       setupRecordCommand,
+		},
+		{
+			name:          "stats",
+			usage:         "stats [flags]",
+			description:   "print lease counts by state, subnet, and vendor, lease durations, and recent renewals",
+			setup:         setupStatsCommand,
+			outputFormats: statsOutputFormats,
+		},
+		{
+			name:          "top",
+			usage:         "top [flags]",
+			description:   "rank the most re-leased IPs, the MACs with the most IPs, and the MACs with the most lease records per day",
+			setup:         setupTopCommand,
+			outputFormats: topOutputFormats,
+		},
+		{
+			name:          "histogram",
+			usage:         "histogram [flags]",
+			description:   "print histograms of lease durations and of the time left on current leases",
+			setup:         setupHistogramCommand,
+			outputFormats: histogramOutputFormats,
+		},
+		{
+			name:          "vendors",
+			usage:         "vendors [flags]",
+			description:   "count active devices by OUI organization",
+			setup:         setupVendorsCommand,
+			outputFormats: outputFormats,
+		},
+		{
+			name:        "free",
+			usage:       "free [flags]",
+			description: "list unleased addresses in the dhcpd.conf ranges",
+			setup:       setupFreeCommand,
+		},
+		{
+			name:          "rogue",
+			usage:         "rogue [flags] [cidr...]",
+			description:   "scan subnets for devices responding without a current lease or reservation",
+			setup:         setupRogueCommand,
+			outputFormats: outputFormats,
+		},
+		{
+			name:          "diff",
+			usage:         "diff [flags] <old> <new>",
+			description:   "compare two leases files, or recorded snapshots given as @time",
+			setup:         setupDiffCommand,
+			outputFormats: diffOutputFormats,
+		},
+		{
+			name:          "lint",
+			usage:         "lint [flags] [file...]",
+			description:   "check leases files for unparsable leases, unknown statements, and overlapping active leases",
+			setup:         setupLintCommand,
+			outputFormats: lintOutputFormats,
+		},
+		{
+			name:        "prune",
+			usage:       "prune [flags] <output-file>",
+			description: "write a compacted copy of a dhcpd leases file with only the last record for each address",
+			setup:       setupPruneCommand,
+		},
+		{
+			name:        "convert",
+			usage:       "convert [flags] -from isc|kea-csv -to isc|kea-csv <input> <output>",
+			description: "convert a leases file between ISC dhcpd and Kea memfile formats",
+			setup:       setupConvertCommand,
+		},
+		{
+			name:        "export",
+			usage:       "export [flags] sqlite <file>",
+			description: "write leases, device history, and OUI data to a SQLite database",
+			setup:       setupExportCommand,
+		},
+		{
+			name:        "zabbix",
+			usage:       "zabbix [flags] discovery|values [subnet]",
+			description: "print dhcpd.conf pools as Zabbix low-level discovery JSON, or their metrics",
+			setup:       setupZabbixCommand,
+		},
+		{
+			name:        "watch",
+			usage:       "watch [flags]",
+			description: "re-print the report whenever the leases file changes",
+			setup:       setupWatchCommand,
+		},
+		{
+			name:        "completion",
+			usage:       "completion bash|zsh|fish",
+			description: "print a shell completion script",
+			setup:       setupCompletionCommand,
+		},
+	}
+}
+
+// errUsage is returned by commands when arguments are invalid and usage has
+// already been printed.
+var errUsage = errors.New("invalid usage")
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %v <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, command := range commands {
+		fmt.Fprintf(os.Stderr, "  %-15v %v\n", command.name, command.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%v <command> -h' for command flags.\n", os.Args[0])
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// runCommand dispatches args to a command. If args is empty or starts with a
+// flag the list command is run.
+func runCommand(ctx context.Context, args []string) error {
+	commandName := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		commandName = args[0]
+		args = args[1:]
+	}
+
+	if commandName == "help" {
+		printUsage()
+		return nil
+	}
+
+	command := findCommand(commandName)
+	if command == nil {
+		fmt.Fprintf(os.Stderr, "unknown command '%v'\n\n", commandName)
+		printUsage()
+		return fmt.Errorf("unknown command '%v': %w", commandName, errUsage)
+	}
+
+	return runCommandArgs(ctx, command, args)
+}
+
+// runCommandArgs parses args with the flags of command and runs it.
+func runCommandArgs(ctx context.Context, command *command, args []string) error {
+	flagSet := newFlagSet(command)
+	run := command.setup(flagSet)
+
+	if err := parseFlags(flagSet, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	slog.Debug("starting", "command", command.name, "gitCommit", gitCommit)
+
+	return run(ctx, flagSet)
+}
+
+func newFlagSet(command *command) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(command.name, flag.ContinueOnError)
+	flagSet.String("config", envOrDefault(flagEnvVars["config"], defaultConfigFile), "YAML config file providing flag defaults (env DHCP_LEASES_CONFIG)")
+	flagSet.Var(logLevelFlag{}, "log-level", "minimum `level` of diagnostics logged to stderr: debug, info, warn, or error (env DHCP_LEASES_LOG_LEVEL)")
+	flagSet.Bool("quiet", false, "log only errors, leaving just the report; same as -log-level error")
+	flagSet.Bool("verbose", false, "log debug details such as each parsed lease, skipped leases file lines, and OUI cache statistics; same as -log-level debug")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %v %v\n\n%v\n\nFlags:\n", os.Args[0], command.usage, command.description)
+		flagSet.PrintDefaults()
+	}
+	return flagSet
+}
+
+func parseFlags(flagSet *flag.FlagSet, args []string) error {
+	if err := flagSet.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+
+	configPath := flagSet.Lookup("config")
+	explicitConfig := configPath.Value.String() != configPath.DefValue
+	if _, ok := os.LookupEnv(flagEnvVars["config"]); ok {
+		explicitConfig = true
+	}
+	config, err := loadConfigFile(configPath.Value.String(), explicitConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := applyConfig(flagSet, config); err != nil {
+		return err
+	}
+
+	return applyVerbosityFlags(flagSet)
+}
+
+// applyVerbosityFlags sets the log level from -quiet or -verbose.
+func applyVerbosityFlags(flagSet *flag.FlagSet) error {
+	quiet := flagSet.Lookup("quiet").Value.String() == "true"
+	verbose := flagSet.Lookup("verbose").Value.String() == "true"
+	switch {
+	case quiet && verbose:
+		return errors.New("-quiet and -verbose cannot be used together")
+	case quiet:
+		logLevel.Set(slog.LevelError)
+	case verbose:
+		logLevel.Set(slog.LevelDebug)
+	}
+	return nil
+}
+
+func setupListCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	registerOutputFlags(flagSet, &opts)
+	finishFilters := registerFilterFlags(flagSet, &opts)
+	registerCheckFlags(flagSet, &opts)
+	registerInfluxFlags(flagSet, &opts)
+	registerMDNSFlags(flagSet, &opts)
+	registerNeighborFlags(flagSet, &opts)
+	registerProbeFlags(flagSet, &opts)
+	groupBy := flagSet.String("group-by", "ip", "report one row per ip, or per mac with current and previous IPs")
+	flagSet.Lookup("output").Usage += "; -group-by mac supports only " + strings.Join(deviceOutputFormats, ", ")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if err := finishFilters(); err != nil {
+			return err
+		}
+
+		var printReport func(context.Context, *options) error
+		var formats []string
+		switch *groupBy {
+		case "ip":
+			printReport, formats = printLeases, leaseOutputFormats
+		case "mac":
+			printReport, formats = printDevices, deviceOutputFormats
+		default:
+			return fmt.Errorf("unknown grouping '%v'", *groupBy)
+		}
+		if !slices.Contains(formats, opts.outputFormat) {
+			return fmt.Errorf("-group-by %v does not support -output %v, expected one of %v", *groupBy, opts.outputFormat, strings.Join(formats, ", "))
+		}
+		return printReport(ctx, &opts)
+	}
+}
+
+func setupCreateDBCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	flagSet.StringVar(&opts.ouiFile, "oui-file", envOrDefault(flagEnvVars["oui-file"], defaultOuiFile), "IEEE oui.txt, MA-M, or MA-S file, IEEE oui.csv, mam.csv, or oui36.csv file, or Wireshark manuf file; run createdb once per file to combine them; each run adds to the prefixes already imported, and a combined database is not rebuilt by -oui-auto-rebuild (env OUI_FILE)")
+	flagSet.StringVar(&opts.ouiDBFile, "oui-db", envOrDefault(flagEnvVars["oui-db"], defaultOuiDBFile), "OUI database file (env OUI_DB_FILE)")
+	flagSet.BoolVar(&opts.ouiDownload, "download", false, "download the OUI registry from -oui-url instead of reading -oui-file, skipping the import if it is unchanged since the last download")
+	flagSet.StringVar(&opts.ouiURL, "oui-url", defaultOuiURL, "URL of the OUI registry downloaded by -download")
+	flagSet.DurationVar(&opts.ouiDownloadTimeout, "download-timeout", defaultOuiDownloadTimeout, "timeout of the -download request")
+	flagSet.StringVar(&opts.ouiSHA256, "oui-sha256", "", "expected SHA-256 checksum in hex of the file downloaded by -download")
+	flagSet.BoolVar(&opts.ouiInfo, "info", false, "print the build time, source, and number of prefixes of -oui-db instead of importing")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		return createOuiDB(ctx, &opts)
+	}
+}
+
+func setupDaemonCommand(flagSet *flag.FlagSet, daemonOpts daemonOptions) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	finishFilters := registerFilterFlags(flagSet, &opts)
+	flagSet.StringVar(&daemonOpts.addr, "addr", daemonOpts.addr, "listen address")
+	flagSet.DurationVar(&daemonOpts.refreshInterval, "refresh-interval", defaultRefreshInterval, "leases file refresh interval; under systemd Type=notify the watchdog is pinged after each successful refresh, so keep it below WatchdogSec=")
+	registerTLSFlags(flagSet, &daemonOpts.tls)
+	if daemonOpts.enableAPI {
+		registerAuthFlags(flagSet, &daemonOpts.auth)
+	}
+	flagSet.BoolVar(&daemonOpts.otlp, "otlp", false, "push metrics after each refresh to an OpenTelemetry collector using OTLP/HTTP JSON, configured by OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS, OTEL_SERVICE_NAME, and the other standard OTEL_* variables")
+	registerEventFlags(flagSet, &opts)
+	registerMDNSFlags(flagSet, &opts)
+	registerNeighborFlags(flagSet, &opts)
+	registerProbeFlags(flagSet, &opts)
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if daemonOpts.refreshInterval <= 0 {
+			fmt.Fprintf(flagSet.Output(), "-refresh-interval must be positive, got %v\n\n", daemonOpts.refreshInterval)
+			flagSet.Usage()
+			return errUsage
+		}
+		if err := finishFilters(); err != nil {
+			return err
+		}
+		if err := daemonOpts.auth.validate(); err != nil {
+			return err
+		}
+		if err := daemonOpts.tls.validate(); err != nil {
+			return err
+		}
+
+		return runDaemon(ctx, &opts, daemonOpts)
+	}
+}
+
+func setupServeCommand(flagSet *flag.FlagSet) commandFunc {
+	return setupDaemonCommand(flagSet, daemonOptions{
+		addr:          defaultServerAddr,
+		enableAPI:     true,
+		enableMetrics: true,
+	})
+}
+
+func setupServeMetricsCommand(flagSet *flag.FlagSet) commandFunc {
+	return setupDaemonCommand(flagSet, daemonOptions{
+		addr:          defaultMetricsAddr,
+		enableMetrics: true,
+	})
+}
+
+// errNotFound is returned by lookups that match no leases.
+var errNotFound = errors.New("no matching lease found")
+
+func setupLookupCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	registerOutputFlags(flagSet, &opts)
+	registerMDNSFlags(flagSet, &opts)
+	registerNeighborFlags(flagSet, &opts)
+	registerProbeFlags(flagSet, &opts)
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if flagSet.NArg() != 2 {
+			flagSet.Usage()
+			return errUsage
+		}
+
+		switch kind, address := flagSet.Arg(0), flagSet.Arg(1); kind {
+		case "ip":
+			ipAddress := net.ParseIP(address)
+			if ipAddress == nil {
+				return fmt.Errorf("invalid IP address '%v'", address)
+			}
+			return lookupIP(ctx, &opts, ipAddress)
+		case "mac":
+			macAddress, err := net.ParseMAC(address)
+			if err != nil {
+				return fmt.Errorf("invalid MAC address '%v'", address)
+			}
+			return lookupMAC(ctx, &opts, macAddress)
+		default:
+			flagSet.Usage()
+			return errUsage
+		}
+	}
+}
+
+// lookupMAC prints every IP address macAddress has held, using the most
+// recent lease record for each address from that MAC.
+func lookupMAC(ctx context.Context, opts *options, macAddress net.HardwareAddr) error {
+	leaseMap := make(leases.LeaseMap)
+
+	if err := parseLeases(ctx, opts, func(lease leases.Lease) error {
+		if bytes.Equal(lease.MACAddress, macAddress) {
+			leaseMap.Add(&lease)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	report, err := buildLeaseReport(ctx, opts, leaseMap, nil)
+	if err != nil {
+		return err
+	}
+
+	if len(report.rows) == 0 {
+		return fmt.Errorf("%w for MAC %v", errNotFound, macAddress)
+	}
+
+	return outputLeaseReport(report, opts.outputFormat, opts.outputFile)
+}
+
+func lookupIP(ctx context.Context, opts *options, ipAddress net.IP) error {
+	opts.filters = append(opts.filters, func(row *leaseReportRow) bool {
+		return row.lease.IPAddress.Equal(ipAddress)
+	})
+
+	report, err := readLeaseReport(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(report.rows) == 0 {
+		return fmt.Errorf("%w for IP %v", errNotFound, ipAddress)
+	}
+
+	if opts.outputFormat == defaultOutputFormat && report.formatTemplate == nil {
+		printLeaseDetails(&report.rows[0])
+		return nil
+	}
+
+	return outputLeaseReport(report, opts.outputFormat, opts.outputFile)
+}
+
+func setupHistoryCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	registerOutputFlags(flagSet, &opts)
+	finishFilters := registerFilterFlags(flagSet, &opts)
+	groupBy := flagSet.String("by", "ip", "group the timeline by ip or mac")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if flagSet.Arg(0) == "query" {
+			return runCommandArgs(ctx, &historyQueryCommand, flagSet.Args()[1:])
+		}
+
+		if flagSet.NArg() > 1 {
+			flagSet.Usage()
+			return errUsage
+		}
+
+		if err := finishFilters(); err != nil {
+			return err
+		}
+
+		return runHistory(ctx, &opts, *groupBy, flagSet.Arg(0))
+	}
+}
+
+func setupStatsCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	finishFilters := registerFilterFlags(flagSet, &opts)
+	registerCheckFlags(flagSet, &opts)
+	flagSet.StringVar(&opts.outputFormat, "output", defaultOutputFormat, "output format: "+strings.Join(statsOutputFormats, ", "))
+	flagSet.StringVar(&opts.outputFile, "out", "", "write non-table output to this file instead of stdout")
+	registerTimeFlags(flagSet)
+	renewalHours := flagSet.Int("renewal-hours", defaultRenewalHours, "count lease renewals in each of this many hours before now")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if err := finishFilters(); err != nil {
+			return err
+		}
+		if *renewalHours < 0 {
+			return fmt.Errorf("invalid -renewal-hours %v", *renewalHours)
+		}
+
+		report, err := readLeaseReport(ctx, &opts)
+		if err != nil {
+			return err
+		}
+
+		stats := computeLeaseStats(report, *renewalHours, time.Now())
+		if err := outputLeaseStats(report, stats, opts.outputFormat, opts.outputFile); err != nil {
+			return err
+		}
+
+		return checkReport(report, &opts)
+	}
+}
+
+func setupFreeCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	registerOutputFlags(flagSet, &opts)
+	excludeExpiredWithin := flagSet.Duration("exclude-expired-within", 0, "also treat addresses whose lease ended within this duration as in use, e.g. 24h")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		return runFree(ctx, &opts, *excludeExpiredWithin)
+	}
+}
+
+func setupWatchCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	registerOutputFlags(flagSet, &opts)
+	finishFilters := registerFilterFlags(flagSet, &opts)
+	registerCheckFlags(flagSet, &opts)
+	registerInfluxFlags(flagSet, &opts)
+	registerEventFlags(flagSet, &opts)
+	registerMDNSFlags(flagSet, &opts)
+	registerNeighborFlags(flagSet, &opts)
+	registerProbeFlags(flagSet, &opts)
+	flagSet.BoolVar(&opts.mergeBackup, "merge-backup", false, "also read the leases~ backup of each leases file, which dhcpd keeps when it periodically rewrites the file, so lease history from before the rewrite is kept; record counts include the records of both files")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if err := finishFilters(); err != nil {
+			return err
+		}
+
+		return watchLeasesFile(ctx, &opts)
+	}
+}
+
+func setupCompletionCommand(flagSet *flag.FlagSet) commandFunc {
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if flagSet.NArg() != 1 {
+			flagSet.Usage()
+			return errUsage
+		}
+
+		return writeCompletionScript(os.Stdout, flagSet.Arg(0))
+	}
+}
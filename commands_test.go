@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestListGroupByMACOutputFormats(t *testing.T) {
+	for _, format := range []string{"influx", "prom-textfile", "xlsx", "jsonl"} {
+		// The format is rejected before the missing leases file is read.
+		err := runCommandArgs(context.Background(), findCommand("list"), []string{
+			"-leases-file", "/nonexistent/dhcpd.leases", "-group-by", "mac", "-output", format,
+		})
+		if err == nil || !strings.Contains(err.Error(), "does not support -output "+format) {
+			t.Errorf("-output %v error = %v, want unsupported format", format, err)
+		}
+	}
+}
+
+func TestServeRefreshIntervalNotPositive(t *testing.T) {
+	for _, interval := range []string{"0", "-1s"} {
+		err := runCommandArgs(context.Background(), findCommand("serve"), []string{"-refresh-interval", interval})
+		if !errors.Is(err, errUsage) {
+			t.Errorf("-refresh-interval %v error = %v, want %v", interval, err, errUsage)
+		}
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	if err := runCommand(context.Background(), []string{"bogus"}); !errors.Is(err, errUsage) {
+		t.Errorf("runCommand error = %v, want %v", err, errUsage)
+	}
+}
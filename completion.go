@@ -0,0 +1,339 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const completionProgramName = "go-dhcp-leases"
+
+// commandArgCompletions lists positional argument keywords for commands.
+var commandArgCompletions = map[string][]string{
+	"history":    {"query"},
+	"lookup":     {"ip", "mac"},
+	"ouidb":      {"compact", "verify"},
+	"zabbix":     {"discovery", "values"},
+	"export":     {"sqlite"},
+	"completion": {"bash", "zsh", "fish"},
+}
+
+type completionFlag struct {
+	name        string
+	usage       string
+	isBool      bool
+	isFile      bool
+	valueChoice []string
+}
+
+type completionCommand struct {
+	name        string
+	description string
+	flags       []completionFlag
+	args        []string
+}
+
+// fileFlags lists flags whose values are file paths.
+var fileFlags = map[string]bool{
+	"config":        true,
+	"dhcpd-conf":    true,
+	"known-devices": true,
+	"leases-file":   true,
+	"oui-file":      true,
+	"oui-db":        true,
+	"out":           true,
+}
+
+// flagValueCompletions returns keyword values for flags that accept them.
+// The -output values are those of the lease listing commands; commands with
+// other formats set outputFormats in the command table.
+func flagValueCompletions() map[string][]string {
+	stateNames := make([]string, 0, len(leases.LeaseStates))
+	for _, state := range leases.LeaseStates {
+		stateNames = append(stateNames, strings.ToLower(state.String()))
+	}
+
+	return map[string][]string{
+		"by":       {"ip", "mac"},
+		"color":    colorModes,
+		"filter":   stateNames,
+		"from":     convertFormatNames,
+		"group-by": {"ip", "mac"},
+		"output":   leaseOutputFormats,
+		"times":    timesModes,
+		"to":       convertFormatNames,
+	}
+}
+
+func completionCommands() []completionCommand {
+	valueCompletions := flagValueCompletions()
+
+	completionCommands := make([]completionCommand, 0, len(commands))
+	for i := range commands {
+		command := &commands[i]
+
+		flagSet := newFlagSet(command)
+		command.setup(flagSet)
+
+		completionCommand := completionCommand{
+			name:        command.name,
+			description: command.description,
+			args:        commandArgCompletions[command.name],
+		}
+
+		flagSet.VisitAll(func(f *flag.Flag) {
+			boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+			valueChoice := valueCompletions[f.Name]
+			if f.Name == "output" && command.outputFormats != nil {
+				valueChoice = command.outputFormats
+			}
+			completionCommand.flags = append(completionCommand.flags, completionFlag{
+				name:        f.Name,
+				usage:       f.Usage,
+				isBool:      ok && boolFlag.IsBoolFlag(),
+				isFile:      fileFlags[f.Name],
+				valueChoice: valueChoice,
+			})
+		})
+
+		completionCommands = append(completionCommands, completionCommand)
+	}
+
+	return completionCommands
+}
+
+func writeCompletionScript(w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		return writeBashCompletion(w, completionCommands())
+	case "zsh":
+		return writeZshCompletion(w, completionCommands())
+	case "fish":
+		return writeFishCompletion(w, completionCommands())
+	}
+	return fmt.Errorf("unsupported shell '%v'", shell)
+}
+
+// sameValueChoices returns the values of a flag if every command accepts the
+// same ones.
+func sameValueChoices(commandChoices map[string][]string) ([]string, bool) {
+	var choices []string
+	for _, c := range commandChoices {
+		if choices != nil && !slices.Equal(choices, c) {
+			return nil, false
+		}
+		choices = c
+	}
+	return choices, true
+}
+
+func writeBashCompletion(w io.Writer, completionCommands []completionCommand) error {
+	var builder strings.Builder
+
+	commandNames := make([]string, 0, len(completionCommands))
+	for _, command := range completionCommands {
+		commandNames = append(commandNames, command.name)
+	}
+
+	// valueFlags maps each flag with keyword values to its values by command,
+	// since a flag such as -output accepts different values per command.
+	valueFlags := make(map[string]map[string][]string)
+	var fileFlagNames []string
+	for _, command := range completionCommands {
+		for _, f := range command.flags {
+			if len(f.valueChoice) > 0 {
+				if valueFlags[f.name] == nil {
+					valueFlags[f.name] = make(map[string][]string)
+				}
+				valueFlags[f.name][command.name] = f.valueChoice
+			} else if f.isFile {
+				fileFlagNames = append(fileFlagNames, "-"+f.name)
+			}
+		}
+	}
+	fileFlagNames = uniqueSortedStrings(fileFlagNames)
+
+	valueFlagNames := make([]string, 0, len(valueFlags))
+	for name := range valueFlags {
+		valueFlagNames = append(valueFlagNames, name)
+	}
+	sort.Strings(valueFlagNames)
+
+	fmt.Fprintf(&builder, "# bash completion for %v\n", completionProgramName)
+	fmt.Fprintf(&builder, "_go_dhcp_leases() {\n")
+	fmt.Fprintf(&builder, "    local cur prev command\n")
+	fmt.Fprintf(&builder, "    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(&builder, "    prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	fmt.Fprintf(&builder, "    command=list\n")
+	fmt.Fprintf(&builder, "    if [[ ${COMP_CWORD} -gt 1 && ${COMP_WORDS[1]} != -* ]]; then\n")
+	fmt.Fprintf(&builder, "        command=\"${COMP_WORDS[1]}\"\n")
+	fmt.Fprintf(&builder, "    fi\n\n")
+	fmt.Fprintf(&builder, "    case \"${prev}\" in\n")
+	for _, name := range valueFlagNames {
+		fmt.Fprintf(&builder, "    -%v)\n", name)
+		if choices, ok := sameValueChoices(valueFlags[name]); ok {
+			fmt.Fprintf(&builder, "        COMPREPLY=($(compgen -W \"%v\" -- \"${cur}\"))\n", strings.Join(choices, " "))
+		} else {
+			fmt.Fprintf(&builder, "        case \"${command}\" in\n")
+			for _, command := range completionCommands {
+				if choices, ok := valueFlags[name][command.name]; ok {
+					fmt.Fprintf(&builder, "        %v)\n", command.name)
+					fmt.Fprintf(&builder, "            COMPREPLY=($(compgen -W \"%v\" -- \"${cur}\"))\n", strings.Join(choices, " "))
+					fmt.Fprintf(&builder, "            ;;\n")
+				}
+			}
+			fmt.Fprintf(&builder, "        esac\n")
+		}
+		fmt.Fprintf(&builder, "        return\n")
+		fmt.Fprintf(&builder, "        ;;\n")
+	}
+	if len(fileFlagNames) > 0 {
+		fmt.Fprintf(&builder, "    %v)\n", strings.Join(fileFlagNames, "|"))
+		fmt.Fprintf(&builder, "        COMPREPLY=($(compgen -f -- \"${cur}\"))\n")
+		fmt.Fprintf(&builder, "        return\n")
+		fmt.Fprintf(&builder, "        ;;\n")
+	}
+	fmt.Fprintf(&builder, "    esac\n\n")
+	fmt.Fprintf(&builder, "    if [[ ${COMP_CWORD} -eq 1 && ${cur} != -* ]]; then\n")
+	fmt.Fprintf(&builder, "        COMPREPLY=($(compgen -W \"%v\" -- \"${cur}\"))\n", strings.Join(commandNames, " "))
+	fmt.Fprintf(&builder, "        return\n")
+	fmt.Fprintf(&builder, "    fi\n\n")
+	fmt.Fprintf(&builder, "    case \"${command}\" in\n")
+	for _, command := range completionCommands {
+		words := make([]string, 0, len(command.flags)+len(command.args))
+		for _, f := range command.flags {
+			words = append(words, "-"+f.name)
+		}
+		words = append(words, command.args...)
+
+		fmt.Fprintf(&builder, "    %v)\n", command.name)
+		fmt.Fprintf(&builder, "        COMPREPLY=($(compgen -W \"%v\" -- \"${cur}\"))\n", strings.Join(words, " "))
+		fmt.Fprintf(&builder, "        ;;\n")
+	}
+	fmt.Fprintf(&builder, "    esac\n")
+	fmt.Fprintf(&builder, "}\n\n")
+	fmt.Fprintf(&builder, "complete -F _go_dhcp_leases %v\n", completionProgramName)
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+func escapeZshDescription(description string) string {
+	return strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`, `:`, `\:`).Replace(description)
+}
+
+func writeZshCompletion(w io.Writer, completionCommands []completionCommand) error {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "#compdef %v\n\n", completionProgramName)
+	fmt.Fprintf(&builder, "_go_dhcp_leases() {\n")
+	fmt.Fprintf(&builder, "    local -a commands\n")
+	fmt.Fprintf(&builder, "    commands=(\n")
+	for _, command := range completionCommands {
+		fmt.Fprintf(&builder, "        '%v:%v'\n", command.name, escapeZshDescription(command.description))
+	}
+	fmt.Fprintf(&builder, "    )\n\n")
+	fmt.Fprintf(&builder, "    local command=list\n")
+	fmt.Fprintf(&builder, "    if (( CURRENT == 2 )) && [[ ${words[2]} != -* ]]; then\n")
+	fmt.Fprintf(&builder, "        _describe 'command' commands\n")
+	fmt.Fprintf(&builder, "        return\n")
+	fmt.Fprintf(&builder, "    fi\n")
+	fmt.Fprintf(&builder, "    if [[ ${words[2]} != -* ]]; then\n")
+	fmt.Fprintf(&builder, "        command=${words[2]}\n")
+	fmt.Fprintf(&builder, "        shift words\n")
+	fmt.Fprintf(&builder, "        (( CURRENT-- ))\n")
+	fmt.Fprintf(&builder, "    fi\n\n")
+	fmt.Fprintf(&builder, "    case ${command} in\n")
+	for _, command := range completionCommands {
+		fmt.Fprintf(&builder, "    %v)\n", command.name)
+		fmt.Fprintf(&builder, "        _arguments")
+		for _, f := range command.flags {
+			spec := fmt.Sprintf("-%v[%v]", f.name, escapeZshDescription(f.usage))
+			switch {
+			case f.isBool:
+			case len(f.valueChoice) > 0:
+				spec += fmt.Sprintf(":%v:(%v)", f.name, strings.Join(f.valueChoice, " "))
+			case f.isFile:
+				spec += fmt.Sprintf(":%v:_files", f.name)
+			default:
+				spec += fmt.Sprintf(":%v: ", f.name)
+			}
+			fmt.Fprintf(&builder, " \\\n            '%v'", spec)
+		}
+		if len(command.args) > 0 {
+			fmt.Fprintf(&builder, " \\\n            '1:argument:(%v)'", strings.Join(command.args, " "))
+		}
+		fmt.Fprintf(&builder, "\n        ;;\n")
+	}
+	fmt.Fprintf(&builder, "    esac\n")
+	fmt.Fprintf(&builder, "}\n\n")
+	fmt.Fprintf(&builder, "compdef _go_dhcp_leases %v\n", completionProgramName)
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+func escapeFishString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+func writeFishCompletion(w io.Writer, completionCommands []completionCommand) error {
+	var builder strings.Builder
+
+	commandNames := make([]string, 0, len(completionCommands))
+	for _, command := range completionCommands {
+		commandNames = append(commandNames, command.name)
+	}
+
+	fmt.Fprintf(&builder, "# fish completion for %v\n", completionProgramName)
+	fmt.Fprintf(&builder, "complete -c %v -f\n", completionProgramName)
+	for _, command := range completionCommands {
+		fmt.Fprintf(&builder, "complete -c %v -n '__fish_use_subcommand' -a %v -d '%v'\n",
+			completionProgramName, command.name, escapeFishString(command.description))
+	}
+
+	for _, command := range completionCommands {
+		condition := fmt.Sprintf("__fish_seen_subcommand_from %v", command.name)
+		if command.name == "list" {
+			condition = fmt.Sprintf("__fish_seen_subcommand_from list; or not __fish_seen_subcommand_from %v", strings.Join(commandNames, " "))
+		}
+
+		for _, f := range command.flags {
+			fmt.Fprintf(&builder, "complete -c %v -n '%v' -o %v", completionProgramName, condition, f.name)
+			switch {
+			case f.isBool:
+			case len(f.valueChoice) > 0:
+				fmt.Fprintf(&builder, " -x -a '%v'", strings.Join(f.valueChoice, " "))
+			case f.isFile:
+				fmt.Fprintf(&builder, " -r -F")
+			default:
+				fmt.Fprintf(&builder, " -x")
+			}
+			fmt.Fprintf(&builder, " -d '%v'\n", escapeFishString(f.usage))
+		}
+
+		if len(command.args) > 0 {
+			fmt.Fprintf(&builder, "complete -c %v -n '%v' -a '%v'\n", completionProgramName, condition, strings.Join(command.args, " "))
+		}
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+func uniqueSortedStrings(values []string) []string {
+	sort.Strings(values)
+
+	uniqueValues := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			uniqueValues = append(uniqueValues, value)
+		}
+	}
+	return uniqueValues
+}
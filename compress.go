@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// decompressingReader returns a reader of the decompressed contents of r if
+// r starts with a gzip or xz header, and of r unchanged otherwise.
+func decompressingReader(r io.Reader) (io.Reader, error) {
+	reader := bufio.NewReader(r)
+	header, _ := reader.Peek(len(xzMagic))
+
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("gzip.NewReader error: %w", err)
+		}
+		return gzipReader, nil
+	case bytes.HasPrefix(header, xzMagic):
+		xzReader, err := xz.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("xz.NewReader error: %w", err)
+		}
+		return xzReader, nil
+	}
+	return reader, nil
+}
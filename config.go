@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigFile = "/etc/go-dhcp-leases/config.yaml"
+
+// flagEnvVars maps flag names to the environment variables that override
+// their defaults.
+var flagEnvVars = map[string]string{
+	"config":        "DHCP_LEASES_CONFIG",
+	"log-level":     "DHCP_LEASES_LOG_LEVEL",
+	"leases-file":   "DHCP_LEASES_FILE",
+	"leases-token":  "DHCP_LEASES_TOKEN",
+	"anonymize-key": "DHCP_LEASES_ANONYMIZE_KEY",
+	"auth-token":    "DHCP_LEASES_AUTH_TOKEN",
+	"auth-password": "DHCP_LEASES_AUTH_PASSWORD",
+	"kea-dsn":       "KEA_DSN",
+	"dhcpd-conf":    "DHCPD_CONF",
+	"oui-file":      "OUI_FILE",
+	"oui-db":        "OUI_DB_FILE",
+}
+
+// configFile holds flag values keyed by flag name. Top-level scalar or list
+// values apply to every command that has a flag of that name; a top-level
+// mapping named after a command applies only to that command, e.g.
+//
+//	leases-file: /var/lib/dhcp/dhcpd.leases
+//	oui-db: /var/lib/go-dhcp-leases/oui.db
+//	filter: current,future
+//	serve:
+//	  addr: ":8080"
+//	  refresh-interval: 30s
+type configFile map[string]interface{}
+
+func loadConfigFile(path string, explicit bool) (configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading config file %v: %w", path, err)
+	}
+
+	// Unmarshal into a plain map so nested mappings decode as
+	// map[string]interface{} rather than configFile.
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing config file %v: %w", path, err)
+	}
+
+	return configFile(config), nil
+}
+
+// configFlagValues returns the values for one flag, converting scalars and
+// lists to the strings accepted by flag.Value.Set.
+func configFlagValues(value interface{}) ([]string, bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return nil, false
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, element := range value {
+			values = append(values, fmt.Sprint(element))
+		}
+		return values, true
+	default:
+		return []string{fmt.Sprint(value)}, true
+	}
+}
+
+// applyConfig sets every flag in flagSet that was not given on the command
+// line and not overridden by its environment variable from config. Values in
+// the section of the command replace top level ones rather than adding to
+// them, which matters for list flags.
+func applyConfig(flagSet *flag.FlagSet, config configFile) error {
+	setFlags := make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	values := maps.Clone(map[string]interface{}(config))
+	if commandConfig, ok := config[flagSet.Name()].(map[string]interface{}); ok {
+		maps.Copy(values, commandConfig)
+	}
+
+	for name, value := range values {
+		if flagSet.Lookup(name) == nil || setFlags[name] {
+			continue
+		}
+		if envVar, ok := flagEnvVars[name]; ok {
+			if _, ok := os.LookupEnv(envVar); ok {
+				continue
+			}
+		}
+
+		flagValues, ok := configFlagValues(value)
+		if !ok {
+			continue
+		}
+		for _, flagValue := range flagValues {
+			if err := flagSet.Set(name, flagValue); err != nil {
+				return fmt.Errorf("invalid config value for %v: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
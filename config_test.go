@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(`
+filter: current
+cidr: [10.0.0.0/24, 10.1.0.0/24]
+addr: ":9000"
+serve:
+  addr: ":8080"
+  cidr: 192.168.0.0/16
+list:
+  addr: ":7000"
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfigFile(path, true)
+	if err != nil {
+		t.Fatalf("loadConfigFile error: %v", err)
+	}
+
+	flagSet := flag.NewFlagSet("serve", flag.ContinueOnError)
+	filter := flagSet.String("filter", "", "")
+	addr := flagSet.String("addr", "", "")
+	var cidrs stringListFlag
+	flagSet.Var(&cidrs, "cidr", "")
+	if err := flagSet.Parse([]string{"-filter", "past"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyConfig(flagSet, config); err != nil {
+		t.Fatalf("applyConfig error: %v", err)
+	}
+	// Command line flags win, and the serve section replaces top level
+	// values, including lists.
+	if *filter != "past" || *addr != ":8080" || cidrs.String() != "192.168.0.0/16" {
+		t.Errorf("got filter %q addr %q cidr %q, want past, :8080, 192.168.0.0/16", *filter, *addr, cidrs.String())
+	}
+}
+
+func TestLoadConfigFileMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.yaml")
+	if config, err := loadConfigFile(path, false); config != nil || err != nil {
+		t.Errorf("loadConfigFile of a missing default = %v, %v, want nil, nil", config, err)
+	}
+	if _, err := loadConfigFile(path, true); err == nil {
+		t.Error("loadConfigFile of a missing explicit file succeeded, want an error")
+	}
+}
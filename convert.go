@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// convertFormatNames are the -from and -to formats of convert.
+var convertFormatNames = []string{"isc", "kea-csv"}
+
+var convertFormats = map[string]leases.FileFormat{
+	"isc":     leases.DhcpdFormat,
+	"kea-csv": leases.KeaFormat,
+}
+
+// selectFamily returns the leases of leaseList in address family 4 or 6,
+// and whether they are DHCPv6 leases. With family 0 the family of the leases
+// is used, which must be the same for all of them, since dhcpd and Kea keep
+// DHCPv4 and DHCPv6 leases in separate files.
+func selectFamily(leaseList []*leases.Lease, family int) ([]*leases.Lease, bool, error) {
+	var ipv4Leases, ipv6Leases []*leases.Lease
+	for _, lease := range leaseList {
+		if lease.IPAddress.To4() != nil {
+			ipv4Leases = append(ipv4Leases, lease)
+		} else {
+			ipv6Leases = append(ipv6Leases, lease)
+		}
+	}
+
+	switch family {
+	case 4:
+		return ipv4Leases, false, nil
+	case 6:
+		return ipv6Leases, true, nil
+	case 0:
+		if len(ipv4Leases) > 0 && len(ipv6Leases) > 0 {
+			return nil, false, fmt.Errorf("found %v DHCPv4 and %v DHCPv6 leases; choose one with -family 4 or -family 6", len(ipv4Leases), len(ipv6Leases))
+		}
+		return leaseList, len(ipv6Leases) > 0, nil
+	}
+	return nil, false, fmt.Errorf("invalid -family %v, expected 4 or 6", family)
+}
+
+// withDhcpdBindingStates returns leaseList with binding states set on
+// leases that have none, such as Kea leases in the default state, which
+// dhcpd needs to tell active leases from free ones.
+func withDhcpdBindingStates(leaseList []*leases.Lease, now time.Time) []*leases.Lease {
+	converted := make([]*leases.Lease, 0, len(leaseList))
+	for _, lease := range leaseList {
+		if lease.BindingState == "" {
+			withState := *lease
+			withState.BindingState = "free"
+			if lease.EndsNever || lease.EndTime.After(now) {
+				withState.BindingState = "active"
+			}
+			lease = &withState
+		}
+		converted = append(converted, lease)
+	}
+	return converted
+}
+
+// convertOptions holds the flags of convert.
+type convertOptions struct {
+	from     string
+	to       string
+	family   int
+	subnetID uint
+	strict   bool
+}
+
+// runConvert converts the leases file inputPath to outputPath, keeping the
+// last record for each address. outputPath is replaced atomically and may
+// not be inputPath.
+func runConvert(ctx context.Context, convertOpts *convertOptions, inputPath string, outputPath string) error {
+	fromFormat, ok := convertFormats[convertOpts.from]
+	if !ok {
+		return fmt.Errorf("invalid -from '%v', expected one of %v", convertOpts.from, strings.Join(convertFormatNames, ", "))
+	}
+	toFormat, ok := convertFormats[convertOpts.to]
+	if !ok {
+		return fmt.Errorf("invalid -to '%v', expected one of %v", convertOpts.to, strings.Join(convertFormatNames, ", "))
+	}
+
+	if sameFile(inputPath, outputPath) {
+		return fmt.Errorf("refusing to overwrite the leases file %v", inputPath)
+	}
+
+	pruned, err := readPrunedLeases(ctx, inputPath, fromFormat, convertOpts.strict)
+	if err != nil {
+		return err
+	}
+
+	leaseList, ipv6, err := selectFamily(pruned.leaseList, convertOpts.family)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomically(outputPath, func(w io.Writer) error {
+		if toFormat == leases.KeaFormat {
+			return leases.WriteKeaLeases(w, leaseList, uint32(convertOpts.subnetID), ipv6)
+		}
+		return writeDhcpdLeasesFile(w, pruned.headerLines, withDhcpdBindingStates(leaseList, time.Now()))
+	}); err != nil {
+		return fmt.Errorf("error writing %v: %w", outputPath, err)
+	}
+
+	slog.Info("wrote converted leases file", "path", outputPath, "format", toFormat, "records", pruned.records, "leases", len(leaseList))
+	return nil
+}
+
+func setupConvertCommand(flagSet *flag.FlagSet) commandFunc {
+	var convertOpts convertOptions
+	flagSet.StringVar(&convertOpts.from, "from", "", "format of the input leases file: "+strings.Join(convertFormatNames, ", "))
+	flagSet.StringVar(&convertOpts.to, "to", "", "format of the output leases file: "+strings.Join(convertFormatNames, ", "))
+	flagSet.IntVar(&convertOpts.family, "family", 0, "convert only DHCPv4 (4) or DHCPv6 (6) leases; required when the input has both")
+	flagSet.UintVar(&convertOpts.subnetID, "subnet-id", 0, "Kea subnet ID written with every lease for -to kea-csv; set Kea's lease-checks to fix to have Kea assign the subnet matching each address instead")
+	flagSet.BoolVar(&convertOpts.strict, "strict", false, "fail instead of warning when the input has unparsable leases, which are left out of the output")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if flagSet.NArg() != 2 || convertOpts.from == "" || convertOpts.to == "" {
+			flagSet.Usage()
+			return errUsage
+		}
+
+		return runConvert(ctx, &convertOpts, flagSet.Arg(0), flagSet.Arg(1))
+	}
+}
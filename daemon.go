@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/dhcpdconf"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+type leaseSnapshot struct {
+	report        *leaseReport
+	parseDuration time.Duration
+	refreshTime   time.Time
+}
+
+// fileStamp is the modification time and size of a file, which change when
+// dhcpd appends to or rewrites a leases file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// statInputFiles returns the stamps of the leases files and dhcpd.conf of
+// opts, or false if any of them is not a local file or cannot be read, so
+// changes cannot be detected.
+func statInputFiles(opts *options) (map[string]fileStamp, bool) {
+	if opts.keaDSN != "" {
+		return nil, false
+	}
+	paths, err := opts.leasesFilePaths()
+	if err != nil {
+		return nil, false
+	}
+	if opts.dhcpdConfFile != "" {
+		paths = append(paths, opts.dhcpdConfFile)
+	}
+
+	stamps := make(map[string]fileStamp, len(paths))
+	for _, path := range paths {
+		if strings.Contains(path, "://") {
+			return nil, false
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, false
+		}
+		stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, true
+}
+
+// leaseFileCache holds the leases parsed by the last refresh, which are
+// reused while the input files are unchanged, and only the lease blocks
+// appended to local dhcpd leases files are parsed when they grow. Reports
+// are still rebuilt on every refresh, since lease states change with time.
+type leaseFileCache struct {
+	stamps        map[string]fileStamp
+	incremental   incrementalLeases
+	leaseMap      leases.LeaseMap
+	dhcpdConf     *dhcpdconf.Config
+	parseDuration time.Duration
+}
+
+// read returns the leases and dhcpd.conf of opts, parsing them only if the
+// input files changed since the last read.
+func (cache *leaseFileCache) read(ctx context.Context, opts *options) (leases.LeaseMap, *dhcpdconf.Config, error) {
+	stamps, ok := statInputFiles(opts)
+	if ok && cache.leaseMap != nil && maps.Equal(stamps, cache.stamps) {
+		slog.Debug("leases files unchanged, reusing parsed leases")
+		return cache.leaseMap, cache.dhcpdConf, nil
+	}
+
+	parseStartTime := time.Now()
+	leaseMap, dhcpdConf, err := cache.readIncremental(ctx, opts)
+	if errors.Is(err, errNotIncremental) {
+		leaseMap, dhcpdConf, err = readLeasesFile(ctx, opts)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cache.stamps = stamps
+	cache.leaseMap = leaseMap
+	cache.dhcpdConf = dhcpdConf
+	cache.parseDuration = time.Since(parseStartTime)
+	return leaseMap, dhcpdConf, nil
+}
+
+// readIncremental is like readLeasesFile, but parses only the lease blocks
+// appended since the last read, or returns errNotIncremental if the leases
+// files cannot be read that way.
+func (cache *leaseFileCache) readIncremental(ctx context.Context, opts *options) (leases.LeaseMap, *dhcpdconf.Config, error) {
+	observations := make(deviceObservations)
+	leaseMap, err := cache.incremental.read(ctx, opts, observations.observe)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recordObservedDevices(opts, observations)
+
+	dhcpdConf, err := readDhcpdConf(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dhcpdConf != nil {
+		// Static leases are added to a copy, since the parsed records are
+		// kept for the next read.
+		leaseMap = maps.Clone(leaseMap)
+		addStaticLeases(dhcpdConf, leaseMap)
+	}
+
+	return leaseMap, dhcpdConf, nil
+}
+
+func newLeaseSnapshot(ctx context.Context, opts *options, cache *leaseFileCache) (*leaseSnapshot, error) {
+	leaseMap, dhcpdConf, err := cache.read(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := buildLeaseReport(ctx, opts, leaseMap, dhcpdConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &leaseSnapshot{
+		report:        report,
+		parseDuration: cache.parseDuration,
+		refreshTime:   time.Now(),
+	}, nil
+}
+
+// leaseDaemon maintains an in-memory view of the leases file that is
+// periodically refreshed and shared by the HTTP API and metrics handlers.
+type leaseDaemon struct {
+	opts            *options
+	refreshInterval time.Duration
+	dispatcher      *eventDispatcher
+	exporter        *otlpExporter
+	// cache is only used by the refresh loop.
+	cache *leaseFileCache
+
+	mutex    sync.RWMutex
+	snapshot *leaseSnapshot
+}
+
+func newLeaseDaemon(ctx context.Context, opts *options, daemonOpts daemonOptions) (*leaseDaemon, error) {
+	dispatcher, err := newEventDispatcher(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var exporter *otlpExporter
+	if daemonOpts.otlp {
+		if exporter, err = newOTLPExporter(); err != nil {
+			dispatcher.close()
+			return nil, err
+		}
+		slog.Info("exporting OTLP metrics", "endpoint", exporter.endpoint)
+	}
+
+	cache := &leaseFileCache{}
+	snapshot, err := newLeaseSnapshot(ctx, opts, cache)
+	if err != nil {
+		dispatcher.close()
+		return nil, err
+	}
+	dispatcher.observe(ctx, snapshot.report)
+	exporter.export(ctx, snapshot)
+
+	return &leaseDaemon{
+		opts:            opts,
+		refreshInterval: daemonOpts.refreshInterval,
+		dispatcher:      dispatcher,
+		exporter:        exporter,
+		cache:           cache,
+		snapshot:        snapshot,
+	}, nil
+}
+
+func (daemon *leaseDaemon) currentSnapshot() *leaseSnapshot {
+	daemon.mutex.RLock()
+	defer daemon.mutex.RUnlock()
+
+	return daemon.snapshot
+}
+
+// refresh replaces the current snapshot, sends lease events for the changes,
+// and exports its metrics if OTLP export is enabled, keeping the previous
+// snapshot if the leases file cannot be read. The leases file is only parsed
+// again if it changed.
+func (daemon *leaseDaemon) refresh(ctx context.Context) {
+	snapshot, err := newLeaseSnapshot(ctx, daemon.opts, daemon.cache)
+	if err != nil {
+		slog.Error("refresh error", "err", err)
+		return
+	}
+	daemon.dispatcher.observe(ctx, snapshot.report)
+	daemon.exporter.export(ctx, snapshot)
+
+	daemon.mutex.Lock()
+	daemon.snapshot = snapshot
+	daemon.mutex.Unlock()
+
+	// Pinging the watchdog only after successful refreshes lets systemd
+	// restart an instance that stopped refreshing.
+	sdNotify("WATCHDOG=1\n" + sdStatus(snapshot.report))
+}
+
+func (daemon *leaseDaemon) runRefreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(daemon.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			daemon.refresh(ctx)
+		}
+	}
+}
+
+type daemonOptions struct {
+	addr            string
+	refreshInterval time.Duration
+	enableAPI       bool
+	enableMetrics   bool
+	// otlp pushes metrics to an OpenTelemetry collector after each refresh.
+	otlp bool
+	auth httpAuth
+	tls  tlsOptions
+}
+
+// runDaemon serves HTTP until ctx is cancelled, then shuts down gracefully:
+// it stops accepting connections, waits up to shutdownTimeout for requests
+// in progress, waits for a refresh in progress, and closes the event sinks.
+// If the server fails, for example because the address is in use, the
+// refresh loop is stopped and the error is returned.
+func runDaemon(ctx context.Context, opts *options, daemonOpts daemonOptions) error {
+	daemon, err := newLeaseDaemon(ctx, opts, daemonOpts)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	serveMux := http.NewServeMux()
+	if daemonOpts.enableMetrics {
+		registerMetricsHandlers(serveMux, daemon)
+	}
+	if daemonOpts.enableAPI {
+		apiServeMux := http.NewServeMux()
+		registerAPIHandlers(apiServeMux, daemon)
+		serveMux.Handle("/", daemonOpts.auth.wrap(apiServeMux))
+	}
+
+	httpServer := &http.Server{
+		Addr:    daemonOpts.addr,
+		Handler: serveMux,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	// A refresh in progress may be writing the device inventory, so wait
+	// for the refresh loop to finish before returning.
+	var refreshWaitGroup sync.WaitGroup
+	refreshWaitGroup.Add(1)
+	go func() {
+		defer refreshWaitGroup.Done()
+		daemon.runRefreshLoop(ctx)
+	}()
+	defer func() {
+		refreshWaitGroup.Wait()
+		daemon.dispatcher.close()
+		slog.Info("shutdown complete")
+	}()
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		slog.Info("shutting down")
+		sdNotify("STOPPING=1")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("httpServer.Shutdown error", "err", err)
+		}
+	}()
+
+	slog.Info("listening", "addr", daemonOpts.addr, "refreshInterval", daemonOpts.refreshInterval)
+	checkWatchdogInterval(daemonOpts.refreshInterval)
+	sdNotify("READY=1\n" + sdStatus(daemon.currentSnapshot().report))
+	if err := daemonOpts.tls.listenAndServe(httpServer); !errors.Is(err, http.ErrServerClosed) {
+		// Stop the refresh loop and the shutdown goroutine, which would
+		// otherwise wait for a signal.
+		cancel()
+		return fmt.Errorf("httpServer.ListenAndServe error: %w", err)
+	}
+
+	// ListenAndServe returns as soon as Shutdown is called; wait for open
+	// connections to be drained.
+	<-shutdownDone
+
+	return nil
+}
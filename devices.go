@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+type deviceReportRow struct {
+	leaseReportRow
+	previousIPs []net.IP
+	leaseCount  int
+	// firstStart is the earliest start time of the MAC's lease records.
+	firstStart time.Time
+}
+
+// deviceReport has one row per MAC address, built from the MAC's most recent
+// lease record.
+type deviceReport struct {
+	rows              []deviceReportRow
+	leaseStateToCount map[leases.LeaseState]int
+	// colorize colors table rows by lease state.
+	colorize bool
+	// formatTemplate replaces the output format if not nil.
+	formatTemplate *template.Template
+}
+
+type deviceHistory struct {
+	latestLease *leases.Lease
+	previousIPs []net.IP
+	leaseCount  int
+	firstStart  time.Time
+}
+
+func buildDeviceReport(ctx context.Context, opts *options) (*deviceReport, error) {
+	var records []*leases.Lease
+	if err := parseLeases(ctx, opts, func(lease leases.Lease) error {
+		records = append(records, &lease)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return buildDeviceReportFromRecords(ctx, opts, records)
+}
+
+// buildDeviceReportFromRecords builds the device report of the lease records
+// of every MAC, which are reordered.
+func buildDeviceReportFromRecords(ctx context.Context, opts *options, records []*leases.Lease) (*deviceReport, error) {
+	macToLeases := make(map[string][]*leases.Lease)
+	for _, lease := range records {
+		macString := lease.MACAddress.String()
+		macToLeases[macString] = append(macToLeases[macString], lease)
+	}
+
+	latestLeases := make([]*leases.Lease, 0, len(macToLeases))
+	latestLeaseToHistory := make(map[*leases.Lease]*deviceHistory, len(macToLeases))
+
+	for _, macLeases := range macToLeases {
+		sort.SliceStable(macLeases, func(i int, j int) bool {
+			return macLeases[i].EndsAfter(macLeases[j])
+		})
+
+		history := &deviceHistory{
+			latestLease: macLeases[0],
+			leaseCount:  len(macLeases),
+		}
+
+		seenIPs := map[string]bool{history.latestLease.IPAddress.String(): true}
+		for _, lease := range macLeases {
+			if !lease.StartTime.IsZero() && (history.firstStart.IsZero() || lease.StartTime.Before(history.firstStart)) {
+				history.firstStart = lease.StartTime
+			}
+		}
+		for _, lease := range macLeases[1:] {
+			if ipString := lease.IPAddress.String(); !seenIPs[ipString] {
+				seenIPs[ipString] = true
+				history.previousIPs = append(history.previousIPs, lease.IPAddress)
+			}
+		}
+
+		latestLeases = append(latestLeases, history.latestLease)
+		latestLeaseToHistory[history.latestLease] = history
+	}
+
+	sort.Slice(latestLeases, func(i int, j int) bool {
+		return (bytes.Compare(latestLeases[i].IPAddress, latestLeases[j].IPAddress) < 0)
+	})
+
+	leaseReport, err := buildLeaseReportFromList(ctx, opts, latestLeases)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &deviceReport{
+		rows:              make([]deviceReportRow, 0, len(leaseReport.rows)),
+		leaseStateToCount: leaseReport.leaseStateToCount,
+		colorize:          leaseReport.colorize,
+		formatTemplate:    leaseReport.formatTemplate,
+	}
+	for _, row := range leaseReport.rows {
+		history := latestLeaseToHistory[row.lease]
+		report.rows = append(report.rows, deviceReportRow{
+			leaseReportRow: row,
+			previousIPs:    history.previousIPs,
+			leaseCount:     history.leaseCount,
+			firstStart:     history.firstStart,
+		})
+	}
+	if anonymizer := newAnonymizer(opts); anonymizer != nil {
+		for i := range report.rows {
+			anonymizer.row(&report.rows[i].leaseReportRow)
+		}
+	}
+
+	return report, nil
+}
+
+// deviceOutputFormats are the output formats of list -group-by mac.
+var deviceOutputFormats = outputFormats
+
+var deviceReportColumns = []string{"MAC", "Current IP", "Previous IPs", "Count", "Hostname", "State", "End Time", "Organization"}
+
+func (row *deviceReportRow) previousIPsString() string {
+	previousIPStrings := make([]string, 0, len(row.previousIPs))
+	for _, ipAddress := range row.previousIPs {
+		previousIPStrings = append(previousIPStrings, ipAddress.String())
+	}
+	return strings.Join(previousIPStrings, " ")
+}
+
+func (row *deviceReportRow) columnValues() []string {
+	return []string{
+		row.lease.MACAddress.String(),
+		row.lease.AddressString(),
+		row.previousIPsString(),
+		strconv.Itoa(row.leaseCount),
+		row.lease.Hostname,
+		row.state.String(),
+		formatEndTime(row.lease),
+		row.organization,
+	}
+}
+
+func printDeviceReport(report *deviceReport) {
+	cellRows := make([][]string, 0, len(report.rows))
+	for i := range report.rows {
+		cellRows = append(cellRows, report.rows[i].columnValues())
+	}
+	layout := newTableLayout(deviceReportColumns, cellRows, terminalWidth())
+
+	reportPrintf("")
+	layout.printHeader(deviceReportColumns)
+
+	for i := range report.rows {
+		line := layout.formatRow(cellRows[i])
+		if report.colorize {
+			line = colorizeState(line, report.rows[i].state)
+		}
+		reportPrintf("%v", line)
+	}
+
+	reportPrintf("")
+	reportPrintf("%v devices with unique MACs:", len(report.rows))
+	for _, state := range leases.LeaseStates {
+		reportPrintf("\t%v %v", report.leaseStateToCount[state], state)
+	}
+}
+
+func outputDeviceReport(report *deviceReport, outputFormat string, outputFile string) error {
+	if report.formatTemplate != nil {
+		rows := make([]*leaseReportRow, 0, len(report.rows))
+		for i := range report.rows {
+			rows = append(rows, &report.rows[i].leaseReportRow)
+		}
+		return writeTemplateOutput(report.formatTemplate, rows, outputFile)
+	}
+
+	if outputFormat == "table" {
+		printDeviceReport(report)
+		return nil
+	}
+
+	cellRows := make([][]string, 0, len(report.rows))
+	for i := range report.rows {
+		cellRows = append(cellRows, report.rows[i].columnValues())
+	}
+
+	return writeTabularOutput(deviceReportColumns, cellRows, outputFormat, outputFile)
+}
+
+func printDevices(ctx context.Context, opts *options) error {
+	report, err := buildDeviceReport(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	return outputDeviceReport(report, opts.outputFormat, opts.outputFile)
+}
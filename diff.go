@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/snapshots"
+)
+
+// leaseChange is the kind of difference between two lease maps for one IP.
+type leaseChange string
+
+const (
+	leaseAdded        leaseChange = "added"
+	leaseRemoved      leaseChange = "removed"
+	leaseReassigned   leaseChange = "reassigned"
+	leaseStateChanged leaseChange = "state-changed"
+)
+
+// leaseDiff is one difference between two lease maps. Old is nil for added
+// leases and New is nil for removed leases.
+type leaseDiff struct {
+	Change leaseChange      `json:"change"`
+	IP     string           `json:"ip"`
+	Old    *snapshots.Lease `json:"old,omitempty"`
+	New    *snapshots.Lease `json:"new,omitempty"`
+}
+
+var diffOutputFormats = append(append([]string(nil), outputFormats...), "json")
+
+// readDiffSide returns the leases of one diff argument, which is either a
+// leases file or @time for the latest snapshot recorded at or before time.
+func readDiffSide(ctx context.Context, opts *options, arg string) ([]snapshots.Lease, error) {
+	if timeString, ok := strings.CutPrefix(arg, "@"); ok {
+		atTime, err := parseQueryTime(timeString)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshotDB, err := snapshots.Open(opts.ouiDBFile, true)
+		if err != nil {
+			return nil, err
+		}
+		defer snapshotDB.Close()
+
+		snapshot, err := snapshotDB.At(atTime)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot == nil {
+			return nil, fmt.Errorf("no snapshot recorded before %v", atTime.Format(ouputTimeFormatString))
+		}
+		slog.Info("using snapshot", "arg", arg, "recordedAt", formatDisplayTime(snapshot.Time))
+
+		return snapshot.Leases, nil
+	}
+
+	sideOpts := *opts
+	sideOpts.leasesFiles = stringListFlag{arg}
+
+	report, err := readLeaseReport(ctx, &sideOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshotLeases(report), nil
+}
+
+// diffLeases returns the differences from oldLeases to newLeases by IP,
+// sorted by IP.
+func diffLeases(oldLeases []snapshots.Lease, newLeases []snapshots.Lease) []leaseDiff {
+	ipToOld := make(map[string]*snapshots.Lease, len(oldLeases))
+	for i := range oldLeases {
+		ipToOld[oldLeases[i].IPAddress] = &oldLeases[i]
+	}
+	ipToNew := make(map[string]*snapshots.Lease, len(newLeases))
+	for i := range newLeases {
+		ipToNew[newLeases[i].IPAddress] = &newLeases[i]
+	}
+
+	var diffs []leaseDiff
+	for ip, oldLease := range ipToOld {
+		newLease, ok := ipToNew[ip]
+		switch {
+		case !ok:
+			diffs = append(diffs, leaseDiff{Change: leaseRemoved, IP: ip, Old: oldLease})
+		case newLease.MACAddress != oldLease.MACAddress:
+			diffs = append(diffs, leaseDiff{Change: leaseReassigned, IP: ip, Old: oldLease, New: newLease})
+		case newLease.State != oldLease.State:
+			diffs = append(diffs, leaseDiff{Change: leaseStateChanged, IP: ip, Old: oldLease, New: newLease})
+		}
+	}
+	for ip, newLease := range ipToNew {
+		if _, ok := ipToOld[ip]; !ok {
+			diffs = append(diffs, leaseDiff{Change: leaseAdded, IP: ip, New: newLease})
+		}
+	}
+
+	sort.Slice(diffs, func(i int, j int) bool {
+		return compareIPStrings(diffs[i].IP, diffs[j].IP) < 0
+	})
+
+	return diffs
+}
+
+// compareIPStrings compares IP address or prefix strings numerically,
+// falling back to string order for values that do not parse.
+func compareIPStrings(a string, b string) int {
+	ipA, _, errA := net.ParseCIDR(a)
+	if errA != nil {
+		ipA = net.ParseIP(a)
+	}
+	ipB, _, errB := net.ParseCIDR(b)
+	if errB != nil {
+		ipB = net.ParseIP(b)
+	}
+	if ipA == nil || ipB == nil {
+		return strings.Compare(a, b)
+	}
+	return bytes.Compare(ipA.To16(), ipB.To16())
+}
+
+var diffColumns = []string{"Change", "IP", "Old MAC", "New MAC", "Old State", "New State", "Hostname"}
+
+func (diff *leaseDiff) columnValues() []string {
+	var oldMAC, newMAC, oldState, newState, hostname string
+	if diff.Old != nil {
+		oldMAC, oldState, hostname = diff.Old.MACAddress, diff.Old.State, diff.Old.Hostname
+	}
+	if diff.New != nil {
+		newMAC, newState = diff.New.MACAddress, diff.New.State
+		if diff.New.Hostname != "" {
+			hostname = diff.New.Hostname
+		}
+	}
+	return []string{string(diff.Change), diff.IP, oldMAC, newMAC, oldState, newState, hostname}
+}
+
+func printLeaseDiffs(diffs []leaseDiff) {
+	cellRows := make([][]string, 0, len(diffs))
+	changeToCount := make(map[leaseChange]int)
+	for i := range diffs {
+		cellRows = append(cellRows, diffs[i].columnValues())
+		changeToCount[diffs[i].Change]++
+	}
+	printTable(diffColumns, cellRows)
+
+	reportPrintf("")
+	reportPrintf("%v differences:", len(diffs))
+	for _, change := range []leaseChange{leaseAdded, leaseRemoved, leaseReassigned, leaseStateChanged} {
+		reportPrintf("\t%v %v", changeToCount[change], change)
+	}
+}
+
+func outputLeaseDiffs(diffs []leaseDiff, outputFormat string, outputFile string) error {
+	switch outputFormat {
+	case "table":
+		printLeaseDiffs(diffs)
+		return nil
+	case "json":
+		if diffs == nil {
+			diffs = []leaseDiff{}
+		}
+		if err := writeOutput(outputFile, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(diffs)
+		}); err != nil {
+			return fmt.Errorf("error writing json output: %w", err)
+		}
+		return nil
+	}
+
+	cellRows := make([][]string, 0, len(diffs))
+	for i := range diffs {
+		cellRows = append(cellRows, diffs[i].columnValues())
+	}
+	return writeTabularOutput(diffColumns, cellRows, outputFormat, outputFile)
+}
+
+func setupDiffCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	flagSet.StringVar(&opts.leasesToken, "leases-token", envOrDefault(flagEnvVars["leases-token"], ""), "bearer token sent when reading http(s):// leases files (env DHCP_LEASES_TOKEN)")
+	flagSet.StringVar(&opts.ouiDBFile, "oui-db", envOrDefault(flagEnvVars["oui-db"], defaultOuiDBFile), "OUI database file, also holding recorded snapshots (env OUI_DB_FILE)")
+	flagSet.StringVar(&opts.outputFormat, "output", defaultOutputFormat, "output format: "+strings.Join(diffOutputFormats, ", "))
+	flagSet.StringVar(&opts.outputFile, "out", "", "write non-table output to this file instead of stdout")
+	registerTimeFlags(flagSet)
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if flagSet.NArg() != 2 {
+			flagSet.Usage()
+			return errUsage
+		}
+
+		oldLeases, err := readDiffSide(ctx, &opts, flagSet.Arg(0))
+		if err != nil {
+			return err
+		}
+		newLeases, err := readDiffSide(ctx, &opts, flagSet.Arg(1))
+		if err != nil {
+			return err
+		}
+
+		return outputLeaseDiffs(diffLeases(oldLeases, newLeases), opts.outputFormat, opts.outputFile)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	// Zone names given to -tz are found without a zoneinfo database, which
+	// minimal servers and containers often lack.
+	_ "time/tzdata"
+)
+
+// Modes of -times.
+const (
+	timesAbsolute = "absolute"
+	timesRelative = "relative"
+	timesBoth     = "both"
+)
+
+var timesModes = []string{timesAbsolute, timesRelative, timesBoth}
+
+// displayLocation is the time zone times are displayed and parsed in, set
+// by -tz.
+var displayLocation = time.Local
+
+// displayTimes is how times are displayed, set by -times.
+var displayTimes = timesAbsolute
+
+// formatDisplayTime formats t in displayLocation, relative to now, or both,
+// depending on displayTimes. The zero time, which leases use for missing
+// times such as the times of static leases, is formatted as "".
+func formatDisplayTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	absolute := t.In(displayLocation).Format(ouputTimeFormatString)
+	switch displayTimes {
+	case timesRelative:
+		return formatRelativeTime(t, time.Now())
+	case timesBoth:
+		return absolute + " (" + formatRelativeTime(t, time.Now()) + ")"
+	}
+	return absolute
+}
+
+// formatRelativeTime formats t relative to now, e.g. "in 3h12m" or "2d4h
+// ago".
+func formatRelativeTime(t time.Time, now time.Time) string {
+	duration := t.Sub(now)
+	if duration >= 0 {
+		return "in " + formatShortDuration(duration)
+	}
+	return formatShortDuration(-duration) + " ago"
+}
+
+// formatShortDuration formats duration in its two largest units of days,
+// hours, minutes, and seconds, e.g. 2d4h, 3h12m, or 45s.
+func formatShortDuration(duration time.Duration) string {
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+
+	var builder strings.Builder
+	parts := 0
+	for _, unit := range units {
+		if count := duration / unit.size; count > 0 || parts > 0 {
+			if count > 0 {
+				fmt.Fprintf(&builder, "%v%v", int64(count), unit.suffix)
+			}
+			duration -= count * unit.size
+			if parts++; parts == 2 {
+				break
+			}
+		}
+	}
+	if builder.Len() == 0 {
+		return "0s"
+	}
+	return builder.String()
+}
+
+// timeZoneFlag is the flag.Value of -tz, setting displayLocation.
+type timeZoneFlag struct{}
+
+func (timeZoneFlag) String() string {
+	if displayLocation == time.Local {
+		return "local"
+	}
+	return displayLocation.String()
+}
+
+func (timeZoneFlag) Set(value string) error {
+	switch strings.ToLower(value) {
+	case "utc":
+		displayLocation = time.UTC
+		return nil
+	case "local":
+		displayLocation = time.Local
+		return nil
+	}
+
+	location, err := time.LoadLocation(value)
+	if err != nil {
+		return err
+	}
+	displayLocation = location
+	return nil
+}
+
+// timesFlag is the flag.Value of -times, setting displayTimes.
+type timesFlag struct{}
+
+func (timesFlag) String() string {
+	return displayTimes
+}
+
+func (timesFlag) Set(value string) error {
+	for _, mode := range timesModes {
+		if value == mode {
+			displayTimes = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("expected one of %v", strings.Join(timesModes, ", "))
+}
+
+// registerTimeFlags registers the flags controlling how times are displayed.
+func registerTimeFlags(flagSet *flag.FlagSet) {
+	flagSet.Var(timeZoneFlag{}, "tz", "time `zone` of displayed times: an IANA zone name such as America/Chicago, utc, or local (default local)")
+	flagSet.Var(timesFlag{}, "times", "display times as absolute timestamps, relative to now such as 'in 3h12m' or '2d4h ago', or both: "+strings.Join(timesModes, ", ")+" (default absolute)")
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatRelativeTime(t *testing.T) {
+	now := time.Date(2020, 6, 26, 22, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		t    time.Time
+		want string
+	}{
+		{now, "in 0s"},
+		{now.Add(45 * time.Second), "in 45s"},
+		{now.Add(3*time.Hour + 12*time.Minute + 5*time.Second), "in 3h12m"},
+		{now.Add(-(2*24*time.Hour + 4*time.Hour + 30*time.Minute)), "2d4h ago"},
+		{now.Add(-(24*time.Hour + 30*time.Second)), "1d ago"},
+	} {
+		if got := formatRelativeTime(test.t, now); got != test.want {
+			t.Errorf("formatRelativeTime(%v) = %q, want %q", test.t.Sub(now), got, test.want)
+		}
+	}
+}
+
+func TestFormatDisplayTimeZero(t *testing.T) {
+	if got := formatDisplayTime(time.Time{}); got != "" {
+		t.Errorf("formatDisplayTime(zero) = %q, want \"\"", got)
+	}
+}
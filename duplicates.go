@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// errDuplicatesFound is returned when -fail-on-duplicates is set and
+// duplicates were found.
+var errDuplicatesFound = errors.New("duplicate leases found")
+
+// duplicateGroup is a set of current leases sharing the same key, such as a
+// MAC address.
+type duplicateGroup struct {
+	key  string
+	rows []*leaseReportRow
+}
+
+// findDuplicates groups the Current rows of report by key and returns the
+// groups with more than one row, sorted by key. Rows with an empty key are
+// ignored.
+func findDuplicates(report *leaseReport, key func(row *leaseReportRow) string) []duplicateGroup {
+	keyToRows := make(map[string][]*leaseReportRow)
+	for i := range report.rows {
+		row := &report.rows[i]
+		if row.state != leases.Current {
+			continue
+		}
+		if rowKey := key(row); rowKey != "" {
+			keyToRows[rowKey] = append(keyToRows[rowKey], row)
+		}
+	}
+
+	var groups []duplicateGroup
+	for rowKey, rows := range keyToRows {
+		if len(rows) > 1 {
+			groups = append(groups, duplicateGroup{key: rowKey, rows: rows})
+		}
+	}
+	sort.Slice(groups, func(i int, j int) bool {
+		return groups[i].key < groups[j].key
+	})
+	return groups
+}
+
+// findDuplicateMACs returns MAC addresses holding Current leases on more
+// than one IP.
+func findDuplicateMACs(report *leaseReport) []duplicateGroup {
+	return findDuplicates(report, func(row *leaseReportRow) string {
+		return row.lease.MACAddress.String()
+	})
+}
+
+// findDuplicateHostnames returns hostnames, compared case-insensitively,
+// reported by Current leases from more than one MAC address.
+func findDuplicateHostnames(report *leaseReport) []duplicateGroup {
+	groups := findDuplicates(report, func(row *leaseReportRow) string {
+		return strings.ToLower(row.lease.Hostname)
+	})
+
+	conflicts := groups[:0]
+	for _, group := range groups {
+		macs := make(map[string]bool)
+		for _, row := range group.rows {
+			macs[row.lease.MACAddress.String()] = true
+		}
+		if len(macs) > 1 {
+			conflicts = append(conflicts, group)
+		}
+	}
+	return conflicts
+}
+
+func printDuplicateMACs(groups []duplicateGroup) {
+	reportPrintf("\t%v MAC addresses with multiple current leases:", len(groups))
+	for _, group := range groups {
+		reportPrintf("\t\tWARNING %v (%v):", group.key, group.rows[0].organization)
+		for _, row := range group.rows {
+			reportPrintf("\t\t\t%-17v%v", row.lease.AddressString(), row.lease.Hostname)
+		}
+	}
+}
+
+func printDuplicateHostnames(groups []duplicateGroup) {
+	reportPrintf("\t%v hostnames with current leases from multiple MACs:", len(groups))
+	for _, group := range groups {
+		reportPrintf("\t\tWARNING %v:", group.rows[0].lease.Hostname)
+		for _, row := range group.rows {
+			reportPrintf("\t\t\t%-17v%-19v%v", row.lease.AddressString(), row.lease.MACAddress, row.organization)
+		}
+	}
+}
+
+// checkReport runs the checks enabled by opts on report, returning the
+// first error.
+func checkReport(report *leaseReport, opts *options) error {
+	duplicatesErr := checkDuplicates(report, opts)
+	unknownErr := checkUnknownDevices(report, opts)
+	if duplicatesErr != nil {
+		return duplicatesErr
+	}
+	return unknownErr
+}
+
+// checkDuplicates prints duplicate warnings for report if enabled by opts
+// and returns errDuplicatesFound if any were found and opts.failOnDuplicates
+// is set.
+func checkDuplicates(report *leaseReport, opts *options) error {
+	if !opts.warnDuplicates && !opts.failOnDuplicates {
+		return nil
+	}
+
+	duplicateMACs := findDuplicateMACs(report)
+	duplicateHostnames := findDuplicateHostnames(report)
+
+	reportPrintf("")
+	reportPrintf("Conflicts:")
+	printDuplicateMACs(duplicateMACs)
+	printDuplicateHostnames(duplicateHostnames)
+
+	if opts.failOnDuplicates && (len(duplicateMACs) > 0 || len(duplicateHostnames) > 0) {
+		return errDuplicatesFound
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultEmailEvents  = "new-device,pool-nearly-full,abandoned-above-threshold"
+	defaultEmailSubject = "DHCP lease alert: {{len .Events}} events"
+	emailTimeout        = 30 * time.Second
+)
+
+const defaultEmailTemplate = `{{range .Events -}}
+{{.Time.Local.Format "2006/01/02 15:04:05 -0700"}} {{.Type}}
+{{- if .Pool}} {{.Pool}} {{printf "%.1f" .PercentUsed}}% used
+{{- else if .Count}} {{.Count}} abandoned leases
+{{- else}} {{.IP}} {{.MAC}} {{.Organization}}{{if .Hostname}} hostname {{.Hostname}}{{end}}{{if .DeviceName}} device {{.DeviceName}}{{end}}
+{{- end}}
+{{end}}`
+
+// emailTemplateData is the data given to the email subject and body
+// templates.
+type emailTemplateData struct {
+	Events []leaseEvent
+}
+
+// emailEventSink emails events through an SMTP server, one message per
+// batch of events.
+type emailEventSink struct {
+	url        *url.URL
+	from       string
+	to         []string
+	eventTypes map[leaseEventType]bool
+	subject    *template.Template
+	body       *template.Template
+}
+
+func newEmailEventSink(opts *options, rawURL string) (*emailEventSink, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp url %v: %w", rawURL, err)
+	}
+	if parsedURL.Hostname() == "" || parsedURL.Port() == "" {
+		return nil, fmt.Errorf("invalid smtp url %v: expected host:port", rawURL)
+	}
+	if opts.emailFrom == "" || len(opts.emailTo) == 0 {
+		return nil, errors.New("-email-from and -email-to are required for smtp event sinks")
+	}
+
+	eventTypes, err := parseLeaseEventTypes(opts.emailEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := template.New("subject").Parse(opts.emailSubject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email subject template: %w", err)
+	}
+
+	bodyText := defaultEmailTemplate
+	if opts.emailTemplateFile != "" {
+		data, err := os.ReadFile(opts.emailTemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading email template %v: %w", opts.emailTemplateFile, err)
+		}
+		bodyText = string(data)
+	}
+	body, err := template.New("body").Parse(bodyText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email template: %w", err)
+	}
+
+	return &emailEventSink{
+		url:        parsedURL,
+		from:       opts.emailFrom,
+		to:         opts.emailTo,
+		eventTypes: eventTypes,
+		subject:    subject,
+		body:       body,
+	}, nil
+}
+
+func (sink *emailEventSink) String() string {
+	return sink.url.Redacted()
+}
+
+// includeEvent reports whether event should be emailed. New devices are
+// only emailed if they are not known devices.
+func (sink *emailEventSink) includeEvent(event *leaseEvent) bool {
+	if sink.eventTypes != nil && !sink.eventTypes[event.Type] {
+		return false
+	}
+	return event.Type != newDevice || event.DeviceName == ""
+}
+
+func (sink *emailEventSink) Send(ctx context.Context, events []leaseEvent) error {
+	data := emailTemplateData{}
+	for i := range events {
+		if sink.includeEvent(&events[i]) {
+			data.Events = append(data.Events, events[i])
+		}
+	}
+	if len(data.Events) == 0 {
+		return nil
+	}
+
+	var subject bytes.Buffer
+	if err := sink.subject.Execute(&subject, data); err != nil {
+		return fmt.Errorf("email subject template error: %w", err)
+	}
+	var body bytes.Buffer
+	if err := sink.body.Execute(&body, data); err != nil {
+		return fmt.Errorf("email template error: %w", err)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %v\r\n", sink.from)
+	fmt.Fprintf(&message, "To: %v\r\n", strings.Join(sink.to, ", "))
+	fmt.Fprintf(&message, "Subject: %v\r\n", strings.ReplaceAll(subject.String(), "\n", " "))
+	fmt.Fprintf(&message, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&message, "\r\n")
+	message.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+
+	if err := sink.sendMail(ctx, message.Bytes()); err != nil {
+		return fmt.Errorf("error sending email through %v: %w", sink, err)
+	}
+	return nil
+}
+
+// sendMail delivers message, using implicit TLS for smtps:// URLs and
+// STARTTLS when the server offers it otherwise. URL credentials are sent
+// with PLAIN auth.
+func (sink *emailEventSink) sendMail(ctx context.Context, message []byte) error {
+	host := sink.url.Hostname()
+	tlsConfig := &tls.Config{ServerName: host}
+
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	var conn net.Conn
+	var err error
+	if sink.url.Scheme == "smtps" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", sink.url.Host)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", sink.url.Host)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && sink.url.Scheme == "smtp" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if sink.url.User != nil {
+		password, _ := sink.url.User.Password()
+		if err := client.Auth(smtp.PlainAuth("", sink.url.User.Username(), password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(sink.from); err != nil {
+		return err
+	}
+	for _, to := range sink.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// leaseEventType is the kind of change reported by a leaseEvent.
+type leaseEventType string
+
+const (
+	// leaseNew is a Current lease for an IP that had no Current lease from
+	// the same MAC.
+	leaseNew leaseEventType = "lease-new"
+	// leaseRenewed is a Current lease extended by the same MAC.
+	leaseRenewed leaseEventType = "lease-renewed"
+	// leaseExpired is a Current lease that ended, was released, or was
+	// replaced or removed, in which case the event has the last known lease.
+	leaseExpired leaseEventType = "lease-expired"
+	// leaseAbandoned is a lease that became Abandoned.
+	leaseAbandoned leaseEventType = "lease-abandoned"
+	// newDevice is a Current lease from a MAC not seen since startup.
+	newDevice leaseEventType = "new-device"
+	// poolNearlyFull is a dhcpd.conf pool whose utilization reached the
+	// -pool-full-threshold percentage, including at startup.
+	poolNearlyFull leaseEventType = "pool-nearly-full"
+	// abandonedAboveThreshold is sent when the number of Abandoned leases
+	// rises above -abandoned-threshold, including at startup.
+	abandonedAboveThreshold leaseEventType = "abandoned-above-threshold"
+)
+
+var leaseEventTypes = []leaseEventType{leaseNew, leaseRenewed, leaseExpired, leaseAbandoned, newDevice, poolNearlyFull, abandonedAboveThreshold}
+
+// parseLeaseEventTypes parses a comma-separated list of event types, or
+// "all" for nil.
+func parseLeaseEventTypes(s string) (map[leaseEventType]bool, error) {
+	if s == "all" {
+		return nil, nil
+	}
+
+	eventTypes := make(map[leaseEventType]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, eventType := range leaseEventTypes {
+			if string(eventType) == name {
+				eventTypes[eventType] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown event type '%v'", name)
+		}
+	}
+	return eventTypes, nil
+}
+
+// leaseEvent is a change between two successive parses of the leases. Pool
+// events have only Type, Time, Pool, and PercentUsed set, and abandoned
+// threshold events only Type, Time, and Count.
+type leaseEvent struct {
+	Type         leaseEventType `json:"type"`
+	Time         time.Time      `json:"time"`
+	IP           string         `json:"ip,omitempty"`
+	MAC          string         `json:"mac,omitempty"`
+	Hostname     string         `json:"hostname,omitempty"`
+	State        string         `json:"state,omitempty"`
+	StartTime    *time.Time     `json:"startTime,omitempty"`
+	EndTime      *time.Time     `json:"endTime,omitempty"`
+	Organization string         `json:"organization,omitempty"`
+	DeviceName   string         `json:"deviceName,omitempty"`
+	Pool         string         `json:"pool,omitempty"`
+	PercentUsed  float64        `json:"percentUsed,omitempty"`
+	Count        int            `json:"count,omitempty"`
+}
+
+func newLeaseEvent(eventType leaseEventType, now time.Time, row *leaseReportRow) leaseEvent {
+	return leaseEvent{
+		Type:         eventType,
+		Time:         now,
+		IP:           row.lease.AddressString(),
+		MAC:          row.lease.MACAddress.String(),
+		Hostname:     row.lease.Hostname,
+		State:        row.state.String(),
+		StartTime:    optionalTime(row.lease.StartTime),
+		EndTime:      optionalTime(row.lease.EndTime),
+		Organization: row.organization,
+		DeviceName:   row.deviceName,
+	}
+}
+
+// eventSink receives the events computed from each parse.
+type eventSink interface {
+	Send(ctx context.Context, events []leaseEvent) error
+	String() string
+}
+
+// writerEventSink writes events as JSON lines.
+type writerEventSink struct {
+	name   string
+	mutex  sync.Mutex
+	writer io.Writer
+	// closer closes the writer of file sinks.
+	closer io.Closer
+}
+
+func (sink *writerEventSink) Send(ctx context.Context, events []leaseEvent) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	encoder := json.NewEncoder(sink.writer)
+	for i := range events {
+		if err := encoder.Encode(&events[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *writerEventSink) String() string {
+	return sink.name
+}
+
+func (sink *writerEventSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if sink.closer == nil {
+		return nil
+	}
+	return sink.closer.Close()
+}
+
+// newEventSink returns the sink for spec, which is stdout, file:PATH to
+// append JSON lines to PATH, an http(s):// webhook URL, an smtp(s):// mail
+// server URL, an mqtt(s):// broker URL, or a syslog sink.
+func newEventSink(opts *options, spec string) (eventSink, error) {
+	switch {
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		return newWebhookEventSink(opts, spec)
+	case strings.HasPrefix(spec, "smtp://") || strings.HasPrefix(spec, "smtps://"):
+		return newEmailEventSink(opts, spec)
+	case strings.HasPrefix(spec, "mqtt://") || strings.HasPrefix(spec, "mqtts://"):
+		return newMQTTEventSink(opts, spec)
+	case spec == "syslog:" || strings.HasPrefix(spec, "syslog://") || strings.HasPrefix(spec, "syslog+tcp://"):
+		return newSyslogEventSink(opts, spec)
+	}
+
+	if spec == "stdout" {
+		return &writerEventSink{name: spec, writer: os.Stdout}, nil
+	}
+
+	if path, ok := strings.CutPrefix(spec, "file:"); ok {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open event file %v: %w", path, err)
+		}
+		return &writerEventSink{name: spec, writer: file, closer: file}, nil
+	}
+
+	return nil, fmt.Errorf("unknown event sink '%v'", spec)
+}
+
+// eventDispatcher computes events between successive lease reports and
+// sends them to its sinks. The first report only establishes a baseline.
+type eventDispatcher struct {
+	sinks              []eventSink
+	poolThreshold      float64
+	abandonedThreshold int
+
+	previous       map[string]*leaseReportRow
+	seenMACs       map[string]bool
+	fullPools      map[string]bool
+	abandonedAbove bool
+}
+
+// newEventDispatcher returns a dispatcher for the sinks in opts, or nil if
+// there are none.
+func newEventDispatcher(opts *options) (*eventDispatcher, error) {
+	if len(opts.eventSinks) == 0 {
+		return nil, nil
+	}
+
+	dispatcher := &eventDispatcher{
+		poolThreshold:      opts.poolFullThreshold,
+		abandonedThreshold: opts.abandonedThreshold,
+		seenMACs:           make(map[string]bool),
+		fullPools:          make(map[string]bool),
+	}
+	for _, spec := range opts.eventSinks {
+		sink, err := newEventSink(opts, spec)
+		if err != nil {
+			// Close the files and connections of the sinks already set up.
+			dispatcher.close()
+			return nil, err
+		}
+		dispatcher.sinks = append(dispatcher.sinks, sink)
+	}
+
+	return dispatcher, nil
+}
+
+// computeEvents returns the events between the previous report and report
+// and makes report the previous report.
+func (dispatcher *eventDispatcher) computeEvents(report *leaseReport, now time.Time) []leaseEvent {
+	current := make(map[string]*leaseReportRow, len(report.rows))
+	for i := range report.rows {
+		row := &report.rows[i]
+		current[row.lease.AddressString()] = row
+	}
+
+	baseline := dispatcher.previous == nil
+	previous := dispatcher.previous
+	dispatcher.previous = current
+
+	var events []leaseEvent
+	for i := range report.rows {
+		row := &report.rows[i]
+		macString := row.lease.MACAddress.String()
+
+		if row.state == leases.Current && len(row.lease.MACAddress) > 0 && !dispatcher.seenMACs[macString] {
+			dispatcher.seenMACs[macString] = true
+			if !baseline {
+				events = append(events, newLeaseEvent(newDevice, now, row))
+			}
+		}
+
+		if baseline {
+			continue
+		}
+
+		previousRow := previous[row.lease.AddressString()]
+		sameMAC := previousRow != nil && previousRow.lease.MACAddress.String() == macString
+		wasCurrent := sameMAC && previousRow.state == leases.Current
+
+		switch {
+		case row.state == leases.Current && !wasCurrent:
+			events = append(events, newLeaseEvent(leaseNew, now, row))
+		case row.state == leases.Current && (row.lease.EndsAfter(previousRow.lease) || !row.lease.StartTime.Equal(previousRow.lease.StartTime)):
+			events = append(events, newLeaseEvent(leaseRenewed, now, row))
+		case row.state == leases.Abandoned && (previousRow == nil || previousRow.state != leases.Abandoned):
+			events = append(events, newLeaseEvent(leaseAbandoned, now, row))
+		case wasCurrent && row.state != leases.Current:
+			events = append(events, newLeaseEvent(leaseExpired, now, row))
+		}
+
+		if previousRow != nil && !sameMAC && previousRow.state == leases.Current {
+			events = append(events, newLeaseEvent(leaseExpired, now, previousRow))
+		}
+	}
+
+	for address, previousRow := range previous {
+		if _, ok := current[address]; !ok && previousRow.state == leases.Current {
+			events = append(events, newLeaseEvent(leaseExpired, now, previousRow))
+		}
+	}
+
+	events = append(events, dispatcher.computePoolEvents(report, now)...)
+	return append(events, dispatcher.computeAbandonedEvents(report, now)...)
+}
+
+// computeAbandonedEvents returns an abandonedAboveThreshold event if the
+// number of Abandoned leases in report rose above the threshold since the
+// previous report. A threshold of zero disables the event.
+func (dispatcher *eventDispatcher) computeAbandonedEvents(report *leaseReport, now time.Time) []leaseEvent {
+	if dispatcher.abandonedThreshold <= 0 {
+		return nil
+	}
+
+	count := report.leaseStateToCount[leases.Abandoned]
+	above := count > dispatcher.abandonedThreshold
+	wasAbove := dispatcher.abandonedAbove
+	dispatcher.abandonedAbove = above
+
+	if !above || wasAbove {
+		return nil
+	}
+	return []leaseEvent{{
+		Type:  abandonedAboveThreshold,
+		Time:  now,
+		Count: count,
+	}}
+}
+
+// computePoolEvents returns a poolNearlyFull event for each pool of report
+// whose utilization reached the threshold since the previous report.
+func (dispatcher *eventDispatcher) computePoolEvents(report *leaseReport, now time.Time) []leaseEvent {
+	var events []leaseEvent
+	for i := range report.pools {
+		usage := &report.pools[i]
+		pool := usage.subnet.String()
+
+		full := usage.percentUsed() >= dispatcher.poolThreshold
+		if full && !dispatcher.fullPools[pool] {
+			events = append(events, leaseEvent{
+				Type:        poolNearlyFull,
+				Time:        now,
+				Pool:        pool,
+				PercentUsed: usage.percentUsed(),
+			})
+		}
+		dispatcher.fullPools[pool] = full
+	}
+	return events
+}
+
+// observe sends the events between the previous report and report to every
+// sink and report itself to every reportSink, logging sink errors. It does
+// nothing if dispatcher is nil.
+func (dispatcher *eventDispatcher) observe(ctx context.Context, report *leaseReport) {
+	if dispatcher == nil {
+		return
+	}
+
+	events := dispatcher.computeEvents(report, time.Now())
+
+	for _, sink := range dispatcher.sinks {
+		if len(events) > 0 {
+			if err := sink.Send(ctx, events); err != nil {
+				slog.Error("event sink error", "sink", sink, "err", err)
+			}
+		}
+		if reportSink, ok := sink.(reportSink); ok {
+			if err := reportSink.PublishReport(ctx, report); err != nil {
+				slog.Error("event sink error", "sink", sink, "err", err)
+			}
+		}
+	}
+}
+
+// close closes the sinks that hold connections or files, such as MQTT
+// brokers and event files. It does nothing if dispatcher is nil.
+func (dispatcher *eventDispatcher) close() {
+	if dispatcher == nil {
+		return
+	}
+
+	for _, sink := range dispatcher.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				slog.Error("event sink close error", "sink", sink, "err", err)
+			}
+		}
+	}
+}
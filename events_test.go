@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// eventRow is a lease report row for an event test.
+type eventRow struct {
+	ip    string
+	mac   string
+	state leases.LeaseState
+	// hours is the end time of the lease in hours after the start time.
+	hours int
+}
+
+// eventReport returns a report of rows with a pool of size addresses, of
+// which leased are used.
+func eventReport(rows []eventRow, size, leased uint64) *leaseReport {
+	startTime := time.Date(2020, 6, 26, 21, 0, 0, 0, time.UTC)
+	report := &leaseReport{leaseStateToCount: make(map[leases.LeaseState]int)}
+	for _, row := range rows {
+		mac, _ := net.ParseMAC(row.mac)
+		report.rows = append(report.rows, leaseReportRow{
+			lease: &leases.Lease{
+				IPAddress:  net.ParseIP(row.ip),
+				MACAddress: mac,
+				StartTime:  startTime,
+				EndTime:    startTime.Add(time.Duration(max(row.hours, 1)) * time.Hour),
+			},
+			state: row.state,
+		})
+		report.leaseStateToCount[row.state]++
+	}
+	if size > 0 {
+		_, subnet, _ := net.ParseCIDR("10.0.0.0/24")
+		report.pools = []poolUsage{{subnet: subnet, size: size, leased: leased}}
+	}
+	return report
+}
+
+// eventStrings returns the sorted events as "type ip mac", "type pool", or
+// "type count" strings.
+func eventStrings(events []leaseEvent) []string {
+	var values []string
+	for _, event := range events {
+		switch {
+		case event.Pool != "":
+			values = append(values, fmt.Sprintf("%v %v", event.Type, event.Pool))
+		case event.Count > 0:
+			values = append(values, fmt.Sprintf("%v %v", event.Type, event.Count))
+		default:
+			values = append(values, fmt.Sprintf("%v %v %v", event.Type, event.IP, event.MAC))
+		}
+	}
+	slices.Sort(values)
+	return values
+}
+
+func TestComputeEvents(t *testing.T) {
+	const (
+		macA = "00:00:00:00:00:0a"
+		macB = "00:00:00:00:00:0b"
+	)
+	current := leases.Current
+
+	for _, test := range []struct {
+		name         string
+		previous     []eventRow
+		current      []eventRow
+		previousPool uint64
+		currentPool  uint64
+		abandoned    int
+		wantBaseline []string
+		want         []string
+	}{
+		{
+			name:     "unchanged",
+			previous: []eventRow{{"10.0.0.1", macA, current, 1}},
+			current:  []eventRow{{"10.0.0.1", macA, current, 1}},
+		},
+		{
+			name:    "new lease and device",
+			current: []eventRow{{"10.0.0.1", macA, current, 1}},
+			want:    []string{"lease-new 10.0.0.1 " + macA, "new-device 10.0.0.1 " + macA},
+		},
+		{
+			name:     "renewed",
+			previous: []eventRow{{"10.0.0.1", macA, current, 1}},
+			current:  []eventRow{{"10.0.0.1", macA, current, 2}},
+			want:     []string{"lease-renewed 10.0.0.1 " + macA},
+		},
+		{
+			name:     "expired",
+			previous: []eventRow{{"10.0.0.1", macA, current, 1}},
+			current:  []eventRow{{"10.0.0.1", macA, leases.Past, 1}},
+			want:     []string{"lease-expired 10.0.0.1 " + macA},
+		},
+		{
+			name:     "released",
+			previous: []eventRow{{"10.0.0.1", macA, current, 1}},
+			current:  []eventRow{{"10.0.0.1", macA, leases.Released, 1}},
+			want:     []string{"lease-expired 10.0.0.1 " + macA},
+		},
+		{
+			name:     "removed",
+			previous: []eventRow{{"10.0.0.1", macA, current, 1}},
+			want:     []string{"lease-expired 10.0.0.1 " + macA},
+		},
+		{
+			name:     "replaced by another device",
+			previous: []eventRow{{"10.0.0.1", macA, current, 1}},
+			current:  []eventRow{{"10.0.0.1", macB, current, 1}},
+			want:     []string{"lease-expired 10.0.0.1 " + macA, "lease-new 10.0.0.1 " + macB, "new-device 10.0.0.1 " + macB},
+		},
+		{
+			name:     "known device moved",
+			previous: []eventRow{{"10.0.0.1", macA, current, 1}},
+			current:  []eventRow{{"10.0.0.2", macA, current, 1}},
+			want:     []string{"lease-expired 10.0.0.1 " + macA, "lease-new 10.0.0.2 " + macA},
+		},
+		{
+			name:     "abandoned",
+			previous: []eventRow{{"10.0.0.1", macA, current, 1}},
+			current:  []eventRow{{"10.0.0.1", macA, leases.Abandoned, 1}},
+			want:     []string{"lease-abandoned 10.0.0.1 " + macA},
+		},
+		{
+			name:     "still abandoned",
+			previous: []eventRow{{"10.0.0.1", macA, leases.Abandoned, 1}},
+			current:  []eventRow{{"10.0.0.1", macA, leases.Abandoned, 1}},
+		},
+		{
+			name:         "pool nearly full",
+			previousPool: 5,
+			currentPool:  9,
+			want:         []string{"pool-nearly-full 10.0.0.0/24"},
+		},
+		{
+			name:         "pool full at startup",
+			previousPool: 9,
+			currentPool:  10,
+			wantBaseline: []string{"pool-nearly-full 10.0.0.0/24"},
+		},
+		{
+			name:      "abandoned above threshold",
+			previous:  []eventRow{{"10.0.0.1", macA, leases.Abandoned, 1}},
+			current:   []eventRow{{"10.0.0.1", macA, leases.Abandoned, 1}, {"10.0.0.2", macB, leases.Abandoned, 1}},
+			abandoned: 1,
+			want:      []string{"abandoned-above-threshold 2", "lease-abandoned 10.0.0.2 " + macB},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var poolSize uint64
+			if test.previousPool > 0 || test.currentPool > 0 {
+				poolSize = 10
+			}
+			dispatcher := &eventDispatcher{
+				poolThreshold:      80,
+				abandonedThreshold: test.abandoned,
+				seenMACs:           make(map[string]bool),
+				fullPools:          make(map[string]bool),
+			}
+			now := time.Date(2020, 6, 26, 21, 30, 0, 0, time.UTC)
+
+			baseline := dispatcher.computeEvents(eventReport(test.previous, poolSize, test.previousPool), now)
+			if got := eventStrings(baseline); !slices.Equal(got, test.wantBaseline) {
+				t.Errorf("got baseline events %v, want %v", got, test.wantBaseline)
+			}
+			events := dispatcher.computeEvents(eventReport(test.current, poolSize, test.currentPool), now)
+			if got := eventStrings(events); !slices.Equal(got, test.want) {
+				t.Errorf("got events %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewEventDispatcherSinkError(t *testing.T) {
+	opts := &options{eventSinks: []string{"file:" + filepath.Join(t.TempDir(), "events.jsonl"), "bogus"}}
+	if _, err := newEventDispatcher(opts); err == nil {
+		t.Errorf("newEventDispatcher error = nil, want unknown event sink error")
+	}
+}
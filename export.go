@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/oui"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/snapshots"
+)
+
+// sqliteSchema creates the tables written by export sqlite. Times are
+// RFC 3339 text in UTC so SQLite date functions can use them, and NULL for
+// leases that never end.
+const sqliteSchema = `
+CREATE TABLE leases (
+	ip TEXT NOT NULL,
+	mac TEXT NOT NULL,
+	hostname TEXT NOT NULL,
+	state TEXT NOT NULL,
+	binding_state TEXT NOT NULL,
+	start_time TEXT,
+	end_time TEXT,
+	cltt_time TEXT,
+	organization TEXT NOT NULL,
+	randomized_mac INTEGER NOT NULL,
+	device_name TEXT NOT NULL
+);
+CREATE INDEX leases_mac ON leases (mac);
+
+CREATE TABLE devices (
+	mac TEXT PRIMARY KEY,
+	last_ip TEXT NOT NULL,
+	hostname TEXT NOT NULL,
+	first_seen TEXT,
+	last_seen TEXT,
+	organization TEXT NOT NULL
+);
+
+CREATE TABLE snapshots (
+	time TEXT PRIMARY KEY
+);
+
+CREATE TABLE snapshot_leases (
+	snapshot_time TEXT NOT NULL REFERENCES snapshots (time),
+	ip TEXT NOT NULL,
+	mac TEXT NOT NULL,
+	hostname TEXT NOT NULL,
+	state TEXT NOT NULL,
+	start_time TEXT,
+	end_time TEXT
+);
+CREATE INDEX snapshot_leases_ip ON snapshot_leases (ip);
+CREATE INDEX snapshot_leases_mac ON snapshot_leases (mac);
+
+CREATE TABLE oui (
+	prefix TEXT PRIMARY KEY,
+	organization TEXT NOT NULL
+);
+`
+
+func setupExportCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	finishFilters := registerFilterFlags(flagSet, &opts)
+	registerMDNSFlags(flagSet, &opts)
+	registerNeighborFlags(flagSet, &opts)
+	registerProbeFlags(flagSet, &opts)
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if flagSet.NArg() != 2 || flagSet.Arg(0) != "sqlite" {
+			flagSet.Usage()
+			return errUsage
+		}
+
+		if err := finishFilters(); err != nil {
+			return err
+		}
+
+		return exportSQLite(ctx, &opts, flagSet.Arg(1))
+	}
+}
+
+// sqliteTime formats t for the export, or returns nil for the zero time.
+func sqliteTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// exportSQLite writes the current leases, and the device inventory,
+// snapshots, and OUI prefixes of opts.ouiDBFile if it exists, to a new
+// SQLite database replacing path.
+func exportSQLite(ctx context.Context, opts *options, path string) error {
+	report, err := readLeaseReport(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	var inventoryRows []inventoryRow
+	_, err = os.Stat(opts.ouiDBFile)
+	ouiDBExists := err == nil
+	switch {
+	case ouiDBExists:
+		if inventoryRows, err = readInventory(ctx, opts); err != nil {
+			return err
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		slog.Info("OUI database not found, exporting only current leases", "path", opts.ouiDBFile)
+	default:
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %v: %w", path, err)
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	db, err := sql.Open("sqlite", tempFile.Name())
+	if err != nil {
+		return fmt.Errorf("sql.Open error: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.BeginTx error: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, sqliteSchema); err != nil {
+		return fmt.Errorf("error creating schema: %w", err)
+	}
+
+	if err := exportSQLiteLeases(ctx, tx, report); err != nil {
+		return err
+	}
+	if err := exportSQLiteDevices(ctx, tx, inventoryRows); err != nil {
+		return err
+	}
+	snapshotCount, ouiCount := 0, 0
+	if ouiDBExists {
+		if snapshotCount, err = exportSQLiteSnapshots(ctx, tx, opts.ouiDBFile); err != nil {
+			return err
+		}
+		if ouiCount, err = exportSQLiteOUIs(ctx, tx, opts.ouiDBFile); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("tx.Commit error: %w", err)
+	}
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("db.Close error: %w", err)
+	}
+	if err := os.Chmod(tempFile.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to chmod %v: %w", tempFile.Name(), err)
+	}
+	if err := os.Rename(tempFile.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename %v to %v: %w", tempFile.Name(), path, err)
+	}
+
+	slog.Info("exported",
+		"path", path, "leases", len(report.rows), "devices", len(inventoryRows), "snapshots", snapshotCount, "ouiPrefixes", ouiCount)
+
+	return nil
+}
+
+func exportSQLiteLeases(ctx context.Context, tx *sql.Tx, report *leaseReport) error {
+	statement, err := tx.PrepareContext(ctx, `INSERT INTO leases (ip, mac, hostname, state, binding_state,
+		start_time, end_time, cltt_time, organization, randomized_mac, device_name)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("tx.PrepareContext error: %w", err)
+	}
+	defer statement.Close()
+
+	for i := range report.rows {
+		row := &report.rows[i]
+		if _, err := statement.ExecContext(ctx,
+			row.lease.AddressString(),
+			row.lease.MACAddress.String(),
+			row.lease.Hostname,
+			row.state.String(),
+			row.lease.BindingState,
+			sqliteTime(row.lease.StartTime),
+			sqliteTime(row.lease.EndTime),
+			sqliteTime(row.lease.ClttTime),
+			row.organization,
+			row.randomizedMAC,
+			row.deviceName,
+		); err != nil {
+			return fmt.Errorf("error inserting lease %v: %w", row.lease.AddressString(), err)
+		}
+	}
+
+	return nil
+}
+
+func exportSQLiteDevices(ctx context.Context, tx *sql.Tx, rows []inventoryRow) error {
+	statement, err := tx.PrepareContext(ctx, `INSERT INTO devices (mac, last_ip, hostname, first_seen, last_seen, organization)
+		VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("tx.PrepareContext error: %w", err)
+	}
+	defer statement.Close()
+
+	for i := range rows {
+		device := rows[i].device
+		if _, err := statement.ExecContext(ctx,
+			device.MACAddress.String(),
+			device.IPAddress.String(),
+			device.Hostname,
+			sqliteTime(device.FirstSeen),
+			sqliteTime(device.LastSeen),
+			rows[i].organization,
+		); err != nil {
+			return fmt.Errorf("error inserting device %v: %w", device.MACAddress, err)
+		}
+	}
+
+	return nil
+}
+
+// exportSQLiteSnapshots copies the snapshots in ouiDBFile, returning the
+// number copied.
+func exportSQLiteSnapshots(ctx context.Context, tx *sql.Tx, ouiDBFile string) (int, error) {
+	snapshotDB, err := snapshots.Open(ouiDBFile, true)
+	if err != nil {
+		return 0, err
+	}
+	defer snapshotDB.Close()
+
+	snapshotStatement, err := tx.PrepareContext(ctx, `INSERT INTO snapshots (time) VALUES (?)`)
+	if err != nil {
+		return 0, fmt.Errorf("tx.PrepareContext error: %w", err)
+	}
+	defer snapshotStatement.Close()
+
+	leaseStatement, err := tx.PrepareContext(ctx, `INSERT INTO snapshot_leases (snapshot_time, ip, mac, hostname,
+		state, start_time, end_time) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("tx.PrepareContext error: %w", err)
+	}
+	defer leaseStatement.Close()
+
+	count := 0
+	err = snapshotDB.ForEach(func(snapshot *snapshots.Snapshot) error {
+		// Snapshot times have nanosecond precision so two snapshots never
+		// share a key.
+		snapshotTime := snapshot.Time.UTC().Format(time.RFC3339Nano)
+		if _, err := snapshotStatement.ExecContext(ctx, snapshotTime); err != nil {
+			return fmt.Errorf("error inserting snapshot %v: %w", snapshotTime, err)
+		}
+
+		for i := range snapshot.Leases {
+			lease := &snapshot.Leases[i]
+			if _, err := leaseStatement.ExecContext(ctx,
+				snapshotTime,
+				lease.IPAddress,
+				lease.MACAddress,
+				lease.Hostname,
+				lease.State,
+				sqliteTime(lease.StartTime),
+				sqliteTime(lease.EndTime),
+			); err != nil {
+				return fmt.Errorf("error inserting snapshot lease %v: %w", lease.IPAddress, err)
+			}
+		}
+
+		count++
+		return nil
+	})
+
+	return count, err
+}
+
+// exportSQLiteOUIs copies the OUI prefixes in ouiDBFile, returning the
+// number copied.
+func exportSQLiteOUIs(ctx context.Context, tx *sql.Tx, ouiDBFile string) (int, error) {
+	ouiDB, err := oui.Open(ouiDBFile, true)
+	if err != nil {
+		return 0, err
+	}
+	defer ouiDB.Close()
+
+	statement, err := tx.PrepareContext(ctx, `INSERT INTO oui (prefix, organization) VALUES (?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("tx.PrepareContext error: %w", err)
+	}
+	defer statement.Close()
+
+	count := 0
+	err = ouiDB.ForEach(func(prefix string, organization string) error {
+		if _, err := statement.ExecContext(ctx, prefix, organization); err != nil {
+			return fmt.Errorf("error inserting OUI %v: %w", prefix, err)
+		}
+		count++
+		return nil
+	})
+
+	return count, err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/dhcpdconf"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// freeAddress is an address within a dhcpd.conf range with no lease that
+// is in use. lastLease is the most recent lease of the address, or nil if it
+// has never been leased.
+type freeAddress struct {
+	ipAddress net.IP
+	subnet    *net.IPNet
+	lastLease *leases.Lease
+}
+
+var freeAddressColumns = []string{"IP", "Subnet", "Last MAC", "Last Hostname", "Last End Time"}
+
+func (address *freeAddress) columnValues() []string {
+	values := []string{address.ipAddress.String(), address.subnet.String(), "", "", ""}
+	if address.lastLease != nil {
+		values[2] = address.lastLease.MACAddress.String()
+		values[3] = address.lastLease.Hostname
+		values[4] = formatEndTime(address.lastLease)
+	}
+	return values
+}
+
+// leaseInUse reports whether lease keeps its address from being handed out,
+// or was released or ended within excludeEndedWithin before now.
+func leaseInUse(lease *leases.Lease, now time.Time, excludeEndedWithin time.Duration) bool {
+	switch lease.GetState(now) {
+	case leases.Past, leases.Released:
+		return excludeEndedWithin > 0 && !lease.EndTime.Before(now.Add(-excludeEndedWithin))
+	}
+	return true
+}
+
+// findFreeAddresses returns the addresses in the ranges of dhcpdConf whose
+// leases in leaseMap are not in use, in range order.
+func findFreeAddresses(dhcpdConf *dhcpdconf.Config, leaseMap leases.LeaseMap, now time.Time, excludeEndedWithin time.Duration) []freeAddress {
+	var freeAddresses []freeAddress
+	for _, subnet := range dhcpdConf.Subnets {
+		for _, r := range subnet.Ranges {
+			start := r.Start.To4()
+			for i := uint64(0); i < r.Size(); i++ {
+				ipAddress := make(net.IP, net.IPv4len)
+				copy(ipAddress, start)
+				addToIPv4(ipAddress, uint32(i))
+
+				lease := leaseMap[ipAddress.String()]
+				if lease != nil && leaseInUse(lease, now, excludeEndedWithin) {
+					continue
+				}
+
+				freeAddresses = append(freeAddresses, freeAddress{
+					ipAddress: ipAddress,
+					subnet:    subnet.Network,
+					lastLease: lease,
+				})
+			}
+		}
+	}
+	return freeAddresses
+}
+
+// addToIPv4 adds n to the 4 byte address ip in place.
+func addToIPv4(ip net.IP, n uint32) {
+	value := uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+	value += n
+	ip[0], ip[1], ip[2], ip[3] = byte(value>>24), byte(value>>16), byte(value>>8), byte(value)
+}
+
+func printFreeAddresses(freeAddresses []freeAddress) {
+	cellRows := make([][]string, 0, len(freeAddresses))
+	for i := range freeAddresses {
+		cellRows = append(cellRows, freeAddresses[i].columnValues())
+	}
+	printTable(freeAddressColumns, cellRows)
+
+	reportPrintf("")
+	reportPrintf("%v free addresses", len(freeAddresses))
+}
+
+func runFree(ctx context.Context, opts *options, excludeEndedWithin time.Duration) error {
+	if opts.dhcpdConfFile == "" {
+		return errors.New("free requires -dhcpd-conf to find configured ranges")
+	}
+
+	leaseMap, dhcpdConf, err := readLeasesFile(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	freeAddresses := findFreeAddresses(dhcpdConf, leaseMap, time.Now(), excludeEndedWithin)
+	if anonymizer := newAnonymizer(opts); anonymizer != nil {
+		for i := range freeAddresses {
+			if freeAddresses[i].lastLease != nil {
+				freeAddresses[i].lastLease = anonymizer.lease(freeAddresses[i].lastLease)
+			}
+		}
+	}
+
+	if opts.outputFormat == defaultOutputFormat {
+		printFreeAddresses(freeAddresses)
+		return nil
+	}
+
+	cellRows := make([][]string, 0, len(freeAddresses))
+	for i := range freeAddresses {
+		cellRows = append(cellRows, freeAddresses[i].columnValues())
+	}
+	return writeTabularOutput(freeAddressColumns, cellRows, opts.outputFormat, opts.outputFile)
+}
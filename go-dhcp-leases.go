@@ -1,356 +1,248 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
-	"net"
+	"io"
+	"log/slog"
 	"os"
-	"sort"
-	"strings"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
-	"github.com/boltdb/bolt"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/dhcpdconf"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/oui"
 )
 
 var gitCommit string
 
-const (
-	defaultLeasesFile       = "/var/lib/dhcp/dhcpd.leases"
-	defaultOuiFile          = "/usr/local/etc/oui.txt"
-	ouiDBFile               = "./oui.db"
-	ouiDBWriteTXSize        = 1000
-	ouiToOrganizationBucket = "ouiToOrganization"
-	leaseTimeFormatString   = "2006/01/02 15:04:05;"
-	ouputTimeFormatString   = "2006/01/02 15:04:05 -0700"
-)
+const ouputTimeFormatString = "2006/01/02 15:04:05 -0700"
 
-func isHexDigits(s string) bool {
-	for _, r := range s {
-		if !(('0' <= r && '9' >= r) || ('a' <= r && 'f' >= r) || ('A' <= r && 'F' >= r)) {
-			return false
-		}
+func createOuiDB(ctx context.Context, opts *options) error {
+	ouiDB, err := oui.Open(opts.ouiDBFile, opts.ouiInfo)
+	if err != nil {
+		return err
 	}
-	return true
-}
+	defer ouiDB.Close()
 
-func createOuiDB() {
-	ouiFile := defaultOuiFile
-	if envValue, ok := os.LookupEnv("OUI_FILE"); ok {
-		ouiFile = envValue
+	if opts.ouiInfo {
+		return printOuiDBInfo(ouiDB, opts)
 	}
 
-	db, err := bolt.Open(ouiDBFile, 0600, nil)
-	if err != nil {
-		log.Fatalf("bolt.Open error %v", err)
+	if opts.ouiDownload {
+		return downloadOuiFile(ctx, opts, ouiDB)
 	}
-	defer db.Close()
 
-	log.Printf("reading %v", ouiFile)
+	return importOuiFile(ctx, opts, ouiDB, false)
+}
+
+// importOuiFile imports opts.ouiFile into ouiDB, recording its SHA-256
+// checksum and modification time for rebuildOuiDBIfChanged. If replace is
+// set, the prefixes of earlier imports are removed; otherwise they are kept,
+// so several registry files can be combined.
+func importOuiFile(ctx context.Context, opts *options, ouiDB *oui.OUIDB, replace bool) error {
+	ouiFile := opts.ouiFile
+
+	slog.Info("reading OUI file", "path", ouiFile)
 	file, err := os.OpenFile(ouiFile, os.O_RDONLY, os.ModePerm)
 	if err != nil {
-		log.Fatalf("Failed to open file %v %s\n", ouiFile, err)
+		return fmt.Errorf("failed to open file %v: %w", ouiFile, err)
 	}
 	defer file.Close()
 
-	ouiToOrganizationToInsert := make(map[string]string)
-
-	insertIntoDB := func() {
-		log.Printf("running update tx len(ouiToOrganizationToInsert) = %v", len(ouiToOrganizationToInsert))
-
-		if err := db.Update(func(tx *bolt.Tx) error {
-
-			bucket, err := tx.CreateBucketIfNotExists([]byte(ouiToOrganizationBucket))
-			if err != nil {
-				return err
-			}
-
-			for key, value := range ouiToOrganizationToInsert {
-				if err = bucket.Put([]byte(key), []byte(value)); err != nil {
-					return err
-				}
-			}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file %v: %w", ouiFile, err)
+	}
 
-			return nil
-		}); err != nil {
-			log.Fatalf("db.Update error %v", err)
-		}
+	hash := sha256.New()
+	reader, err := decompressingReader(io.TeeReader(file, hash))
+	if err != nil {
+		return fmt.Errorf("error reading %v: %w", ouiFile, err)
+	}
 
-		ouiToOrganizationToInsert = make(map[string]string)
+	// Record an absolute path so rebuildOuiDBIfChanged can tell whether
+	// -oui-file is the same file when run from another directory.
+	source, err := filepath.Abs(ouiFile)
+	if err != nil {
+		source = ouiFile
 	}
 
-	lineNumber := 0
-	scanner := bufio.NewScanner(file)
+	importContext := ouiDB.ImportContext
+	combined := ""
+	if replace {
+		importContext = ouiDB.ReplaceContext
+	} else if combined, err = combinedOuiDBMetadata(ouiDB, source); err != nil {
+		return err
+	}
 
-	for scanner.Scan() {
-		lineNumber++
+	lineNumber, err := importContext(ctx, reader)
+	if err != nil {
+		return fmt.Errorf("error importing %v: %w", ouiFile, err)
+	}
 
-		line := strings.TrimSpace(scanner.Text())
+	slog.Info("read OUI file", "path", ouiFile, "lines", lineNumber)
 
-		if len(line) < 23 {
-			continue
-		}
+	return recordOuiDBMetadata(ouiDB, opts.ouiDBFile, map[string]string{
+		ouiSourceMetadataKey:        source,
+		ouiSourceHashMetadataKey:    hex.EncodeToString(hash.Sum(nil)),
+		ouiSourceModTimeMetadataKey: fileInfo.ModTime().Format(time.RFC3339Nano),
+		ouiCombinedMetadataKey:      combined,
+	})
+}
 
-		ouiString := line[0:6]
-		if !isHexDigits(ouiString) {
-			continue
-		}
+// readLeasesFile reads the leases selected by opts, recording their MACs in
+// the device inventory if opts.recordDevices is set and opts.ouiMemory is
+// not, and adding static leases from opts.dhcpdConfFile if set. The parsed
+// dhcpd.conf is also returned, or nil if opts.dhcpdConfFile is not set.
+func readLeasesFile(ctx context.Context, opts *options) (leases.LeaseMap, *dhcpdconf.Config, error) {
+	return readLeasesFileRecords(ctx, opts, nil)
+}
 
-		ouiKeyString := strings.ToLower(ouiString[0:2] + ":" + ouiString[2:4] + ":" + ouiString[4:6])
-		organization := line[22:]
+// readLeasesFileRecords is like readLeasesFile, also calling record, if not
+// nil, with a copy of each lease record as it is parsed, so callers needing
+// every record do not parse the leases again.
+func readLeasesFileRecords(ctx context.Context, opts *options, record func(leases.Lease)) (leases.LeaseMap, *dhcpdconf.Config, error) {
+	leaseMap := make(leases.LeaseMap)
+	observations := make(deviceObservations)
 
-		ouiToOrganizationToInsert[ouiKeyString] = organization
-		if len(ouiToOrganizationToInsert) >= ouiDBWriteTXSize {
-			insertIntoDB()
+	if err := parseLeases(ctx, opts, func(lease leases.Lease) error {
+		if record != nil {
+			record(lease)
 		}
-
+		leaseMap.Add(&lease)
+		observations.observe(&lease)
+		return nil
+	}); err != nil {
+		return nil, nil, err
 	}
 
-	if err = scanner.Err(); err != nil {
-		log.Fatalf("scanner error %v", err)
-	}
+	recordObservedDevices(opts, observations)
 
-	if len(ouiToOrganizationToInsert) > 0 {
-		insertIntoDB()
+	dhcpdConf, err := readDhcpdConf(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dhcpdConf != nil {
+		addStaticLeases(dhcpdConf, leaseMap)
 	}
 
-	log.Printf("read %v lines from %v", lineNumber, ouiFile)
+	return leaseMap, dhcpdConf, nil
 }
 
-type leaseState int
-
-const (
-	// Abandoned lease
-	Abandoned leaseState = iota
-	// Future lease
-	Future
-	// Current lease
-	Current
-	// Past lease
-	Past
-)
-
-var leaseStates = []leaseState{Abandoned, Future, Current, Past}
-
-func (leaseState leaseState) String() string {
-	switch leaseState {
-	case Abandoned:
-		return "Abandoned"
-	case Future:
-		return "Future"
-	case Current:
-		return "Current"
-	case Past:
-		return "Past"
+// recordObservedDevices records observations in the device inventory if
+// -record-devices is set.
+func recordObservedDevices(opts *options, observations deviceObservations) {
+	if opts.recordDevices && !opts.ouiMemory {
+		if err := recordDevices(opts, observations); err != nil {
+			slog.Warn("device inventory error", "err", err)
+		}
 	}
-	return "UNKNOWN"
 }
 
-type leaseInfo struct {
-	ipAddress  net.IP
-	count      int
-	startTime  time.Time
-	endTime    time.Time
-	clttTime   time.Time
-	macAddress net.HardwareAddr
-	hostname   string
-	abandoned  bool
-}
+// readDhcpdConf parses the dhcpd.conf of opts, or returns nil if none is
+// configured.
+func readDhcpdConf(opts *options) (*dhcpdconf.Config, error) {
+	if opts.dhcpdConfFile == "" {
+		return nil, nil
+	}
 
-func (li *leaseInfo) String() string {
-	return fmt.Sprintf("ipAddress=%v startTime=%v endTime=%v clttTime=%v macAddress=%v hostname=%v", li.ipAddress.String(), li.startTime, li.endTime, li.clttTime, li.macAddress.String(), li.hostname)
+	slog.Info("reading dhcpd.conf", "path", opts.dhcpdConfFile)
+	return dhcpdconf.ParseFile(opts.dhcpdConfFile)
 }
 
-func (li *leaseInfo) GetState(now time.Time) leaseState {
-	switch {
-	case li.abandoned:
-		return Abandoned
-	case now.Before(li.startTime):
-		return Future
-	case (now.After(li.startTime) || now.Equal(li.startTime)) && (now.Before(li.endTime) || now.Equal(li.endTime)):
-		return Current
-	default:
-		return Past
+// addStaticLeases adds a static lease to leaseMap for each fixed address in
+// the host declarations of config that has no lease records.
+func addStaticLeases(config *dhcpdconf.Config, leaseMap leases.LeaseMap) {
+	for _, lease := range staticLeases(config) {
+		if _, ok := leaseMap[lease.IPAddress.String()]; ok {
+			continue
+		}
+		leaseMap.Add(lease)
 	}
 }
 
-type leaseMap map[string]*leaseInfo
-
-func readLeasesFile() leaseMap {
-	leaseMap := make(leaseMap)
+// staticLeases returns a static lease for each fixed address in the host
+// declarations of config.
+func staticLeases(config *dhcpdconf.Config) []*leases.Lease {
+	var staticLeases []*leases.Lease
+	for _, host := range config.Hosts {
+		hostname := host.Hostname
+		if hostname == "" {
+			hostname = host.Name
+		}
 
-	leasesFile := defaultLeasesFile
-	if envValue, ok := os.LookupEnv("DHCP_LEASES_FILE"); ok {
-		leasesFile = envValue
+		for _, fixedAddress := range host.FixedAddresses {
+			staticLeases = append(staticLeases, &leases.Lease{
+				IPAddress:  fixedAddress,
+				MACAddress: host.MACAddress,
+				Hostname:   hostname,
+				Static:     true,
+			})
+		}
 	}
+	return staticLeases
+}
 
-	log.Printf("reading %v", leasesFile)
-	file, err := os.OpenFile(leasesFile, os.O_RDONLY, os.ModePerm)
+func readLeaseReport(ctx context.Context, opts *options) (*leaseReport, error) {
+	leaseMap, dhcpdConf, err := readLeasesFile(ctx, opts)
 	if err != nil {
-		log.Fatalf("Failed to open file %v %s\n", leasesFile, err)
+		return nil, err
 	}
-	defer file.Close()
 
-	lineNumber := 0
-	var currentIP net.IP
-	var currentLeaseInfo *leaseInfo
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lineNumber++
-
-		line := strings.TrimSpace(scanner.Text())
-
-		if currentLeaseInfo == nil {
-			if strings.HasPrefix(line, "lease ") && strings.HasSuffix(line, " {") {
-				currentIP = net.ParseIP(strings.Split(line, " ")[1])
-				currentLeaseInfo = &leaseInfo{
-					ipAddress: currentIP,
-					count:     1,
-				}
-			}
-		} else {
-			switch {
-			case strings.HasPrefix(line, "starts"):
-				split := strings.Split(line, " ")
-				timeString := split[2] + " " + split[3]
-				startTime, err := time.ParseInLocation(leaseTimeFormatString, timeString, time.UTC)
-				if err != nil {
-					log.Fatalf("error parsing start timeString '%v' %v", timeString, err)
-				}
-				currentLeaseInfo.startTime = startTime
-			case strings.HasPrefix(line, "ends"):
-				split := strings.Split(line, " ")
-				timeString := split[2] + " " + split[3]
-				endTime, err := time.ParseInLocation(leaseTimeFormatString, timeString, time.UTC)
-				if err != nil {
-					log.Fatalf("error parsing end timeString '%v' %v", timeString, err)
-				}
-				currentLeaseInfo.endTime = endTime
-			case strings.HasPrefix(line, "cltt"):
-				split := strings.Split(line, " ")
-				timeString := split[2] + " " + split[3]
-				clttTime, err := time.ParseInLocation(leaseTimeFormatString, timeString, time.UTC)
-				if err != nil {
-					log.Fatalf("error parsing cltt timeString '%v' %v", timeString, err)
-				}
-				currentLeaseInfo.clttTime = clttTime
-			case strings.HasPrefix(line, "hardware ethernet "):
-				macString := strings.Split(strings.Split(line, " ")[2], ";")[0]
-				macAddress, err := net.ParseMAC(macString)
-				if err != nil {
-					log.Fatalf("error parsing macString '%v' %v", macString, err)
-				}
-				currentLeaseInfo.macAddress = macAddress
-			case strings.HasPrefix(line, "client-hostname "):
-				hostname := strings.Split(line, "\"")[1]
-				currentLeaseInfo.hostname = hostname
-			case strings.HasPrefix(line, "abandoned;"):
-				currentLeaseInfo.abandoned = true
-			case strings.HasPrefix(line, "}"):
-				if currentLeaseInfo != nil {
-					ipString := currentIP.String()
-					existingLeaseInfo, ok := leaseMap[ipString]
-					if ok {
-						totalCount := currentLeaseInfo.count + existingLeaseInfo.count
-						if currentLeaseInfo.endTime.After(existingLeaseInfo.endTime) {
-							currentLeaseInfo.count = totalCount
-							leaseMap[ipString] = currentLeaseInfo
-						} else {
-							existingLeaseInfo.count = totalCount
-						}
-					} else {
-						leaseMap[ipString] = currentLeaseInfo
-					}
-				}
-				currentLeaseInfo = nil
-			}
-		}
-	}
+	return buildLeaseReport(ctx, opts, leaseMap, dhcpdConf)
+}
 
-	if err = scanner.Err(); err != nil {
-		log.Fatalf("scan file error: %v", err)
+func printLeases(ctx context.Context, opts *options) error {
+	if opts.outputFormat == "jsonl" {
+		return streamLeasesJSONL(ctx, opts)
 	}
 
-	log.Printf("read %v lines from %v", lineNumber, leasesFile)
-
-	return leaseMap
-}
-
-func printLeaseMap(leaseMap leaseMap) {
-	db, err := bolt.Open(ouiDBFile, 0600, &bolt.Options{ReadOnly: true})
+	report, err := readLeaseReport(ctx, opts)
 	if err != nil {
-		log.Fatalf("bolt.Open error %v", err)
+		return err
 	}
-	defer db.Close()
 
-	const formatString = "%-17v%-19v%-6v%-22v%-10v%-27v%-27v%-24v"
-
-	log.Printf("")
-	log.Printf(formatString, "IP", "MAC", "Count", "Hostname", "State", "End Time", "Last Transaction Time", "Organization")
-	log.Printf(strings.Repeat("=", 180))
+	return printCheckedLeaseReport(ctx, report, opts)
+}
 
-	ipAddresses := make([]net.IP, 0, len(leaseMap))
-	for _, leaseInfo := range leaseMap {
-		ipAddresses = append(ipAddresses, leaseInfo.ipAddress)
+// printCheckedLeaseReport outputs report, pushes it to InfluxDB if enabled,
+// and runs the checks enabled by opts.
+func printCheckedLeaseReport(ctx context.Context, report *leaseReport, opts *options) error {
+	if err := outputLeaseReport(report, opts.outputFormat, opts.outputFile); err != nil {
+		return err
 	}
 
-	sort.Slice(ipAddresses, func(i int, j int) bool {
-		return (bytes.Compare(ipAddresses[i], ipAddresses[j]) < 0)
-	})
-
-	leaseStateToCount := make(map[leaseState]int)
-
-	now := time.Now()
-
-	for _, ipAddress := range ipAddresses {
-		ipString := ipAddress.String()
-		leaseInfo := leaseMap[ipString]
-		macString := leaseInfo.macAddress.String()
-		ouiKeyString := strings.ToLower(macString[0:8])
-		organization := "UNKNOWN"
-
-		if err := db.View(func(tx *bolt.Tx) error {
-			if value := tx.Bucket([]byte(ouiToOrganizationBucket)).Get([]byte(ouiKeyString)); value != nil {
-				organization = string(value)
-			}
-			return nil
-		}); err != nil {
-			log.Fatalf("db.View error %v", err)
+	if opts.influxURL != "" {
+		if err := pushInfluxLines(ctx, report, opts.influxURL, opts.influxToken); err != nil {
+			return err
 		}
-
-		leaseState := leaseInfo.GetState(now)
-		leaseStateToCount[leaseState]++
-
-		log.Printf(
-			formatString,
-			ipString,
-			macString,
-			leaseInfo.count,
-			leaseInfo.hostname,
-			leaseState,
-			leaseInfo.endTime.Local().Format(ouputTimeFormatString),
-			leaseInfo.clttTime.Local().Format(ouputTimeFormatString),
-			organization)
 	}
 
-	log.Printf("")
-	log.Printf("%v leases with unique IPs:", len(leaseMap))
-	for _, state := range leaseStates {
-		log.Printf("\t%v %v", leaseStateToCount[state], state)
-	}
+	return checkReport(report, opts)
 }
 
 func main() {
-	log.SetFlags(0)
+	setupLogging()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	// Restore the default signal behavior once shutdown starts, so a second
+	// SIGINT or SIGTERM stops a shutdown that is taking too long.
+	context.AfterFunc(ctx, stop)
+
+	err := runCommand(ctx, os.Args[1:])
 
-	log.Printf("gitCommit: %v", gitCommit)
+	stop()
 
-	if (len(os.Args) == 2) && (os.Args[1] == "-createdb") {
-		log.Printf("createdb mode")
-		createOuiDB()
-	} else {
-		leaseMap := readLeasesFile()
-		printLeaseMap(leaseMap)
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	} else if err != nil {
+		slog.Error("command failed", "err", err)
+		os.Exit(1)
 	}
 }
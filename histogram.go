@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+var histogramOutputFormats = []string{"table", "json"}
+
+// defaultHistogramBuckets are the upper bounds of the histogram buckets,
+// around common lease times.
+var defaultHistogramBuckets = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+	4 * time.Hour,
+	8 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+	2 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+}
+
+// histogramBarWidth is the width of the bar of the largest bucket.
+const histogramBarWidth = 40
+
+// parseHistogramBucket parses a bucket bound, a Go duration such as 90m or a
+// number of days such as 7d.
+func parseHistogramBucket(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		count, err := strconv.Atoi(days)
+		if err != nil || count <= 0 {
+			return 0, fmt.Errorf("invalid bucket '%v'", value)
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid bucket '%v'", value)
+	}
+	return duration, nil
+}
+
+// parseHistogramBuckets parses -buckets, returning the default buckets if
+// none are given.
+func parseHistogramBuckets(values []string) ([]time.Duration, error) {
+	if len(values) == 0 {
+		return defaultHistogramBuckets, nil
+	}
+
+	bounds := make([]time.Duration, 0, len(values))
+	for _, value := range values {
+		bound, err := parseHistogramBucket(value)
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, bound)
+	}
+	sort.Slice(bounds, func(i int, j int) bool {
+		return bounds[i] < bounds[j]
+	})
+	return bounds, nil
+}
+
+// histogramBucket counts the durations from Min up to but not including
+// Max. The last bucket has no Max.
+type histogramBucket struct {
+	MinSeconds float64 `json:"minSeconds"`
+	MaxSeconds float64 `json:"maxSeconds,omitempty"`
+	Count      int     `json:"count"`
+
+	min time.Duration
+	max time.Duration
+}
+
+func (bucket *histogramBucket) label() string {
+	switch {
+	case bucket.max == 0:
+		return ">= " + formatShortDuration(bucket.min)
+	case bucket.min == 0:
+		return "< " + formatShortDuration(bucket.max)
+	}
+	return formatShortDuration(bucket.min) + " - " + formatShortDuration(bucket.max)
+}
+
+// durationHistogram counts durations in buckets bounded by bounds.
+type durationHistogram struct {
+	Buckets []histogramBucket `json:"buckets"`
+	Total   int               `json:"total"`
+}
+
+func newDurationHistogram(bounds []time.Duration) *durationHistogram {
+	histogram := &durationHistogram{
+		Buckets: make([]histogramBucket, 0, len(bounds)+1),
+	}
+	var previous time.Duration
+	for _, bound := range bounds {
+		if bound == previous {
+			continue
+		}
+		histogram.Buckets = append(histogram.Buckets, histogramBucket{
+			MinSeconds: previous.Seconds(),
+			MaxSeconds: bound.Seconds(),
+			min:        previous,
+			max:        bound,
+		})
+		previous = bound
+	}
+	histogram.Buckets = append(histogram.Buckets, histogramBucket{
+		MinSeconds: previous.Seconds(),
+		min:        previous,
+	})
+	return histogram
+}
+
+func (histogram *durationHistogram) add(duration time.Duration) {
+	histogram.Total++
+	i := sort.Search(len(histogram.Buckets)-1, func(i int) bool {
+		return duration < histogram.Buckets[i].max
+	})
+	histogram.Buckets[i].Count++
+}
+
+// leaseHistograms holds the histograms printed by histogram, in the form
+// written by histogram -output json.
+type leaseHistograms struct {
+	// Durations are the configured lengths of leases, ends - starts.
+	Durations *durationHistogram `json:"durations"`
+	// Remaining is the time left on Current leases.
+	Remaining *durationHistogram `json:"remaining"`
+}
+
+// computeLeaseHistograms counts the durations of the leases of report with
+// a start and end time, and the remaining time of its Current leases.
+// Static leases and leases that never end are not counted.
+func computeLeaseHistograms(report *leaseReport, bounds []time.Duration, now time.Time) *leaseHistograms {
+	histograms := &leaseHistograms{
+		Durations: newDurationHistogram(bounds),
+		Remaining: newDurationHistogram(bounds),
+	}
+
+	for i := range report.rows {
+		row := &report.rows[i]
+		lease := row.lease
+		if lease.Static || lease.EndsNever {
+			continue
+		}
+
+		if !lease.StartTime.IsZero() && !lease.EndTime.Before(lease.StartTime) {
+			histograms.Durations.add(lease.EndTime.Sub(lease.StartTime))
+		}
+		if row.state == leases.Current {
+			histograms.Remaining.add(lease.EndTime.Sub(now))
+		}
+	}
+
+	return histograms
+}
+
+func printDurationHistogram(title string, histogram *durationHistogram) {
+	largest := 0
+	for i := range histogram.Buckets {
+		largest = max(largest, histogram.Buckets[i].Count)
+	}
+
+	cellRows := make([][]string, 0, len(histogram.Buckets))
+	for i := range histogram.Buckets {
+		bucket := &histogram.Buckets[i]
+		bar := ""
+		if bucket.Count > 0 {
+			bar = strings.Repeat("#", max(1, bucket.Count*histogramBarWidth/largest))
+		}
+		cellRows = append(cellRows, []string{bucket.label(), strconv.Itoa(bucket.Count), bar})
+	}
+	printTable([]string{title, "Leases", ""}, cellRows)
+}
+
+func outputLeaseHistograms(histograms *leaseHistograms, outputFormat string, outputFile string) error {
+	switch outputFormat {
+	case "table":
+		printDurationHistogram("Lease Duration", histograms.Durations)
+		printDurationHistogram("Remaining Time", histograms.Remaining)
+		return nil
+	case "json":
+		if err := writeOutput(outputFile, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(histograms)
+		}); err != nil {
+			return fmt.Errorf("error writing json output: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format '%v'", outputFormat)
+}
+
+func setupHistogramCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	finishFilters := registerFilterFlags(flagSet, &opts)
+	flagSet.StringVar(&opts.outputFormat, "output", defaultOutputFormat, "output format: "+strings.Join(histogramOutputFormats, ", "))
+	flagSet.StringVar(&opts.outputFile, "out", "", "write non-table output to this file instead of stdout")
+	var buckets stringListFlag
+	flagSet.Var(&buckets, "buckets", "comma-separated upper bounds of the histogram buckets, as durations such as 30m, 12h, or 7d (default 1m,5m,15m,30m,1h,2h,4h,8h,12h,1d,2d,7d,30d)")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if err := finishFilters(); err != nil {
+			return err
+		}
+		bounds, err := parseHistogramBuckets(buckets)
+		if err != nil {
+			return err
+		}
+
+		report, err := readLeaseReport(ctx, &opts)
+		if err != nil {
+			return err
+		}
+
+		return outputLeaseHistograms(computeLeaseHistograms(report, bounds, time.Now()), opts.outputFormat, opts.outputFile)
+	}
+}
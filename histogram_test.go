@@ -0,0 +1,42 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseHistogramBuckets(t *testing.T) {
+	got, err := parseHistogramBuckets([]string{"7d", "90m", "1h"})
+	if err != nil {
+		t.Fatalf("parseHistogramBuckets error: %v", err)
+	}
+	if want := []time.Duration{time.Hour, 90 * time.Minute, 7 * 24 * time.Hour}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, value := range []string{"0d", "-1h", "xd", "forever"} {
+		if _, err := parseHistogramBucket(value); err == nil {
+			t.Errorf("parseHistogramBucket(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestDurationHistogram(t *testing.T) {
+	histogram := newDurationHistogram([]time.Duration{time.Minute, time.Hour, time.Hour})
+	for _, duration := range []time.Duration{0, 59 * time.Second, time.Minute, 30 * time.Minute, time.Hour, 48 * time.Hour} {
+		histogram.add(duration)
+	}
+
+	var counts []int
+	for _, bucket := range histogram.Buckets {
+		counts = append(counts, bucket.Count)
+	}
+	// Duplicate bounds are merged, and the last bucket has no upper bound.
+	if want := []int{2, 2, 2}; !slices.Equal(counts, want) {
+		t.Errorf("got bucket counts %v, want %v", counts, want)
+	}
+	if histogram.Total != 6 {
+		t.Errorf("got total %v, want 6", histogram.Total)
+	}
+}
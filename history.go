@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// historyKey returns the value history records are grouped by.
+type historyKey func(lease *leases.Lease) []byte
+
+func historyKeyForGroupBy(groupBy string) (historyKey, error) {
+	switch groupBy {
+	case "ip":
+		return func(lease *leases.Lease) []byte {
+			return lease.IPAddress.To16()
+		}, nil
+	case "mac":
+		return func(lease *leases.Lease) []byte {
+			return lease.MACAddress
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown history grouping '%v'", groupBy)
+}
+
+// readLeaseHistory returns every lease record in the leases file without
+// collapsing records for the same IP, grouped by key and ordered by start time.
+func readLeaseHistory(ctx context.Context, opts *options, key historyKey) ([]*leases.Lease, error) {
+	var leaseList []*leases.Lease
+
+	if err := parseLeases(ctx, opts, func(lease leases.Lease) error {
+		leaseList = append(leaseList, &lease)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(leaseList, func(i int, j int) bool {
+		if c := bytes.Compare(key(leaseList[i]), key(leaseList[j])); c != 0 {
+			return c < 0
+		}
+		return leaseList[i].StartTime.Before(leaseList[j].StartTime)
+	})
+
+	return leaseList, nil
+}
+
+var historyColumns = []string{"IP", "MAC", "Hostname", "State", "Start Time", "End Time", "Organization"}
+
+func printLeaseHistory(report *leaseReport, key historyKey) {
+	cellRows := make([][]string, 0, len(report.rows))
+	for i := range report.rows {
+		row := &report.rows[i]
+		cellRows = append(cellRows, []string{
+			row.lease.AddressString(),
+			row.lease.MACAddress.String(),
+			row.lease.Hostname,
+			row.state.String(),
+			formatDisplayTime(row.lease.StartTime),
+			formatEndTime(row.lease),
+			row.organization,
+		})
+	}
+	layout := newTableLayout(historyColumns, cellRows, terminalWidth())
+
+	for i := range report.rows {
+		row := &report.rows[i]
+
+		if i == 0 || !bytes.Equal(key(row.lease), key(report.rows[i-1].lease)) {
+			reportPrintf("")
+			layout.printHeader(historyColumns)
+		}
+
+		line := layout.formatRow(cellRows[i])
+		if report.colorize {
+			line = colorizeState(line, row.state)
+		}
+		reportPrintf("%v", line)
+	}
+
+	reportPrintf("")
+	reportPrintf("%v lease records", len(report.rows))
+}
+
+func runHistory(ctx context.Context, opts *options, groupBy string, address string) error {
+	key, err := historyKeyForGroupBy(groupBy)
+	if err != nil {
+		return err
+	}
+
+	if address != "" {
+		if ipAddress := net.ParseIP(address); ipAddress != nil {
+			opts.filters = append(opts.filters, func(row *leaseReportRow) bool {
+				return row.lease.IPAddress.Equal(ipAddress)
+			})
+		} else if macAddress, err := net.ParseMAC(address); err == nil {
+			opts.filters = append(opts.filters, func(row *leaseReportRow) bool {
+				return bytes.Equal(row.lease.MACAddress, macAddress)
+			})
+		} else {
+			return fmt.Errorf("invalid IP or MAC address '%v'", address)
+		}
+	}
+
+	leaseList, err := readLeaseHistory(ctx, opts, key)
+	if err != nil {
+		return err
+	}
+
+	report, err := buildLeaseReportFromList(ctx, opts, leaseList)
+	if err != nil {
+		return err
+	}
+	newAnonymizer(opts).rows(report.rows)
+
+	if address != "" && len(report.rows) == 0 {
+		return fmt.Errorf("%w for %v", errNotFound, address)
+	}
+
+	if opts.outputFormat == defaultOutputFormat && report.formatTemplate == nil {
+		printLeaseHistory(report, key)
+		return nil
+	}
+
+	return outputLeaseReport(report, opts.outputFormat, opts.outputFile)
+}
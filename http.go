@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// httpLeaseSource reads a leases file from an HTTP(S) URL. Credentials in
+// the URL are sent with basic auth, and a non-empty token is sent as a
+// bearer token.
+type httpLeaseSource struct {
+	url    *url.URL
+	token  string
+	strict bool
+}
+
+func newHTTPLeaseSource(rawURL string, token string, strict bool) (*httpLeaseSource, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %v: %w", rawURL, err)
+	}
+	if parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid url %v: missing host", rawURL)
+	}
+
+	return &httpLeaseSource{
+		url:    parsedURL,
+		token:  token,
+		strict: strict,
+	}, nil
+}
+
+func (source *httpLeaseSource) String() string {
+	return source.url.Redacted()
+}
+
+func (source *httpLeaseSource) ParseLeases(ctx context.Context, fn func(leases.Lease) error) error {
+	slog.Info("reading leases", "source", source)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, source.url.String(), nil)
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext error: %w", err)
+	}
+	if source.token != "" {
+		request.Header.Set("Authorization", "Bearer "+source.token)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("error fetching %v: %w", source, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("error fetching %v: %v", source, response.Status)
+	}
+
+	return parseLeasesReader(ctx, source.String(), response.Body, source.strict, fn)
+}
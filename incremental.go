@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// errNotIncremental is returned by incrementalLeases.read when the lease
+// sources are not plain local dhcpd leases files, so they must be parsed in
+// full on every read.
+var errNotIncremental = errors.New("leases cannot be read incrementally")
+
+// incrementalLeases holds the leases parsed from local dhcpd leases files
+// and how far each file has been read, so later reads only parse the lease
+// blocks appended since. dhcpd only appends to a leases file until it
+// periodically rewrites it as a new file, which is detected by the file
+// identity changing or the file shrinking, and then every file is parsed
+// again.
+type incrementalLeases struct {
+	files map[string]*incrementalFile
+	// leaseMap holds the merged records of the files, without static leases
+	// from dhcpd.conf. It is never modified once returned, since reports
+	// built from it may still be in use.
+	leaseMap leases.LeaseMap
+}
+
+// incrementalFile is how far a leases file has been read.
+type incrementalFile struct {
+	info os.FileInfo
+	// offset is the end of the last complete top level block read; a block
+	// dhcpd is still writing is read again once it is complete.
+	offset int64
+	// lines is the number of lines before offset.
+	lines int
+}
+
+// openLeasesFile is a leases file opened for a read.
+type openLeasesFile struct {
+	path string
+	file *os.File
+	info os.FileInfo
+}
+
+// openLeasesFiles opens the leases files of opts, or returns
+// errNotIncremental if any of them is not a local file.
+func openLeasesFiles(opts *options) ([]openLeasesFile, error) {
+	if opts.keaDSN != "" {
+		return nil, errNotIncremental
+	}
+	paths, err := opts.leasesFilePaths()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if strings.Contains(path, "://") {
+			return nil, errNotIncremental
+		}
+	}
+
+	files := make([]openLeasesFile, 0, len(paths))
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			closeLeasesFiles(files)
+			return nil, fmt.Errorf("failed to open file %v: %w", path, err)
+		}
+		// Stat the open file, so a rewrite after the file was opened is
+		// seen by the next read rather than mixed into this one.
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			closeLeasesFiles(files)
+			return nil, fmt.Errorf("failed to stat file %v: %w", path, err)
+		}
+		files = append(files, openLeasesFile{path: path, file: file, info: info})
+	}
+	return files, nil
+}
+
+func closeLeasesFiles(files []openLeasesFile) {
+	for _, file := range files {
+		file.file.Close()
+	}
+}
+
+// appended reports whether every one of files is the same file last read,
+// at least as long as it was, so only its new blocks need to be parsed.
+func (inc *incrementalLeases) appended(files []openLeasesFile) bool {
+	if inc.leaseMap == nil || len(files) != len(inc.files) {
+		return false
+	}
+	for _, file := range files {
+		last, ok := inc.files[file.path]
+		if !ok {
+			return false
+		}
+		if !os.SameFile(last.info, file.info) {
+			slog.Info("leases file replaced, reading it in full", "path", file.path)
+			return false
+		}
+		if file.info.Size() < last.offset {
+			slog.Info("leases file truncated, reading it in full", "path", file.path)
+			return false
+		}
+	}
+	return true
+}
+
+// read returns the merged lease records of the leases files of opts,
+// parsing only the blocks appended since the last read when possible, and
+// calls observe with each newly parsed record. It returns errNotIncremental
+// if the files must be parsed with parseLeases instead.
+func (inc *incrementalLeases) read(ctx context.Context, opts *options, observe func(*leases.Lease)) (leases.LeaseMap, error) {
+	files, err := openLeasesFiles(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeLeasesFiles(files)
+
+	if !inc.appended(files) {
+		inc.files, inc.leaseMap = nil, nil
+
+		leaseMap := make(leases.LeaseMap)
+		readFiles := make(map[string]*incrementalFile, len(files))
+		for _, file := range files {
+			if ok, err := isPlainDhcpdLeasesFile(file.file); err != nil {
+				return nil, fmt.Errorf("error reading %v: %w", file.path, err)
+			} else if !ok {
+				return nil, errNotIncremental
+			}
+
+			readFile := &incrementalFile{info: file.info}
+			if err := readFile.read(ctx, file, opts.strict, func(lease *leases.Lease) {
+				leaseMap.Add(lease)
+				observe(lease)
+			}); err != nil {
+				return nil, err
+			}
+			readFiles[file.path] = readFile
+		}
+
+		inc.files, inc.leaseMap = readFiles, leaseMap
+		return leaseMap, nil
+	}
+
+	var leaseMap leases.LeaseMap
+	for _, file := range files {
+		readFile := inc.files[file.path]
+		readFile.info = file.info
+		if file.info.Size() == readFile.offset {
+			continue
+		}
+
+		if leaseMap == nil {
+			leaseMap = maps.Clone(inc.leaseMap)
+		}
+		if err := readFile.read(ctx, file, opts.strict, func(lease *leases.Lease) {
+			// Add updates the count of an existing record in place, so
+			// replace it with a copy first.
+			ipString := lease.IPAddress.String()
+			if existingLease, ok := leaseMap[ipString]; ok {
+				copiedLease := *existingLease
+				leaseMap[ipString] = &copiedLease
+			}
+			leaseMap.Add(lease)
+			observe(lease)
+		}); err != nil {
+			// The read position of the file is unknown, so start again.
+			inc.files, inc.leaseMap = nil, nil
+			return nil, err
+		}
+	}
+
+	if leaseMap == nil {
+		slog.Debug("no lease blocks appended, reusing parsed leases")
+		return inc.leaseMap, nil
+	}
+	inc.leaseMap = leaseMap
+	return leaseMap, nil
+}
+
+// isPlainDhcpdLeasesFile reports whether file is an uncompressed dhcpd
+// leases file, whose offsets are those of its lease blocks.
+func isPlainDhcpdLeasesFile(file *os.File) (bool, error) {
+	header := make([]byte, max(leases.FileFormatHeaderLength, len(xzMagic)))
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	header = header[:n]
+
+	if bytes.HasPrefix(header, gzipMagic) || bytes.HasPrefix(header, xzMagic) {
+		return false, nil
+	}
+	return leases.DetectFileFormat(header) == leases.DhcpdFormat, nil
+}
+
+// read parses the complete blocks of file after the offset of readFile,
+// calling add with each lease record, and advances the offset past them.
+func (readFile *incrementalFile) read(ctx context.Context, file openLeasesFile, strict bool, add func(*leases.Lease)) error {
+	if _, err := file.file.Seek(readFile.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking %v: %w", file.path, err)
+	}
+
+	blocks := &completeBlockReader{reader: bufio.NewReader(file.file)}
+	parser, problems := newSourceParser(file.path, strict)
+	parser.StartLine = readFile.lines
+	if err := parser.ParseLeasesContext(ctx, blocks, func(lease leases.Lease) error {
+		add(&lease)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("error parsing %v: %w", file.path, err)
+	}
+
+	slog.Info("read leases", "source", file.path, "offset", readFile.offset, "bytes", blocks.consumed, "lines", blocks.lines)
+	problems.log()
+
+	readFile.offset += blocks.consumed
+	readFile.lines += blocks.lines
+	return nil
+}
+
+// completeBlockReader reads the complete lines of a dhcpd leases file up to
+// the end of its last complete top level block, holding back a lease block
+// that dhcpd has not finished writing.
+type completeBlockReader struct {
+	reader *bufio.Reader
+	// block holds the lines of the current top level block.
+	block      []byte
+	blockLines int
+	depth      int
+	// pending holds complete blocks not yet returned by Read.
+	pending []byte
+	// consumed and lines count the bytes and lines of complete blocks.
+	consumed int64
+	lines    int
+	err      error
+}
+
+func (blocks *completeBlockReader) Read(p []byte) (int, error) {
+	for len(blocks.pending) == 0 {
+		if blocks.err != nil {
+			return 0, blocks.err
+		}
+
+		line, err := blocks.reader.ReadBytes('\n')
+		if err != nil {
+			// A final line without a newline is still being written.
+			blocks.err = err
+			continue
+		}
+
+		blocks.block = append(blocks.block, line...)
+		blocks.blockLines++
+		trimmed := bytes.TrimSpace(line)
+		switch {
+		case bytes.HasSuffix(trimmed, []byte("{")):
+			blocks.depth++
+		case bytes.HasPrefix(trimmed, []byte("}")) && blocks.depth > 0:
+			blocks.depth--
+		}
+		if blocks.depth == 0 {
+			blocks.pending = blocks.block
+			blocks.block = nil
+			blocks.consumed += int64(len(blocks.pending))
+			blocks.lines += blocks.blockLines
+			blocks.blockLines = 0
+		}
+	}
+
+	n := copy(p, blocks.pending)
+	blocks.pending = blocks.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// leaseBlock returns a dhcpd lease block for ip.
+func leaseBlock(ip string) string {
+	return "lease " + ip + " {\n  starts 5 2020/06/26 21:00:00;\n  ends 5 2020/06/26 22:00:00;\n}\n"
+}
+
+func TestCompleteBlockReader(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		text     string
+		wantText string
+	}{
+		{"complete", leaseBlock("10.0.0.1"), leaseBlock("10.0.0.1")},
+		{"partial line", leaseBlock("10.0.0.1") + "lease 10.0.0.2 {\n  starts", leaseBlock("10.0.0.1")},
+		{"unterminated block", leaseBlock("10.0.0.1") + "lease 10.0.0.2 {\n", leaseBlock("10.0.0.1")},
+		{"nested block", "failover peer \"a\" state {\n  my state {\n  }\n}\nlease", "failover peer \"a\" state {\n  my state {\n  }\n}\n"},
+		{"top level statements", "# comment\nserver-duid \"x\";\n", "# comment\nserver-duid \"x\";\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			blocks := &completeBlockReader{reader: bufio.NewReader(strings.NewReader(test.text))}
+			text, err := io.ReadAll(blocks)
+			if err != nil {
+				t.Fatalf("ReadAll error: %v", err)
+			}
+			if string(text) != test.wantText {
+				t.Errorf("got text %q, want %q", text, test.wantText)
+			}
+			wantConsumed, wantLines := int64(len(test.wantText)), strings.Count(test.wantText, "\n")
+			if blocks.consumed != wantConsumed || blocks.lines != wantLines {
+				t.Errorf("got consumed %v lines %v, want %v and %v", blocks.consumed, blocks.lines, wantConsumed, wantLines)
+			}
+		})
+	}
+}
+
+// incrementalTest reads a leases file in a temporary directory with an
+// incrementalLeases.
+type incrementalTest struct {
+	t           *testing.T
+	path        string
+	opts        *options
+	incremental incrementalLeases
+}
+
+func newIncrementalTest(t *testing.T) *incrementalTest {
+	path := filepath.Join(t.TempDir(), "dhcpd.leases")
+	return &incrementalTest{
+		t:    t,
+		path: path,
+		opts: &options{leasesFiles: stringListFlag{path}},
+	}
+}
+
+func (test *incrementalTest) write(text string) {
+	if err := os.WriteFile(test.path, []byte(text), 0644); err != nil {
+		test.t.Fatal(err)
+	}
+}
+
+func (test *incrementalTest) append(text string) {
+	file, err := os.OpenFile(test.path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(text); err != nil {
+		test.t.Fatal(err)
+	}
+}
+
+// read returns the sorted IPs of the merged leases and of the leases newly
+// parsed by the read.
+func (test *incrementalTest) read() (ips, observed []string) {
+	leaseMap, err := test.incremental.read(context.Background(), test.opts, func(lease *leases.Lease) {
+		observed = append(observed, lease.IPAddress.String())
+	})
+	if err != nil {
+		test.t.Fatalf("read error: %v", err)
+	}
+	for ip := range leaseMap {
+		ips = append(ips, ip)
+	}
+	slices.Sort(ips)
+	slices.Sort(observed)
+	return ips, observed
+}
+
+func (test *incrementalTest) offset() int64 {
+	return test.incremental.files[test.path].offset
+}
+
+func TestIncrementalReadSplitBlock(t *testing.T) {
+	test := newIncrementalTest(t)
+	second := leaseBlock("10.0.0.2")
+	splitAt := strings.Index(second, "ends")
+
+	test.write(leaseBlock("10.0.0.1") + second[:splitAt])
+	ips, observed := test.read()
+	if want := []string{"10.0.0.1"}; !slices.Equal(ips, want) || !slices.Equal(observed, want) {
+		t.Errorf("first read got %v observed %v, want %v", ips, observed, want)
+	}
+	if want := int64(len(leaseBlock("10.0.0.1"))); test.offset() != want {
+		t.Errorf("first read offset = %v, want %v at the end of the complete block", test.offset(), want)
+	}
+
+	test.append(second[splitAt:])
+	ips, observed = test.read()
+	if want := []string{"10.0.0.1", "10.0.0.2"}; !slices.Equal(ips, want) {
+		t.Errorf("second read got %v, want %v", ips, want)
+	}
+	if want := []string{"10.0.0.2"}; !slices.Equal(observed, want) {
+		t.Errorf("second read observed %v, want only the completed block %v", observed, want)
+	}
+	if want := int64(len(leaseBlock("10.0.0.1") + second)); test.offset() != want {
+		t.Errorf("second read offset = %v, want %v", test.offset(), want)
+	}
+}
+
+func TestIncrementalReadRewrite(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		rewrite func(test *incrementalTest, text string)
+	}{
+		{"truncated", (*incrementalTest).write},
+		{"replaced", func(test *incrementalTest, text string) {
+			newPath := test.path + ".new"
+			if err := os.WriteFile(newPath, []byte(text), 0644); err != nil {
+				test.t.Fatal(err)
+			}
+			if err := os.Rename(newPath, test.path); err != nil {
+				test.t.Fatal(err)
+			}
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			inc := newIncrementalTest(t)
+			inc.write(leaseBlock("10.0.0.1") + leaseBlock("10.0.0.2") + leaseBlock("10.0.0.3"))
+			inc.read()
+
+			// A rewrite drops expired leases, so the new file is shorter.
+			rewritten := leaseBlock("10.0.0.4")
+			test.rewrite(inc, rewritten)
+			ips, observed := inc.read()
+			if want := []string{"10.0.0.4"}; !slices.Equal(ips, want) || !slices.Equal(observed, want) {
+				t.Errorf("got %v observed %v, want %v from the rewritten file only", ips, observed, want)
+			}
+			if want := int64(len(rewritten)); inc.offset() != want {
+				t.Errorf("offset = %v, want %v from the start of the rewritten file", inc.offset(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const influxTimeout = 10 * time.Second
+
+// escapeInfluxTag escapes a tag key or value for InfluxDB line protocol.
+func escapeInfluxTag(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `,`, `\,`, ` `, `\ `, `=`, `\=`, "\n", `\n`).Replace(value)
+}
+
+// writeInfluxLines writes the lease counts by state, the lease counts by
+// organization, and the pool utilization of report as InfluxDB line
+// protocol, all with timestamp now.
+func writeInfluxLines(report *leaseReport, now time.Time, w io.Writer) error {
+	timestamp := now.UnixNano()
+
+	for _, state := range leases.LeaseStates {
+		if _, err := fmt.Fprintf(w, "dhcp_leases,state=%v count=%vi %v\n",
+			escapeInfluxTag(strings.ToLower(state.String())), report.leaseStateToCount[state], timestamp); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "dhcp_leases_unique_ips count=%vi %v\n", len(report.rows), timestamp); err != nil {
+		return err
+	}
+
+	organizationToCount := make(map[string]int)
+	for i := range report.rows {
+		organizationToCount[report.rows[i].organization]++
+	}
+	organizations := make([]string, 0, len(organizationToCount))
+	for organization := range organizationToCount {
+		organizations = append(organizations, organization)
+	}
+	sort.Strings(organizations)
+
+	for _, organization := range organizations {
+		if _, err := fmt.Fprintf(w, "dhcp_leases_organization,organization=%v count=%vi %v\n",
+			escapeInfluxTag(organization), organizationToCount[organization], timestamp); err != nil {
+			return err
+		}
+	}
+
+	for i := range report.pools {
+		usage := &report.pools[i]
+		if _, err := fmt.Fprintf(w, "dhcp_pool,subnet=%v size=%vi,leased=%vi,free=%vi,percent_used=%v %v\n",
+			escapeInfluxTag(usage.subnet.String()), usage.size, usage.leased, usage.free(), usage.percentUsed(), timestamp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pushInfluxLines POSTs the line protocol of report to rawURL, an InfluxDB
+// write endpoint such as http://host:8086/api/v2/write?org=ORG&bucket=BUCKET.
+// A non-empty token is sent in the Authorization header.
+func pushInfluxLines(ctx context.Context, report *leaseReport, rawURL string, token string) error {
+	var body bytes.Buffer
+	if err := writeInfluxLines(report, time.Now(), &body); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, influxTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, &body)
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext error: %w", err)
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token != "" {
+		request.Header.Set("Authorization", "Token "+token)
+	}
+
+	redactedURL := rawURL
+	if parsedURL, err := url.Parse(rawURL); err == nil {
+		redactedURL = parsedURL.Redacted()
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("error pushing to influx %v: %w", redactedURL, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("error pushing to influx %v: %v %v", redactedURL, response.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sort"
+	"strings"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/inventory"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// deviceObservations collects inventory entries by MAC address string from
+// the lease records of one run.
+type deviceObservations map[string]*inventory.Device
+
+// observe merges lease into observations. Static leases and leases without
+// a MAC address or start time are ignored.
+func (observations deviceObservations) observe(lease *leases.Lease) {
+	if lease.Static || len(lease.MACAddress) == 0 || lease.StartTime.IsZero() {
+		return
+	}
+
+	lastSeen := lease.StartTime
+	if lease.ClttTime.After(lastSeen) {
+		lastSeen = lease.ClttTime
+	}
+
+	observed := &inventory.Device{
+		MACAddress: lease.MACAddress,
+		FirstSeen:  lease.StartTime,
+		LastSeen:   lastSeen,
+		IPAddress:  lease.IPAddress,
+		Hostname:   lease.Hostname,
+	}
+
+	macString := lease.MACAddress.String()
+	if device, ok := observations[macString]; ok {
+		device.Merge(observed)
+	} else {
+		observations[macString] = observed
+	}
+}
+
+// recordDevices merges observations into the device inventory in
+// opts.ouiDBFile.
+func recordDevices(opts *options, observations deviceObservations) error {
+	if len(observations) == 0 {
+		return nil
+	}
+
+	inventoryDB, err := inventory.Open(opts.ouiDBFile, false)
+	if err != nil {
+		return err
+	}
+	defer inventoryDB.Close()
+
+	devices := make([]*inventory.Device, 0, len(observations))
+	for _, device := range observations {
+		devices = append(devices, device)
+	}
+
+	return inventoryDB.Record(devices)
+}
+
+type inventoryRow struct {
+	device       *inventory.Device
+	organization string
+}
+
+var inventoryColumns = []string{"MAC", "Last IP", "Hostname", "First Seen", "Last Seen", "Organization"}
+
+func (row *inventoryRow) columnValues() []string {
+	return []string{
+		row.device.MACAddress.String(),
+		row.device.IPAddress.String(),
+		row.device.Hostname,
+		formatDisplayTime(row.device.FirstSeen),
+		formatDisplayTime(row.device.LastSeen),
+		row.organization,
+	}
+}
+
+// readInventory returns the device inventory in opts.ouiDBFile, most
+// recently seen first.
+func readInventory(ctx context.Context, opts *options) ([]inventoryRow, error) {
+	inventoryDB, err := inventory.Open(opts.ouiDBFile, true)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := inventoryDB.Devices()
+	inventoryDB.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	ouiDB, err := openOrganizationDB(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer ouiDB.Close()
+
+	rows := make([]inventoryRow, 0, len(devices))
+	for _, device := range devices {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		organization, err := lookupOrganization(ouiDB, device.MACAddress)
+		if err != nil {
+			return nil, err
+		}
+		row := inventoryRow{
+			device:       device,
+			organization: organization,
+		}
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i int, j int) bool {
+		return rows[i].device.LastSeen.After(rows[j].device.LastSeen)
+	})
+
+	return rows, nil
+}
+
+func printInventory(rows []inventoryRow) {
+	cellRows := make([][]string, 0, len(rows))
+	for i := range rows {
+		cellRows = append(cellRows, rows[i].columnValues())
+	}
+	printTable(inventoryColumns, cellRows)
+
+	reportPrintf("")
+	reportPrintf("%v devices in inventory", len(rows))
+}
+
+func setupDevicesCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	flagSet.StringVar(&opts.ouiDBFile, "oui-db", envOrDefault(flagEnvVars["oui-db"], defaultOuiDBFile), "OUI database file holding the device inventory (env OUI_DB_FILE)")
+	flagSet.StringVar(&opts.outputFormat, "output", defaultOutputFormat, "output format: "+strings.Join(outputFormats, ", "))
+	flagSet.StringVar(&opts.outputFile, "out", "", "write non-table output to this file instead of stdout")
+	registerTimeFlags(flagSet)
+	registerAnonymizeFlags(flagSet, &opts)
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		rows, err := readInventory(ctx, &opts)
+		if err != nil {
+			return err
+		}
+		if anonymizer := newAnonymizer(&opts); anonymizer != nil {
+			for i := range rows {
+				rows[i].device = anonymizer.device(rows[i].device)
+			}
+		}
+
+		if opts.outputFormat == defaultOutputFormat {
+			printInventory(rows)
+			return nil
+		}
+
+		cellRows := make([][]string, 0, len(rows))
+		for i := range rows {
+			cellRows = append(cellRows, rows[i].columnValues())
+		}
+		return writeTabularOutput(inventoryColumns, cellRows, opts.outputFormat, opts.outputFile)
+	}
+}
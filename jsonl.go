@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// checkStreamable returns an error naming a flag of opts that needs every
+// lease before output starts, which -output jsonl does not wait for.
+func checkStreamable(opts *options) error {
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"format-template", opts.formatTemplate != ""},
+		{"mdns", opts.mdns},
+		{"neighbors", opts.neighbors},
+		{"probe", opts.probe != ""},
+		{"warn-duplicates", opts.warnDuplicates},
+		{"fail-on-duplicates", opts.failOnDuplicates},
+		{"alert-unknown", opts.alertUnknown},
+		{"influx-url", opts.influxURL != ""},
+	} {
+		if flag.set {
+			return fmt.Errorf("-%v cannot be used with -output jsonl", flag.name)
+		}
+	}
+	return nil
+}
+
+// writeJSONLines writes the rows of report to w as JSON Lines.
+func writeJSONLines(report *leaseReport, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for i := range report.rows {
+		if err := encoder.Encode(report.rows[i].toJSON()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamLeasesJSONL writes each lease record to opts.outputFile or stdout as
+// a JSON line as soon as it is parsed, without merging the records of an
+// IP, so large leases files can be processed incrementally. Static leases
+// from dhcpd.conf for fixed addresses without records follow the records.
+func streamLeasesJSONL(ctx context.Context, opts *options) error {
+	if err := checkStreamable(opts); err != nil {
+		return err
+	}
+
+	var devices knownDevices
+	if opts.knownDevicesFile != "" {
+		var err error
+		devices, err = loadKnownDevices(opts.knownDevicesFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	dhcpdConf, err := readDhcpdConf(opts)
+	if err != nil {
+		return err
+	}
+
+	anonymizer := newAnonymizer(opts)
+	observations := make(deviceObservations)
+	// recordedIPs holds the IPs with lease records, which are not given
+	// static leases, if dhcpd.conf is read.
+	var recordedIPs map[string]bool
+	if dhcpdConf != nil {
+		recordedIPs = make(map[string]bool)
+	}
+
+	ouiDB, err := openOrganizationDB(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	err = writeOutput(opts.outputFile, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		writeLease := func(lease *leases.Lease) error {
+			row := leaseReportRow{
+				lease:         lease,
+				state:         lease.GetState(time.Now()),
+				randomizedMAC: lease.RandomizedMAC(),
+				deviceName:    devices[lease.MACAddress.String()],
+			}
+			organization, err := lookupOrganization(ouiDB, lease.MACAddress)
+			if err != nil {
+				return err
+			}
+			row.organization = organization
+			if !opts.includeRow(&row) {
+				return nil
+			}
+			if anonymizer != nil {
+				anonymizer.row(&row)
+			}
+			if err := encoder.Encode(row.toJSON()); err != nil {
+				return fmt.Errorf("error writing jsonl output: %w", err)
+			}
+			return nil
+		}
+
+		if err := parseLeases(ctx, opts, func(lease leases.Lease) error {
+			observations.observe(&lease)
+			if recordedIPs != nil {
+				recordedIPs[lease.IPAddress.String()] = true
+			}
+			return writeLease(&lease)
+		}); err != nil {
+			return err
+		}
+
+		if dhcpdConf == nil {
+			return nil
+		}
+		for _, lease := range staticLeases(dhcpdConf) {
+			ipString := lease.IPAddress.String()
+			if recordedIPs[ipString] {
+				continue
+			}
+			recordedIPs[ipString] = true
+			if err := writeLease(lease); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	// The device inventory is in the OUI database file, so close it first.
+	ouiDB.Close()
+	if err != nil {
+		return err
+	}
+
+	recordObservedDevices(opts, observations)
+	return nil
+}
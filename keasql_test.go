@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// fakeKeaSQLRows returns rows of values, where nil values are NULL.
+type fakeKeaSQLRows struct {
+	columns []string
+	rows    [][]interface{}
+	next    int
+}
+
+func (rows *fakeKeaSQLRows) Columns() ([]string, error) {
+	return rows.columns, nil
+}
+
+func (rows *fakeKeaSQLRows) Next() bool {
+	rows.next++
+	return rows.next <= len(rows.rows)
+}
+
+func (rows *fakeKeaSQLRows) Scan(dest ...interface{}) error {
+	for i, value := range rows.rows[rows.next-1] {
+		if err := dest[i].(*sql.NullString).Scan(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rows *fakeKeaSQLRows) Err() error {
+	return nil
+}
+
+func TestScanKeaRows(t *testing.T) {
+	rows := &fakeKeaSQLRows{
+		columns: []string{"address", "hwaddr", "client_id", "valid_lifetime", "expire", "hostname", "state"},
+		rows: [][]interface{}{
+			{"10.0.0.1", "001122334455", "01001122334455", int64(3600), int64(1593208800), "laptop", int64(0)},
+			{"10.0.0.2", "001122334466", nil, int64(3600), int64(1593208800), nil, int64(1)},
+			{"bogus", nil, nil, nil, nil, nil, nil},
+		},
+	}
+
+	var invalid []*leases.ParseError
+	parser := leases.NewParser()
+	parser.InvalidLease = func(err *leases.ParseError) {
+		invalid = append(invalid, err)
+	}
+
+	var got []leases.Lease
+	if err := scanKeaRows(rows, parser, func(lease leases.Lease) error {
+		got = append(got, lease)
+		return nil
+	}); err != nil {
+		t.Fatalf("scanKeaRows error: %v", err)
+	}
+
+	if len(got) != 2 || len(invalid) != 1 || invalid[0].Line != 3 {
+		t.Fatalf("got %v leases and invalid rows %v, want 2 leases and row 3 invalid", len(got), invalid)
+	}
+
+	endTime := time.Date(2020, 6, 26, 22, 0, 0, 0, time.UTC)
+	first := got[0]
+	if first.IPAddress.String() != "10.0.0.1" || first.MACAddress.String() != "00:11:22:33:44:55" ||
+		first.Hostname != "laptop" || !first.EndTime.Equal(endTime) {
+		t.Errorf("got first lease %v", &first)
+	}
+	if want := []byte{1, 0, 0x11, 0x22, 0x33, 0x44, 0x55}; !reflect.DeepEqual(first.UID, want) {
+		t.Errorf("got client id %x, want %x", first.UID, want)
+	}
+
+	second := got[1]
+	if second.UID != nil || second.Hostname != "" || !second.Abandoned {
+		t.Errorf("got second lease %v uid %x abandoned %v, want declined lease without client id", &second, second.UID, second.Abandoned)
+	}
+}
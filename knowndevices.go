@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// errUnknownDevicesFound is returned when -alert-unknown is set and current
+// leases from unknown devices were found.
+var errUnknownDevicesFound = errors.New("unknown devices found")
+
+// knownDevices maps MAC address strings to friendly device names.
+type knownDevices map[string]string
+
+// loadKnownDevices reads a known devices file. Each line holds a MAC
+// address followed by the device name, e.g.
+//
+//	# MAC               Name
+//	b8:27:eb:11:22:33  Kitchen Pi
+//	3a:11:22:33:44:55  Alice's iPhone
+//
+// Blank lines and lines starting with # are ignored.
+func loadKnownDevices(path string) (knownDevices, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening known devices file %v: %w", path, err)
+	}
+	defer file.Close()
+
+	devices := make(knownDevices)
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		macString := strings.Fields(line)[0]
+		name := strings.TrimSpace(line[len(macString):])
+
+		mac, err := net.ParseMAC(macString)
+		if err != nil {
+			return nil, fmt.Errorf("%v line %v: %w", path, lineNumber, err)
+		}
+
+		if name == "" {
+			name = mac.String()
+		}
+		devices[mac.String()] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading known devices file %v: %w", path, err)
+	}
+
+	return devices, nil
+}
+
+// deviceColumnGroup adds the known device name of each row, or UNKNOWN.
+var deviceColumnGroup = &optionalColumnGroup{
+	columns: []string{"Device"},
+	values: func(row *leaseReportRow) []string {
+		if row.deviceName == "" {
+			return []string{unknownDevice}
+		}
+		return []string{row.deviceName}
+	},
+}
+
+const unknownDevice = "UNKNOWN"
+
+// findUnknownDevices returns the Current rows of report whose MAC is not a
+// known device.
+func findUnknownDevices(report *leaseReport) []*leaseReportRow {
+	var unknown []*leaseReportRow
+	for i := range report.rows {
+		row := &report.rows[i]
+		if row.state == leases.Current && row.deviceName == "" {
+			unknown = append(unknown, row)
+		}
+	}
+	return unknown
+}
+
+// checkUnknownDevices prints the current leases from unknown devices if
+// opts.alertUnknown is set, returning errUnknownDevicesFound if there are
+// any.
+func checkUnknownDevices(report *leaseReport, opts *options) error {
+	if !opts.alertUnknown {
+		return nil
+	}
+
+	unknown := findUnknownDevices(report)
+
+	reportPrintf("")
+	reportPrintf("%v current leases from unknown devices:", len(unknown))
+	for _, row := range unknown {
+		reportPrintf("\tALERT %-17v%-19v%-22v%v", row.lease.AddressString(), row.lease.MACAddress, row.lease.Hostname, row.organization)
+	}
+
+	if len(unknown) > 0 {
+		return errUnknownDevicesFound
+	}
+	return nil
+}
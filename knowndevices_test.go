@@ -0,0 +1,43 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKnownDevices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known-devices")
+	if err := os.WriteFile(path, []byte("# MAC               Name\n"+
+		"B8-27-EB-11-22-33  Kitchen Pi\n"+
+		"\n"+
+		"3a:11:22:33:44:55  Alice's iPhone\n"+
+		"00:11:22:33:44:55\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadKnownDevices(path)
+	if err != nil {
+		t.Fatalf("loadKnownDevices error: %v", err)
+	}
+	want := knownDevices{
+		"b8:27:eb:11:22:33": "Kitchen Pi",
+		"3a:11:22:33:44:55": "Alice's iPhone",
+		"00:11:22:33:44:55": "00:11:22:33:44:55",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoadKnownDevicesInvalidMAC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known-devices")
+	if err := os.WriteFile(path, []byte("00:11:22:33:44:55 ok\nnot-a-mac bad\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadKnownDevices(path); err == nil {
+		t.Error("loadKnownDevices succeeded, want an error for line 2")
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// lintCheck names the kind of problem reported by lint.
+type lintCheck string
+
+const (
+	lintParseError        lintCheck = "parse-error"
+	lintUnterminatedBlock lintCheck = "unterminated-block"
+	lintUnknownStatement  lintCheck = "unknown-statement"
+	lintOverlappingLeases lintCheck = "overlapping-leases"
+)
+
+// lintProblem is a problem found in a leases file, in the form written by
+// lint -output json.
+type lintProblem struct {
+	File    string    `json:"file"`
+	Line    int       `json:"line"`
+	Check   lintCheck `json:"check"`
+	Message string    `json:"message"`
+}
+
+var lintColumns = []string{"File", "Line", "Check", "Message"}
+
+var lintOutputFormats = append(append([]string(nil), outputFormats...), "json")
+
+func (problem *lintProblem) columnValues() []string {
+	return []string{problem.File, fmt.Sprint(problem.Line), string(problem.Check), problem.Message}
+}
+
+// knownLeaseStatements are the keywords of dhcpd leases file statements,
+// including those within on blocks, that the parser does not use. Skipped
+// statements starting with any other keyword are reported as unknown.
+var knownLeaseStatements = map[string]bool{
+	"authoring-byte-order":    true,
+	"bootp":                   true,
+	"case":                    true,
+	"class":                   true,
+	"client-hostname":         true,
+	"db-time-format":          true,
+	"default":                 true,
+	"deleted":                 true,
+	"dynamic":                 true,
+	"else":                    true,
+	"elsif":                   true,
+	"execute":                 true,
+	"failover":                true,
+	"fixed-address":           true,
+	"group":                   true,
+	"hardware":                true,
+	"host":                    true,
+	"if":                      true,
+	"log":                     true,
+	"mclt":                    true,
+	"my":                      true,
+	"on":                      true,
+	"option":                  true,
+	"partner":                 true,
+	"reserved":                true,
+	"server-duid":             true,
+	"set":                     true,
+	"subclass":                true,
+	"switch":                  true,
+	"uid":                     true,
+	"unset":                   true,
+	"vendor-class-identifier": true,
+}
+
+// statementKeyword returns the first word of a leases file statement.
+func statementKeyword(line string) string {
+	words := strings.FieldsFunc(line, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '(' || r == ';'
+	})
+	if len(words) == 0 {
+		return line
+	}
+	return words[0]
+}
+
+// leaseClient returns the MAC address, client identifier, or DUID and IAID
+// identifying the client holding lease.
+func leaseClient(lease *leases.Lease) string {
+	switch {
+	case lease.MACAddress != nil:
+		return lease.MACAddress.String()
+	case len(lease.UID) > 0:
+		return "uid " + hex.EncodeToString(lease.UID)
+	case len(lease.DUID) > 0:
+		return fmt.Sprintf("duid %v iaid %v", hex.EncodeToString(lease.DUID), lease.IAID)
+	}
+	return "unknown client"
+}
+
+// lintLease is an active lease record and the line its block ends on.
+type lintLease struct {
+	lease leases.Lease
+	line  int
+}
+
+// overlaps reports whether lease, active from its start time, began before
+// previous, held by another client, ended.
+func (previous *lintLease) overlaps(lease *leases.Lease) bool {
+	if leaseClient(&previous.lease) == leaseClient(lease) {
+		return false
+	}
+	return previous.lease.EndsNever || previous.lease.EndTime.After(lease.StartTime)
+}
+
+// lintLeasesFile fully parses the leases file at path and returns the
+// problems found in it.
+func lintLeasesFile(ctx context.Context, path string) ([]lintProblem, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %v: %w", path, err)
+	}
+	defer file.Close()
+
+	var problems []lintProblem
+	addProblem := func(line int, check lintCheck, format string, args ...interface{}) {
+		problems = append(problems, lintProblem{
+			File:    path,
+			Line:    line,
+			Check:   check,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	parser := leases.NewParser()
+	parser.InvalidLease = func(err *leases.ParseError) {
+		check := lintParseError
+		if err.Unterminated {
+			check = lintUnterminatedBlock
+		}
+		addProblem(err.Line, check, "%v", err.Reason)
+	}
+	parser.SkippedLine = func(lineNumber int, line string) {
+		if keyword := statementKeyword(line); !knownLeaseStatements[keyword] {
+			addProblem(lineNumber, lintUnknownStatement, "unknown statement '%v'", line)
+		}
+	}
+
+	addressToActive := make(map[string]*lintLease)
+	if err := parseLeasesFormat(ctx, parser, file, func(lease leases.Lease) error {
+		address := lease.AddressString()
+		if lease.BindingState != "active" {
+			delete(addressToActive, address)
+			return nil
+		}
+
+		if previous := addressToActive[address]; previous != nil && previous.overlaps(&lease) {
+			addProblem(parser.LineNumber(), lintOverlappingLeases, "%v leased to %v starting %v while leased to %v until %v on line %v",
+				address, leaseClient(&lease), formatDisplayTime(lease.StartTime),
+				leaseClient(&previous.lease), formatDisplayTime(previous.lease.EndTime), previous.line)
+		}
+		addressToActive[address] = &lintLease{lease: lease, line: parser.LineNumber()}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("error parsing %v: %w", path, err)
+	}
+
+	problems = append(problems, overlappingPrefixProblems(path, addressToActive, time.Now())...)
+
+	return problems, nil
+}
+
+// overlappingPrefixProblems returns a problem for each current delegated
+// prefix in addressToActive that lies within another one.
+func overlappingPrefixProblems(path string, addressToActive map[string]*lintLease, now time.Time) []lintProblem {
+	var prefixes []*lintLease
+	for _, active := range addressToActive {
+		if active.lease.Prefix != nil && active.lease.GetState(now) == leases.Current {
+			prefixes = append(prefixes, active)
+		}
+	}
+	sort.Slice(prefixes, func(i int, j int) bool {
+		return prefixes[i].line < prefixes[j].line
+	})
+
+	var problems []lintProblem
+	for _, inner := range prefixes {
+		innerOnes, _ := inner.lease.Prefix.Mask.Size()
+		for _, outer := range prefixes {
+			outerOnes, _ := outer.lease.Prefix.Mask.Size()
+			if outerOnes >= innerOnes || !outer.lease.Prefix.Contains(inner.lease.Prefix.IP) {
+				continue
+			}
+			problems = append(problems, lintProblem{
+				File:  path,
+				Line:  inner.line,
+				Check: lintOverlappingLeases,
+				Message: fmt.Sprintf("%v delegated to %v is within %v delegated to %v on line %v",
+					inner.lease.Prefix, leaseClient(&inner.lease), outer.lease.Prefix, leaseClient(&outer.lease), outer.line),
+			})
+		}
+	}
+	return problems
+}
+
+func printLintProblems(problems []lintProblem, fileCount int) {
+	if len(problems) > 0 {
+		cellRows := make([][]string, 0, len(problems))
+		for i := range problems {
+			cellRows = append(cellRows, problems[i].columnValues())
+		}
+		printTable(lintColumns, cellRows)
+		reportPrintf("")
+	}
+	reportPrintf("%v problems found in %v files", len(problems), fileCount)
+}
+
+func outputLintProblems(problems []lintProblem, fileCount int, outputFormat string, outputFile string) error {
+	switch outputFormat {
+	case "table":
+		printLintProblems(problems, fileCount)
+		return nil
+	case "json":
+		if problems == nil {
+			problems = []lintProblem{}
+		}
+		if err := writeOutput(outputFile, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(problems)
+		}); err != nil {
+			return fmt.Errorf("error writing json output: %w", err)
+		}
+		return nil
+	}
+
+	cellRows := make([][]string, 0, len(problems))
+	for i := range problems {
+		cellRows = append(cellRows, problems[i].columnValues())
+	}
+	return writeTabularOutput(lintColumns, cellRows, outputFormat, outputFile)
+}
+
+// runLint checks each of paths, writing the problems found, and returns an
+// error if there were any so lint can gate configuration changes.
+func runLint(ctx context.Context, opts *options, paths []string) error {
+	var problems []lintProblem
+	for _, path := range paths {
+		fileProblems, err := lintLeasesFile(ctx, path)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, fileProblems...)
+	}
+
+	if err := outputLintProblems(problems, len(paths), opts.outputFormat, opts.outputFile); err != nil {
+		return err
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%v problems found", len(problems))
+	}
+	return nil
+}
+
+func setupLintCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	flagSet.Var(&opts.leasesFiles, "leases-file", "dhcpd, Kea memfile, or udhcpd leases file or glob checked when no files are given (repeatable, env DHCP_LEASES_FILE, default "+defaultLeasesFile+")")
+	flagSet.StringVar(&opts.outputFormat, "output", defaultOutputFormat, "output format: "+strings.Join(lintOutputFormats, ", "))
+	flagSet.StringVar(&opts.outputFile, "out", "", "write non-table output to this file instead of stdout")
+	registerTimeFlags(flagSet)
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		paths := flagSet.Args()
+		if len(paths) == 0 {
+			var err error
+			if paths, err = opts.leasesFilePaths(); err != nil {
+				return err
+			}
+		}
+
+		return runLint(ctx, &opts, paths)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logLevel is the minimum level of diagnostics logged to stderr, set by
+// -log-level.
+var logLevel = new(slog.LevelVar)
+
+// setupLogging logs diagnostics with log/slog to stderr, keeping stdout for
+// report data, at the level in the DHCP_LEASES_LOG_LEVEL environment
+// variable until -log-level is parsed.
+func setupLogging() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+
+	if value, ok := os.LookupEnv(flagEnvVars["log-level"]); ok {
+		if err := (logLevelFlag{}).Set(value); err != nil {
+			slog.Warn("ignoring invalid log level", "env", flagEnvVars["log-level"], "err", err)
+		}
+	}
+}
+
+// logLevelFlag is the flag.Value of -log-level, setting logLevel.
+type logLevelFlag struct{}
+
+func (logLevelFlag) String() string {
+	return strings.ToLower(logLevel.Level().String())
+}
+
+func (logLevelFlag) Set(value string) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return fmt.Errorf("expected debug, info, warn, or error")
+	}
+	logLevel.Set(level)
+	return nil
+}
+
+// reportPrintf prints a line of report data to stdout.
+func reportPrintf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stdout, format+"\n", args...)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const (
+	defaultMetricsAddr     = ":9974"
+	defaultRefreshInterval = time.Minute
+)
+
+type leaseMetrics struct {
+	leaseStateToCount    map[leases.LeaseState]int
+	uniqueIPs            int
+	organizationToCount  map[string]int
+	parseDuration        time.Duration
+	lastRefreshTimestamp time.Time
+	pools                []poolUsage
+}
+
+func newLeaseMetrics(snapshot *leaseSnapshot) *leaseMetrics {
+	metrics := &leaseMetrics{
+		leaseStateToCount:    snapshot.report.leaseStateToCount,
+		uniqueIPs:            len(snapshot.report.rows),
+		organizationToCount:  make(map[string]int),
+		parseDuration:        snapshot.parseDuration,
+		lastRefreshTimestamp: snapshot.refreshTime,
+		pools:                snapshot.report.pools,
+	}
+
+	for i := range snapshot.report.rows {
+		metrics.organizationToCount[snapshot.report.rows[i].organization]++
+	}
+
+	return metrics
+}
+
+func escapeMetricLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// writeLeaseMetrics writes metrics to out in the Prometheus text format,
+// returning the first write error.
+func writeLeaseMetrics(metrics *leaseMetrics, out io.Writer) error {
+	w := bufio.NewWriter(out)
+
+	fmt.Fprintf(w, "# HELP dhcp_leases Number of leases with unique IPs by lease state.\n")
+	fmt.Fprintf(w, "# TYPE dhcp_leases gauge\n")
+	for _, state := range leases.LeaseStates {
+		fmt.Fprintf(w, "dhcp_leases{state=\"%v\"} %v\n", state, metrics.leaseStateToCount[state])
+	}
+
+	fmt.Fprintf(w, "# HELP dhcp_leases_unique_ips Total number of leases with unique IPs.\n")
+	fmt.Fprintf(w, "# TYPE dhcp_leases_unique_ips gauge\n")
+	fmt.Fprintf(w, "dhcp_leases_unique_ips %v\n", metrics.uniqueIPs)
+
+	organizations := make([]string, 0, len(metrics.organizationToCount))
+	for organization := range metrics.organizationToCount {
+		organizations = append(organizations, organization)
+	}
+	sort.Strings(organizations)
+
+	fmt.Fprintf(w, "# HELP dhcp_leases_vendor Number of leases with unique IPs by OUI organization.\n")
+	fmt.Fprintf(w, "# TYPE dhcp_leases_vendor gauge\n")
+	for _, organization := range organizations {
+		fmt.Fprintf(w, "dhcp_leases_vendor{organization=\"%v\"} %v\n", escapeMetricLabelValue(organization), metrics.organizationToCount[organization])
+	}
+
+	if len(metrics.pools) > 0 {
+		fmt.Fprintf(w, "# HELP dhcp_leases_pool_size Number of addresses in the dynamic ranges of a subnet.\n")
+		fmt.Fprintf(w, "# TYPE dhcp_leases_pool_size gauge\n")
+		for i := range metrics.pools {
+			fmt.Fprintf(w, "dhcp_leases_pool_size{subnet=\"%v\"} %v\n", metrics.pools[i].subnet, metrics.pools[i].size)
+		}
+
+		fmt.Fprintf(w, "# HELP dhcp_leases_pool_leased Number of current leases in the dynamic ranges of a subnet.\n")
+		fmt.Fprintf(w, "# TYPE dhcp_leases_pool_leased gauge\n")
+		for i := range metrics.pools {
+			fmt.Fprintf(w, "dhcp_leases_pool_leased{subnet=\"%v\"} %v\n", metrics.pools[i].subnet, metrics.pools[i].leased)
+		}
+
+		fmt.Fprintf(w, "# HELP dhcp_leases_pool_free Number of unleased addresses in the dynamic ranges of a subnet.\n")
+		fmt.Fprintf(w, "# TYPE dhcp_leases_pool_free gauge\n")
+		for i := range metrics.pools {
+			fmt.Fprintf(w, "dhcp_leases_pool_free{subnet=\"%v\"} %v\n", metrics.pools[i].subnet, metrics.pools[i].free())
+		}
+	}
+
+	// The parse duration is only measured by the daemon.
+	if metrics.parseDuration > 0 {
+		fmt.Fprintf(w, "# HELP dhcp_leases_parse_duration_seconds Time taken to parse the leases file.\n")
+		fmt.Fprintf(w, "# TYPE dhcp_leases_parse_duration_seconds gauge\n")
+		fmt.Fprintf(w, "dhcp_leases_parse_duration_seconds %v\n", metrics.parseDuration.Seconds())
+	}
+
+	fmt.Fprintf(w, "# HELP dhcp_leases_last_refresh_timestamp_seconds Unix time of the last leases file refresh.\n")
+	fmt.Fprintf(w, "# TYPE dhcp_leases_last_refresh_timestamp_seconds gauge\n")
+	fmt.Fprintf(w, "dhcp_leases_last_refresh_timestamp_seconds %v\n", metrics.lastRefreshTimestamp.Unix())
+
+	// bufio.Writer keeps the first write error, which Flush returns.
+	return w.Flush()
+}
+
+func registerMetricsHandlers(serveMux *http.ServeMux, daemon *leaseDaemon) {
+	serveMux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		metrics := newLeaseMetrics(daemon.currentSnapshot())
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := writeLeaseMetrics(metrics, w); err != nil {
+			slog.Error("error writing metrics response", "err", err)
+		}
+	})
+}
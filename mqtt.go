@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const (
+	defaultMQTTTopicPrefix     = "go-dhcp-leases"
+	defaultMQTTDiscoveryPrefix = "homeassistant"
+	mqttTimeout                = 10 * time.Second
+	// mqttDisconnectQuiesce is how long to wait for publishes in progress
+	// when disconnecting, in milliseconds.
+	mqttDisconnectQuiesce = 250
+)
+
+// reportSink is implemented by event sinks that also publish the state of
+// every lease report, not only the events between reports.
+type reportSink interface {
+	PublishReport(ctx context.Context, report *leaseReport) error
+}
+
+// mqttEventSink publishes events and the presence of every device to an
+// MQTT broker, with Home Assistant MQTT discovery messages that make each
+// MAC a device_tracker entity.
+type mqttEventSink struct {
+	url             *url.URL
+	client          mqtt.Client
+	topicPrefix     string
+	discoveryPrefix string
+
+	mutex      sync.Mutex
+	discovered map[string]bool
+	// home holds the MACs last published as home.
+	home map[string]bool
+}
+
+func newMQTTEventSink(opts *options, rawURL string) (*mqttEventSink, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mqtt url %v: %w", rawURL, err)
+	}
+	if parsedURL.Hostname() == "" {
+		return nil, fmt.Errorf("invalid mqtt url %v: missing host", rawURL)
+	}
+
+	scheme, port := "tcp", "1883"
+	if parsedURL.Scheme == "mqtts" {
+		scheme, port = "ssl", "8883"
+	}
+	if parsedURL.Port() != "" {
+		port = parsedURL.Port()
+	}
+
+	clientOptions := mqtt.NewClientOptions().
+		AddBroker(fmt.Sprintf("%v://%v:%v", scheme, parsedURL.Hostname(), port)).
+		SetClientID(fmt.Sprintf("%v-%v", defaultMQTTTopicPrefix, time.Now().UnixNano())).
+		SetConnectTimeout(mqttTimeout).
+		SetAutoReconnect(true).
+		SetTLSConfig(&tls.Config{ServerName: parsedURL.Hostname()})
+	if parsedURL.User != nil {
+		password, _ := parsedURL.User.Password()
+		clientOptions.SetUsername(parsedURL.User.Username()).SetPassword(password)
+	}
+
+	return &mqttEventSink{
+		url:             parsedURL,
+		client:          mqtt.NewClient(clientOptions),
+		topicPrefix:     strings.TrimSuffix(opts.mqttTopicPrefix, "/"),
+		discoveryPrefix: strings.TrimSuffix(opts.mqttDiscoveryPrefix, "/"),
+		discovered:      make(map[string]bool),
+		home:            make(map[string]bool),
+	}, nil
+}
+
+func (sink *mqttEventSink) String() string {
+	return sink.url.Redacted()
+}
+
+// Close disconnects from the broker.
+func (sink *mqttEventSink) Close() error {
+	if sink.client.IsConnected() {
+		sink.client.Disconnect(mqttDisconnectQuiesce)
+	}
+	return nil
+}
+
+// connect connects to the broker if not already connected.
+func (sink *mqttEventSink) connect() error {
+	if sink.client.IsConnectionOpen() {
+		return nil
+	}
+	token := sink.client.Connect()
+	if !token.WaitTimeout(mqttTimeout) {
+		return fmt.Errorf("timeout connecting to %v", sink)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("error connecting to %v: %w", sink, err)
+	}
+	return nil
+}
+
+func (sink *mqttEventSink) publish(topic string, retained bool, payload interface{}) error {
+	var data []byte
+	switch payload := payload.(type) {
+	case string:
+		data = []byte(payload)
+	default:
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return fmt.Errorf("json.Marshal error: %w", err)
+		}
+	}
+
+	token := sink.client.Publish(topic, 1, retained, data)
+	if !token.WaitTimeout(mqttTimeout) {
+		return fmt.Errorf("timeout publishing to %v", topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("error publishing to %v: %w", topic, err)
+	}
+	return nil
+}
+
+// Send publishes each event to the events topic.
+func (sink *mqttEventSink) Send(ctx context.Context, events []leaseEvent) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if err := sink.connect(); err != nil {
+		return err
+	}
+
+	for i := range events {
+		if err := sink.publish(sink.topicPrefix+"/events", false, &events[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mqttDeviceState is the attributes payload of one device.
+type mqttDeviceState struct {
+	IP           string `json:"ip"`
+	Hostname     string `json:"hostname,omitempty"`
+	State        string `json:"state"`
+	Organization string `json:"organization"`
+	DeviceName   string `json:"deviceName,omitempty"`
+	home         bool
+	name         string
+}
+
+// PublishReport publishes the retained presence and attributes of every
+// MAC in report, home if it has a Current lease, and the Home Assistant
+// discovery config of MACs not yet announced. MACs previously home that are
+// no longer in report are published as not_home.
+func (sink *mqttEventSink) PublishReport(ctx context.Context, report *leaseReport) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if err := sink.connect(); err != nil {
+		return err
+	}
+
+	macToState := make(map[string]*mqttDeviceState)
+	for i := range report.rows {
+		row := &report.rows[i]
+		if len(row.lease.MACAddress) == 0 {
+			continue
+		}
+
+		macString := row.lease.MACAddress.String()
+		current := row.state == leases.Current
+		if state, ok := macToState[macString]; ok && (state.home || !current) {
+			continue
+		}
+
+		name := row.deviceName
+		if name == "" {
+			name = row.lease.Hostname
+		}
+		if name == "" {
+			name = macString
+		}
+
+		macToState[macString] = &mqttDeviceState{
+			IP:           row.lease.AddressString(),
+			Hostname:     row.lease.Hostname,
+			State:        row.state.String(),
+			Organization: row.organization,
+			DeviceName:   row.deviceName,
+			home:         current,
+			name:         name,
+		}
+	}
+
+	for macString, state := range macToState {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		objectID := strings.ReplaceAll(macString, ":", "")
+		deviceTopic := sink.topicPrefix + "/devices/" + objectID
+
+		if sink.discoveryPrefix != "" && !sink.discovered[macString] {
+			if err := sink.publish(sink.discoveryPrefix+"/device_tracker/"+defaultMQTTTopicPrefix+"/"+objectID+"/config", true, map[string]interface{}{
+				"name":                  nil,
+				"unique_id":             defaultMQTTTopicPrefix + "_" + objectID,
+				"state_topic":           deviceTopic + "/state",
+				"json_attributes_topic": deviceTopic + "/attributes",
+				"payload_home":          "home",
+				"payload_not_home":      "not_home",
+				"source_type":           "router",
+				"device": map[string]interface{}{
+					"connections":  [][]string{{"mac", macString}},
+					"identifiers":  []string{defaultMQTTTopicPrefix + "_" + objectID},
+					"name":         state.name,
+					"manufacturer": state.Organization,
+				},
+			}); err != nil {
+				return err
+			}
+			sink.discovered[macString] = true
+		}
+
+		presence := "not_home"
+		if state.home {
+			presence = "home"
+		}
+		if err := sink.publish(deviceTopic+"/state", true, presence); err != nil {
+			return err
+		}
+		if err := sink.publish(deviceTopic+"/attributes", true, state); err != nil {
+			return err
+		}
+		sink.home[macString] = state.home
+	}
+
+	for macString, home := range sink.home {
+		if _, ok := macToState[macString]; ok || !home {
+			continue
+		}
+		objectID := strings.ReplaceAll(macString, ":", "")
+		if err := sink.publish(sink.topicPrefix+"/devices/"+objectID+"/state", true, "not_home"); err != nil {
+			return err
+		}
+		sink.home[macString] = false
+	}
+
+	return nil
+}
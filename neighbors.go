@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Presence of a leased IP in the neighbor (ARP/NDP) table.
+const (
+	presenceOnline  = "Online"
+	presenceStale   = "Stale"
+	presenceOffline = "Offline"
+)
+
+const (
+	defaultNeighborCommand = "ip neigh show"
+	procNetARPFile         = "/proc/net/arp"
+)
+
+// neighborEntry is the entry of an IP address in the neighbor table.
+// macAddress is nil for incomplete entries.
+type neighborEntry struct {
+	presence   string
+	macAddress net.HardwareAddr
+}
+
+// neighborPresence maps IP address strings to neighbor table entries.
+type neighborPresence map[string]neighborEntry
+
+// ipNeighStatePresence maps the states of Linux ip neigh entries to
+// presence. Other states are offline.
+var ipNeighStatePresence = map[string]string{
+	"REACHABLE": presenceOnline,
+	"PERMANENT": presenceOnline,
+	"NOARP":     presenceOnline,
+	"STALE":     presenceStale,
+	"DELAY":     presenceStale,
+	"PROBE":     presenceStale,
+}
+
+// parseNeighborLine parses a line of Linux ip neigh output, /proc/net/arp, or
+// BSD and macOS arp -an output, returning the IP address and its entry.
+func parseNeighborLine(line string) (string, neighborEntry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", neighborEntry{}, false
+	}
+
+	// BSD and macOS: ? (10.0.0.1) at 00:11:22:33:44:55 on em0 expires in 1183 seconds [ethernet]
+	if len(fields) >= 4 && fields[2] == "at" && strings.HasPrefix(fields[1], "(") {
+		ipAddress := net.ParseIP(strings.Trim(fields[1], "()"))
+		if ipAddress == nil {
+			return "", neighborEntry{}, false
+		}
+		macAddress, err := net.ParseMAC(fields[3])
+		switch {
+		case err != nil:
+			return ipAddress.String(), neighborEntry{presence: presenceOffline}, true
+		case strings.Contains(line, "expired"):
+			return ipAddress.String(), neighborEntry{presence: presenceStale, macAddress: macAddress}, true
+		}
+		return ipAddress.String(), neighborEntry{presence: presenceOnline, macAddress: macAddress}, true
+	}
+
+	ipAddress := net.ParseIP(fields[0])
+	if ipAddress == nil {
+		return "", neighborEntry{}, false
+	}
+
+	// /proc/net/arp: 10.0.0.1 0x1 0x2 00:11:22:33:44:55 * eth0
+	if len(fields) == 6 && strings.HasPrefix(fields[1], "0x") && strings.HasPrefix(fields[2], "0x") {
+		flags, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+		if err != nil {
+			return "", neighborEntry{}, false
+		}
+		// ATF_COM is set for completed entries.
+		if flags&0x2 == 0 {
+			return ipAddress.String(), neighborEntry{presence: presenceOffline}, true
+		}
+		macAddress, _ := net.ParseMAC(fields[3])
+		return ipAddress.String(), neighborEntry{presence: presenceOnline, macAddress: macAddress}, true
+	}
+
+	// OpenBSD: 10.0.0.1 00:11:22:33:44:55 em0 19m59s
+	if len(fields) >= 3 {
+		if macAddress, err := net.ParseMAC(fields[1]); err == nil {
+			return ipAddress.String(), neighborEntry{presence: presenceOnline, macAddress: macAddress}, true
+		}
+		if fields[1] == "(incomplete)" {
+			return ipAddress.String(), neighborEntry{presence: presenceOffline}, true
+		}
+	}
+
+	// Linux ip neigh: 10.0.0.1 dev eth0 lladdr 00:11:22:33:44:55 REACHABLE
+	entry := neighborEntry{presence: presenceOffline}
+	if presence, ok := ipNeighStatePresence[fields[len(fields)-1]]; ok {
+		entry.presence = presence
+	}
+	for i := 1; i+1 < len(fields); i++ {
+		if fields[i] == "lladdr" {
+			entry.macAddress, _ = net.ParseMAC(fields[i+1])
+		}
+	}
+	return ipAddress.String(), entry, true
+}
+
+// presenceRank orders presence from least to most present.
+var presenceRank = map[string]int{
+	presenceOffline: 0,
+	presenceStale:   1,
+	presenceOnline:  2,
+}
+
+// parseNeighbors reads neighbor table entries from r in any format accepted
+// by parseNeighborLine. Lines in other formats, such as headers, are skipped.
+func parseNeighbors(r io.Reader) (neighborPresence, error) {
+	presence := make(neighborPresence)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if ipAddress, entry, ok := parseNeighborLine(scanner.Text()); ok {
+			// Keep the most present of duplicate entries from several
+			// interfaces.
+			if existing, ok := presence[ipAddress]; !ok || presenceRank[entry.presence] > presenceRank[existing.presence] {
+				presence[ipAddress] = entry
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan error: %w", err)
+	}
+	return presence, nil
+}
+
+// readNeighbors runs opts.neighborCommand and parses its output. If the
+// default command is not installed /proc/net/arp is read instead.
+func readNeighbors(ctx context.Context, opts *options) (neighborPresence, error) {
+	args := strings.Fields(opts.neighborCommand)
+	if len(args) == 0 {
+		return nil, errors.New("empty -neighbor-command")
+	}
+
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if errors.Is(err, exec.ErrNotFound) && opts.neighborCommand == defaultNeighborCommand {
+		file, err := os.Open(procNetARPFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file %v: %w", procNetARPFile, err)
+		}
+		defer file.Close()
+		return parseNeighbors(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to run '%v': %w", opts.neighborCommand, err)
+	}
+
+	return parseNeighbors(strings.NewReader(string(output)))
+}
+
+// lookupNeighborPresence returns the neighbor table for the report, logging
+// errors since presence is only an enrichment of the report.
+func lookupNeighborPresence(ctx context.Context, opts *options) neighborPresence {
+	presence, err := readNeighbors(ctx, opts)
+	if err != nil {
+		slog.Warn("neighbor table error", "err", err)
+		return nil
+	}
+	return presence
+}
+
+// presenceOf returns the presence of ipAddress in the neighbor table, which
+// is offline if it has no entry.
+func (presence neighborPresence) presenceOf(ipAddress net.IP) string {
+	if entry, ok := presence[ipAddress.String()]; ok {
+		return entry.presence
+	}
+	return presenceOffline
+}
+
+// presenceColumnGroup adds whether the IP of each row is in the neighbor
+// table.
+var presenceColumnGroup = &optionalColumnGroup{
+	columns: []string{"Presence"},
+	values: func(row *leaseReportRow) []string {
+		return []string{row.presence}
+	},
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNeighbors(t *testing.T) {
+	output := strings.Join([]string{
+		// Linux ip neigh
+		"10.0.0.1 dev eth0 lladdr 00:11:22:33:44:01 REACHABLE",
+		"10.0.0.2 dev eth0 lladdr 00:11:22:33:44:02 STALE",
+		"10.0.0.3 dev eth0  FAILED",
+		// /proc/net/arp
+		"IP address       HW type     Flags       HW address            Mask     Device",
+		"10.0.0.4         0x1         0x2         00:11:22:33:44:04     *        eth0",
+		"10.0.0.5         0x1         0x0         00:00:00:00:00:00     *        eth0",
+		// BSD and macOS arp -an
+		"? (10.0.0.6) at 00:11:22:33:44:06 on em0 expires in 1183 seconds [ethernet]",
+		"? (10.0.0.7) at (incomplete) on em0 [ethernet]",
+		// OpenBSD arp -an
+		"10.0.0.8 00:11:22:33:44:08 em0 19m59s",
+		// A duplicate entry from another interface keeps the most present.
+		"10.0.0.2 dev wlan0 lladdr 00:11:22:33:44:02 REACHABLE",
+	}, "\n")
+
+	presence, err := parseNeighbors(strings.NewReader(output))
+	if err != nil {
+		t.Fatalf("parseNeighbors error: %v", err)
+	}
+
+	for _, test := range []struct {
+		ip       string
+		presence string
+		mac      string
+	}{
+		{"10.0.0.1", presenceOnline, "00:11:22:33:44:01"},
+		{"10.0.0.2", presenceOnline, "00:11:22:33:44:02"},
+		{"10.0.0.3", presenceOffline, ""},
+		{"10.0.0.4", presenceOnline, "00:11:22:33:44:04"},
+		{"10.0.0.5", presenceOffline, ""},
+		{"10.0.0.6", presenceOnline, "00:11:22:33:44:06"},
+		{"10.0.0.7", presenceOffline, ""},
+		{"10.0.0.8", presenceOnline, "00:11:22:33:44:08"},
+	} {
+		entry, ok := presence[test.ip]
+		if !ok {
+			t.Errorf("%v not found", test.ip)
+			continue
+		}
+		if entry.presence != test.presence || entry.macAddress.String() != test.mac {
+			t.Errorf("%v = %v %v, want %v %v", test.ip, entry.presence, entry.macAddress, test.presence, test.mac)
+		}
+	}
+	if len(presence) != 8 {
+		t.Errorf("got %v entries, want 8", len(presence))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+func newTestRow(ip string, mac string, hostname string, organization string) *leaseReportRow {
+	macAddress, _ := net.ParseMAC(mac)
+	return &leaseReportRow{
+		lease: &leases.Lease{
+			IPAddress:  net.ParseIP(ip),
+			MACAddress: macAddress,
+			Hostname:   hostname,
+		},
+		state:        leases.Current,
+		organization: organization,
+	}
+}
+
+func TestLeaseFilters(t *testing.T) {
+	row := newTestRow("10.0.0.5", "b8:27:eb:11:22:33", "Kitchen-Pi", "Raspberry Pi Foundation")
+
+	for _, test := range []struct {
+		name   string
+		filter func() (leaseFilter, error)
+		want   bool
+	}{
+		{"state", func() (leaseFilter, error) { return parseStateFilter("current,past") }, true},
+		{"other state", func() (leaseFilter, error) { return parseStateFilter("abandoned") }, false},
+		{"cidr", func() (leaseFilter, error) { return parseCIDRFilter([]string{"10.0.0.4/30"}) }, true},
+		{"other cidr", func() (leaseFilter, error) { return parseCIDRFilter([]string{"10.0.0.0/30", "192.168.0.0/16"}) }, false},
+		{"vendor substring", func() (leaseFilter, error) { return parseVendorFilter("raspberry") }, true},
+		{"vendor regex", func() (leaseFilter, error) { return parseVendorFilter("/^Raspberry/") }, true},
+		{"other vendor", func() (leaseFilter, error) { return parseVendorFilter("apple") }, false},
+		{"hostname glob", func() (leaseFilter, error) { return parseHostnameFilter("kitchen-*") }, true},
+		{"hostname regex", func() (leaseFilter, error) { return parseHostnameFilter("/Pi$/") }, true},
+		{"other hostname", func() (leaseFilter, error) { return parseHostnameFilter("office-*") }, false},
+		{"mac prefix", func() (leaseFilter, error) { return parseMACPrefixFilter([]string{"B8-27-EB"}) }, true},
+		{"partial mac prefix", func() (leaseFilter, error) { return parseMACPrefixFilter([]string{"b8:2"}) }, true},
+		{"other mac prefix", func() (leaseFilter, error) { return parseMACPrefixFilter([]string{"dc:a6:32"}) }, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := test.filter()
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if got := filter(row); got != test.want {
+				t.Errorf("filter = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLeaseFilterErrors(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		filter func() (leaseFilter, error)
+	}{
+		{"state", func() (leaseFilter, error) { return parseStateFilter("current,bogus") }},
+		{"cidr", func() (leaseFilter, error) { return parseCIDRFilter([]string{"10.0.0.0/33"}) }},
+		{"vendor regex", func() (leaseFilter, error) { return parseVendorFilter("/(/") }},
+		{"hostname regex", func() (leaseFilter, error) { return parseHostnameFilter("/(/") }},
+		{"hostname glob", func() (leaseFilter, error) { return parseHostnameFilter("[") }},
+		{"mac prefix", func() (leaseFilter, error) { return parseMACPrefixFilter([]string{"zz:11"}) }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.filter(); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestExpiryFilters(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		name        string
+		endTime     time.Time
+		wantWithin  bool
+		wantExpired bool
+	}{
+		{"ends soon", now.Add(30 * time.Minute), true, false},
+		{"ends later", now.Add(2 * time.Hour), false, false},
+		{"ended recently", now.Add(-30 * time.Minute), false, true},
+		{"ended long ago", now.Add(-2 * time.Hour), false, false},
+	} {
+		row := newTestRow("10.0.0.1", "00:11:22:33:44:55", "", "")
+		row.lease.EndTime = test.endTime
+		if got := expiresWithinFilter(time.Hour)(row); got != test.wantWithin {
+			t.Errorf("%v: expiresWithinFilter = %v, want %v", test.name, got, test.wantWithin)
+		}
+		if got := expiredSinceFilter(time.Hour)(row); got != test.wantExpired {
+			t.Errorf("%v: expiredSinceFilter = %v, want %v", test.name, got, test.wantExpired)
+		}
+	}
+}
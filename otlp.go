@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const (
+	defaultOTLPEndpoint = "http://localhost:4318"
+	defaultOTLPTimeout  = 10 * time.Second
+	otlpServiceName     = "go-dhcp-leases"
+)
+
+// otlpExporter pushes lease metrics to an OpenTelemetry collector using
+// OTLP/HTTP with JSON encoding, configured by the standard OTEL_* environment
+// variables.
+type otlpExporter struct {
+	endpoint           string
+	headers            map[string]string
+	resourceAttributes map[string]string
+	client             *http.Client
+}
+
+// otlpEnv returns the value of the metrics specific OTEL_EXPORTER_OTLP_METRICS_
+// variable for name, or else of the generic OTEL_EXPORTER_OTLP_ variable.
+func otlpEnv(name string) (string, bool) {
+	if value, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_METRICS_" + name); ok {
+		return value, true
+	}
+	value, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_" + name)
+	return value, ok
+}
+
+// parseOTLPKeyValues parses a comma-separated list of URL-encoded key=value
+// pairs, the format of OTEL_EXPORTER_OTLP_HEADERS and OTEL_RESOURCE_ATTRIBUTES.
+func parseOTLPKeyValues(envVar string, s string) (map[string]string, error) {
+	keyValues := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid %v entry '%v'", envVar, pair)
+		}
+		key, keyErr := url.QueryUnescape(strings.TrimSpace(key))
+		value, valueErr := url.QueryUnescape(strings.TrimSpace(value))
+		if keyErr != nil || valueErr != nil {
+			return nil, fmt.Errorf("invalid %v entry '%v'", envVar, pair)
+		}
+		keyValues[key] = value
+	}
+	return keyValues, nil
+}
+
+// newOTLPExporter returns an exporter configured by OTEL_EXPORTER_OTLP_ENDPOINT
+// or OTEL_EXPORTER_OTLP_METRICS_ENDPOINT, the matching _HEADERS, _TIMEOUT, and
+// _PROTOCOL variables, OTEL_SERVICE_NAME, and OTEL_RESOURCE_ATTRIBUTES.
+// Only the http/json protocol is supported.
+func newOTLPExporter() (*otlpExporter, error) {
+	if protocol, ok := otlpEnv("PROTOCOL"); ok && protocol != "http/json" {
+		return nil, fmt.Errorf("unsupported OTLP protocol '%v', only http/json is supported", protocol)
+	}
+
+	endpoint, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT")
+	if !ok {
+		endpoint = strings.TrimSuffix(envOrDefault("OTEL_EXPORTER_OTLP_ENDPOINT", defaultOTLPEndpoint), "/") + "/v1/metrics"
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %v: %w", endpoint, err)
+	}
+
+	headersValue, _ := otlpEnv("HEADERS")
+	headers, err := parseOTLPKeyValues("OTEL_EXPORTER_OTLP_HEADERS", headersValue)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := defaultOTLPTimeout
+	if timeoutValue, ok := otlpEnv("TIMEOUT"); ok {
+		milliseconds, err := strconv.Atoi(timeoutValue)
+		if err != nil || milliseconds <= 0 {
+			return nil, fmt.Errorf("invalid OTLP timeout '%v', expected milliseconds", timeoutValue)
+		}
+		timeout = time.Duration(milliseconds) * time.Millisecond
+	}
+
+	resourceAttributes, err := parseOTLPKeyValues("OTEL_RESOURCE_ATTRIBUTES", os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, err
+	}
+	if serviceName := os.Getenv("OTEL_SERVICE_NAME"); serviceName != "" {
+		resourceAttributes["service.name"] = serviceName
+	} else if resourceAttributes["service.name"] == "" {
+		resourceAttributes["service.name"] = otlpServiceName
+	}
+
+	return &otlpExporter{
+		endpoint:           endpoint,
+		headers:            headers,
+		resourceAttributes: resourceAttributes,
+		client:             &http.Client{Timeout: timeout},
+	}, nil
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+// otlpDataPoint is a NumberDataPoint. 64 bit integers are strings in the
+// JSON encoding of OTLP.
+type otlpDataPoint struct {
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	TimeUnixNano string         `json:"timeUnixNano"`
+	AsInt        *string        `json:"asInt,omitempty"`
+	AsDouble     *float64       `json:"asDouble,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Unit        string    `json:"unit,omitempty"`
+	Gauge       otlpGauge `json:"gauge"`
+}
+
+type otlpScopeMetrics struct {
+	Scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	} `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+func otlpAttributes(keyValues ...string) []otlpKeyValue {
+	attributes := make([]otlpKeyValue, 0, len(keyValues)/2)
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		attributes = append(attributes, otlpKeyValue{Key: keyValues[i], Value: otlpAnyValue{StringValue: keyValues[i+1]}})
+	}
+	return attributes
+}
+
+func otlpIntDataPoint(timeUnixNano string, value uint64, attributes ...string) otlpDataPoint {
+	asInt := strconv.FormatUint(value, 10)
+	return otlpDataPoint{
+		Attributes:   otlpAttributes(attributes...),
+		TimeUnixNano: timeUnixNano,
+		AsInt:        &asInt,
+	}
+}
+
+// buildMetricsRequest returns the same gauges as the Prometheus metrics
+// endpoint, under the same names.
+func (exporter *otlpExporter) buildMetricsRequest(metrics *leaseMetrics) *otlpMetricsRequest {
+	timeUnixNano := strconv.FormatInt(metrics.lastRefreshTimestamp.UnixNano(), 10)
+
+	stateGauge := otlpMetric{Name: "dhcp_leases", Description: "Number of leases with unique IPs by lease state.", Unit: "{lease}"}
+	for _, state := range leases.LeaseStates {
+		stateGauge.Gauge.DataPoints = append(stateGauge.Gauge.DataPoints,
+			otlpIntDataPoint(timeUnixNano, uint64(metrics.leaseStateToCount[state]), "state", state.String()))
+	}
+
+	uniqueIPsGauge := otlpMetric{Name: "dhcp_leases_unique_ips", Description: "Total number of leases with unique IPs.", Unit: "{lease}"}
+	uniqueIPsGauge.Gauge.DataPoints = append(uniqueIPsGauge.Gauge.DataPoints, otlpIntDataPoint(timeUnixNano, uint64(metrics.uniqueIPs)))
+
+	organizations := make([]string, 0, len(metrics.organizationToCount))
+	for organization := range metrics.organizationToCount {
+		organizations = append(organizations, organization)
+	}
+	sort.Strings(organizations)
+
+	vendorGauge := otlpMetric{Name: "dhcp_leases_vendor", Description: "Number of leases with unique IPs by OUI organization.", Unit: "{lease}"}
+	for _, organization := range organizations {
+		vendorGauge.Gauge.DataPoints = append(vendorGauge.Gauge.DataPoints,
+			otlpIntDataPoint(timeUnixNano, uint64(metrics.organizationToCount[organization]), "organization", organization))
+	}
+
+	gauges := []otlpMetric{stateGauge, uniqueIPsGauge, vendorGauge}
+
+	if len(metrics.pools) > 0 {
+		sizeGauge := otlpMetric{Name: "dhcp_leases_pool_size", Description: "Number of addresses in the dynamic ranges of a subnet.", Unit: "{address}"}
+		leasedGauge := otlpMetric{Name: "dhcp_leases_pool_leased", Description: "Number of current leases in the dynamic ranges of a subnet.", Unit: "{address}"}
+		freeGauge := otlpMetric{Name: "dhcp_leases_pool_free", Description: "Number of unleased addresses in the dynamic ranges of a subnet.", Unit: "{address}"}
+		for i := range metrics.pools {
+			usage := &metrics.pools[i]
+			subnet := usage.subnet.String()
+			sizeGauge.Gauge.DataPoints = append(sizeGauge.Gauge.DataPoints, otlpIntDataPoint(timeUnixNano, usage.size, "subnet", subnet))
+			leasedGauge.Gauge.DataPoints = append(leasedGauge.Gauge.DataPoints, otlpIntDataPoint(timeUnixNano, usage.leased, "subnet", subnet))
+			freeGauge.Gauge.DataPoints = append(freeGauge.Gauge.DataPoints, otlpIntDataPoint(timeUnixNano, usage.free(), "subnet", subnet))
+		}
+		gauges = append(gauges, sizeGauge, leasedGauge, freeGauge)
+	}
+
+	parseSeconds := metrics.parseDuration.Seconds()
+	parseGauge := otlpMetric{Name: "dhcp_leases_parse_duration_seconds", Description: "Time taken to parse the leases file.", Unit: "s"}
+	parseGauge.Gauge.DataPoints = append(parseGauge.Gauge.DataPoints, otlpDataPoint{TimeUnixNano: timeUnixNano, AsDouble: &parseSeconds})
+	gauges = append(gauges, parseGauge)
+
+	keys := make([]string, 0, len(exporter.resourceAttributes))
+	for key := range exporter.resourceAttributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	resourceAttributes := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		resourceAttributes = append(resourceAttributes, key, exporter.resourceAttributes[key])
+	}
+
+	var scopeMetrics otlpScopeMetrics
+	scopeMetrics.Scope.Name = otlpServiceName
+	scopeMetrics.Scope.Version = gitCommit
+	scopeMetrics.Metrics = gauges
+
+	var resourceMetrics otlpResourceMetrics
+	resourceMetrics.Resource.Attributes = otlpAttributes(resourceAttributes...)
+	resourceMetrics.ScopeMetrics = []otlpScopeMetrics{scopeMetrics}
+
+	return &otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{resourceMetrics}}
+}
+
+// export pushes the metrics of snapshot, logging errors. It does nothing if
+// exporter is nil.
+func (exporter *otlpExporter) export(ctx context.Context, snapshot *leaseSnapshot) {
+	if exporter == nil {
+		return
+	}
+
+	if err := exporter.push(ctx, newLeaseMetrics(snapshot)); err != nil {
+		slog.Error("otlp export error", "err", err)
+	}
+}
+
+func (exporter *otlpExporter) push(ctx context.Context, metrics *leaseMetrics) error {
+	body, err := json.Marshal(exporter.buildMetricsRequest(metrics))
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, exporter.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext error: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range exporter.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := exporter.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error posting to %v: %w", exporter.endpoint, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("error posting to %v: %v %v", exporter.endpoint, response.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/kvstore"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/oui"
+)
+
+func setupOuiDBCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	flagSet.StringVar(&opts.ouiDBFile, "oui-db", envOrDefault(flagEnvVars["oui-db"], defaultOuiDBFile), "OUI database file (env OUI_DB_FILE)")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if flagSet.NArg() != 1 {
+			flagSet.Usage()
+			return errUsage
+		}
+
+		switch flagSet.Arg(0) {
+		case "compact":
+			return compactOuiDB(&opts)
+		case "verify":
+			return verifyOuiDB(&opts)
+		}
+		flagSet.Usage()
+		return errUsage
+	}
+}
+
+// compactOuiDB rewrites opts.ouiDBFile to reclaim the space freed by
+// earlier imports.
+func compactOuiDB(opts *options) error {
+	sizeBefore, sizeAfter, err := kvstore.CompactBolt(opts.ouiDBFile)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("compacted OUI database", "path", opts.ouiDBFile, "bytesBefore", sizeBefore, "bytesAfter", sizeAfter)
+	return nil
+}
+
+// verifyOuiDB checks the file structure of opts.ouiDBFile and that every
+// prefix and organization in it is valid, logging each problem found.
+func verifyOuiDB(opts *options) error {
+	store, err := kvstore.OpenBolt(opts.ouiDBFile, true)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	checkErrors, err := store.Check()
+	if err != nil {
+		return err
+	}
+	for _, checkError := range checkErrors {
+		slog.Warn("OUI database check error", "path", opts.ouiDBFile, "err", checkError)
+	}
+
+	ouiDB := oui.New(store)
+	problems, err := ouiDB.Verify()
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		slog.Warn("OUI database problem", "path", opts.ouiDBFile, "problem", problem)
+	}
+
+	if count := len(checkErrors) + len(problems); count > 0 {
+		return fmt.Errorf("%v problems found in %v", count, opts.ouiDBFile)
+	}
+
+	count, err := ouiDB.Count()
+	if err != nil {
+		return err
+	}
+	slog.Info("OUI database is valid", "path", opts.ouiDBFile, "prefixes", count)
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/oui"
+)
+
+const (
+	defaultOuiURL             = "https://standards-oui.ieee.org/oui/oui.txt"
+	defaultOuiDownloadTimeout = 5 * time.Minute
+	// minOuiDownloadSize and maxOuiDownloadSize bound the size of a
+	// downloaded registry, to reject error pages and runaway responses. The
+	// IEEE oui.txt is several megabytes.
+	minOuiDownloadSize = 64 * 1024
+	maxOuiDownloadSize = 256 * 1024 * 1024
+
+	ouiDownloadURLMetadataKey  = "downloadURL"
+	ouiETagMetadataKey         = "etag"
+	ouiLastModifiedMetadataKey = "lastModified"
+)
+
+// downloadOuiFile downloads the OUI registry from opts.ouiURL and imports it
+// into ouiDB. The ETag and Last-Modified of the previous download are sent
+// for the same URL so an unchanged registry is not downloaded again.
+func downloadOuiFile(ctx context.Context, opts *options, ouiDB *oui.OUIDB) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.ouiDownloadTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, opts.ouiURL, nil)
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext error: %w", err)
+	}
+	request.Header.Set("User-Agent", "go-dhcp-leases/"+gitCommit)
+
+	downloadURL, err := ouiDB.Metadata(ouiDownloadURLMetadataKey)
+	if err != nil {
+		return err
+	}
+	if downloadURL == opts.ouiURL {
+		etag, err := ouiDB.Metadata(ouiETagMetadataKey)
+		if err != nil {
+			return err
+		}
+		lastModified, err := ouiDB.Metadata(ouiLastModifiedMetadataKey)
+		if err != nil {
+			return err
+		}
+		if etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+		if lastModified != "" {
+			request.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	slog.Info("downloading OUI registry", "url", opts.ouiURL)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("error downloading %v: %w", opts.ouiURL, err)
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotModified:
+		slog.Info("OUI registry not modified since last download", "url", opts.ouiURL)
+		return nil
+	case response.StatusCode != http.StatusOK:
+		return fmt.Errorf("error downloading %v: %v", opts.ouiURL, response.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxOuiDownloadSize+1))
+	if err != nil {
+		return fmt.Errorf("error downloading %v: %w", opts.ouiURL, err)
+	}
+	if err := checkOuiDownload(opts, response, data); err != nil {
+		return fmt.Errorf("error downloading %v: %w", opts.ouiURL, err)
+	}
+	slog.Info("downloaded OUI registry", "url", opts.ouiURL, "bytes", len(data))
+
+	reader, err := decompressingReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error reading %v: %w", opts.ouiURL, err)
+	}
+
+	lineNumber, err := ouiDB.ImportContext(ctx, reader)
+	if err != nil {
+		return fmt.Errorf("error importing %v: %w", opts.ouiURL, err)
+	}
+	slog.Info("read OUI registry", "url", opts.ouiURL, "lines", lineNumber)
+
+	if err := ouiDB.SetMetadata(map[string]string{
+		ouiDownloadURLMetadataKey:  opts.ouiURL,
+		ouiETagMetadataKey:         response.Header.Get("ETag"),
+		ouiLastModifiedMetadataKey: response.Header.Get("Last-Modified"),
+	}); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	return recordOuiDBMetadata(ouiDB, opts.ouiDBFile, map[string]string{
+		ouiSourceMetadataKey:        opts.ouiURL,
+		ouiSourceHashMetadataKey:    hex.EncodeToString(sum[:]),
+		ouiSourceModTimeMetadataKey: "",
+	})
+}
+
+// checkOuiDownload checks the size of data against the response
+// Content-Length and the download size limits, and its SHA-256 checksum
+// against opts.ouiSHA256 if set.
+func checkOuiDownload(opts *options, response *http.Response, data []byte) error {
+	if response.ContentLength >= 0 && int64(len(data)) != response.ContentLength {
+		return fmt.Errorf("received %v bytes, expected Content-Length %v", len(data), response.ContentLength)
+	}
+	if len(data) > maxOuiDownloadSize {
+		return fmt.Errorf("response larger than %v bytes", maxOuiDownloadSize)
+	}
+	if len(data) < minOuiDownloadSize {
+		return fmt.Errorf("response of %v bytes is smaller than %v bytes", len(data), minOuiDownloadSize)
+	}
+
+	if opts.ouiSHA256 != "" {
+		sum := sha256.Sum256(data)
+		if checksum := hex.EncodeToString(sum[:]); !strings.EqualFold(checksum, opts.ouiSHA256) {
+			return fmt.Errorf("SHA-256 checksum %v does not match expected %v", checksum, opts.ouiSHA256)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/oui"
+)
+
+const (
+	defaultOuiMaxAge = 90 * 24 * time.Hour
+
+	ouiBuiltAtMetadataKey = "builtAt"
+	ouiSourceMetadataKey  = "source"
+	ouiCountMetadataKey   = "count"
+
+	ouiSourceHashMetadataKey    = "sourceSHA256"
+	ouiSourceModTimeMetadataKey = "sourceModTime"
+	// ouiCombinedMetadataKey is "true" if the database holds prefixes of
+	// more than one source, so it is not rebuilt from one of them.
+	ouiCombinedMetadataKey = "combined"
+)
+
+// combinedOuiDBMetadata returns the ouiCombinedMetadataKey value of ouiDB
+// after importing source on top of its prefixes.
+func combinedOuiDBMetadata(ouiDB *oui.OUIDB, source string) (string, error) {
+	empty, err := ouiDB.Empty()
+	if err != nil || empty {
+		return "", err
+	}
+	combined, err := ouiDB.Metadata(ouiCombinedMetadataKey)
+	if err != nil {
+		return "", err
+	}
+	previousSource, err := ouiDB.Metadata(ouiSourceMetadataKey)
+	if err != nil {
+		return "", err
+	}
+	if combined == "" && previousSource == source {
+		return "", nil
+	}
+	return "true", nil
+}
+
+// recordOuiDBMetadata stores the build time and number of prefixes of ouiDB
+// after an import, with sourceMetadata describing the source file or URL.
+func recordOuiDBMetadata(ouiDB *oui.OUIDB, ouiDBFile string, sourceMetadata map[string]string) error {
+	count, err := ouiDB.Count()
+	if err != nil {
+		return err
+	}
+
+	metadata := map[string]string{
+		ouiBuiltAtMetadataKey: time.Now().Format(time.RFC3339),
+		ouiCountMetadataKey:   strconv.Itoa(count),
+	}
+	for key, value := range sourceMetadata {
+		metadata[key] = value
+	}
+	if err := ouiDB.SetMetadata(metadata); err != nil {
+		return err
+	}
+
+	slog.Info("built OUI database", "path", ouiDBFile, "prefixes", count)
+	return nil
+}
+
+// ouiDBBuiltAt returns the build time recorded in ouiDB, or the zero time if
+// it was built before build times were recorded.
+func ouiDBBuiltAt(ouiDB *oui.OUIDB) (time.Time, error) {
+	value, err := ouiDB.Metadata(ouiBuiltAtMetadataKey)
+	if err != nil || value == "" {
+		return time.Time{}, err
+	}
+
+	builtAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid OUI database build time '%v': %w", value, err)
+	}
+	return builtAt, nil
+}
+
+// checkOuiDBAge warns if ouiDB was built longer than opts.ouiMaxAge ago or
+// has no build time, or returns an error instead if opts.strict is set.
+// A zero opts.ouiMaxAge disables the check.
+func checkOuiDBAge(ouiDB *oui.OUIDB, opts *options) error {
+	if opts.ouiMaxAge <= 0 {
+		return nil
+	}
+
+	builtAt, err := ouiDBBuiltAt(ouiDB)
+	if err != nil {
+		return err
+	}
+
+	var problem string
+	switch age := time.Since(builtAt); {
+	case builtAt.IsZero():
+		problem = fmt.Sprintf("%v has no build time", opts.ouiDBFile)
+	case age > opts.ouiMaxAge:
+		problem = fmt.Sprintf("%v was built %v ago, more than -oui-max-age %v", opts.ouiDBFile, age.Round(time.Second), opts.ouiMaxAge)
+	default:
+		return nil
+	}
+
+	if opts.strict {
+		return fmt.Errorf("%v; run createdb to rebuild it", problem)
+	}
+	slog.Warn(problem + "; run createdb to rebuild it")
+	return nil
+}
+
+// printOuiDBInfo prints the metadata of the OUI database.
+func printOuiDBInfo(ouiDB *oui.OUIDB, opts *options) error {
+	builtAt, err := ouiDBBuiltAt(ouiDB)
+	if err != nil {
+		return err
+	}
+	source, err := ouiDB.Metadata(ouiSourceMetadataKey)
+	if err != nil {
+		return err
+	}
+	count, err := ouiDB.Count()
+	if err != nil {
+		return err
+	}
+
+	reportPrintf("OUI database: %v", opts.ouiDBFile)
+	if builtAt.IsZero() {
+		reportPrintf("Built:        unknown")
+	} else {
+		reportPrintf("Built:        %v (%v ago)", builtAt.Format(ouputTimeFormatString), time.Since(builtAt).Round(time.Minute))
+	}
+	if source != "" {
+		reportPrintf("Source:       %v", source)
+	}
+	reportPrintf("Prefixes:     %v", count)
+	return nil
+}
+
+// sameOuiSource reports whether source, the file or URL recorded as the
+// source of an OUI database, is the file ouiFile with info fileInfo.
+func sameOuiSource(source string, ouiFile string, fileInfo os.FileInfo) bool {
+	if source == "" || strings.Contains(source, "://") {
+		return false
+	}
+	if source == ouiFile {
+		return true
+	}
+	sourceInfo, err := os.Stat(source)
+	return err == nil && os.SameFile(sourceInfo, fileInfo)
+}
+
+// rebuildOuiDBIfChanged replaces the prefixes of opts.ouiDBFile with those
+// of opts.ouiFile if the file exists and its contents changed since it was
+// last imported, or if the database has no OUI data, so prefixes withdrawn
+// from the file are removed. The modification time is compared first so the
+// file is only hashed when it was touched. A database built from another
+// file, combining several files, or downloaded with createdb -download is
+// left as it is.
+func rebuildOuiDBIfChanged(ctx context.Context, opts *options) error {
+	if !opts.ouiAutoRebuild || opts.ouiFile == "" {
+		return nil
+	}
+
+	fileInfo, err := os.Stat(opts.ouiFile)
+	if err != nil {
+		return nil
+	}
+	modTime := fileInfo.ModTime().Format(time.RFC3339Nano)
+
+	// Check read-only first so the database is only locked for writing
+	// when a rebuild is needed.
+	if _, err := os.Stat(opts.ouiDBFile); err == nil {
+		ouiDB, err := oui.Open(opts.ouiDBFile, true)
+		if err != nil {
+			return err
+		}
+		empty, err := ouiDB.Empty()
+		if err != nil {
+			ouiDB.Close()
+			return err
+		}
+		source, err := ouiDB.Metadata(ouiSourceMetadataKey)
+		if err != nil {
+			ouiDB.Close()
+			return err
+		}
+		combined, err := ouiDB.Metadata(ouiCombinedMetadataKey)
+		if err != nil {
+			ouiDB.Close()
+			return err
+		}
+		recordedModTime, err := ouiDB.Metadata(ouiSourceModTimeMetadataKey)
+		ouiDB.Close()
+		if err != nil {
+			return err
+		}
+		if !empty && !sameOuiSource(source, opts.ouiFile, fileInfo) {
+			slog.Debug("OUI database built from another source, not rebuilding", "path", opts.ouiDBFile, "source", source, "ouiFile", opts.ouiFile)
+			return nil
+		}
+		if !empty && combined != "" {
+			slog.Debug("OUI database combines several sources, not rebuilding", "path", opts.ouiDBFile, "ouiFile", opts.ouiFile)
+			return nil
+		}
+		if recordedModTime == modTime {
+			return nil
+		}
+	}
+
+	ouiDB, err := oui.Open(opts.ouiDBFile, false)
+	if err != nil {
+		return err
+	}
+	defer ouiDB.Close()
+
+	empty, err := ouiDB.Empty()
+	if err != nil {
+		return err
+	}
+	recordedHash, err := ouiDB.Metadata(ouiSourceHashMetadataKey)
+	if err != nil {
+		return err
+	}
+
+	if !empty && recordedHash != "" {
+		hash, err := hashFile(opts.ouiFile)
+		if err != nil {
+			return err
+		}
+		if hash == recordedHash {
+			return ouiDB.SetMetadata(map[string]string{ouiSourceModTimeMetadataKey: modTime})
+		}
+	}
+
+	if empty {
+		slog.Info("building OUI database", "path", opts.ouiDBFile, "ouiFile", opts.ouiFile)
+	} else {
+		slog.Info("OUI file changed, rebuilding OUI database", "path", opts.ouiDBFile, "ouiFile", opts.ouiFile)
+	}
+	return importOuiFile(ctx, opts, ouiDB, true)
+}
+
+// hashFile returns the SHA-256 checksum of the file at path in hex.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %v: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error reading %v: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// memoryOuiFile caches the MemoryDB loaded from an OUI file by
+// loadMemoryOrganizationDB until the file changes.
+var memoryOuiFile struct {
+	mutex    sync.Mutex
+	path     string
+	modTime  time.Time
+	memoryDB *oui.MemoryDB
+}
+
+// loadMemoryOrganizationDB returns opts.ouiFile loaded into memory, or the
+// embedded OUI registry snapshot if the file does not exist, without
+// opening opts.ouiDBFile.
+func loadMemoryOrganizationDB(ctx context.Context, opts *options) (organizationDB, error) {
+	fileInfo, err := os.Stat(opts.ouiFile)
+	if opts.ouiFile == "" || errors.Is(err, fs.ErrNotExist) {
+		slog.Info("using embedded OUI data", "date", oui.EmbeddedDate)
+		return oui.Embedded()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file %v: %w", opts.ouiFile, err)
+	}
+
+	memoryOuiFile.mutex.Lock()
+	defer memoryOuiFile.mutex.Unlock()
+
+	if memoryOuiFile.memoryDB != nil && memoryOuiFile.path == opts.ouiFile && memoryOuiFile.modTime.Equal(fileInfo.ModTime()) {
+		return memoryOuiFile.memoryDB, nil
+	}
+
+	file, err := os.Open(opts.ouiFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %v: %w", opts.ouiFile, err)
+	}
+	defer file.Close()
+
+	reader, err := decompressingReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %w", opts.ouiFile, err)
+	}
+
+	memoryDB := oui.NewMemoryDB()
+	if _, err := memoryDB.ImportContext(ctx, reader); err != nil {
+		return nil, fmt.Errorf("error importing %v: %w", opts.ouiFile, err)
+	}
+	slog.Info("loaded OUI file", "path", opts.ouiFile, "prefixes", memoryDB.Len())
+
+	memoryOuiFile.path = opts.ouiFile
+	memoryOuiFile.modTime = fileInfo.ModTime()
+	memoryOuiFile.memoryDB = memoryDB
+	return memoryDB, nil
+}
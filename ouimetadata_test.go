@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/inventory"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/oui"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/snapshots"
+)
+
+const (
+	ciscoOuiTxt = `00-00-0C   (hex)		Cisco Systems, Inc
+00000C     (base 16)		Cisco Systems, Inc
+`
+	xeroxOuiTxt = `00-00-01   (hex)		XEROX CORPORATION
+000001     (base 16)		XEROX CORPORATION
+`
+)
+
+// ouiTestOptions returns options for an OUI file and OUI database in a
+// temporary directory.
+func ouiTestOptions(t *testing.T) *options {
+	dir := t.TempDir()
+	return &options{
+		ouiFile:        filepath.Join(dir, "oui.txt"),
+		ouiDBFile:      filepath.Join(dir, "oui.db"),
+		ouiAutoRebuild: true,
+	}
+}
+
+// writeOuiFile writes text to opts.ouiFile with a modification time of
+// modTime, so rebuildOuiDBIfChanged sees every write as a change.
+func writeOuiFile(t *testing.T, opts *options, text string, modTime time.Time) {
+	if err := os.WriteFile(opts.ouiFile, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(opts.ouiFile, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func lookupTestOuiDB(t *testing.T, opts *options, mac string) (string, bool) {
+	ouiDB, err := oui.Open(opts.ouiDBFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ouiDB.Close()
+
+	macAddress, _ := net.ParseMAC(mac)
+	organization, found, err := ouiDB.Lookup(macAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return organization, found
+}
+
+func TestRebuildOuiDBIfChanged(t *testing.T) {
+	opts := ouiTestOptions(t)
+	modTime := time.Date(2020, 6, 26, 22, 0, 0, 0, time.UTC)
+
+	writeOuiFile(t, opts, ciscoOuiTxt, modTime)
+	if err := rebuildOuiDBIfChanged(context.Background(), opts); err != nil {
+		t.Fatalf("rebuildOuiDBIfChanged error: %v", err)
+	}
+	if organization, found := lookupTestOuiDB(t, opts, "00:00:0c:01:02:03"); !found {
+		t.Fatalf("Lookup after first build = %q, %v, want Cisco", organization, found)
+	}
+
+	// The device inventory and snapshots share the database and must
+	// survive a rebuild.
+	macAddress, _ := net.ParseMAC("00:00:0c:01:02:03")
+	inventoryDB, err := inventory.Open(opts.ouiDBFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = inventoryDB.Record([]*inventory.Device{{MACAddress: macAddress, FirstSeen: modTime, LastSeen: modTime, IPAddress: net.ParseIP("10.0.0.1")}})
+	inventoryDB.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshotDB, err := snapshots.Open(opts.ouiDBFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = snapshotDB.Record(&snapshots.Snapshot{Time: modTime, Leases: []snapshots.Lease{{IPAddress: "10.0.0.1", StartTime: modTime}}})
+	snapshotDB.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeOuiFile(t, opts, xeroxOuiTxt, modTime.Add(time.Hour))
+	if err := rebuildOuiDBIfChanged(context.Background(), opts); err != nil {
+		t.Fatalf("rebuildOuiDBIfChanged error: %v", err)
+	}
+	if organization, found := lookupTestOuiDB(t, opts, "00:00:0c:01:02:03"); found {
+		t.Errorf("Lookup of withdrawn prefix = %q, want not found", organization)
+	}
+	if organization, _ := lookupTestOuiDB(t, opts, "00:00:01:01:02:03"); organization != "XEROX CORPORATION" {
+		t.Errorf("Lookup of new prefix = %q, want XEROX CORPORATION", organization)
+	}
+
+	inventoryDB, err = inventory.Open(opts.ouiDBFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices, err := inventoryDB.Devices()
+	inventoryDB.Close()
+	if err != nil || len(devices) != 1 {
+		t.Errorf("after rebuild got devices %v, %v, want the recorded device", devices, err)
+	}
+	snapshotDB, err = snapshots.Open(opts.ouiDBFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := snapshotDB.At(modTime)
+	snapshotDB.Close()
+	if err != nil || snapshot == nil {
+		t.Errorf("after rebuild got snapshot %v, %v, want the recorded snapshot", snapshot, err)
+	}
+}
+
+func TestCreateOuiDBCombinesFiles(t *testing.T) {
+	opts := ouiTestOptions(t)
+	xeroxFile := filepath.Join(filepath.Dir(opts.ouiFile), "xerox.txt")
+	modTime := time.Date(2020, 6, 26, 22, 0, 0, 0, time.UTC)
+
+	writeOuiFile(t, opts, ciscoOuiTxt, modTime)
+	if err := os.WriteFile(xeroxFile, []byte(xeroxOuiTxt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, ouiFile := range []string{opts.ouiFile, xeroxFile} {
+		createOpts := *opts
+		createOpts.ouiFile = ouiFile
+		if err := createOuiDB(context.Background(), &createOpts); err != nil {
+			t.Fatalf("createOuiDB(%v) error: %v", ouiFile, err)
+		}
+	}
+
+	// Changing one of the combined files does not rebuild the database
+	// from it alone.
+	opts.ouiFile = xeroxFile
+	writeOuiFile(t, opts, xeroxOuiTxt+"\n", modTime.Add(time.Hour))
+	if err := rebuildOuiDBIfChanged(context.Background(), opts); err != nil {
+		t.Fatalf("rebuildOuiDBIfChanged error: %v", err)
+	}
+	for _, mac := range []string{"00:00:0c:01:02:03", "00:00:01:01:02:03"} {
+		if organization, found := lookupTestOuiDB(t, opts, mac); !found {
+			t.Errorf("Lookup(%v) = %q, %v, want the combined prefix", mac, organization, found)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+// Package dhcpdconf reads declarations from ISC dhcpd.conf files.
+package dhcpdconf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Host is a host declaration.
+type Host struct {
+	Name           string
+	MACAddress     net.HardwareAddr
+	FixedAddresses []net.IP
+	// Hostname is from option host-name, empty if absent.
+	Hostname string
+}
+
+// Range is an IPv4 address range from a range statement.
+type Range struct {
+	Start net.IP
+	End   net.IP
+}
+
+func (r Range) String() string {
+	return r.Start.String() + "-" + r.End.String()
+}
+
+// Size returns the number of addresses in r.
+func (r Range) Size() uint64 {
+	return uint64(ipv4ToUint32(r.End)) - uint64(ipv4ToUint32(r.Start)) + 1
+}
+
+// Contains reports whether ip is within r.
+func (r Range) Contains(ip net.IP) bool {
+	if ip.To4() == nil {
+		return false
+	}
+	value := ipv4ToUint32(ip)
+	return value >= ipv4ToUint32(r.Start) && value <= ipv4ToUint32(r.End)
+}
+
+func ipv4ToUint32(ip net.IP) uint32 {
+	ip4 := ip.To4()
+	return uint32(ip4[0])<<24 | uint32(ip4[1])<<16 | uint32(ip4[2])<<8 | uint32(ip4[3])
+}
+
+// Subnet is an IPv4 subnet declaration with the dynamic ranges declared in
+// it, including ranges in its pools and in pools of its shared-network that
+// fall within it.
+type Subnet struct {
+	Network *net.IPNet
+	Ranges  []Range
+}
+
+// Config holds the declarations read from a dhcpd.conf file and the files it
+// includes.
+type Config struct {
+	Hosts   []Host
+	Subnets []*Subnet
+}
+
+// statement is a statement or declaration and, if it is followed by a block
+// in braces, the statements within the block.
+type statement struct {
+	tokens     []string
+	block      []statement
+	hasBlock   bool
+	lineNumber int
+}
+
+// ParseError describes a line of a dhcpd.conf file that cannot be parsed.
+type ParseError struct {
+	Line   int
+	Reason string
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("line %v: %v", err.Line, err.Reason)
+}
+
+// parseErrorf returns a ParseError for line with a formatted reason.
+func parseErrorf(line int, format string, args ...interface{}) error {
+	return &ParseError{Line: line, Reason: fmt.Sprintf(format, args...)}
+}
+
+type tokenizer struct {
+	reader     *bufio.Reader
+	lineNumber int
+}
+
+func (t *tokenizer) errorf(format string, args ...interface{}) error {
+	return parseErrorf(t.lineNumber, format, args...)
+}
+
+// next returns the next token, or io.EOF. Quoted strings are returned with
+// their quotes so they can be told apart from keywords.
+func (t *tokenizer) next() (string, error) {
+	for {
+		c, err := t.reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case c == '\n':
+			t.lineNumber++
+		case c == ' ' || c == '\t' || c == '\r':
+		case c == '#':
+			if _, err := t.reader.ReadString('\n'); err != nil {
+				return "", err
+			}
+			t.lineNumber++
+		case c == '{' || c == '}' || c == ';':
+			return string(c), nil
+		case c == '"':
+			var builder strings.Builder
+			builder.WriteByte(c)
+			for {
+				c, err := t.reader.ReadByte()
+				if err != nil {
+					return "", t.errorf("unterminated string")
+				}
+				builder.WriteByte(c)
+				if c == '\\' {
+					escaped, err := t.reader.ReadByte()
+					if err != nil {
+						return "", t.errorf("unterminated string")
+					}
+					builder.WriteByte(escaped)
+					continue
+				}
+				if c == '\n' {
+					t.lineNumber++
+				}
+				if c == '"' {
+					return builder.String(), nil
+				}
+			}
+		default:
+			var builder strings.Builder
+			builder.WriteByte(c)
+			for {
+				peek, err := t.reader.Peek(1)
+				if err != nil || strings.ContainsRune(" \t\r\n{};#\"", rune(peek[0])) {
+					return builder.String(), nil
+				}
+				t.reader.ReadByte()
+				builder.WriteByte(peek[0])
+			}
+		}
+	}
+}
+
+// parseStatements reads statements until the end of input, or until the
+// closing brace of the enclosing block if inBlock is true.
+func (t *tokenizer) parseStatements(inBlock bool) ([]statement, error) {
+	var statements []statement
+	var current statement
+
+	for {
+		token, err := t.next()
+		if err == io.EOF {
+			if inBlock {
+				return nil, t.errorf("missing }")
+			}
+			if len(current.tokens) > 0 {
+				return nil, t.errorf("missing ; after '%v'", strings.Join(current.tokens, " "))
+			}
+			return statements, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch token {
+		case ";":
+			if len(current.tokens) > 0 {
+				statements = append(statements, current)
+			}
+			current = statement{}
+		case "{":
+			current.block, err = t.parseStatements(true)
+			if err != nil {
+				return nil, err
+			}
+			current.hasBlock = true
+			statements = append(statements, current)
+			current = statement{}
+		case "}":
+			if !inBlock {
+				return nil, t.errorf("unexpected }")
+			}
+			if len(current.tokens) > 0 {
+				return nil, t.errorf("missing ; after '%v'", strings.Join(current.tokens, " "))
+			}
+			return statements, nil
+		default:
+			if len(current.tokens) == 0 {
+				current.lineNumber = t.lineNumber
+			}
+			current.tokens = append(current.tokens, token)
+		}
+	}
+}
+
+// unquote returns token without surrounding double quotes.
+func unquote(token string) string {
+	if len(token) >= 2 && strings.HasPrefix(token, "\"") && strings.HasSuffix(token, "\"") {
+		return token[1 : len(token)-1]
+	}
+	return token
+}
+
+// parser builds a Config from statements, following include statements.
+type parser struct {
+	config *Config
+	dir    string
+	// including holds the absolute paths of the files being parsed, to
+	// detect include cycles.
+	including map[string]bool
+	// sharedRanges are ranges declared outside any subnet, in pools of a
+	// shared-network, assigned to subnets once all subnets are known.
+	sharedRanges []Range
+}
+
+func (p *parser) parseHost(name string, block []statement) error {
+	host := Host{Name: name}
+
+	for _, stmt := range block {
+		tokens := stmt.tokens
+		switch {
+		case len(tokens) == 3 && tokens[0] == "hardware" && tokens[1] == "ethernet":
+			mac, err := net.ParseMAC(tokens[2])
+			if err != nil {
+				return parseErrorf(stmt.lineNumber, "error parsing host %v mac '%v' %v", name, tokens[2], err)
+			}
+			host.MACAddress = mac
+		case len(tokens) >= 2 && tokens[0] == "fixed-address":
+			for _, address := range strings.Split(strings.Join(tokens[1:], ""), ",") {
+				// Fixed addresses may also be DNS names, which are not
+				// resolved here.
+				if ip := net.ParseIP(address); ip != nil {
+					host.FixedAddresses = append(host.FixedAddresses, ip)
+				}
+			}
+		case len(tokens) == 3 && tokens[0] == "option" && tokens[1] == "host-name":
+			host.Hostname = unquote(tokens[2])
+		}
+	}
+
+	p.config.Hosts = append(p.config.Hosts, host)
+	return nil
+}
+
+func (p *parser) parseRange(stmt statement) (Range, error) {
+	tokens := stmt.tokens[1:]
+	if len(tokens) > 0 && tokens[0] == "dynamic-bootp" {
+		tokens = tokens[1:]
+	}
+	if len(tokens) < 1 || len(tokens) > 2 {
+		return Range{}, parseErrorf(stmt.lineNumber, "error parsing range '%v'", strings.Join(stmt.tokens, " "))
+	}
+
+	r := Range{Start: net.ParseIP(tokens[0]).To4()}
+	r.End = r.Start
+	if len(tokens) == 2 {
+		r.End = net.ParseIP(tokens[1]).To4()
+	}
+	if r.Start == nil || r.End == nil || ipv4ToUint32(r.Start) > ipv4ToUint32(r.End) {
+		return Range{}, parseErrorf(stmt.lineNumber, "error parsing range '%v'", strings.Join(stmt.tokens, " "))
+	}
+	return r, nil
+}
+
+func (p *parser) parseSubnet(stmt statement) (*Subnet, error) {
+	tokens := stmt.tokens
+	if len(tokens) != 4 || tokens[2] != "netmask" {
+		return nil, parseErrorf(stmt.lineNumber, "error parsing subnet '%v'", strings.Join(tokens, " "))
+	}
+
+	ip := net.ParseIP(tokens[1]).To4()
+	mask := net.ParseIP(tokens[3]).To4()
+	if ip == nil || mask == nil {
+		return nil, parseErrorf(stmt.lineNumber, "error parsing subnet '%v'", strings.Join(tokens, " "))
+	}
+
+	subnet := &Subnet{
+		Network: &net.IPNet{
+			IP:   ip.Mask(net.IPMask(mask)),
+			Mask: net.IPMask(mask),
+		},
+	}
+	p.config.Subnets = append(p.config.Subnets, subnet)
+	return subnet, nil
+}
+
+// walk reads declarations from statements. subnet is the enclosing subnet,
+// or nil outside of subnets.
+func (p *parser) walk(statements []statement, subnet *Subnet) error {
+	for _, stmt := range statements {
+		tokens := stmt.tokens
+		switch {
+		case stmt.hasBlock && len(tokens) == 2 && tokens[0] == "host":
+			if err := p.parseHost(unquote(tokens[1]), stmt.block); err != nil {
+				return err
+			}
+		case stmt.hasBlock && len(tokens) > 0 && tokens[0] == "subnet":
+			innerSubnet, err := p.parseSubnet(stmt)
+			if err != nil {
+				return err
+			}
+			if err := p.walk(stmt.block, innerSubnet); err != nil {
+				return err
+			}
+		case stmt.hasBlock:
+			// Hosts and pools may be declared within groups,
+			// shared-networks, and other blocks.
+			if err := p.walk(stmt.block, subnet); err != nil {
+				return err
+			}
+		case len(tokens) > 0 && tokens[0] == "range":
+			r, err := p.parseRange(stmt)
+			if err != nil {
+				return err
+			}
+			if subnet != nil {
+				subnet.Ranges = append(subnet.Ranges, r)
+			} else {
+				p.sharedRanges = append(p.sharedRanges, r)
+			}
+		case len(tokens) == 2 && tokens[0] == "include":
+			includePath := unquote(tokens[1])
+			if !filepath.IsAbs(includePath) && p.dir != "" {
+				includePath = filepath.Join(p.dir, includePath)
+			}
+			if absPath, err := filepath.Abs(includePath); err == nil && p.including[absPath] {
+				return parseErrorf(stmt.lineNumber, "include cycle through %v", includePath)
+			}
+			if err := p.parseFile(includePath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) parse(r io.Reader) error {
+	t := &tokenizer{
+		reader:     bufio.NewReader(r),
+		lineNumber: 1,
+	}
+	statements, err := t.parseStatements(false)
+	if err != nil {
+		return err
+	}
+	return p.walk(statements, nil)
+}
+
+// assignSharedRanges adds each range declared in a shared-network pool to
+// the subnet containing its start address.
+func (p *parser) assignSharedRanges() {
+	for _, r := range p.sharedRanges {
+		for _, subnet := range p.config.Subnets {
+			if subnet.Network.Contains(r.Start) {
+				subnet.Ranges = append(subnet.Ranges, r)
+				break
+			}
+		}
+	}
+}
+
+func (p *parser) parseFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file %v: %w", path, err)
+	}
+	defer file.Close()
+
+	if absPath, err := filepath.Abs(path); err == nil {
+		if p.including == nil {
+			p.including = make(map[string]bool)
+		}
+		p.including[absPath] = true
+		defer delete(p.including, absPath)
+	}
+
+	if err := p.parse(file); err != nil {
+		return fmt.Errorf("error parsing %v: %w", path, err)
+	}
+	return nil
+}
+
+// Parse reads declarations from r. Include statements are resolved
+// relative to the current directory.
+func Parse(r io.Reader) (*Config, error) {
+	p := &parser{config: &Config{}}
+	if err := p.parse(r); err != nil {
+		return nil, err
+	}
+	p.assignSharedRanges()
+	return p.config, nil
+}
+
+// ParseFile reads declarations from the file at path and the files it
+// includes. Relative include paths are resolved against the directory of
+// path.
+func ParseFile(path string) (*Config, error) {
+	p := &parser{
+		config: &Config{},
+		dir:    filepath.Dir(path),
+	}
+	if err := p.parseFile(path); err != nil {
+		return nil, err
+	}
+	p.assignSharedRanges()
+	return p.config, nil
+}
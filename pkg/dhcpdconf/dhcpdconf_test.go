@@ -0,0 +1,146 @@
+package dhcpdconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConf = `
+# Comments and options are ignored.
+option domain-name "example.com";
+
+subnet 10.0.0.0 netmask 255.255.255.0 {
+  range 10.0.0.100 10.0.0.199;
+  pool {
+    range dynamic-bootp 10.0.0.200 10.0.0.209;
+  }
+  host printer {
+    hardware ethernet 00:11:22:33:44:55;
+    fixed-address 10.0.0.5, 10.0.0.6;
+    option host-name "laser";
+  }
+}
+
+shared-network lab {
+  subnet 10.1.0.0 netmask 255.255.0.0 { }
+  pool {
+    range 10.1.2.1 10.1.2.10;
+  }
+}
+
+group {
+  host "nas" {
+    hardware ethernet aa:bb:cc:dd:ee:ff;
+    fixed-address nas.example.com;
+  }
+}
+`
+
+func TestParse(t *testing.T) {
+	config, err := Parse(strings.NewReader(testConf))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	if len(config.Hosts) != 2 {
+		t.Fatalf("got %v hosts, want 2", len(config.Hosts))
+	}
+	printer := config.Hosts[0]
+	if printer.Name != "printer" || printer.Hostname != "laser" || printer.MACAddress.String() != "00:11:22:33:44:55" {
+		t.Errorf("got host %+v, want printer", printer)
+	}
+	if len(printer.FixedAddresses) != 2 || printer.FixedAddresses[0].String() != "10.0.0.5" || printer.FixedAddresses[1].String() != "10.0.0.6" {
+		t.Errorf("got fixed addresses %v, want 10.0.0.5 and 10.0.0.6", printer.FixedAddresses)
+	}
+	if nas := config.Hosts[1]; nas.Name != "nas" || len(nas.FixedAddresses) != 0 {
+		t.Errorf("got host %+v, want nas without resolved fixed addresses", nas)
+	}
+
+	for _, test := range []struct {
+		network string
+		ranges  []string
+	}{
+		{"10.0.0.0/24", []string{"10.0.0.100-10.0.0.199", "10.0.0.200-10.0.0.209"}},
+		{"10.1.0.0/16", []string{"10.1.2.1-10.1.2.10"}},
+	} {
+		var subnet *Subnet
+		for _, s := range config.Subnets {
+			if s.Network.String() == test.network {
+				subnet = s
+			}
+		}
+		if subnet == nil {
+			t.Errorf("subnet %v not found", test.network)
+			continue
+		}
+		var ranges []string
+		for _, r := range subnet.Ranges {
+			ranges = append(ranges, r.String())
+		}
+		if strings.Join(ranges, " ") != strings.Join(test.ranges, " ") {
+			t.Errorf("subnet %v ranges = %v, want %v", test.network, ranges, test.ranges)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		conf    string
+		wantErr string
+	}{
+		{"missing brace", "subnet 10.0.0.0 netmask 255.0.0.0 {\n", "missing }"},
+		{"unexpected brace", "}\n", "unexpected }"},
+		{"missing semicolon", "host a {\n  fixed-address 10.0.0.1\n}\n", "missing ; after 'fixed-address 10.0.0.1'"},
+		{"unterminated string", "option domain-name \"example.com;\n", "unterminated string"},
+		{"bad mac", "host a { hardware ethernet zz; }\n", "error parsing host a mac"},
+		{"bad range", "subnet 10.0.0.0 netmask 255.0.0.0 { range 10.0.0.9 10.0.0.1; }\n", "error parsing range"},
+		{"bad subnet", "subnet 10.0.0.0 { }\n", "error parsing subnet"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.conf))
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Parse error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFileInclude(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hosts.conf"), []byte("host a { hardware ethernet 00:00:00:00:00:01; fixed-address 10.0.0.1; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "dhcpd.conf")
+	if err := os.WriteFile(path, []byte("include \"hosts.conf\";\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ParseFile(path)
+	if err != nil {
+		t.Fatalf("ParseFile error: %v", err)
+	}
+	if len(config.Hosts) != 1 || config.Hosts[0].Name != "a" {
+		t.Errorf("got hosts %+v, want host a from the included file", config.Hosts)
+	}
+}
+
+func TestParseFileIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hosts.conf"), []byte("host a { hardware ethernet 00:00:00:00:00:01; }\ninclude \"dhcpd.conf\";\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "dhcpd.conf")
+	if err := os.WriteFile(path, []byte("include \"hosts.conf\";\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ParseFile(path)
+	var parseError *ParseError
+	if !errors.As(err, &parseError) || parseError.Line != 2 || !strings.Contains(parseError.Reason, "include cycle") {
+		t.Errorf("ParseFile error = %v, want include cycle on line 2", err)
+	}
+}
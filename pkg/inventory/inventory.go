@@ -0,0 +1,154 @@
+// Package inventory records every MAC address observed in leases files.
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/kvstore"
+)
+
+const devicesBucket = "devices"
+
+// Device is the inventory entry for one MAC address.
+type Device struct {
+	MACAddress net.HardwareAddr
+	// FirstSeen and LastSeen are the earliest lease start time and the
+	// latest lease start or last transaction time observed for the MAC.
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// IPAddress and Hostname are from the lease last seen.
+	IPAddress net.IP
+	Hostname  string
+}
+
+// Merge updates device with the observations in other, which must be for
+// the same MAC address. An empty hostname in other does not replace the
+// hostname of device.
+func (device *Device) Merge(other *Device) {
+	if device.FirstSeen.IsZero() || (!other.FirstSeen.IsZero() && other.FirstSeen.Before(device.FirstSeen)) {
+		device.FirstSeen = other.FirstSeen
+	}
+
+	if other.LastSeen.Before(device.LastSeen) {
+		return
+	}
+	device.LastSeen = other.LastSeen
+	device.IPAddress = other.IPAddress
+	if other.Hostname != "" {
+		device.Hostname = other.Hostname
+	}
+}
+
+type deviceJSON struct {
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	IPAddress string    `json:"ipAddress"`
+	Hostname  string    `json:"hostname,omitempty"`
+}
+
+// DB is a kvstore.Store bucket of devices keyed by MAC address. It may share
+// a store with an oui.OUIDB.
+type DB struct {
+	store kvstore.Store
+}
+
+// Open opens the bbolt inventory database at path, creating it and
+// its parent directories if readOnly is false.
+func Open(path string, readOnly bool) (*DB, error) {
+	store, err := kvstore.OpenBolt(path, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return New(store), nil
+}
+
+// New returns an inventory DB stored in store.
+func New(store kvstore.Store) *DB {
+	return &DB{store: store}
+}
+
+// Close closes the store of the database.
+func (inventoryDB *DB) Close() error {
+	return inventoryDB.store.Close()
+}
+
+func decodeDevice(key []byte, value []byte) (*Device, error) {
+	macAddress, err := net.ParseMAC(string(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid device key %q: %w", key, err)
+	}
+
+	var decoded deviceJSON
+	if err := json.Unmarshal(value, &decoded); err != nil {
+		return nil, fmt.Errorf("invalid device %v: %w", macAddress, err)
+	}
+
+	return &Device{
+		MACAddress: macAddress,
+		FirstSeen:  decoded.FirstSeen,
+		LastSeen:   decoded.LastSeen,
+		IPAddress:  net.ParseIP(decoded.IPAddress),
+		Hostname:   decoded.Hostname,
+	}, nil
+}
+
+// Record merges devices into the database in a single transaction.
+func (inventoryDB *DB) Record(devices []*Device) error {
+	if err := inventoryDB.store.Batch(func(tx kvstore.Tx) error {
+		for _, device := range devices {
+			key := []byte(device.MACAddress.String())
+
+			merged := *device
+			if value := tx.Get(devicesBucket, key); value != nil {
+				stored, err := decodeDevice(key, value)
+				if err != nil {
+					return err
+				}
+				stored.Merge(device)
+				merged = *stored
+			}
+
+			value, err := json.Marshal(deviceJSON{
+				FirstSeen: merged.FirstSeen,
+				LastSeen:  merged.LastSeen,
+				IPAddress: merged.IPAddress.String(),
+				Hostname:  merged.Hostname,
+			})
+			if err != nil {
+				return err
+			}
+			if err := tx.Put(devicesBucket, key, value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("db.Update error: %w", err)
+	}
+
+	return nil
+}
+
+// Devices returns every device in the database, sorted by MAC address.
+func (inventoryDB *DB) Devices() ([]*Device, error) {
+	var devices []*Device
+
+	if err := inventoryDB.store.View(func(tx kvstore.Tx) error {
+		return tx.ForEach(devicesBucket, nil, func(key []byte, value []byte) error {
+			device, err := decodeDevice(key, value)
+			if err != nil {
+				return err
+			}
+			devices = append(devices, device)
+			return nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("db.View error: %w", err)
+	}
+
+	return devices, nil
+}
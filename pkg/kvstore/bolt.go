@@ -0,0 +1,186 @@
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+)
+
+// boltLockTimeout is how long OpenBolt waits for the file lock of a database
+// held by another process.
+var boltLockTimeout = 5 * time.Second
+
+// BoltStore is a Store in a bbolt database file.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the bbolt database at path, creating it and its parent
+// directories if readOnly is false. It returns ErrLocked if another process
+// keeps the database locked for longer than boltLockTimeout.
+func OpenBolt(path string, readOnly bool) (*BoltStore, error) {
+	if !readOnly {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %v: %w", path, err)
+		}
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: readOnly, Timeout: boltLockTimeout})
+	if errors.Is(err, berrors.ErrTimeout) {
+		return nil, fmt.Errorf("%v: %w by another process, waited %v", path, ErrLocked, boltLockTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bolt.Open error: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (store *BoltStore) Get(bucket string, key []byte) ([]byte, error) {
+	var value []byte
+	err := store.View(func(tx Tx) error {
+		value = bytes.Clone(tx.Get(bucket, key))
+		return nil
+	})
+	return value, err
+}
+
+func (store *BoltStore) Put(bucket string, key []byte, value []byte) error {
+	return store.Batch(func(tx Tx) error {
+		return tx.Put(bucket, key, value)
+	})
+}
+
+func (store *BoltStore) View(fn func(tx Tx) error) error {
+	return store.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx: tx})
+	})
+}
+
+func (store *BoltStore) Batch(fn func(tx Tx) error) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx: tx})
+	})
+}
+
+func (store *BoltStore) Close() error {
+	return store.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (tx boltTx) Get(bucket string, key []byte) []byte {
+	if boltBucket := tx.tx.Bucket([]byte(bucket)); boltBucket != nil {
+		return boltBucket.Get(key)
+	}
+	return nil
+}
+
+func (tx boltTx) Put(bucket string, key []byte, value []byte) error {
+	boltBucket, err := tx.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
+	return boltBucket.Put(key, value)
+}
+
+func (tx boltTx) Delete(bucket string, key []byte) error {
+	if boltBucket := tx.tx.Bucket([]byte(bucket)); boltBucket != nil {
+		return boltBucket.Delete(key)
+	}
+	return nil
+}
+
+func (tx boltTx) DeleteBucket(bucket string) error {
+	if tx.tx.Bucket([]byte(bucket)) == nil {
+		return nil
+	}
+	return tx.tx.DeleteBucket([]byte(bucket))
+}
+
+func (tx boltTx) ForEach(bucket string, start []byte, fn func(key []byte, value []byte) error) error {
+	boltBucket := tx.tx.Bucket([]byte(bucket))
+	if boltBucket == nil {
+		return nil
+	}
+
+	cursor := boltBucket.Cursor()
+	key, value := cursor.First()
+	if start != nil {
+		key, value = cursor.Seek(start)
+	}
+	for ; key != nil; key, value = cursor.Next() {
+		if err := fn(key, value); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Check verifies the page structure of the database, returning the errors
+// found.
+func (store *BoltStore) Check() ([]error, error) {
+	var problems []error
+	err := store.db.View(func(tx *bolt.Tx) error {
+		for problem := range tx.Check() {
+			problems = append(problems, problem)
+		}
+		return nil
+	})
+	return problems, err
+}
+
+// compactTxMaxSize is the size of the transactions copying a database in
+// CompactBolt.
+const compactTxMaxSize = 64 * 1024 * 1024
+
+// CompactBolt rewrites the bbolt database at path without free pages,
+// replacing it once the copy is complete. It returns the file sizes before
+// and after. The database must not be open for writing elsewhere.
+func CompactBolt(path string) (int64, int64, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat file %v: %w", path, err)
+	}
+
+	src, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return 0, 0, fmt.Errorf("bolt.Open error: %w", err)
+	}
+	defer src.Close()
+
+	tempPath := path + ".compact"
+	defer os.Remove(tempPath)
+
+	dst, err := bolt.Open(tempPath, fileInfo.Mode().Perm(), nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bolt.Open error: %w", err)
+	}
+	if err := bolt.Compact(dst, src, compactTxMaxSize); err != nil {
+		dst.Close()
+		return 0, 0, fmt.Errorf("bolt.Compact error: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return 0, 0, fmt.Errorf("db.Close error: %w", err)
+	}
+
+	compactedInfo, err := os.Stat(tempPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat file %v: %w", tempPath, err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return 0, 0, fmt.Errorf("failed to rename %v to %v: %w", tempPath, path, err)
+	}
+
+	return fileInfo.Size(), compactedInfo.Size(), nil
+}
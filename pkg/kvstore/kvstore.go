@@ -0,0 +1,57 @@
+// Package kvstore is a key-value store of named buckets, with bbolt and
+// in-memory implementations.
+package kvstore
+
+import "errors"
+
+// ErrStop may be returned by a ForEach callback to stop the iteration
+// without an error.
+var ErrStop = errors.New("stop iteration")
+
+// ErrLocked is returned by OpenBolt when another process holds the database
+// open for writing, such as a running server.
+var ErrLocked = errors.New("database is locked")
+
+// Store is a key-value store of named buckets. Keys within a bucket are
+// ordered bytewise.
+type Store interface {
+	// Get returns a copy of the value of key in bucket, or nil if there is
+	// none.
+	Get(bucket string, key []byte) ([]byte, error)
+	// Put sets the value of key in bucket, creating the bucket if needed.
+	Put(bucket string, key []byte, value []byte) error
+	// View calls fn with a read-only transaction.
+	View(fn func(tx Tx) error) error
+	// Batch calls fn with a read-write transaction, whose writes are applied
+	// atomically if fn returns nil and discarded otherwise.
+	Batch(fn func(tx Tx) error) error
+	// Close closes the store.
+	Close() error
+}
+
+// Tx is a transaction of a Store. Slices returned by or passed to callbacks
+// from a Tx are only valid until the transaction ends.
+type Tx interface {
+	// Get returns the value of key in bucket, or nil if there is none.
+	Get(bucket string, key []byte) []byte
+	// Put sets the value of key in bucket, creating the bucket if needed.
+	Put(bucket string, key []byte, value []byte) error
+	// Delete removes key from bucket.
+	Delete(bucket string, key []byte) error
+	// DeleteBucket removes bucket and all of its keys.
+	DeleteBucket(bucket string) error
+	// ForEach calls fn for each key in bucket at or after start in order,
+	// stopping at the first error. A nil start iterates the whole bucket.
+	// ErrStop stops the iteration and is not returned.
+	ForEach(bucket string, start []byte, fn func(key []byte, value []byte) error) error
+}
+
+// Count returns the number of keys in bucket.
+func Count(tx Tx, bucket string) (int, error) {
+	count := 0
+	err := tx.ForEach(bucket, nil, func(key []byte, value []byte) error {
+		count++
+		return nil
+	})
+	return count, err
+}
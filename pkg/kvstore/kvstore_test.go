@@ -0,0 +1,176 @@
+package kvstore
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testStores returns a MemoryStore and a BoltStore in a temporary directory.
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	boltStore, err := OpenBolt(filepath.Join(t.TempDir(), "test.db"), false)
+	if err != nil {
+		t.Fatalf("OpenBolt error: %v", err)
+	}
+	t.Cleanup(func() { boltStore.Close() })
+
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"bolt":   boltStore,
+	}
+}
+
+func TestStore(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"b", "a", "c"} {
+				if err := store.Put("bucket", []byte(key), []byte("value "+key)); err != nil {
+					t.Fatalf("Put error: %v", err)
+				}
+			}
+
+			value, err := store.Get("bucket", []byte("b"))
+			if err != nil || string(value) != "value b" {
+				t.Errorf("Get = %q, %v, want \"value b\"", value, err)
+			}
+			if value, _ := store.Get("missing", []byte("b")); value != nil {
+				t.Errorf("Get of missing bucket = %q, want nil", value)
+			}
+
+			var keys []string
+			if err := store.View(func(tx Tx) error {
+				return tx.ForEach("bucket", []byte("b"), func(key []byte, value []byte) error {
+					keys = append(keys, string(key))
+					return nil
+				})
+			}); err != nil {
+				t.Fatalf("View error: %v", err)
+			}
+			if want := []string{"b", "c"}; !slices.Equal(keys, want) {
+				t.Errorf("ForEach from b = %v, want %v", keys, want)
+			}
+
+			keys = nil
+			if err := store.View(func(tx Tx) error {
+				return tx.ForEach("bucket", nil, func(key []byte, value []byte) error {
+					keys = append(keys, string(key))
+					return ErrStop
+				})
+			}); err != nil {
+				t.Fatalf("View with ErrStop error: %v", err)
+			}
+			if want := []string{"a"}; !slices.Equal(keys, want) {
+				t.Errorf("ForEach stopped after a = %v, want %v", keys, want)
+			}
+		})
+	}
+}
+
+func TestStoreBatchRollback(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := store.Put("bucket", []byte("kept"), []byte("1")); err != nil {
+				t.Fatalf("Put error: %v", err)
+			}
+
+			errFailed := errors.New("failed")
+			err := store.Batch(func(tx Tx) error {
+				if err := tx.Put("bucket", []byte("discarded"), []byte("2")); err != nil {
+					return err
+				}
+				if err := tx.Delete("bucket", []byte("kept")); err != nil {
+					return err
+				}
+				return errFailed
+			})
+			if !errors.Is(err, errFailed) {
+				t.Fatalf("Batch error = %v, want %v", err, errFailed)
+			}
+
+			var count int
+			store.View(func(tx Tx) error {
+				count, err = Count(tx, "bucket")
+				return err
+			})
+			if value, _ := store.Get("bucket", []byte("kept")); string(value) != "1" || count != 1 {
+				t.Errorf("after failed Batch got kept = %q and %v keys, want 1 and 1 key", value, count)
+			}
+		})
+	}
+}
+
+// bucketKeys returns the keys of bucket in store.
+func bucketKeys(t *testing.T, store Store, bucket string) []string {
+	t.Helper()
+	var keys []string
+	if err := store.View(func(tx Tx) error {
+		return tx.ForEach(bucket, nil, func(key []byte, value []byte) error {
+			keys = append(keys, string(key))
+			return nil
+		})
+	}); err != nil {
+		t.Fatalf("View error: %v", err)
+	}
+	return keys
+}
+
+func TestStoreDeleteBucket(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"a", "b"} {
+				if err := store.Put("bucket", []byte(key), []byte("old")); err != nil {
+					t.Fatalf("Put error: %v", err)
+				}
+			}
+
+			errFailed := errors.New("failed")
+			if err := store.Batch(func(tx Tx) error {
+				if err := tx.DeleteBucket("bucket"); err != nil {
+					return err
+				}
+				return errFailed
+			}); !errors.Is(err, errFailed) {
+				t.Fatalf("Batch error = %v, want %v", err, errFailed)
+			}
+			if keys, want := bucketKeys(t, store, "bucket"), []string{"a", "b"}; !slices.Equal(keys, want) {
+				t.Errorf("after failed Batch got keys %v, want %v", keys, want)
+			}
+
+			if err := store.Batch(func(tx Tx) error {
+				if err := tx.DeleteBucket("missing"); err != nil {
+					return err
+				}
+				if err := tx.DeleteBucket("bucket"); err != nil {
+					return err
+				}
+				return tx.Put("bucket", []byte("c"), []byte("new"))
+			}); err != nil {
+				t.Fatalf("Batch error: %v", err)
+			}
+			if keys, want := bucketKeys(t, store, "bucket"), []string{"c"}; !slices.Equal(keys, want) {
+				t.Errorf("after DeleteBucket got keys %v, want %v", keys, want)
+			}
+		})
+	}
+}
+
+func TestOpenBoltLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	store, err := OpenBolt(path, false)
+	if err != nil {
+		t.Fatalf("OpenBolt error: %v", err)
+	}
+	defer store.Close()
+
+	defer func(timeout time.Duration) { boltLockTimeout = timeout }(boltLockTimeout)
+	boltLockTimeout = 10 * time.Millisecond
+
+	for _, readOnly := range []bool{false, true} {
+		if _, err := OpenBolt(path, readOnly); !errors.Is(err, ErrLocked) {
+			t.Errorf("OpenBolt readOnly %v error = %v, want %v", readOnly, err, ErrLocked)
+		}
+	}
+}
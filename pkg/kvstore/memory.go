@@ -0,0 +1,143 @@
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// MemoryStore is a Store in memory, for deployments that cannot write a
+// database file and for tests.
+type MemoryStore struct {
+	mutex   sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]map[string][]byte)}
+}
+
+func (store *MemoryStore) Get(bucket string, key []byte) ([]byte, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return bytes.Clone(store.buckets[bucket][string(key)]), nil
+}
+
+func (store *MemoryStore) Put(bucket string, key []byte, value []byte) error {
+	return store.Batch(func(tx Tx) error {
+		return tx.Put(bucket, key, value)
+	})
+}
+
+func (store *MemoryStore) View(fn func(tx Tx) error) error {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return fn(&memoryTx{buckets: store.buckets})
+}
+
+// Batch copies each bucket the first time fn writes to it, and replaces the
+// buckets of store with the copies if fn succeeds.
+func (store *MemoryStore) Batch(fn func(tx Tx) error) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	tx := &memoryTx{
+		buckets:  store.buckets,
+		writable: true,
+		copied:   make(map[string]map[string][]byte),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for bucket, values := range tx.copied {
+		store.buckets[bucket] = values
+	}
+	return nil
+}
+
+func (store *MemoryStore) Close() error {
+	return nil
+}
+
+type memoryTx struct {
+	buckets  map[string]map[string][]byte
+	writable bool
+	copied   map[string]map[string][]byte
+}
+
+func (tx *memoryTx) bucket(bucket string) map[string][]byte {
+	if values, ok := tx.copied[bucket]; ok {
+		return values
+	}
+	return tx.buckets[bucket]
+}
+
+// writableBucket returns the copy of bucket written by tx.
+func (tx *memoryTx) writableBucket(bucket string) (map[string][]byte, error) {
+	if !tx.writable {
+		return nil, errors.New("write in read-only transaction")
+	}
+	values, ok := tx.copied[bucket]
+	if !ok {
+		values = maps.Clone(tx.buckets[bucket])
+		if values == nil {
+			values = make(map[string][]byte)
+		}
+		tx.copied[bucket] = values
+	}
+	return values, nil
+}
+
+func (tx *memoryTx) Get(bucket string, key []byte) []byte {
+	return tx.bucket(bucket)[string(key)]
+}
+
+func (tx *memoryTx) Put(bucket string, key []byte, value []byte) error {
+	values, err := tx.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+	values[string(key)] = bytes.Clone(value)
+	return nil
+}
+
+func (tx *memoryTx) Delete(bucket string, key []byte) error {
+	values, err := tx.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+	delete(values, string(key))
+	return nil
+}
+
+func (tx *memoryTx) DeleteBucket(bucket string) error {
+	if !tx.writable {
+		return errors.New("write in read-only transaction")
+	}
+	tx.copied[bucket] = make(map[string][]byte)
+	return nil
+}
+
+func (tx *memoryTx) ForEach(bucket string, start []byte, fn func(key []byte, value []byte) error) error {
+	values := tx.bucket(bucket)
+	keys := slices.Sorted(maps.Keys(values))
+
+	for _, key := range keys {
+		if key < string(start) {
+			continue
+		}
+		if err := fn([]byte(key), values[key]); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package leases
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const keaV4TestHeader = "address,hwaddr,client_id,valid_lifetime,expire,subnet_id,fqdn_fwd,fqdn_rev,hostname,state,user_context\n"
+
+// parseKea returns the leases parsed from text by parser.
+func parseKea(parser *Parser, text string) ([]Lease, error) {
+	var parsed []Lease
+	err := parser.ParseKeaLeasesContext(context.Background(), strings.NewReader(text), func(lease Lease) error {
+		parsed = append(parsed, lease)
+		return nil
+	})
+	return parsed, err
+}
+
+func TestParseKeaLeases(t *testing.T) {
+	parsed, err := parseKea(NewParser(), keaV4TestHeader+
+		"10.0.0.1,00:11:22:33:44:55,01:00:11:22:33:44:55,3600,1593208800,1,0,0,laptop&#x2cwork,0,\n"+
+		"10.0.0.2,00:11:22:33:44:66,,3600,1593205200,1,0,0,,2,\n"+
+		"10.0.0.3,00:11:22:33:44:77,,4294967295,4294967295,1,0,0,,1,\n")
+	if err != nil {
+		t.Fatalf("ParseKeaLeasesContext error: %v", err)
+	}
+	if len(parsed) != 3 {
+		t.Fatalf("got %v leases, want 3", len(parsed))
+	}
+
+	endTime := time.Date(2020, 6, 26, 22, 0, 0, 0, time.UTC)
+	current := parsed[0]
+	if current.Hostname != "laptop,work" || current.MACAddress.String() != "00:11:22:33:44:55" ||
+		!reflect.DeepEqual(current.UID, []byte{1, 0, 0x11, 0x22, 0x33, 0x44, 0x55}) ||
+		!current.EndTime.Equal(endTime) || !current.StartTime.Equal(endTime.Add(-time.Hour)) {
+		t.Errorf("got lease %v uid %x", &current, current.UID)
+	}
+	if state := current.GetState(endTime.Add(-time.Minute)); state != Current {
+		t.Errorf("GetState = %v, want Current", state)
+	}
+
+	// An expired-reclaimed row.
+	expired := parsed[1]
+	if expired.BindingState != "expired" || expired.GetState(endTime) != Past {
+		t.Errorf("got binding state %q state %v, want expired and Past", expired.BindingState, expired.GetState(endTime))
+	}
+
+	// A declined row with an infinite lifetime.
+	declined := parsed[2]
+	if !declined.Abandoned || !declined.EndsNever || declined.GetState(endTime) != Abandoned {
+		t.Errorf("got declined lease %v abandoned %v", &declined, declined.Abandoned)
+	}
+}
+
+func TestParseKeaHeaderOnly(t *testing.T) {
+	parsed, err := parseKea(NewParser(), keaV4TestHeader)
+	if err != nil || len(parsed) != 0 {
+		t.Errorf("got %v leases, error %v, want none", len(parsed), err)
+	}
+}
+
+func TestParseKeaMissingAddressColumn(t *testing.T) {
+	if _, err := parseKea(NewParser(), "hwaddr,expire\n00:11:22:33:44:55,0\n"); err == nil {
+		t.Error("got no error for a header without an address column")
+	}
+}
+
+func TestParseKeaMalformedRows(t *testing.T) {
+	text := keaV4TestHeader +
+		"10.0.0.1,00:11:22:33:44:55,,3600,1593208800,1,0,0,a\"b,0,\n" +
+		"not-an-ip,00:11:22:33:44:66,,3600,1593208800,1,0,0,,0,\n" +
+		"10.0.0.3,00:11:22:33:44:77,,3600,soon,1,0,0,,0,\n" +
+		"10.0.0.4,00:11:22:33:44:88,,3600,1593208800,1,0,0,,0,\n"
+
+	if _, err := parseKea(NewParser(), text); err == nil {
+		t.Fatal("got no error for a malformed row without InvalidLease")
+	}
+
+	var reportedLines []int
+	parser := NewParser()
+	parser.InvalidLease = func(err *ParseError) {
+		reportedLines = append(reportedLines, err.Line)
+	}
+	parsed, err := parseKea(parser, text)
+	if err != nil {
+		t.Fatalf("ParseKeaLeasesContext with InvalidLease error: %v", err)
+	}
+	if want := []int{2, 3, 4}; !reflect.DeepEqual(reportedLines, want) {
+		t.Errorf("got invalid lines %v, want %v", reportedLines, want)
+	}
+	if len(parsed) != 1 || parsed[0].IPAddress.String() != "10.0.0.4" {
+		t.Errorf("got leases %v, want 10.0.0.4 only", parsed)
+	}
+}
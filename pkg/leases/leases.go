@@ -0,0 +1,192 @@
+// Package leases parses ISC dhcpd leases files.
+package leases
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// LeaseState classifies a lease relative to a point in time.
+type LeaseState int
+
+const (
+	// Abandoned lease
+	Abandoned LeaseState = iota
+	// Future lease
+	Future
+	// Current lease
+	Current
+	// Past lease
+	Past
+	// Released lease, given back by the client before it ended
+	Released
+	// Backup lease, free and held by the failover secondary
+	Backup
+	// Static reservation from a dhcpd.conf host declaration
+	Static
+)
+
+// LeaseStates lists all lease states in display order.
+var LeaseStates = []LeaseState{Abandoned, Future, Current, Past, Released, Backup, Static}
+
+func (leaseState LeaseState) String() string {
+	switch leaseState {
+	case Abandoned:
+		return "Abandoned"
+	case Future:
+		return "Future"
+	case Current:
+		return "Current"
+	case Past:
+		return "Past"
+	case Released:
+		return "Released"
+	case Backup:
+		return "Backup"
+	case Static:
+		return "Static"
+	}
+	return "UNKNOWN"
+}
+
+// Lease is a single lease record from a leases file.
+type Lease struct {
+	IPAddress net.IP
+	Count     int
+	StartTime time.Time
+	// EndTime is zero if the lease never ends or has no ends statement.
+	EndTime time.Time
+	// EndsNever is true for leases with "ends never;" or an infinite
+	// lifetime. A lease that has no end time without it has ended.
+	EndsNever  bool
+	ClttTime   time.Time
+	MACAddress net.HardwareAddr
+	Hostname   string
+	Abandoned  bool
+	// Static is true for reservations from dhcpd.conf host declarations,
+	// which have no lease records.
+	Static bool
+
+	// UID is the client identifier from the uid statement, nil if absent.
+	// See DescribeClientID.
+	UID []byte
+
+	// Relay agent information (option 82) sub-options, nil if absent.
+	// See DataString.
+	AgentCircuitID []byte
+	AgentRemoteID  []byte
+
+	// Variables holds set statements such as vendor-class-identifier, with
+	// quoted string values unescaped. Nil if there are none.
+	Variables map[string]string
+
+	// Failover timestamps: the end time sent to the peer (tstp), the end
+	// time the peer acknowledged (tsfp), and the actual end time the peer
+	// acknowledged (atsfp). Zero if absent.
+	TstpTime  time.Time
+	TsfpTime  time.Time
+	AtsfpTime time.Time
+
+	// Binding states from the binding state, next binding state, and rewind
+	// binding state statements, e.g. "active" or "free". Empty if absent.
+	BindingState       string
+	NextBindingState   string
+	RewindBindingState string
+
+	// DHCPv6 fields, set for addresses and prefixes within ia-na, ia-ta,
+	// and ia-pd blocks. MACAddress is derived from DUID when possible.
+	IAType            string
+	IAID              uint32
+	DUID              []byte
+	Prefix            *net.IPNet
+	PreferredLifetime time.Duration
+	ValidLifetime     time.Duration
+}
+
+func (lease *Lease) String() string {
+	return fmt.Sprintf("ipAddress=%v startTime=%v endTime=%v clttTime=%v macAddress=%v hostname=%v", lease.IPAddress.String(), lease.StartTime, lease.EndTime, lease.ClttTime, lease.MACAddress.String(), lease.Hostname)
+}
+
+// AddressString returns the delegated prefix for ia-pd leases and the IP
+// address otherwise.
+func (lease *Lease) AddressString() string {
+	if lease.Prefix != nil {
+		return lease.Prefix.String()
+	}
+	return lease.IPAddress.String()
+}
+
+// RandomizedMAC reports whether the MAC address of lease is randomized. See
+// IsRandomizedMAC.
+func (lease *Lease) RandomizedMAC() bool {
+	return IsRandomizedMAC(lease.MACAddress)
+}
+
+// IsRandomizedMAC reports whether macAddress has the locally administered
+// bit set, as used by the MAC address randomization of phones and laptops.
+func IsRandomizedMAC(macAddress net.HardwareAddr) bool {
+	return len(macAddress) > 0 && macAddress[0]&0x02 != 0
+}
+
+// EndsAfter reports whether lease ends after other, treating leases that
+// never end as ending last.
+func (lease *Lease) EndsAfter(other *Lease) bool {
+	switch {
+	case lease.EndsNever:
+		return !other.EndsNever
+	case other.EndsNever:
+		return false
+	}
+	return lease.EndTime.After(other.EndTime)
+}
+
+// DDNSForwardName returns the DNS name registered by DHCP-DDNS for lease,
+// from its ddns-fwd-name variable.
+func (lease *Lease) DDNSForwardName() string {
+	return lease.Variables["ddns-fwd-name"]
+}
+
+// DDNSReverseName returns the PTR name registered by DHCP-DDNS for lease,
+// from its ddns-rev-name variable.
+func (lease *Lease) DDNSReverseName() string {
+	return lease.Variables["ddns-rev-name"]
+}
+
+// DDNSTxt returns the TXT record value used by DHCP-DDNS for lease, from its
+// ddns-txt variable.
+func (lease *Lease) DDNSTxt() string {
+	return lease.Variables["ddns-txt"]
+}
+
+// GetState returns the state of the lease at time now.
+func (lease *Lease) GetState(now time.Time) LeaseState {
+	if lease.Static {
+		return Static
+	}
+
+	switch lease.BindingState {
+	case "abandoned":
+		return Abandoned
+	case "free", "expired", "reset":
+		return Past
+	case "released":
+		return Released
+	case "backup":
+		return Backup
+	}
+
+	switch {
+	case lease.Abandoned:
+		return Abandoned
+	case now.Before(lease.StartTime):
+		return Future
+	case (now.After(lease.StartTime) || now.Equal(lease.StartTime)) && (lease.EndsNever || now.Before(lease.EndTime) || now.Equal(lease.EndTime)):
+		return Current
+	default:
+		return Past
+	}
+}
+
+// LeaseMap maps IP address strings to the most recent lease for that address.
+type LeaseMap map[string]*Lease
@@ -0,0 +1,474 @@
+package leases
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	leaseTimeFormatString = "2006/01/02 15:04:05;"
+	contextCheckLines     = 1024
+)
+
+// Parser reads ISC dhcpd leases files. Both DHCPv4 lease blocks and DHCPv6
+// ia-na, ia-ta, and ia-pd blocks are recognized.
+type Parser struct {
+	lineNumber int
+
+	// StartLine is the number of lines of the leases file before the input
+	// given to ParseLeases, when parsing the rest of a file from an offset,
+	// so that reported line numbers are those of the whole file.
+	StartLine int
+
+	// SkippedLine, if not nil, is called with each statement of a dhcpd
+	// leases file that is not parsed, such as server-duid or the statements
+	// of on expiry blocks. Blank lines, comments, and closing braces are not
+	// reported.
+	SkippedLine func(lineNumber int, line string)
+
+	// InvalidLease, if not nil, is called with the error for each statement
+	// that cannot be parsed, such as an unparsable time or MAC address, and
+	// the lease containing it is skipped. If it is nil, parsing stops at the
+	// first such error.
+	InvalidLease func(err *ParseError)
+}
+
+// ParseError describes a line of a leases file that cannot be parsed.
+type ParseError struct {
+	Line   int
+	Reason string
+	// Unterminated is set when the file ends within a block.
+	Unterminated bool
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("line %v: %v", err.Line, err.Reason)
+}
+
+// NewParser returns a new Parser.
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// LineNumber returns the number of lines read by the most recent call to
+// Parse or ParseLeases.
+func (parser *Parser) LineNumber() int {
+	return parser.lineNumber
+}
+
+// skip reports line to SkippedLine.
+func (parser *Parser) skip(line string) {
+	if parser.SkippedLine == nil || line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "}") {
+		return
+	}
+	parser.SkippedLine(parser.lineNumber, line)
+}
+
+func (parser *Parser) errorf(format string, args ...interface{}) error {
+	return &ParseError{
+		Line:   parser.lineNumber,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+// invalidLease reports err to InvalidLease, returning false if parsing
+// should stop instead because InvalidLease is nil or err is not a
+// *ParseError.
+func (parser *Parser) invalidLease(err error) bool {
+	var parseError *ParseError
+	if parser.InvalidLease == nil || !errors.As(err, &parseError) {
+		return false
+	}
+	parser.InvalidLease(parseError)
+	return true
+}
+
+// parseTime parses the time in a statement such as "ends 4 2020/06/26
+// 22:00:00;". It also accepts "ends never;", returning the zero time (see
+// neverTime), and
+// the "ends epoch 1593208800; # Fri Jun 26 22:00:00 2020" form written when
+// dhcpd is configured with db-time-format local.
+func (parser *Parser) parseTime(line string, name string) (time.Time, error) {
+	if neverTime(line) {
+		return time.Time{}, nil
+	}
+
+	split := strings.Split(line, " ")
+
+	if len(split) >= 3 && split[1] == "epoch" {
+		epochString := strings.TrimSuffix(split[2], ";")
+		seconds, err := strconv.ParseInt(epochString, 10, 64)
+		if err != nil {
+			return time.Time{}, parser.errorf("error parsing %v epoch '%v' %v", name, epochString, err)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	if len(split) < 4 {
+		return time.Time{}, parser.errorf("error parsing %v line '%v'", name, line)
+	}
+
+	timeString := split[2] + " " + split[3]
+	parsedTime, err := time.ParseInLocation(leaseTimeFormatString, timeString, time.UTC)
+	if err != nil {
+		return time.Time{}, parser.errorf("error parsing %v timeString '%v' %v", name, timeString, err)
+	}
+	return parsedTime, nil
+}
+
+// neverTime reports whether the time statement line, such as "ends never;",
+// has the time never.
+func neverTime(line string) bool {
+	split := strings.Split(line, " ")
+	return len(split) >= 2 && split[1] == "never;"
+}
+
+// ParseLeases reads lease records from r and calls fn for each one in file
+// order without retaining them. Parsing stops at the first error returned by fn.
+func ParseLeases(r io.Reader, fn func(Lease) error) error {
+	return NewParser().ParseLeases(r, fn)
+}
+
+// ParseLeases reads lease records from r and calls fn for each one in file
+// order without retaining them. Parsing stops at the first error returned by fn.
+func (parser *Parser) ParseLeases(r io.Reader, fn func(Lease) error) error {
+	return parser.ParseLeasesContext(context.Background(), r, fn)
+}
+
+// iaBlock holds the statements of a DHCPv6 ia-na, ia-ta, or ia-pd block
+// that apply to each iaaddr or iaprefix it contains.
+type iaBlock struct {
+	iaType   string
+	iaid     uint32
+	duid     []byte
+	clttTime time.Time
+}
+
+// quotedString returns the unescaped contents between the first and last
+// double quotes in line.
+func quotedString(line string) ([]byte, bool) {
+	first := strings.Index(line, "\"")
+	last := strings.LastIndex(line, "\"")
+	if first < 0 || last <= first {
+		return nil, false
+	}
+	return unescapeString(line[first+1 : last]), true
+}
+
+func (parser *Parser) parseIABlock(line string) (*iaBlock, error) {
+	iaType := strings.Split(line, " ")[0]
+
+	key, ok := quotedString(line)
+	if !ok || len(key) < 4 {
+		return nil, parser.errorf("error parsing %v line '%v'", iaType, line)
+	}
+
+	// dhcpd stores the IAID in host byte order at the start of the key,
+	// followed by the client DUID.
+	return &iaBlock{
+		iaType: iaType,
+		iaid:   binary.LittleEndian.Uint32(key[0:4]),
+		duid:   key[4:],
+	}, nil
+}
+
+func (parser *Parser) parseLifetime(line string) (time.Duration, error) {
+	split := strings.Split(strings.TrimSuffix(line, ";"), " ")
+	seconds, err := strconv.ParseUint(split[len(split)-1], 10, 32)
+	if err != nil {
+		return 0, parser.errorf("error parsing lifetime line '%v' %v", line, err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func (parser *Parser) finishIALease(lease *Lease, ia *iaBlock) {
+	lease.IAType = ia.iaType
+	lease.IAID = ia.iaid
+	lease.DUID = ia.duid
+	if lease.ClttTime.IsZero() {
+		lease.ClttTime = ia.clttTime
+	}
+	// DHCPv6 leases have no starts statement; the last transaction time is
+	// when the current binding began.
+	if lease.StartTime.IsZero() {
+		lease.StartTime = lease.ClttTime
+	}
+	if lease.MACAddress == nil {
+		lease.MACAddress = macAddressFromDUID(ia.duid)
+	}
+}
+
+// ParseLeasesContext is like ParseLeases but stops with ctx.Err() if ctx is
+// cancelled before the end of r is reached.
+func (parser *Parser) ParseLeasesContext(ctx context.Context, r io.Reader, fn func(Lease) error) error {
+	parser.lineNumber = parser.StartLine
+	var currentIA *iaBlock
+	var currentLease *Lease
+	// nestedBlockDepth counts open blocks such as on expiry { within the
+	// current lease, whose statements are not part of the lease itself.
+	nestedBlockDepth := 0
+	// invalidIA and invalidLease are set when the current block has a
+	// statement reported to InvalidLease, so its leases are skipped.
+	invalidIA := false
+	invalidLease := false
+	// blockStartLine is the line of the innermost open lease, iaaddr,
+	// iaprefix, or ia block.
+	blockStartLine := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parser.lineNumber++
+
+		if (parser.lineNumber % contextCheckLines) == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+
+		var err error
+		switch {
+		case currentLease != nil && nestedBlockDepth > 0:
+			if strings.HasSuffix(line, "{") {
+				nestedBlockDepth++
+			} else if strings.HasPrefix(line, "}") {
+				nestedBlockDepth--
+			}
+			parser.skip(line)
+		case currentLease != nil && strings.HasSuffix(line, "{"):
+			nestedBlockDepth++
+			parser.skip(line)
+		case currentLease != nil:
+			err = parser.parseLeaseStatement(line, currentLease)
+			if err == nil && strings.HasPrefix(line, "}") {
+				if !invalidIA && !invalidLease {
+					if currentIA != nil {
+						parser.finishIALease(currentLease, currentIA)
+					}
+					if err := fn(*currentLease); err != nil {
+						return err
+					}
+				}
+				currentLease = nil
+				invalidLease = false
+			}
+		case currentIA != nil:
+			switch {
+			case strings.HasPrefix(line, "cltt"):
+				currentIA.clttTime, err = parser.parseTime(line, "cltt")
+			case strings.HasPrefix(line, "iaaddr ") && strings.HasSuffix(line, " {"):
+				ipString := strings.Split(line, " ")[1]
+				ipAddress := net.ParseIP(ipString)
+				if ipAddress == nil {
+					err = parser.errorf("error parsing ipString '%v'", ipString)
+				}
+				currentLease = &Lease{
+					IPAddress: ipAddress,
+					Count:     1,
+				}
+				blockStartLine = parser.lineNumber
+			case strings.HasPrefix(line, "iaprefix ") && strings.HasSuffix(line, " {"):
+				prefixString := strings.Split(line, " ")[1]
+				ipAddress, prefix, parseErr := net.ParseCIDR(prefixString)
+				if parseErr != nil {
+					err = parser.errorf("error parsing prefixString '%v' %v", prefixString, parseErr)
+				}
+				currentLease = &Lease{
+					IPAddress: ipAddress,
+					Prefix:    prefix,
+					Count:     1,
+				}
+				blockStartLine = parser.lineNumber
+			case strings.HasPrefix(line, "}"):
+				currentIA = nil
+				invalidIA = false
+			default:
+				parser.skip(line)
+			}
+		default:
+			switch {
+			case strings.HasPrefix(line, "lease ") && strings.HasSuffix(line, " {"):
+				ipString := strings.Split(line, " ")[1]
+				ipAddress := net.ParseIP(ipString)
+				if ipAddress == nil {
+					err = parser.errorf("error parsing ipString '%v'", ipString)
+				}
+				currentLease = &Lease{
+					IPAddress: ipAddress,
+					Count:     1,
+				}
+				blockStartLine = parser.lineNumber
+			case (strings.HasPrefix(line, "ia-na ") || strings.HasPrefix(line, "ia-ta ") || strings.HasPrefix(line, "ia-pd ")) &&
+				strings.HasSuffix(line, " {"):
+				currentIA, err = parser.parseIABlock(line)
+				if currentIA == nil {
+					currentIA = &iaBlock{}
+				}
+				blockStartLine = parser.lineNumber
+			default:
+				parser.skip(line)
+			}
+		}
+		if err != nil {
+			if !parser.invalidLease(err) {
+				return err
+			}
+			if currentLease != nil {
+				invalidLease = true
+			} else {
+				invalidIA = true
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scan error: %w", err)
+	}
+
+	// A file truncated within a block, such as one still being written,
+	// ends with a lease that is never passed to fn.
+	if currentLease != nil || currentIA != nil {
+		err := &ParseError{
+			Line:         parser.lineNumber,
+			Reason:       fmt.Sprintf("unterminated block starting at line %v", blockStartLine),
+			Unterminated: true,
+		}
+		if !parser.invalidLease(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseDataStatement returns the data value of a statement such as
+// uid "\001\000\003";, where prefix is the statement name and a space.
+func (parser *Parser) parseDataStatement(line string, prefix string) ([]byte, error) {
+	valueString := strings.TrimSuffix(strings.TrimPrefix(line, prefix), ";")
+	value, ok := parseDataValue(valueString)
+	if !ok {
+		return nil, parser.errorf("error parsing %v'%v'", prefix, valueString)
+	}
+	return value, nil
+}
+
+// parseBindingState returns the state name from a binding state line such as
+// "next binding state free;".
+func parseBindingState(line string) string {
+	split := strings.Split(strings.TrimSuffix(line, ";"), " ")
+	return split[len(split)-1]
+}
+
+// parseLeaseStatement applies one statement inside a lease, iaaddr, or
+// iaprefix block to lease.
+func (parser *Parser) parseLeaseStatement(line string, lease *Lease) error {
+	var err error
+	switch {
+	case strings.HasPrefix(line, "starts"):
+		lease.StartTime, err = parser.parseTime(line, "start")
+	case strings.HasPrefix(line, "ends"):
+		lease.EndTime, err = parser.parseTime(line, "end")
+		lease.EndsNever = neverTime(line)
+	case strings.HasPrefix(line, "cltt"):
+		lease.ClttTime, err = parser.parseTime(line, "cltt")
+	case strings.HasPrefix(line, "tstp "):
+		lease.TstpTime, err = parser.parseTime(line, "tstp")
+	case strings.HasPrefix(line, "tsfp "):
+		lease.TsfpTime, err = parser.parseTime(line, "tsfp")
+	case strings.HasPrefix(line, "atsfp "):
+		lease.AtsfpTime, err = parser.parseTime(line, "atsfp")
+	case strings.HasPrefix(line, "preferred-life "):
+		lease.PreferredLifetime, err = parser.parseLifetime(line)
+	case strings.HasPrefix(line, "max-life "):
+		lease.ValidLifetime, err = parser.parseLifetime(line)
+	case strings.HasPrefix(line, "hardware ethernet "):
+		macString := strings.Split(strings.Split(line, " ")[2], ";")[0]
+		lease.MACAddress, err = net.ParseMAC(macString)
+		if err != nil {
+			err = parser.errorf("error parsing macString '%v' %v", macString, err)
+		}
+	case strings.HasPrefix(line, "uid "):
+		lease.UID, err = parser.parseDataStatement(line, "uid ")
+	case strings.HasPrefix(line, "option agent.circuit-id "):
+		lease.AgentCircuitID, err = parser.parseDataStatement(line, "option agent.circuit-id ")
+	case strings.HasPrefix(line, "option agent.remote-id "):
+		lease.AgentRemoteID, err = parser.parseDataStatement(line, "option agent.remote-id ")
+	case strings.HasPrefix(line, "set "):
+		name, value, found := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(line, "set "), ";"), " = ")
+		if !found {
+			return parser.errorf("error parsing set line '%v'", line)
+		}
+		if lease.Variables == nil {
+			lease.Variables = make(map[string]string)
+		}
+		if strings.HasPrefix(value, "\"") {
+			if quoted, ok := quotedString(value); ok {
+				value = string(quoted)
+			}
+		}
+		lease.Variables[name] = value
+	case strings.HasPrefix(line, "client-hostname "):
+		if hostname, ok := quotedString(line); ok {
+			lease.Hostname = string(hostname)
+		}
+	case strings.HasPrefix(line, "binding state "):
+		lease.BindingState = parseBindingState(line)
+	case strings.HasPrefix(line, "next binding state "):
+		lease.NextBindingState = parseBindingState(line)
+	case strings.HasPrefix(line, "rewind binding state "):
+		lease.RewindBindingState = parseBindingState(line)
+	case strings.HasPrefix(line, "abandoned;"):
+		lease.Abandoned = true
+	default:
+		parser.skip(line)
+	}
+	return err
+}
+
+// Parse reads leases from r and returns the most recent lease for each IP
+// address, with Count set to the number of lease records seen for that address.
+func (parser *Parser) Parse(r io.Reader) (LeaseMap, error) {
+	return parser.ParseContext(context.Background(), r)
+}
+
+// ParseContext is like Parse but stops with ctx.Err() if ctx is cancelled
+// before the end of r is reached.
+func (parser *Parser) ParseContext(ctx context.Context, r io.Reader) (LeaseMap, error) {
+	leaseMap := make(LeaseMap)
+
+	if err := parser.ParseLeasesContext(ctx, r, func(lease Lease) error {
+		leaseMap.Add(&lease)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return leaseMap, nil
+}
+
+// Add merges lease into leaseMap, keeping the lease with the latest end time
+// for its IP address and summing the record counts.
+func (leaseMap LeaseMap) Add(lease *Lease) {
+	ipString := lease.IPAddress.String()
+	existingLease, ok := leaseMap[ipString]
+	if !ok {
+		leaseMap[ipString] = lease
+		return
+	}
+
+	totalCount := lease.Count + existingLease.Count
+	if lease.EndsAfter(existingLease) {
+		lease.Count = totalCount
+		leaseMap[ipString] = lease
+	} else {
+		existingLease.Count = totalCount
+	}
+}
@@ -0,0 +1,285 @@
+package leases
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseAll returns the leases parsed from text by parser.
+func parseAll(parser *Parser, text string) ([]Lease, error) {
+	var parsed []Lease
+	err := parser.ParseLeases(strings.NewReader(text), func(lease Lease) error {
+		parsed = append(parsed, lease)
+		return nil
+	})
+	return parsed, err
+}
+
+func TestParseLeaseTimes(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		ends      string
+		wantEnd   time.Time
+		wantNever bool
+		wantState LeaseState
+	}{
+		{"date", "ends 5 2020/06/26 22:00:00;", time.Date(2020, 6, 26, 22, 0, 0, 0, time.UTC), false, Past},
+		{"never", "ends never;", time.Time{}, true, Current},
+		{"epoch", "ends epoch 1593208800; # Fri Jun 26 22:00:00 2020", time.Date(2020, 6, 26, 22, 0, 0, 0, time.UTC), false, Past},
+		// A lease without an ends statement, such as one cut short, has
+		// ended rather than never ending.
+		{"missing", "", time.Time{}, false, Past},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := parseAll(NewParser(), "lease 10.0.0.1 {\n  starts 5 2020/06/26 21:00:00;\n  "+test.ends+"\n}\n")
+			if err != nil {
+				t.Fatalf("ParseLeases error: %v", err)
+			}
+			if len(parsed) != 1 {
+				t.Fatalf("got %v leases, want 1", len(parsed))
+			}
+			lease := parsed[0]
+			if !lease.EndTime.Equal(test.wantEnd) || lease.EndsNever != test.wantNever {
+				t.Errorf("got end time %v never %v, want %v never %v", lease.EndTime, lease.EndsNever, test.wantEnd, test.wantNever)
+			}
+			if state := lease.GetState(time.Date(2020, 6, 26, 23, 0, 0, 0, time.UTC)); state != test.wantState {
+				t.Errorf("GetState = %v, want %v", state, test.wantState)
+			}
+			if want := time.Date(2020, 6, 26, 21, 0, 0, 0, time.UTC); !lease.StartTime.Equal(want) {
+				t.Errorf("got start time %v, want %v", lease.StartTime, want)
+			}
+		})
+	}
+}
+
+const nestedBlocksLeases = `server-duid "\000\001";
+lease 10.0.0.1 {
+  starts 5 2020/06/26 21:00:00;
+  ends 5 2020/06/26 22:00:00;
+  hardware ethernet 00:11:22:33:44:55;
+  on expiry {
+    if exists agent.circuit-id {
+      set hostname = "inner";
+    }
+    on release { }
+  }
+  client-hostname "laptop";
+}
+`
+
+func TestParseNestedBlocks(t *testing.T) {
+	var skipped []string
+	parser := NewParser()
+	parser.SkippedLine = func(lineNumber int, line string) {
+		skipped = append(skipped, line)
+	}
+
+	parsed, err := parseAll(parser, nestedBlocksLeases)
+	if err != nil {
+		t.Fatalf("ParseLeases error: %v", err)
+	}
+	if len(parsed) != 1 {
+		t.Fatalf("got %v leases, want 1", len(parsed))
+	}
+	// Statements of nested blocks do not apply to the lease, and its
+	// statements after the nested block do.
+	lease := parsed[0]
+	if lease.Hostname != "laptop" || lease.Variables != nil || lease.MACAddress.String() != "00:11:22:33:44:55" {
+		t.Errorf("got %v variables %v, want laptop without variables", &lease, lease.Variables)
+	}
+
+	want := []string{
+		`server-duid "\000\001";`,
+		"on expiry {",
+		"if exists agent.circuit-id {",
+		`set hostname = "inner";`,
+		"on release { }",
+	}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Errorf("got skipped lines %q, want %q", skipped, want)
+	}
+}
+
+const dhcpv6Leases = `authoring-byte-order little-endian;
+ia-na "\001\000\000\000\000\001\000\001\000\000\000\000\000\021\042\063\104\125" {
+  cltt 5 2020/06/26 21:00:00;
+  iaaddr 2001:db8::10 {
+    binding state active;
+    preferred-life 1800;
+    max-life 3600;
+    ends 5 2020/06/26 22:00:00;
+  }
+}
+ia-pd "\002\000\000\000\000\003\000\001\000\021\042\063\104\146" {
+  cltt 5 2020/06/26 21:30:00;
+  iaprefix 2001:db8:1::/48 {
+    binding state active;
+    ends 5 2020/06/26 23:00:00;
+  }
+}
+`
+
+func TestParseDHCPv6(t *testing.T) {
+	parsed, err := parseAll(NewParser(), dhcpv6Leases)
+	if err != nil {
+		t.Fatalf("ParseLeases error: %v", err)
+	}
+	if len(parsed) != 2 {
+		t.Fatalf("got %v leases, want 2", len(parsed))
+	}
+
+	na := parsed[0]
+	if na.IAType != "ia-na" || na.IAID != 1 || na.IPAddress.String() != "2001:db8::10" || na.Prefix != nil {
+		t.Errorf("got ia-na lease %+v", na)
+	}
+	// The MAC is derived from the DUID-LLT, and the start time is the cltt
+	// of the ia block.
+	if na.MACAddress.String() != "00:11:22:33:44:55" || !na.StartTime.Equal(time.Date(2020, 6, 26, 21, 0, 0, 0, time.UTC)) {
+		t.Errorf("got ia-na MAC %v start %v", na.MACAddress, na.StartTime)
+	}
+	if na.PreferredLifetime != 30*time.Minute || na.ValidLifetime != time.Hour || na.BindingState != "active" {
+		t.Errorf("got ia-na lifetimes %v %v state %v", na.PreferredLifetime, na.ValidLifetime, na.BindingState)
+	}
+
+	pd := parsed[1]
+	if pd.IAType != "ia-pd" || pd.IAID != 2 || pd.AddressString() != "2001:db8:1::/48" || pd.MACAddress.String() != "00:11:22:33:44:66" {
+		t.Errorf("got ia-pd lease %+v", pd)
+	}
+}
+
+func TestParseUnterminated(t *testing.T) {
+	text := "lease 10.0.0.1 {\n  ends never;\n}\nlease 10.0.0.2 {\n  starts 5 2020/06/26 21:00:00;\n"
+
+	parsed, err := parseAll(NewParser(), text)
+	var parseError *ParseError
+	if !errors.As(err, &parseError) || !parseError.Unterminated || parseError.Line != 5 {
+		t.Fatalf("got error %v, want unterminated block at line 5", err)
+	}
+	if len(parsed) != 1 || parsed[0].IPAddress.String() != "10.0.0.1" {
+		t.Errorf("got leases %v, want 10.0.0.1 only", parsed)
+	}
+	if want := "unterminated block starting at line 4"; parseError.Reason != want {
+		t.Errorf("got reason %q, want %q", parseError.Reason, want)
+	}
+
+	// With InvalidLease set the unterminated block is reported to it and
+	// parsing succeeds.
+	var reported []*ParseError
+	parser := NewParser()
+	parser.InvalidLease = func(err *ParseError) {
+		reported = append(reported, err)
+	}
+	if _, err := parseAll(parser, text); err != nil {
+		t.Fatalf("ParseLeases with InvalidLease error: %v", err)
+	}
+	if len(reported) != 1 || !reported[0].Unterminated {
+		t.Errorf("got reported errors %v, want one unterminated block", reported)
+	}
+}
+
+const invalidLeases = `lease 10.0.0.1 {
+  ends 5 2020/13/26 22:00:00;
+}
+lease 10.0.0.2 {
+  hardware ethernet 00:11:22:33:44:zz;
+}
+lease not-an-ip {
+  ends never;
+}
+ia-na "\001" {
+  iaaddr 2001:db8::1 {
+    ends never;
+  }
+}
+lease 10.0.0.3 {
+  ends never;
+}
+`
+
+func TestParseInvalidLeases(t *testing.T) {
+	_, err := parseAll(NewParser(), invalidLeases)
+	var parseError *ParseError
+	if !errors.As(err, &parseError) || parseError.Line != 2 {
+		t.Fatalf("got error %v, want a ParseError at line 2", err)
+	}
+
+	var reportedLines []int
+	parser := NewParser()
+	parser.InvalidLease = func(err *ParseError) {
+		reportedLines = append(reportedLines, err.Line)
+	}
+	parsed, err := parseAll(parser, invalidLeases)
+	if err != nil {
+		t.Fatalf("ParseLeases with InvalidLease error: %v", err)
+	}
+	if want := []int{2, 5, 7, 10}; !reflect.DeepEqual(reportedLines, want) {
+		t.Errorf("got invalid lines %v, want %v", reportedLines, want)
+	}
+	// Only the valid lease is passed to fn; the leases containing invalid
+	// statements and the iaaddr of the invalid ia block are skipped.
+	if len(parsed) != 1 || !parsed[0].IPAddress.Equal(net.ParseIP("10.0.0.3")) {
+		t.Errorf("got leases %v, want 10.0.0.3 only", parsed)
+	}
+	if parser.LineNumber() != 17 {
+		t.Errorf("LineNumber = %v, want 17", parser.LineNumber())
+	}
+}
+
+func TestParseStartLine(t *testing.T) {
+	parser := NewParser()
+	parser.StartLine = 100
+	_, err := parseAll(parser, "lease 10.0.0.1 {\n  ends bogus;\n}\n")
+	var parseError *ParseError
+	if !errors.As(err, &parseError) || parseError.Line != 102 {
+		t.Errorf("got error %v, want a ParseError at line 102", err)
+	}
+}
+
+func TestParseCallbackError(t *testing.T) {
+	errStop := errors.New("stop")
+	calls := 0
+	err := ParseLeases(strings.NewReader("lease 10.0.0.1 {\n}\nlease 10.0.0.2 {\n}\n"), func(lease Lease) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("got error %v after %v calls, want %v after 1 call", err, calls, errStop)
+	}
+}
+
+func TestLeaseMapAdd(t *testing.T) {
+	start := time.Date(2020, 6, 26, 21, 0, 0, 0, time.UTC)
+	parsed, err := parseAll(NewParser(), `lease 10.0.0.1 {
+  ends 5 2020/06/26 22:00:00;
+  client-hostname "first";
+}
+lease 10.0.0.1 {
+  ends never;
+  client-hostname "never";
+}
+lease 10.0.0.1 {
+  ends 5 2020/06/26 23:00:00;
+  client-hostname "last";
+}
+`)
+	if err != nil {
+		t.Fatalf("ParseLeases error: %v", err)
+	}
+
+	leaseMap := make(LeaseMap)
+	for i := range parsed {
+		leaseMap.Add(&parsed[i])
+	}
+	// Leases that never end are kept over leases with an end time.
+	lease := leaseMap["10.0.0.1"]
+	if len(leaseMap) != 1 || lease.Hostname != "never" || lease.Count != 3 {
+		t.Errorf("got %v with count %v, want the never ending lease with count 3", lease, lease.Count)
+	}
+	if state := lease.GetState(start); state != Current {
+		t.Errorf("GetState = %v, want Current", state)
+	}
+}
@@ -0,0 +1,163 @@
+package leases
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	duidTypeLLT          = 1
+	duidTypeLL           = 3
+	hardwareTypeEthernet = 1
+)
+
+// unescapeString decodes the contents of a dhcpd quoted string, in which
+// non-printable bytes are written as \ooo octal escapes and quotes and
+// backslashes are escaped with a backslash.
+func unescapeString(s string) []byte {
+	decoded := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			decoded = append(decoded, s[i])
+			continue
+		}
+
+		if i+3 < len(s) && isOctalDigit(s[i+1]) && isOctalDigit(s[i+2]) && isOctalDigit(s[i+3]) {
+			decoded = append(decoded, ((s[i+1]-'0')<<6)|((s[i+2]-'0')<<3)|(s[i+3]-'0'))
+			i += 3
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n':
+			decoded = append(decoded, '\n')
+		case 't':
+			decoded = append(decoded, '\t')
+		case 'r':
+			decoded = append(decoded, '\r')
+		default:
+			decoded = append(decoded, s[i])
+		}
+	}
+	return decoded
+}
+
+func isOctalDigit(b byte) bool {
+	return '0' <= b && b <= '7'
+}
+
+// macAddressFromDUID returns the ethernet address embedded in a DUID-LLT or
+// DUID-LL, or nil for other DUID types.
+func macAddressFromDUID(duid []byte) net.HardwareAddr {
+	if len(duid) < 4 {
+		return nil
+	}
+
+	var linkLayerAddress []byte
+	switch binary.BigEndian.Uint16(duid[0:2]) {
+	case duidTypeLLT:
+		if len(duid) < 8 {
+			return nil
+		}
+		linkLayerAddress = duid[8:]
+	case duidTypeLL:
+		linkLayerAddress = duid[4:]
+	default:
+		return nil
+	}
+
+	if binary.BigEndian.Uint16(duid[2:4]) != hardwareTypeEthernet || len(linkLayerAddress) != 6 {
+		return nil
+	}
+
+	return append([]byte(nil), linkLayerAddress...)
+}
+
+// clientIDTypeDUID is the client identifier type of RFC 4361 identifiers,
+// which hold an IAID and a DUID.
+const clientIDTypeDUID = 255
+
+// hexString formats b as colon separated hex bytes.
+func hexString(b []byte) string {
+	parts := make([]string, len(b))
+	for i := range b {
+		parts[i] = hex.EncodeToString(b[i : i+1])
+	}
+	return strings.Join(parts, ":")
+}
+
+// DataString formats a data value such as an option 82 circuit-id as text if
+// it is printable ASCII, and as colon separated hex bytes otherwise.
+func DataString(b []byte) string {
+	for _, c := range b {
+		if c < ' ' || c > '~' {
+			return hexString(b)
+		}
+	}
+	return string(b)
+}
+
+// parseDataValue decodes a dhcpd data value, written either as a quoted
+// string or as colon separated hex bytes.
+func parseDataValue(value string) ([]byte, bool) {
+	if strings.HasPrefix(value, "\"") {
+		return quotedString(value)
+	}
+
+	decoded := make([]byte, 0, (len(value)+1)/3)
+	for _, part := range strings.Split(value, ":") {
+		if len(part) == 1 {
+			part = "0" + part
+		}
+		b, err := hex.DecodeString(part)
+		if err != nil || len(b) != 1 {
+			return nil, false
+		}
+		decoded = append(decoded, b[0])
+	}
+	return decoded, true
+}
+
+// describeDUID returns a description of a DUID such as "DUID-LL
+// 00:03:93:aa:bb:cc".
+func describeDUID(duid []byte) string {
+	if len(duid) < 2 {
+		return "DUID " + hexString(duid)
+	}
+
+	if mac := macAddressFromDUID(duid); mac != nil {
+		if binary.BigEndian.Uint16(duid[0:2]) == duidTypeLLT {
+			return "DUID-LLT " + mac.String()
+		}
+		return "DUID-LL " + mac.String()
+	}
+
+	switch binary.BigEndian.Uint16(duid[0:2]) {
+	case 2:
+		return "DUID-EN " + hexString(duid[2:])
+	case 4:
+		return "DUID-UUID " + hexString(duid[2:])
+	}
+	return "DUID " + hexString(duid)
+}
+
+// DescribeClientID returns a description of a DHCP client identifier, such
+// as a lease uid: the hardware type and address for type 1 to 255
+// identifiers, or the IAID and decoded DUID for RFC 4361 identifiers.
+func DescribeClientID(clientID []byte) string {
+	switch {
+	case len(clientID) == 0:
+		return ""
+	case clientID[0] == clientIDTypeDUID && len(clientID) >= 5:
+		return fmt.Sprintf("IAID %v %v", binary.BigEndian.Uint32(clientID[1:5]), describeDUID(clientID[5:]))
+	case clientID[0] == hardwareTypeEthernet && len(clientID) == 7:
+		return "ethernet " + net.HardwareAddr(clientID[1:]).String()
+	case clientID[0] == 0:
+		return fmt.Sprintf("%q", clientID[1:])
+	}
+	return hexString(clientID)
+}
@@ -0,0 +1,118 @@
+package leases
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// udhcpd leases files start with the time the file was written as a
+// big-endian int64, followed by fixed size records:
+//
+//	uint32 expires     seconds until expiry at the time the file was written
+//	uint32 ip          IP address in network order
+//	uint8  mac[6]
+//	char   hostname[20] NUL padded
+//	uint8  pad[2]
+const (
+	udhcpdHeaderSize = 8
+	udhcpdRecordSize = 36
+)
+
+// FileFormat identifies the format of a leases file.
+type FileFormat int
+
+const (
+	// DhcpdFormat is an ISC dhcpd leases file
+	DhcpdFormat FileFormat = iota
+	// KeaFormat is a Kea memfile CSV lease database
+	KeaFormat
+	// UdhcpdFormat is a BusyBox udhcpd binary leases file
+	UdhcpdFormat
+)
+
+func (format FileFormat) String() string {
+	switch format {
+	case DhcpdFormat:
+		return "dhcpd"
+	case KeaFormat:
+		return "Kea memfile"
+	case UdhcpdFormat:
+		return "udhcpd"
+	}
+	return "UNKNOWN"
+}
+
+// FileFormatHeaderLength is the number of leading bytes of a leases file
+// examined by DetectFileFormat.
+const FileFormatHeaderLength = len(keaHeaderPrefix)
+
+// DetectFileFormat returns the format of a leases file starting with header.
+// Text formats never contain NUL bytes, while udhcpd files start with a
+// big-endian timestamp whose high byte is zero.
+func DetectFileFormat(header []byte) FileFormat {
+	switch {
+	case len(header) > 0 && header[0] == 0:
+		return UdhcpdFormat
+	case strings.HasPrefix(string(header), keaHeaderPrefix):
+		return KeaFormat
+	}
+	return DhcpdFormat
+}
+
+// ParseUdhcpdLeasesContext reads lease records from a BusyBox udhcpd binary
+// leases file and calls fn for each one in file order. Each record counts as
+// one line. udhcpd does not record lease start times, so StartTime and
+// ClttTime are left zero.
+func (parser *Parser) ParseUdhcpdLeasesContext(ctx context.Context, r io.Reader, fn func(Lease) error) error {
+	parser.lineNumber = 0
+
+	var header [udhcpdHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("error reading udhcpd header: %w", err)
+	}
+	writtenAt := time.Unix(int64(binary.BigEndian.Uint64(header[:])), 0).UTC()
+
+	var record [udhcpdRecordSize]byte
+	for {
+		_, err := io.ReadFull(r, record[:])
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		parser.lineNumber++
+		if err != nil {
+			return parser.errorf("error reading udhcpd record %v", err)
+		}
+
+		if (parser.lineNumber % contextCheckLines) == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		expires := int32(binary.BigEndian.Uint32(record[0:4]))
+		ipAddress := net.IPv4(record[4], record[5], record[6], record[7])
+		macAddress := append(net.HardwareAddr(nil), record[8:14]...)
+		hostname := string(record[14:34])
+		if i := strings.IndexByte(hostname, 0); i >= 0 {
+			hostname = hostname[:i]
+		}
+
+		if err := fn(Lease{
+			IPAddress:  ipAddress,
+			Count:      1,
+			EndTime:    writtenAt.Add(time.Duration(expires) * time.Second),
+			MACAddress: macAddress,
+			Hostname:   hostname,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
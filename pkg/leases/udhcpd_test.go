@@ -0,0 +1,75 @@
+package leases
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// udhcpdRecord returns a udhcpd leases file record.
+func udhcpdRecord(expires int32, ip [4]byte, mac [6]byte, hostname string) []byte {
+	record := make([]byte, udhcpdRecordSize)
+	binary.BigEndian.PutUint32(record[0:4], uint32(expires))
+	copy(record[4:8], ip[:])
+	copy(record[8:14], mac[:])
+	copy(record[14:34], hostname)
+	return record
+}
+
+func TestParseUdhcpdLeases(t *testing.T) {
+	writtenAt := time.Date(2020, 6, 26, 22, 0, 0, 0, time.UTC)
+
+	var file bytes.Buffer
+	binary.Write(&file, binary.BigEndian, writtenAt.Unix())
+	file.Write(udhcpdRecord(3600, [4]byte{192, 168, 1, 10}, [6]byte{0, 0x11, 0x22, 0x33, 0x44, 0x55}, "laptop"))
+	file.Write(udhcpdRecord(-60, [4]byte{192, 168, 1, 11}, [6]byte{0, 0x11, 0x22, 0x33, 0x44, 0x66}, ""))
+
+	if format := DetectFileFormat(file.Bytes()); format != UdhcpdFormat {
+		t.Fatalf("DetectFileFormat = %v, want udhcpd", format)
+	}
+
+	var got []Lease
+	parser := NewParser()
+	if err := parser.ParseUdhcpdLeasesContext(context.Background(), &file, func(lease Lease) error {
+		got = append(got, lease)
+		return nil
+	}); err != nil {
+		t.Fatalf("ParseUdhcpdLeasesContext error: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %v leases, want 2", len(got))
+	}
+	for i, want := range []struct {
+		ip       string
+		mac      string
+		hostname string
+		endTime  time.Time
+	}{
+		{"192.168.1.10", "00:11:22:33:44:55", "laptop", writtenAt.Add(time.Hour)},
+		{"192.168.1.11", "00:11:22:33:44:66", "", writtenAt.Add(-time.Minute)},
+	} {
+		lease := got[i]
+		if lease.IPAddress.String() != want.ip || lease.MACAddress.String() != want.mac || lease.Hostname != want.hostname || !lease.EndTime.Equal(want.endTime) {
+			t.Errorf("lease %v = %v, want %+v", i, &lease, want)
+		}
+	}
+	if parser.LineNumber() != 2 {
+		t.Errorf("LineNumber = %v, want 2", parser.LineNumber())
+	}
+}
+
+func TestParseUdhcpdLeasesTruncated(t *testing.T) {
+	var file bytes.Buffer
+	binary.Write(&file, binary.BigEndian, int64(0))
+	file.Write(udhcpdRecord(60, [4]byte{10, 0, 0, 1}, [6]byte{}, "")[:10])
+
+	err := NewParser().ParseUdhcpdLeasesContext(context.Background(), &file, func(lease Lease) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("ParseUdhcpdLeasesContext succeeded, want an error for a truncated record")
+	}
+}
@@ -0,0 +1,160 @@
+package leases
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// escapeString encodes b as the contents of a dhcpd quoted string, writing
+// non-printable bytes as \ooo octal escapes. It is the inverse of
+// unescapeString.
+func escapeString(b []byte) string {
+	var builder strings.Builder
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&builder, "\\%03o", c)
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+// leaseWriter writes the statements of a lease block, stopping at the first
+// write error.
+type leaseWriter struct {
+	w      io.Writer
+	indent string
+	err    error
+}
+
+func (writer *leaseWriter) printf(format string, args ...interface{}) {
+	if writer.err != nil {
+		return
+	}
+	_, writer.err = fmt.Fprintf(writer.w, writer.indent+format+"\n", args...)
+}
+
+// time writes a time statement such as "starts 4 2020/06/26 22:00:00;",
+// omitting zero times.
+func (writer *leaseWriter) time(name string, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	t = t.UTC()
+	writer.printf("%v %v %v", name, int(t.Weekday()), t.Format(leaseTimeFormatString))
+}
+
+// state writes a binding state statement, omitting empty states.
+func (writer *leaseWriter) state(name string, state string) {
+	if state != "" {
+		writer.printf("%v %v;", name, state)
+	}
+}
+
+// data writes a statement with a data value as a quoted string, omitting
+// empty values.
+func (writer *leaseWriter) data(name string, value []byte) {
+	if len(value) > 0 {
+		writer.printf("%v \"%v\";", name, escapeString(value))
+	}
+}
+
+// statements writes the statements of lease within its block.
+func (writer *leaseWriter) statements(lease *Lease) {
+	// DHCPv6 leases have no starts statement, and their last transaction
+	// time belongs to the ia block.
+	if lease.IAType == "" {
+		writer.time("starts", lease.StartTime)
+	}
+	if lease.EndsNever {
+		writer.printf("ends never;")
+	} else {
+		writer.time("ends", lease.EndTime)
+	}
+	writer.time("tstp", lease.TstpTime)
+	writer.time("tsfp", lease.TsfpTime)
+	writer.time("atsfp", lease.AtsfpTime)
+	if lease.IAType == "" {
+		writer.time("cltt", lease.ClttTime)
+	}
+	if lease.PreferredLifetime > 0 {
+		writer.printf("preferred-life %v;", int64(lease.PreferredLifetime/time.Second))
+	}
+	if lease.ValidLifetime > 0 {
+		writer.printf("max-life %v;", int64(lease.ValidLifetime/time.Second))
+	}
+	writer.state("binding state", lease.BindingState)
+	writer.state("next binding state", lease.NextBindingState)
+	writer.state("rewind binding state", lease.RewindBindingState)
+	if lease.Abandoned {
+		writer.printf("abandoned;")
+	}
+	// The MAC address of DHCPv6 leases is derived from the DUID.
+	if lease.IAType == "" && len(lease.MACAddress) > 0 {
+		writer.printf("hardware ethernet %v;", lease.MACAddress)
+	}
+	writer.data("uid", lease.UID)
+	writer.data("option agent.circuit-id", lease.AgentCircuitID)
+	writer.data("option agent.remote-id", lease.AgentRemoteID)
+
+	names := make([]string, 0, len(lease.Variables))
+	for name := range lease.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writer.printf("set %v = \"%v\";", name, escapeString([]byte(lease.Variables[name])))
+	}
+
+	if lease.Hostname != "" {
+		writer.data("client-hostname", []byte(lease.Hostname))
+	}
+}
+
+// WriteLease writes lease to w as a dhcpd leases file block: a lease block
+// for DHCPv4 leases, or an ia-na, ia-ta, or ia-pd block holding one iaaddr
+// or iaprefix for DHCPv6 leases. Set statement values are written as quoted
+// strings. Files with DHCPv6 leases should start with
+// "authoring-byte-order little-endian;", the byte order of the IAIDs
+// written.
+func WriteLease(w io.Writer, lease *Lease) error {
+	writer := &leaseWriter{w: w}
+
+	if lease.IAType == "" {
+		writer.printf("lease %v {", lease.IPAddress)
+		writer.indent = "  "
+		writer.statements(lease)
+		writer.indent = ""
+		writer.printf("}")
+		return writer.err
+	}
+
+	key := make([]byte, 4, 4+len(lease.DUID))
+	binary.LittleEndian.PutUint32(key, lease.IAID)
+	key = append(key, lease.DUID...)
+
+	writer.printf("%v \"%v\" {", lease.IAType, escapeString(key))
+	writer.indent = "  "
+	writer.time("cltt", lease.ClttTime)
+	if lease.Prefix != nil {
+		writer.printf("iaprefix %v {", lease.Prefix)
+	} else {
+		writer.printf("iaaddr %v {", lease.IPAddress)
+	}
+	writer.indent = "    "
+	writer.statements(lease)
+	writer.indent = "  "
+	writer.printf("}")
+	writer.indent = ""
+	writer.printf("}")
+	return writer.err
+}
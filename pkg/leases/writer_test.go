@@ -0,0 +1,94 @@
+package leases
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteLeaseRoundTrip(t *testing.T) {
+	start := time.Date(2020, 6, 26, 22, 0, 0, 0, time.UTC)
+	_, prefix, _ := net.ParseCIDR("2001:db8:1::/48")
+
+	for _, test := range []struct {
+		name  string
+		lease Lease
+	}{
+		{
+			name: "dhcpv4",
+			lease: Lease{
+				IPAddress:        net.ParseIP("10.0.0.1"),
+				Count:            1,
+				StartTime:        start,
+				EndTime:          start.Add(time.Hour),
+				ClttTime:         start,
+				TstpTime:         start.Add(2 * time.Hour),
+				MACAddress:       net.HardwareAddr{0, 0x11, 0x22, 0x33, 0x44, 0x55},
+				Hostname:         "host \"quoted\"",
+				UID:              []byte{1, 0, 0x11, 0x22, 0x33, 0x44, 0x55},
+				AgentCircuitID:   []byte("eth0"),
+				Variables:        map[string]string{"vendor-class-identifier": "MSFT 5.0"},
+				BindingState:     "active",
+				NextBindingState: "free",
+			},
+		},
+		{
+			name: "never ends",
+			lease: Lease{
+				IPAddress:  net.ParseIP("10.0.0.2"),
+				Count:      1,
+				StartTime:  start,
+				EndsNever:  true,
+				MACAddress: net.HardwareAddr{0, 0x11, 0x22, 0x33, 0x44, 0x66},
+				Abandoned:  true,
+			},
+		},
+		{
+			name: "no end time",
+			lease: Lease{
+				IPAddress:  net.ParseIP("10.0.0.3"),
+				Count:      1,
+				StartTime:  start,
+				MACAddress: net.HardwareAddr{0, 0x11, 0x22, 0x33, 0x44, 0x77},
+			},
+		},
+		{
+			name: "ia-pd",
+			lease: Lease{
+				IPAddress:         prefix.IP,
+				Prefix:            prefix,
+				Count:             1,
+				StartTime:         start,
+				EndTime:           start.Add(time.Hour),
+				ClttTime:          start,
+				IAType:            "ia-pd",
+				IAID:              7,
+				DUID:              []byte{0, 2, 0, 0, 0, 9, 1, 2},
+				PreferredLifetime: 30 * time.Minute,
+				ValidLifetime:     time.Hour,
+				BindingState:      "active",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := WriteLease(&buffer, &test.lease); err != nil {
+				t.Fatalf("WriteLease error: %v", err)
+			}
+
+			var got []Lease
+			if err := ParseLeases(strings.NewReader(buffer.String()), func(lease Lease) error {
+				got = append(got, lease)
+				return nil
+			}); err != nil {
+				t.Fatalf("ParseLeases error: %v\n%v", err, buffer.String())
+			}
+			if len(got) != 1 || !reflect.DeepEqual(got[0], test.lease) {
+				t.Errorf("got %+v, want %+v\n%v", got, test.lease, buffer.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+// Package mdns looks up the names of hosts on the local network with
+// multicast DNS (RFC 6762) and DNS-based service discovery (RFC 6763).
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	// servicesName is browsed to list the service types advertised on the
+	// network, whose instances are then browsed for their host addresses.
+	servicesName = "_services._dns-sd._udp.local."
+	// maxQuestions is the number of questions sent in one query.
+	maxQuestions  = 32
+	maxPacketSize = 9000
+)
+
+var multicastAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// reverseName returns the in-addr.arpa name of an IPv4 address.
+func reverseName(ipAddress net.IP) string {
+	ip4 := ipAddress.To4()
+	return fmt.Sprintf("%v.%v.%v.%v.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0])
+}
+
+// hostName returns name without its trailing dot and .local domain.
+func hostName(name string) string {
+	name = strings.TrimSuffix(name, ".")
+	return strings.TrimSuffix(name, ".local")
+}
+
+// lookup is one run of LookupNames.
+type lookup struct {
+	conn       *ipv4.PacketConn
+	interfaces []net.Interface
+	// reverseNameToIP maps the reverse names queried to their addresses.
+	reverseNameToIP map[string]string
+	// browsedServices are the service types already queried.
+	browsedServices map[string]bool
+	ipToName        map[string]string
+}
+
+// LookupNames queries mDNS for the names of ipAddresses, with reverse
+// lookups and by browsing the DNS-SD services advertised on the network,
+// until timeout or ctx is done. It returns the names found by IP address
+// string, without the .local domain. Only IPv4 addresses are looked up, on
+// every multicast interface.
+func LookupNames(ctx context.Context, ipAddresses []net.IP, timeout time.Duration) (map[string]string, error) {
+	interfaces, err := multicastInterfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	// Queries from a port other than 5353 are answered by unicast to that
+	// port, so the group does not need to be joined.
+	udpConn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("net.ListenUDP error: %w", err)
+	}
+	defer udpConn.Close()
+
+	l := &lookup{
+		conn:            ipv4.NewPacketConn(udpConn),
+		interfaces:      interfaces,
+		reverseNameToIP: make(map[string]string),
+		browsedServices: make(map[string]bool),
+		ipToName:        make(map[string]string),
+	}
+
+	questions := []dnsmessage.Question{ptrQuestion(servicesName)}
+	for _, ipAddress := range ipAddresses {
+		if ipAddress.To4() == nil {
+			continue
+		}
+		name := reverseName(ipAddress)
+		l.reverseNameToIP[name] = ipAddress.String()
+		questions = append(questions, ptrQuestion(name))
+	}
+	if err := l.query(questions); err != nil {
+		return nil, err
+	}
+
+	if err := udpConn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, fmt.Errorf("SetReadDeadline error: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		udpConn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, _, err := udpConn.ReadFrom(buffer)
+		if errors.Is(err, net.ErrClosed) || errors.Is(err, context.DeadlineExceeded) || isTimeout(err) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ReadFrom error: %w", err)
+		}
+		if err := l.handleResponse(buffer[:n]); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make(map[string]string)
+	for _, ipAddress := range l.reverseNameToIP {
+		if name, ok := l.ipToName[ipAddress]; ok {
+			names[ipAddress] = name
+		}
+	}
+	return names, nil
+}
+
+func isTimeout(err error) bool {
+	var netError net.Error
+	return errors.As(err, &netError) && netError.Timeout()
+}
+
+// multicastInterfaces returns the up, non-loopback interfaces with multicast
+// and an IPv4 address.
+func multicastInterfaces() ([]net.Interface, error) {
+	allInterfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("net.Interfaces error: %w", err)
+	}
+
+	var interfaces []net.Interface
+	for _, iface := range allInterfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addresses, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			if ipNet, ok := address.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				interfaces = append(interfaces, iface)
+				break
+			}
+		}
+	}
+
+	if len(interfaces) == 0 {
+		return nil, errors.New("no multicast interfaces with IPv4 addresses")
+	}
+	return interfaces, nil
+}
+
+func ptrQuestion(name string) dnsmessage.Question {
+	return dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  dnsmessage.TypePTR,
+		Class: dnsmessage.ClassINET,
+	}
+}
+
+// query sends questions in batches of maxQuestions on every interface.
+func (l *lookup) query(questions []dnsmessage.Question) error {
+	for len(questions) > 0 {
+		batch := questions[:min(len(questions), maxQuestions)]
+		questions = questions[len(batch):]
+
+		message := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: uint16(rand.N(1 << 16))},
+			Questions: batch,
+		}
+		packet, err := message.Pack()
+		if err != nil {
+			return fmt.Errorf("message.Pack error: %w", err)
+		}
+
+		sent := false
+		var sendErr error
+		for i := range l.interfaces {
+			if err := l.conn.SetMulticastInterface(&l.interfaces[i]); err != nil {
+				sendErr = err
+				continue
+			}
+			if _, err := l.conn.WriteTo(packet, nil, multicastAddr); err != nil {
+				sendErr = err
+				continue
+			}
+			sent = true
+		}
+		if !sent {
+			return fmt.Errorf("error sending mDNS query: %w", sendErr)
+		}
+	}
+	return nil
+}
+
+// handleResponse records the names in the records of a response, and
+// browses service types it lists that were not browsed yet. Malformed
+// responses are ignored.
+func (l *lookup) handleResponse(packet []byte) error {
+	var message dnsmessage.Message
+	if err := message.Unpack(packet); err != nil || !message.Header.Response {
+		return nil
+	}
+
+	var newQuestions []dnsmessage.Question
+	resources := append(message.Answers, message.Additionals...)
+
+	for _, resource := range resources {
+		body, ok := resource.Body.(*dnsmessage.PTRResource)
+		if !ok {
+			continue
+		}
+		name, target := resource.Header.Name.String(), body.PTR.String()
+		if ipAddress, ok := l.reverseNameToIP[name]; ok {
+			l.ipToName[ipAddress] = hostName(target)
+		} else if name == servicesName && !l.browsedServices[target] {
+			l.browsedServices[target] = true
+			newQuestions = append(newQuestions, ptrQuestion(target))
+		}
+	}
+
+	// Reverse answers are preferred over names from address records.
+	for _, resource := range resources {
+		if body, ok := resource.Body.(*dnsmessage.AResource); ok {
+			ipAddress := net.IP(body.A[:]).String()
+			if _, ok := l.ipToName[ipAddress]; !ok {
+				l.ipToName[ipAddress] = hostName(resource.Header.Name.String())
+			}
+		}
+	}
+
+	if len(newQuestions) > 0 {
+		return l.query(newQuestions)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package oui
+
+import (
+	"net"
+	"sync"
+)
+
+// DefaultCacheSize is a Cache size far above the number of distinct
+// prefixes seen on most networks.
+const DefaultCacheSize = 65536
+
+type cacheEntry struct {
+	organization string
+	found        bool
+}
+
+// Cache remembers lookup results by MAC prefix, so lookups of MACs sharing a
+// prefix reach the database once. It is safe for concurrent use.
+type Cache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	entries    map[string]cacheEntry
+	hits       int
+	misses     int
+}
+
+// NewCache returns an empty Cache holding at most maxEntries prefixes. When
+// full it is emptied before caching another prefix.
+func NewCache(maxEntries int) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]cacheEntry),
+	}
+}
+
+// cachedPrefixLengths are the prefix lengths under which results are
+// cached, shortest first.
+var cachedPrefixLengths = []int{24, 28, 36}
+
+// cached returns the cached result for a prefix of macAddress. The caller
+// must hold cache.mutex.
+func (cache *Cache) cached(macAddress net.HardwareAddr) (cacheEntry, bool) {
+	for _, prefixLength := range cachedPrefixLengths {
+		key := prefixKey(macAddress, prefixLength)
+		if key == "" {
+			continue
+		}
+		if entry, ok := cache.entries[key]; ok {
+			return entry, true
+		}
+	}
+	return cacheEntry{}, false
+}
+
+// Lookup returns the cached result for a prefix of macAddress, or calls
+// lookup and caches its result under the prefix it returns the length of,
+// such as OUIDB.LookupPrefix, if there is none. Results for whole OUIs are
+// shared by every MAC of the OUI. Errors are not cached.
+func (cache *Cache) Lookup(macAddress net.HardwareAddr, lookup func(net.HardwareAddr) (string, int, bool, error)) (string, bool, error) {
+	if prefixKey(macAddress, 24) == "" {
+		organization, _, found, err := lookup(macAddress)
+		return organization, found, err
+	}
+
+	cache.mutex.Lock()
+	entry, ok := cache.cached(macAddress)
+	if ok {
+		cache.hits++
+	} else {
+		cache.misses++
+	}
+	cache.mutex.Unlock()
+	if ok {
+		return entry.organization, entry.found, nil
+	}
+
+	organization, prefixLength, found, err := lookup(macAddress)
+	if err != nil {
+		return "", false, err
+	}
+
+	if key := prefixKey(macAddress, prefixLength); key != "" {
+		cache.mutex.Lock()
+		if len(cache.entries) >= cache.maxEntries {
+			clear(cache.entries)
+		}
+		cache.entries[key] = cacheEntry{organization: organization, found: found}
+		cache.mutex.Unlock()
+	}
+
+	return organization, found, nil
+}
+
+// Stats returns the number of lookups answered from the cache and the number
+// that called the lookup function.
+func (cache *Cache) Stats() (hits int, misses int) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.hits, cache.misses
+}
+
+// Len returns the number of cached prefixes.
+func (cache *Cache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return len(cache.entries)
+}
@@ -0,0 +1,121 @@
+package oui
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/kvstore"
+)
+
+// countingLookup returns the LookupPrefix of ouiDB and a pointer to the
+// number of times it was called.
+func countingLookup(ouiDB *OUIDB) (func(net.HardwareAddr) (string, int, bool, error), *int) {
+	calls := 0
+	return func(macAddress net.HardwareAddr) (string, int, bool, error) {
+		calls++
+		return ouiDB.LookupPrefix(macAddress)
+	}, &calls
+}
+
+func newTestOUIDB(t *testing.T, texts ...string) *OUIDB {
+	t.Helper()
+	ouiDB := New(kvstore.NewMemoryStore())
+	for _, text := range texts {
+		if _, err := ouiDB.ImportContext(context.Background(), strings.NewReader(text)); err != nil {
+			t.Fatalf("ImportContext error: %v", err)
+		}
+	}
+	return ouiDB
+}
+
+func TestCacheLookup(t *testing.T) {
+	ouiDB := newTestOUIDB(t, ouiTxtExcerpt, mamTxtExcerpt, oui36TxtExcerpt)
+
+	for _, test := range []struct {
+		name      string
+		macs      []string
+		want      string
+		wantFound bool
+		// wantCalls is the number of database lookups for macs.
+		wantCalls int
+	}{
+		{
+			name:      "same OUI",
+			macs:      []string{"00:00:0c:12:34:56", "00:00:0c:ab:cd:ef"},
+			want:      "Cisco Systems, Inc",
+			wantFound: true,
+			wantCalls: 1,
+		},
+		{
+			name:      "same unknown OUI",
+			macs:      []string{"00:11:22:00:00:01", "00:11:22:ff:00:02"},
+			wantCalls: 1,
+		},
+		{
+			name:      "same MA-M prefix",
+			macs:      []string{"58:fc:db:01:02:03", "58:fc:db:0f:ff:ff"},
+			want:      "Spang Power Electronics",
+			wantFound: true,
+			wantCalls: 1,
+		},
+		{
+			name:      "different MA-S prefixes",
+			macs:      []string{"70:b3:d5:0f:e1:23", "70:b3:d5:0f:f1:23"},
+			want:      "Cleanflux",
+			wantFound: true,
+			wantCalls: 2,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewCache(DefaultCacheSize)
+			lookup, calls := countingLookup(ouiDB)
+			for i, mac := range test.macs {
+				macAddress, err := net.ParseMAC(mac)
+				if err != nil {
+					t.Fatalf("ParseMAC(%q) error: %v", mac, err)
+				}
+				got, found, err := cache.Lookup(macAddress, lookup)
+				if err != nil {
+					t.Fatalf("Lookup(%v) error: %v", mac, err)
+				}
+				if i == 0 && (got != test.want || found != test.wantFound) {
+					t.Errorf("Lookup(%v) = %q, %v, want %q, %v", mac, got, found, test.want, test.wantFound)
+				}
+			}
+			if *calls != test.wantCalls {
+				t.Errorf("got %v database lookups, want %v", *calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+// registrationAuthorityExcerpt is the oui.txt entry of an OUI whose MA-S
+// assignments are in oui36TxtExcerpt.
+const registrationAuthorityExcerpt = `70-B3-D5   (hex)		IEEE Registration Authority
+70B3D5     (base 16)		IEEE Registration Authority
+`
+
+// TestCacheLookupSharedOUI checks that a result cached for a MAC of an OUI
+// with longer prefixes is not used for other MACs of the OUI.
+func TestCacheLookupSharedOUI(t *testing.T) {
+	ouiDB := newTestOUIDB(t, oui36TxtExcerpt, registrationAuthorityExcerpt)
+	cache := NewCache(DefaultCacheSize)
+
+	for _, test := range []struct {
+		mac  string
+		want string
+	}{
+		{"70:b3:d5:11:11:11", "IEEE Registration Authority"},
+		{"70:b3:d5:0f:e1:23", "Cleanflux"},
+		{"70:b3:d5:0c:3f:ff", "Automata GmbH & Co. KG"},
+		{"70:b3:d5:22:22:22", "IEEE Registration Authority"},
+	} {
+		macAddress, _ := net.ParseMAC(test.mac)
+		got, found, err := cache.Lookup(macAddress, ouiDB.LookupPrefix)
+		if err != nil || !found || got != test.want {
+			t.Errorf("Lookup(%v) = %q, %v, %v, want %q", test.mac, got, found, err, test.want)
+		}
+	}
+}
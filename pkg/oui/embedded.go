@@ -0,0 +1,42 @@
+package oui
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"sync"
+
+	"github.com/ulikunitz/xz"
+)
+
+// EmbeddedDate is the date the embedded registry snapshot was fetched.
+const EmbeddedDate = "2020-07-21"
+
+// embeddedRegistry is an xz compressed snapshot of the IEEE OUI registry in
+// oui.txt format. Regenerate it with:
+//
+//	xz -9e -c oui.txt > oui.txt.xz
+//
+//go:embed oui.txt.xz
+var embeddedRegistry []byte
+
+// Embedded returns a MemoryDB of the registry snapshot embedded in the
+// binary, for use when no OUI database has been created. The snapshot is
+// decompressed once and the returned MemoryDB is shared.
+func Embedded() (*MemoryDB, error) {
+	return loadEmbedded()
+}
+
+var loadEmbedded = sync.OnceValues(func() (*MemoryDB, error) {
+	reader, err := xz.NewReader(bytes.NewReader(embeddedRegistry))
+	if err != nil {
+		return nil, fmt.Errorf("xz.NewReader error: %w", err)
+	}
+
+	memoryDB := NewMemoryDB()
+	if _, err := memoryDB.ImportContext(context.Background(), reader); err != nil {
+		return nil, fmt.Errorf("error reading embedded OUI registry: %w", err)
+	}
+	return memoryDB, nil
+})
@@ -0,0 +1,51 @@
+package oui
+
+import (
+	"context"
+	"io"
+	"net"
+)
+
+// MemoryDB is an in-memory map of MAC prefixes to organization names, with
+// the same lookups as OUIDB.
+type MemoryDB struct {
+	prefixToOrganization map[string]string
+}
+
+// NewMemoryDB returns an empty MemoryDB.
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{prefixToOrganization: make(map[string]string)}
+}
+
+// ImportContext reads an IEEE registry text or CSV file or Wireshark manuf
+// file from r into memoryDB, returning the number of lines read. It stops
+// with ctx.Err() if ctx is cancelled.
+func (memoryDB *MemoryDB) ImportContext(ctx context.Context, r io.Reader) (int, error) {
+	return scanEntries(r, func(key string, organization string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		memoryDB.prefixToOrganization[key] = organization
+		return nil
+	})
+}
+
+// Len returns the number of prefixes in memoryDB.
+func (memoryDB *MemoryDB) Len() int {
+	return len(memoryDB.prefixToOrganization)
+}
+
+// Lookup returns the organization registered for the longest stored prefix
+// of macAddress. The boolean result is false if no organization is found.
+func (memoryDB *MemoryDB) Lookup(macAddress net.HardwareAddr) (string, bool, error) {
+	organization, found := lookupPrefixes(macAddress, func(key string) (string, bool) {
+		organization, ok := memoryDB.prefixToOrganization[key]
+		return organization, ok
+	})
+	return organization, found, nil
+}
+
+// Close does nothing, for symmetry with OUIDB.
+func (memoryDB *MemoryDB) Close() error {
+	return nil
+}
@@ -0,0 +1,625 @@
+// Package oui maps MAC address prefixes to IEEE registered organizations.
+package oui
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/kvstore"
+)
+
+const (
+	ouiToOrganizationBucket = "ouiToOrganization"
+	metadataBucket          = "metadata"
+	writeTXSize             = 1000
+)
+
+// OUIDB is a kvstore.Store bucket mapping OUIs to organization names.
+type OUIDB struct {
+	store kvstore.Store
+}
+
+// Open opens the bbolt OUI database at path, creating it and
+// its parent directories if readOnly is false.
+func Open(path string, readOnly bool) (*OUIDB, error) {
+	store, err := kvstore.OpenBolt(path, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return New(store), nil
+}
+
+// New returns an OUIDB stored in store.
+func New(store kvstore.Store) *OUIDB {
+	return &OUIDB{store: store}
+}
+
+// Close closes the store of the database.
+func (ouiDB *OUIDB) Close() error {
+	return ouiDB.store.Close()
+}
+
+func isHexDigits(s string) bool {
+	for _, r := range s {
+		if !(('0' <= r && '9' >= r) || ('a' <= r && 'f' >= r) || ('A' <= r && 'F' >= r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// prefixLengths are the lengths in bits of the prefixes longer than an OUI
+// that are stored, longest first: IEEE MA-S and MA-M assignments.
+var prefixLengths = []int{36, 28}
+
+// lookupPrefixLengths are the prefix lengths tried by Lookup, longest first.
+var lookupPrefixLengths = append(slices.Clone(prefixLengths), 24)
+
+// prefixKey returns the database key of the first prefixLength bits of
+// macAddress, or "" if prefixLength is not 24 or one of prefixLengths.
+func prefixKey(macAddress net.HardwareAddr, prefixLength int) string {
+	if len(macAddress) < 3 || (prefixLength > 24 && len(macAddress) < 6) {
+		return ""
+	}
+	if prefixLength == 24 {
+		return macAddress[0:3].String()
+	}
+	if !slices.Contains(prefixLengths, prefixLength) {
+		return ""
+	}
+
+	masked := make(net.HardwareAddr, 6)
+	for i := range masked {
+		bits := prefixLength - 8*i
+		switch {
+		case bits >= 8:
+			masked[i] = macAddress[i]
+		case bits > 0:
+			masked[i] = macAddress[i] & (0xff << (8 - bits))
+		}
+	}
+	return fmt.Sprintf("%v/%v", masked, prefixLength)
+}
+
+// parsePrefix parses a MAC prefix of a 24 bit OUI like 00:11:22, or a
+// longer prefix with its length like 00:11:22:33:40:00/28, separated by
+// colons or dashes, and returns its key.
+func parsePrefix(prefix string) (string, bool) {
+	address, lengthString, hasLength := strings.Cut(strings.ReplaceAll(prefix, "-", ":"), "/")
+	if !hasLength {
+		if len(address) != 8 {
+			return "", false
+		}
+		address += ":00:00:00"
+		lengthString = "24"
+	}
+
+	macAddress, err := net.ParseMAC(address)
+	if err != nil || len(macAddress) != 6 {
+		return "", false
+	}
+	prefixLength, err := strconv.Atoi(lengthString)
+	if err != nil {
+		return "", false
+	}
+
+	key := prefixKey(macAddress, prefixLength)
+	return key, key != ""
+}
+
+// rangePrefixLengths maps the number of addresses in the "(base 16)"
+// ranges of IEEE MA-M and MA-S files to the length in bits of the prefix.
+var rangePrefixLengths = map[uint64]int{
+	0x100000: 28,
+	0x1000:   36,
+}
+
+// ouiTxtParser parses the lines of an IEEE oui.txt, mam.txt, or oui36.txt
+// file. Each entry has a "(hex)" line with the 24 bit OUI followed by a
+// "(base 16)" line, which in MA-M and MA-S files gives the range of the
+// assignment within the OUI instead of the OUI itself.
+type ouiTxtParser struct {
+	// hexOUI is the OUI of the last "(hex)" line, in hex digits.
+	hexOUI string
+}
+
+// parseLine returns the key of the prefix and the organization of a
+// "(base 16)" line, remembering the OUI of "(hex)" lines for it. "(hex)"
+// lines giving a prefix with its length, like 58-FC-DB-00-00-00/28, are
+// also accepted.
+func (parser *ouiTxtParser) parseLine(line string) (string, string, bool) {
+	if prefix, organization, ok := strings.Cut(line, "(hex)"); ok {
+		prefix = strings.TrimSpace(prefix)
+		if strings.Contains(prefix, "/") {
+			key, ok := parsePrefix(prefix)
+			return key, strings.TrimSpace(organization), ok
+		}
+		parser.hexOUI = strings.ReplaceAll(prefix, "-", "")
+		if len(parser.hexOUI) != 6 || !isHexDigits(parser.hexOUI) {
+			parser.hexOUI = ""
+		}
+		return "", "", false
+	}
+
+	assignment, organization, ok := strings.Cut(line, "(base 16)")
+	if !ok {
+		return "", "", false
+	}
+	assignment = strings.TrimSpace(assignment)
+	organization = strings.TrimSpace(organization)
+	if organization == "" || !isHexDigits(strings.ReplaceAll(assignment, "-", "")) {
+		return "", "", false
+	}
+
+	rangeStart, rangeEnd, isRange := strings.Cut(assignment, "-")
+	if !isRange {
+		if len(assignment) != 6 {
+			return "", "", false
+		}
+		ouiKeyString := strings.ToLower(assignment[0:2] + ":" + assignment[2:4] + ":" + assignment[4:6])
+		return ouiKeyString, organization, true
+	}
+
+	if parser.hexOUI == "" || len(rangeStart) != 6 || len(rangeEnd) != 6 {
+		return "", "", false
+	}
+	start, err := strconv.ParseUint(rangeStart, 16, 32)
+	if err != nil {
+		return "", "", false
+	}
+	end, err := strconv.ParseUint(rangeEnd, 16, 32)
+	if err != nil || end < start {
+		return "", "", false
+	}
+	prefixLength, ok := rangePrefixLengths[end-start+1]
+	if !ok {
+		return "", "", false
+	}
+	macAddress, err := hex.DecodeString(parser.hexOUI + rangeStart)
+	if err != nil {
+		return "", "", false
+	}
+
+	return prefixKey(macAddress, prefixLength), organization, true
+}
+
+// isManufLine reports whether line is an entry of a Wireshark manuf file,
+// which start with a colon-separated MAC prefix.
+func isManufLine(line string) bool {
+	return len(line) >= 8 && line[2] == ':' && line[5] == ':' &&
+		isHexDigits(line[0:2]) && isHexDigits(line[3:5]) && isHexDigits(line[6:8])
+}
+
+// parseManufLine parses an entry of a Wireshark manuf file: a MAC prefix, a
+// short name, and an optional long name separated by tabs, where older files
+// give the long name as a # comment. The long name is returned if present.
+// Entries with prefix lengths other than 24 bits or prefixLengths are
+// skipped.
+func parseManufLine(line string) (string, string, bool) {
+	prefix, rest, ok := strings.Cut(line, "\t")
+	if !ok {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return "", "", false
+		}
+		prefix, rest = fields[0], strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+	}
+
+	key, ok := parsePrefix(prefix)
+	if !ok {
+		return "", "", false
+	}
+
+	shortName, longName, _ := strings.Cut(rest, "\t")
+	if before, comment, ok := strings.Cut(shortName, "#"); ok {
+		shortName, longName = before, comment
+	}
+
+	organization := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(longName), "#"))
+	if organization == "" {
+		organization = strings.TrimSpace(shortName)
+	}
+	if organization == "" {
+		return "", "", false
+	}
+
+	return key, organization, true
+}
+
+// csvRegistryPrefixLengths maps the registries of IEEE CSV files to the
+// length in bits of their assignments.
+var csvRegistryPrefixLengths = map[string]int{
+	"MA-L": 24,
+	"MA-M": 28,
+	"MA-S": 36,
+	"IAB":  36,
+}
+
+// isCSVLine reports whether line is an entry of an IEEE oui.csv, mam.csv,
+// oui36.csv, or iab.csv file, which start with the registry name.
+func isCSVLine(line string) bool {
+	registry, _, ok := strings.Cut(line, ",")
+	_, known := csvRegistryPrefixLengths[registry]
+	return ok && known
+}
+
+// parseCSVLine parses an entry of an IEEE CSV registry file, with the
+// columns Registry, Assignment, Organization Name, and Organization Address.
+// The assignment is the prefix in hex digits without separators.
+func parseCSVLine(line string) (string, string, bool) {
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	record, err := reader.Read()
+	if err != nil || len(record) < 3 {
+		return "", "", false
+	}
+
+	prefixLength := csvRegistryPrefixLengths[record[0]]
+	assignment := strings.TrimSpace(record[1])
+	if len(assignment)*4 != prefixLength || !isHexDigits(assignment) {
+		return "", "", false
+	}
+	macAddress, err := hex.DecodeString((assignment + "000000000000")[:12])
+	if err != nil {
+		return "", "", false
+	}
+
+	organization := strings.TrimSpace(record[2])
+	if organization == "" {
+		return "", "", false
+	}
+
+	return prefixKey(macAddress, prefixLength), organization, true
+}
+
+// parseLine returns the prefix key and organization of an entry of an IEEE
+// registry text or CSV file or Wireshark manuf file. txtParser holds the
+// state of the IEEE text file being read.
+func parseLine(line string, txtParser *ouiTxtParser) (string, string, bool) {
+	line = strings.TrimSpace(line)
+	switch {
+	case isManufLine(line):
+		return parseManufLine(line)
+	case isCSVLine(line):
+		return parseCSVLine(line)
+	}
+	return txtParser.parseLine(line)
+}
+
+// scanEntries calls fn with the prefix key and organization of each entry
+// read from r, returning the number of lines read.
+func scanEntries(r io.Reader, fn func(key string, organization string) error) (int, error) {
+	lineNumber := 0
+	scanner := bufio.NewScanner(r)
+	var txtParser ouiTxtParser
+
+	for scanner.Scan() {
+		lineNumber++
+
+		key, organization, ok := parseLine(scanner.Text(), &txtParser)
+		if !ok {
+			continue
+		}
+
+		if err := fn(key, organization); err != nil {
+			return lineNumber, err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return lineNumber, fmt.Errorf("scan error: %w", err)
+	}
+
+	return lineNumber, nil
+}
+
+// lookupPrefixes returns the organization of the longest prefix of
+// macAddress found by get.
+func lookupPrefixes(macAddress net.HardwareAddr, get func(key string) (string, bool)) (string, bool) {
+	for _, prefixLength := range lookupPrefixLengths {
+		key := prefixKey(macAddress, prefixLength)
+		if key == "" {
+			continue
+		}
+		if organization, ok := get(key); ok {
+			return organization, true
+		}
+	}
+	return "", false
+}
+
+// keyPrefixLength returns the length in bits of the prefix of key.
+func keyPrefixLength(key string) int {
+	_, lengthString, hasLength := strings.Cut(key, "/")
+	if !hasLength {
+		return 24
+	}
+	prefixLength, _ := strconv.Atoi(lengthString)
+	return prefixLength
+}
+
+// keyStart returns the start shared by the keys of all prefixes within the
+// first prefixLength bits of macAddress, which is 24 or 28.
+func keyStart(macAddress net.HardwareAddr, prefixLength int) string {
+	if prefixLength == 24 {
+		return prefixKey(macAddress, 24) + ":"
+	}
+	// The first 28 bits are the first 7 hex digits, which with their
+	// colons are the first 10 characters of the key.
+	return prefixKey(macAddress, prefixLength)[:10]
+}
+
+// resolvePrefix is like lookupPrefixes, but also returns the length in bits
+// of the prefix of macAddress that determines the result, which is the same
+// for every MAC sharing that prefix. storedWithin reports whether a prefix
+// longer than prefixLength bits is stored within the prefix of macAddress of
+// that length; if so, the result is only known to hold for the 36 bit
+// prefix.
+func resolvePrefix(macAddress net.HardwareAddr, get func(key string) (string, bool), storedWithin func(macAddress net.HardwareAddr, prefixLength int) bool) (string, int, bool) {
+	for _, prefixLength := range lookupPrefixLengths {
+		key := prefixKey(macAddress, prefixLength)
+		if key == "" {
+			continue
+		}
+		organization, ok := get(key)
+		if !ok {
+			continue
+		}
+		if prefixLength == prefixLengths[0] || !storedWithin(macAddress, prefixLength) {
+			return organization, prefixLength, true
+		}
+		return organization, prefixLengths[0], true
+	}
+
+	if storedWithin(macAddress, 24) {
+		return "", prefixLengths[0], false
+	}
+	return "", 24, false
+}
+
+// ImportContext reads an IEEE oui.txt or CSV registry file or a Wireshark
+// manuf file from r, detecting the format of each line, and stores its
+// entries in the database, keeping entries already stored. It returns the
+// number of lines read, and stops with ctx.Err() if ctx is cancelled.
+// Entries committed before cancellation remain in the database.
+func (ouiDB *OUIDB) ImportContext(ctx context.Context, r io.Reader) (int, error) {
+	ouiToOrganizationToInsert := make(map[string]string)
+
+	insertIntoDB := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := ouiDB.store.Batch(func(tx kvstore.Tx) error {
+			for key, value := range ouiToOrganizationToInsert {
+				if err := tx.Put(ouiToOrganizationBucket, []byte(key), []byte(value)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("db.Update error: %w", err)
+		}
+
+		ouiToOrganizationToInsert = make(map[string]string)
+		return nil
+	}
+
+	lineNumber, err := scanEntries(r, func(key string, organization string) error {
+		ouiToOrganizationToInsert[key] = organization
+		if len(ouiToOrganizationToInsert) >= writeTXSize {
+			return insertIntoDB()
+		}
+		return nil
+	})
+	if err != nil {
+		return lineNumber, err
+	}
+
+	if len(ouiToOrganizationToInsert) > 0 {
+		if err := insertIntoDB(); err != nil {
+			return lineNumber, err
+		}
+	}
+
+	return lineNumber, nil
+}
+
+// ReplaceContext is like ImportContext, but replaces every stored entry with
+// the entries of r in a single transaction, so prefixes withdrawn from or
+// reassigned in the registry do not keep their old organization. The
+// database is unchanged if reading r fails or ctx is cancelled.
+func (ouiDB *OUIDB) ReplaceContext(ctx context.Context, r io.Reader) (int, error) {
+	ouiToOrganization := make(map[string]string)
+	lineNumber, err := scanEntries(r, func(key string, organization string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ouiToOrganization[key] = organization
+		return nil
+	})
+	if err != nil {
+		return lineNumber, err
+	}
+
+	if err := ouiDB.store.Batch(func(tx kvstore.Tx) error {
+		if err := tx.DeleteBucket(ouiToOrganizationBucket); err != nil {
+			return err
+		}
+		for key, value := range ouiToOrganization {
+			if err := tx.Put(ouiToOrganizationBucket, []byte(key), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return lineNumber, fmt.Errorf("db.Update error: %w", err)
+	}
+
+	return lineNumber, nil
+}
+
+// Lookup returns the organization registered for the longest stored prefix
+// of macAddress. The boolean result is false if no organization is found.
+func (ouiDB *OUIDB) Lookup(macAddress net.HardwareAddr) (string, bool, error) {
+	if len(macAddress) < 3 {
+		return "", false, nil
+	}
+
+	organization := ""
+	found := false
+
+	if err := ouiDB.store.View(func(tx kvstore.Tx) error {
+		organization, found = lookupPrefixes(macAddress, func(key string) (string, bool) {
+			value := tx.Get(ouiToOrganizationBucket, []byte(key))
+			return string(value), value != nil
+		})
+		return nil
+	}); err != nil {
+		return "", false, fmt.Errorf("db.View error: %w", err)
+	}
+
+	return organization, found, nil
+}
+
+// LookupPrefix is like Lookup, but also returns the length in bits of the
+// prefix of macAddress that determines the result: 24 if no longer prefix
+// is stored within its OUI, the length of the matched longer prefix, or 36
+// if the result may differ for other MACs in the same OUI. Every MAC sharing
+// that prefix has the same result.
+func (ouiDB *OUIDB) LookupPrefix(macAddress net.HardwareAddr) (string, int, bool, error) {
+	if len(macAddress) < 3 {
+		return "", 0, false, nil
+	}
+
+	organization := ""
+	prefixLength := 0
+	found := false
+
+	if err := ouiDB.store.View(func(tx kvstore.Tx) error {
+		get := func(key string) (string, bool) {
+			value := tx.Get(ouiToOrganizationBucket, []byte(key))
+			return string(value), value != nil
+		}
+		storedWithin := func(macAddress net.HardwareAddr, prefixLength int) bool {
+			start := keyStart(macAddress, prefixLength)
+			stored := false
+			// Errors only come from the callback, which returns none.
+			_ = tx.ForEach(ouiToOrganizationBucket, []byte(start), func(key []byte, value []byte) error {
+				if !strings.HasPrefix(string(key), start) {
+					return kvstore.ErrStop
+				}
+				if keyPrefixLength(string(key)) > prefixLength {
+					stored = true
+					return kvstore.ErrStop
+				}
+				return nil
+			})
+			return stored
+		}
+		organization, prefixLength, found = resolvePrefix(macAddress, get, storedWithin)
+		return nil
+	}); err != nil {
+		return "", 0, false, fmt.Errorf("db.View error: %w", err)
+	}
+
+	return organization, prefixLength, found, nil
+}
+
+// Empty reports whether the database has no organizations, as when it was
+// created only to hold other data.
+func (ouiDB *OUIDB) Empty() (bool, error) {
+	empty := true
+	if err := ouiDB.store.View(func(tx kvstore.Tx) error {
+		return tx.ForEach(ouiToOrganizationBucket, nil, func(key []byte, value []byte) error {
+			empty = false
+			return kvstore.ErrStop
+		})
+	}); err != nil {
+		return false, fmt.Errorf("db.View error: %w", err)
+	}
+	return empty, nil
+}
+
+// Count returns the number of prefixes in the database.
+func (ouiDB *OUIDB) Count() (int, error) {
+	count := 0
+	if err := ouiDB.store.View(func(tx kvstore.Tx) error {
+		var err error
+		count, err = kvstore.Count(tx, ouiToOrganizationBucket)
+		return err
+	}); err != nil {
+		return 0, fmt.Errorf("db.View error: %w", err)
+	}
+	return count, nil
+}
+
+// ForEach calls fn with each prefix in the database and its organization,
+// in prefix order, stopping at the first error. Prefixes are formatted like
+// 00:11:22 for OUIs or 00:11:22:33:40:00/28 for longer prefixes.
+func (ouiDB *OUIDB) ForEach(fn func(prefix string, organization string) error) error {
+	return ouiDB.store.View(func(tx kvstore.Tx) error {
+		return tx.ForEach(ouiToOrganizationBucket, nil, func(key []byte, value []byte) error {
+			return fn(string(key), string(value))
+		})
+	})
+}
+
+// Verify checks that every key in the database is a valid MAC prefix and
+// every organization is non-empty, returning a description of each problem
+// found.
+func (ouiDB *OUIDB) Verify() ([]string, error) {
+	var problems []string
+	if err := ouiDB.ForEach(func(prefix string, organization string) error {
+		if key, ok := parsePrefix(prefix); !ok || key != prefix {
+			problems = append(problems, fmt.Sprintf("invalid prefix %q", prefix))
+		}
+		if strings.TrimSpace(organization) == "" {
+			problems = append(problems, fmt.Sprintf("empty organization for prefix %q", prefix))
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("db.View error: %w", err)
+	}
+	return problems, nil
+}
+
+// Metadata returns the value stored for key by SetMetadata, or "" if none.
+func (ouiDB *OUIDB) Metadata(key string) (string, error) {
+	value, err := ouiDB.store.Get(metadataBucket, []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("db.View error: %w", err)
+	}
+	return string(value), nil
+}
+
+// SetMetadata stores keyToValue in the metadata of the database, deleting
+// keys with empty values.
+func (ouiDB *OUIDB) SetMetadata(keyToValue map[string]string) error {
+	if err := ouiDB.store.Batch(func(tx kvstore.Tx) error {
+		for key, value := range keyToValue {
+			var err error
+			if value == "" {
+				err = tx.Delete(metadataBucket, []byte(key))
+			} else {
+				err = tx.Put(metadataBucket, []byte(key), []byte(value))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("db.Update error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package oui
+
+import (
+	"context"
+	"maps"
+	"net"
+	"strings"
+	"testing"
+)
+
+// ouiTxtExcerpt is an excerpt of the IEEE oui.txt (MA-L) file.
+const ouiTxtExcerpt = `OUI/MA-L			Organization
+company_id			Organization
+				Address
+
+00-00-0C   (hex)		Cisco Systems, Inc
+00000C     (base 16)		Cisco Systems, Inc
+				80 West Tasman Drive
+				San Jose  CA  94568
+				US
+`
+
+// mamTxtExcerpt is an excerpt of the IEEE mam.txt (MA-M) file.
+const mamTxtExcerpt = `OUI/MA-M			Organization
+company_id			Organization
+				Address
+
+58-FC-DB   (hex)		Spang Power Electronics
+000000-0FFFFF     (base 16)		Spang Power Electronics
+				9305 Progress Parkway
+				Mentor  OH  44060
+				US
+
+70-B3-D5   (hex)		Automata GmbH & Co. KG
+C00000-CFFFFF     (base 16)		Automata GmbH & Co. KG
+				Gewerbering 5
+				Hallbergmoos    85399
+				DE
+`
+
+// oui36TxtExcerpt is an excerpt of the IEEE oui36.txt (MA-S) file.
+const oui36TxtExcerpt = `OUI/MA-S			Organization
+company_id			Organization
+				Address
+
+70-B3-D5   (hex)		Cleanflux
+0FE000-0FEFFF     (base 16)		Cleanflux
+				Mozartstr. 4
+				Leonberg    71229
+				DE
+
+70-B3-D5   (hex)		Automata GmbH & Co. KG
+0C3000-0C3FFF     (base 16)		Automata GmbH & Co. KG
+				Gewerbering 5
+				Hallbergmoos    85399
+				DE
+`
+
+func importText(t *testing.T, text string) map[string]string {
+	t.Helper()
+	memoryDB := NewMemoryDB()
+	if _, err := memoryDB.ImportContext(context.Background(), strings.NewReader(text)); err != nil {
+		t.Fatalf("ImportContext error: %v", err)
+	}
+	return memoryDB.prefixToOrganization
+}
+
+func TestImportOUITxt(t *testing.T) {
+	got := importText(t, ouiTxtExcerpt)
+	want := map[string]string{
+		"00:00:0c": "Cisco Systems, Inc",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestImportMAMTxt(t *testing.T) {
+	got := importText(t, mamTxtExcerpt)
+	want := map[string]string{
+		"58:fc:db:00:00:00/28": "Spang Power Electronics",
+		"70:b3:d5:c0:00:00/28": "Automata GmbH & Co. KG",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestImportOUI36Txt(t *testing.T) {
+	got := importText(t, oui36TxtExcerpt)
+	want := map[string]string{
+		"70:b3:d5:0f:e0:00/36": "Cleanflux",
+		"70:b3:d5:0c:30:00/36": "Automata GmbH & Co. KG",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLookupMASPrefix(t *testing.T) {
+	memoryDB := NewMemoryDB()
+	for _, text := range []string{ouiTxtExcerpt, oui36TxtExcerpt} {
+		if _, err := memoryDB.ImportContext(context.Background(), strings.NewReader(text)); err != nil {
+			t.Fatalf("ImportContext error: %v", err)
+		}
+	}
+
+	for _, test := range []struct {
+		mac  string
+		want string
+	}{
+		{"70:b3:d5:0f:e1:23", "Cleanflux"},
+		{"70:b3:d5:0c:3f:ff", "Automata GmbH & Co. KG"},
+		{"00:00:0c:12:34:56", "Cisco Systems, Inc"},
+	} {
+		macAddress, err := net.ParseMAC(test.mac)
+		if err != nil {
+			t.Fatalf("ParseMAC(%q) error: %v", test.mac, err)
+		}
+		got, ok, err := memoryDB.Lookup(macAddress)
+		if err != nil || !ok || got != test.want {
+			t.Errorf("Lookup(%v) = %q, %v, %v, want %q", test.mac, got, ok, err, test.want)
+		}
+	}
+
+	macAddress, _ := net.ParseMAC("70:b3:d5:0f:f0:00")
+	if got, ok, _ := memoryDB.Lookup(macAddress); ok {
+		t.Errorf("Lookup(%v) = %q, want no organization", macAddress, got)
+	}
+}
+
+func TestImportManuf(t *testing.T) {
+	got := importText(t, "# Wireshark manuf file\n"+
+		"00:00:0C\tCisco\tCisco Systems, Inc\n"+
+		"00:00:0D\tFibronic\t# Fibronics Ltd.\n"+
+		"00:00:0E\tFujitsu\n"+
+		"70:B3:D5:0F:E0:00/36\tCleanflu\tCleanflux\n"+
+		"00:1B:C5:00:00:00/25\tIgnored\tUnsupported length\n")
+	want := map[string]string{
+		"00:00:0c":             "Cisco Systems, Inc",
+		"00:00:0d":             "Fibronics Ltd.",
+		"00:00:0e":             "Fujitsu",
+		"70:b3:d5:0f:e0:00/36": "Cleanflux",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	got := importText(t, "Registry,Assignment,Organization Name,Organization Address\n"+
+		"MA-L,00000C,\"Cisco Systems, Inc\",San Jose CA US\n"+
+		"MA-M,58FCDB0,Spang Power Electronics,Mentor OH US\n"+
+		"MA-S,70B3D50FE,Cleanflux,Leonberg DE\n"+
+		"MA-L,00000,Too Short,\n"+
+		"MA-L,00000D,,\n")
+	want := map[string]string{
+		"00:00:0c":             "Cisco Systems, Inc",
+		"58:fc:db:00:00:00/28": "Spang Power Electronics",
+		"70:b3:d5:0f:e0:00/36": "Cleanflux",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	for _, test := range []struct {
+		prefix string
+		want   string
+		wantOK bool
+	}{
+		{"00:11:22", "00:11:22", true},
+		{"00-11-22", "00:11:22", true},
+		{"00:11:22:33:4f:ff/28", "00:11:22:30:00:00/28", true},
+		{"00:11:22:33:40:00/36", "00:11:22:33:40:00/36", true},
+		{"00:11:22:33:40:00/32", "", false},
+		{"00:11", "", false},
+		{"zz:11:22", "", false},
+	} {
+		got, ok := parsePrefix(test.prefix)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("parsePrefix(%q) = %q, %v, want %q, %v", test.prefix, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	ouiDB := newTestOUIDB(t, ouiTxtExcerpt, mamTxtExcerpt)
+
+	// A cancelled replace leaves the database as it was.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ouiDB.ReplaceContext(ctx, strings.NewReader(oui36TxtExcerpt)); err == nil {
+		t.Errorf("ReplaceContext with cancelled context error = nil, want error")
+	}
+	if count, _ := ouiDB.Count(); count != 3 {
+		t.Errorf("after cancelled ReplaceContext got %v prefixes, want 3", count)
+	}
+
+	if _, err := ouiDB.ReplaceContext(context.Background(), strings.NewReader(mamTxtExcerpt)); err != nil {
+		t.Fatalf("ReplaceContext error: %v", err)
+	}
+	for _, test := range []struct {
+		mac       string
+		want      string
+		wantFound bool
+	}{
+		{"00:00:0c:01:02:03", "", false},
+		{"58:fc:db:01:02:03", "Spang Power Electronics", true},
+	} {
+		macAddress, _ := net.ParseMAC(test.mac)
+		organization, found, err := ouiDB.Lookup(macAddress)
+		if err != nil || organization != test.want || found != test.wantFound {
+			t.Errorf("Lookup(%v) = %q, %v, %v, want %q, %v", test.mac, organization, found, err, test.want, test.wantFound)
+		}
+	}
+	if count, _ := ouiDB.Count(); count != 2 {
+		t.Errorf("after ReplaceContext got %v prefixes, want 2", count)
+	}
+}
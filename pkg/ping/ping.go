@@ -0,0 +1,169 @@
+// Package ping sends ICMP echo requests to many IPv4 addresses at once.
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// protocolICMP is the IANA protocol number of ICMP for IPv4.
+const protocolICMP = 1
+
+// Options configures Ping.
+type Options struct {
+	// Rate is the maximum number of echo requests sent per second.
+	Rate int
+	// Timeout is how long to wait for a reply after the last request.
+	Timeout time.Duration
+}
+
+// listen opens an unprivileged ICMP socket if the kernel allows it, or a raw
+// socket otherwise, which requires root. It returns the connection and
+// whether it is unprivileged, in which case the kernel sets the echo ID.
+func listen() (*icmp.PacketConn, bool, error) {
+	conn, err := icmp.ListenPacket("udp4", "0.0.0.0")
+	if err == nil {
+		return conn, true, nil
+	}
+	conn, rawErr := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if rawErr != nil {
+		return nil, false, fmt.Errorf("icmp.ListenPacket error: %w", errors.Join(err, rawErr))
+	}
+	return conn, false, nil
+}
+
+// Ping sends one echo request to each IPv4 address in ipAddresses, at most
+// opts.Rate per second, and returns the round trip times of the addresses
+// that replied by IP address string. Other addresses are ignored.
+func Ping(ctx context.Context, ipAddresses []net.IP, opts Options) (map[string]time.Duration, error) {
+	if !slices.ContainsFunc(ipAddresses, func(ipAddress net.IP) bool { return ipAddress.To4() != nil }) {
+		return map[string]time.Duration{}, nil
+	}
+
+	conn, unprivileged, err := listen()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	id := os.Getpid() & 0xffff
+
+	// sentTimes is shared with the sender, which sets the read deadline
+	// once every request has been sent, ending the reads below.
+	var mutex sync.Mutex
+	sentTimes := make(map[string]time.Time)
+	sendDone := false
+	rtts := make(map[string]time.Duration)
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, fmt.Errorf("SetReadDeadline error: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		interval := time.Second / time.Duration(max(opts.Rate, 1))
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		seq := 0
+		for _, ipAddress := range ipAddresses {
+			ip4 := ipAddress.To4()
+			if ip4 == nil {
+				continue
+			}
+
+			message := icmp.Message{
+				Type: ipv4.ICMPTypeEcho,
+				Body: &icmp.Echo{ID: id, Seq: seq & 0xffff, Data: []byte("go-dhcp-leases")},
+			}
+			seq++
+			packet, err := message.Marshal(nil)
+			if err != nil {
+				continue
+			}
+
+			var addr net.Addr = &net.IPAddr{IP: ip4}
+			if unprivileged {
+				addr = &net.UDPAddr{IP: ip4}
+			}
+			mutex.Lock()
+			sentTimes[ip4.String()] = time.Now()
+			mutex.Unlock()
+			// Writes to unreachable networks fail; those addresses are down.
+			conn.WriteTo(packet, addr)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+
+		mutex.Lock()
+		sendDone = true
+		mutex.Unlock()
+		conn.SetReadDeadline(time.Now().Add(opts.Timeout))
+	}()
+
+	buffer := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buffer)
+		if err != nil {
+			var netError net.Error
+			if errors.As(err, &netError) && netError.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("ReadFrom error: %w", err)
+		}
+		received := time.Now()
+
+		message, err := icmp.ParseMessage(protocolICMP, buffer[:n])
+		if err != nil || message.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := message.Body.(*icmp.Echo)
+		if !ok || (!unprivileged && echo.ID != id) {
+			continue
+		}
+
+		var peerIP net.IP
+		switch addr := peer.(type) {
+		case *net.UDPAddr:
+			peerIP = addr.IP
+		case *net.IPAddr:
+			peerIP = addr.IP
+		}
+
+		mutex.Lock()
+		if sentTime, ok := sentTimes[peerIP.String()]; ok {
+			if _, replied := rtts[peerIP.String()]; !replied {
+				rtts[peerIP.String()] = received.Sub(sentTime)
+			}
+		}
+		allReplied := sendDone && len(rtts) == len(sentTimes)
+		mutex.Unlock()
+
+		if allReplied {
+			break
+		}
+	}
+
+	return rtts, nil
+}
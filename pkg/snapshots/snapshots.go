@@ -0,0 +1,188 @@
+// Package snapshots stores timestamped snapshots of the lease map so past
+// lease assignments can be queried after the leases file has been
+// rewritten.
+package snapshots
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/kvstore"
+)
+
+const snapshotsBucket = "snapshots"
+
+// Lease is one lease in a snapshot. EndTime is zero for leases that never
+// end, which have EndsNever set, and for leases without an end time.
+type Lease struct {
+	IPAddress  string    `json:"ipAddress"`
+	MACAddress string    `json:"macAddress"`
+	Hostname   string    `json:"hostname,omitempty"`
+	State      string    `json:"state"`
+	StartTime  time.Time `json:"startTime"`
+	EndTime    time.Time `json:"endTime"`
+	EndsNever  bool      `json:"endsNever,omitempty"`
+}
+
+// ActiveAt reports whether lease was held at time t.
+func (lease *Lease) ActiveAt(t time.Time) bool {
+	return !t.Before(lease.StartTime) && (lease.EndsNever || !t.After(lease.EndTime))
+}
+
+// Snapshot is the lease map at one point in time.
+type Snapshot struct {
+	Time   time.Time
+	Leases []Lease
+}
+
+// DB is a kvstore.Store bucket of snapshots keyed by time. It may share a
+// store with an oui.OUIDB.
+type DB struct {
+	store kvstore.Store
+}
+
+// Open opens the bbolt snapshot database at path, creating it and
+// its parent directories if readOnly is false.
+func Open(path string, readOnly bool) (*DB, error) {
+	store, err := kvstore.OpenBolt(path, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return New(store), nil
+}
+
+// New returns a snapshot DB stored in store.
+func New(store kvstore.Store) *DB {
+	return &DB{store: store}
+}
+
+// Close closes the store of the database.
+func (snapshotDB *DB) Close() error {
+	return snapshotDB.store.Close()
+}
+
+// timeKey encodes t as a big-endian UnixNano so keys sort by time.
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+}
+
+func decodeSnapshot(key []byte, value []byte) (*Snapshot, error) {
+	snapshot := &Snapshot{Time: keyTime(key)}
+	if err := json.Unmarshal(value, &snapshot.Leases); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %v: %w", snapshot.Time, err)
+	}
+	return snapshot, nil
+}
+
+// Record stores snapshot, replacing any snapshot with the same time.
+func (snapshotDB *DB) Record(snapshot *Snapshot) error {
+	value, err := json.Marshal(snapshot.Leases)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	if err := snapshotDB.store.Put(snapshotsBucket, timeKey(snapshot.Time), value); err != nil {
+		return fmt.Errorf("db.Update error: %w", err)
+	}
+
+	return nil
+}
+
+// Prune deletes snapshots taken before cutoff, unless cutoff is zero, and
+// then the oldest snapshots beyond the newest maxSnapshots, unless
+// maxSnapshots is zero. It returns the number of snapshots deleted.
+func (snapshotDB *DB) Prune(cutoff time.Time, maxSnapshots int) (int, error) {
+	deleted := 0
+
+	if err := snapshotDB.store.Batch(func(tx kvstore.Tx) error {
+		excess := 0
+		if maxSnapshots > 0 {
+			count, err := kvstore.Count(tx, snapshotsBucket)
+			if err != nil {
+				return err
+			}
+			excess = count - maxSnapshots
+		}
+
+		var keysToDelete [][]byte
+		if err := tx.ForEach(snapshotsBucket, nil, func(key []byte, value []byte) error {
+			if excess <= 0 && (cutoff.IsZero() || !keyTime(key).Before(cutoff)) {
+				return kvstore.ErrStop
+			}
+			keysToDelete = append(keysToDelete, append([]byte(nil), key...))
+			excess--
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, key := range keysToDelete {
+			if err := tx.Delete(snapshotsBucket, key); err != nil {
+				return err
+			}
+		}
+		deleted = len(keysToDelete)
+
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("db.Update error: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// At returns the latest snapshot taken at or before t, or nil if there is
+// none.
+func (snapshotDB *DB) At(t time.Time) (*Snapshot, error) {
+	var snapshot *Snapshot
+
+	if err := snapshotDB.store.View(func(tx kvstore.Tx) error {
+		var key, value []byte
+		if err := tx.ForEach(snapshotsBucket, nil, func(k []byte, v []byte) error {
+			if keyTime(k).After(t) {
+				return kvstore.ErrStop
+			}
+			key, value = k, v
+			return nil
+		}); err != nil {
+			return err
+		}
+		if key == nil {
+			return nil
+		}
+
+		var err error
+		snapshot, err = decodeSnapshot(key, value)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("db.View error: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// ForEach calls fn for each snapshot, oldest first, stopping at the first
+// error.
+func (snapshotDB *DB) ForEach(fn func(snapshot *Snapshot) error) error {
+	if err := snapshotDB.store.View(func(tx kvstore.Tx) error {
+		return tx.ForEach(snapshotsBucket, nil, func(key []byte, value []byte) error {
+			snapshot, err := decodeSnapshot(key, value)
+			if err != nil {
+				return err
+			}
+			return fn(snapshot)
+		})
+	}); err != nil {
+		return fmt.Errorf("db.View error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,261 @@
+// Package xlsx writes simple Office Open XML workbooks: sheets of a header
+// row and rows of text and number cells, with the header row frozen and an
+// autofilter over the sheet.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSheetNameLength is the longest sheet name Excel accepts.
+const maxSheetNameLength = 31
+
+// maxColumnWidth limits the width of columns fitted to long cell values.
+const maxColumnWidth = 60
+
+// Sheet is a worksheet of a workbook.
+type Sheet struct {
+	// Name is the sheet tab name. Characters Excel does not allow in sheet
+	// names are replaced, and long names are truncated.
+	Name    string
+	Columns []string
+	// Rows hold string, int, int64, uint64, and float64 cells, written as
+	// text or numbers. Other values are written as text with fmt.Sprint.
+	Rows [][]any
+}
+
+// SheetName returns name with the characters Excel does not allow in sheet
+// names replaced by '_', truncated to 31 characters.
+func SheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, "'")
+	if name == "" {
+		name = "Sheet"
+	}
+	if utf8.RuneCountInString(name) > maxSheetNameLength {
+		name = string([]rune(name)[:maxSheetNameLength])
+	}
+	return name
+}
+
+// uniqueSheetNames returns the sheet names of sheets, adding a number to
+// names already used, which Excel compares case-insensitively.
+func uniqueSheetNames(sheets []Sheet) []string {
+	used := make(map[string]bool, len(sheets))
+	names := make([]string, 0, len(sheets))
+	for i := range sheets {
+		base := SheetName(sheets[i].Name)
+		name := base
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			suffix := " (" + strconv.Itoa(n) + ")"
+			name = string([]rune(base)[:min(utf8.RuneCountInString(base), maxSheetNameLength-len(suffix))]) + suffix
+		}
+		used[strings.ToLower(name)] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// columnName returns the letters of the zero-based column index, e.g. A,
+// Z, AA.
+func columnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+func escape(value string) string {
+	var builder strings.Builder
+	xml.EscapeText(&builder, []byte(value))
+	return builder.String()
+}
+
+// cellXML returns the XML of a cell at ref with value, using style.
+func cellXML(ref string, value any, style int) string {
+	var number string
+	switch v := value.(type) {
+	case int:
+		number = strconv.Itoa(v)
+	case int64:
+		number = strconv.FormatInt(v, 10)
+	case uint64:
+		number = strconv.FormatUint(v, 10)
+	case float64:
+		number = strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return fmt.Sprintf(`<c r="%v" s="%v" t="inlineStr"><is><t xml:space="preserve">%v</t></is></c>`, ref, style, escape(v))
+	default:
+		return cellXML(ref, fmt.Sprint(v), style)
+	}
+	return fmt.Sprintf(`<c r="%v" s="%v"><v>%v</v></c>`, ref, style, number)
+}
+
+// cellWidth returns the display width of value in characters.
+func cellWidth(value any) int {
+	if s, ok := value.(string); ok {
+		return utf8.RuneCountInString(s)
+	}
+	return len(fmt.Sprint(value))
+}
+
+func writeSheet(w io.Writer, sheet *Sheet) error {
+	bufferedWriter := bufio.NewWriter(w)
+
+	widths := make([]int, len(sheet.Columns))
+	for i, column := range sheet.Columns {
+		widths[i] = cellWidth(column)
+	}
+	for _, row := range sheet.Rows {
+		for i, cell := range row {
+			if i < len(widths) {
+				widths[i] = max(widths[i], cellWidth(cell))
+			}
+		}
+	}
+
+	lastRef := columnName(max(len(sheet.Columns)-1, 0)) + strconv.Itoa(len(sheet.Rows)+1)
+
+	fmt.Fprint(bufferedWriter, xml.Header)
+	fmt.Fprint(bufferedWriter, `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	fmt.Fprint(bufferedWriter, `<sheetViews><sheetView workbookViewId="0">`)
+	fmt.Fprint(bufferedWriter, `<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`)
+	fmt.Fprint(bufferedWriter, `<selection pane="bottomLeft" activeCell="A2" sqref="A2"/>`)
+	fmt.Fprint(bufferedWriter, `</sheetView></sheetViews>`)
+	if len(widths) > 0 {
+		fmt.Fprint(bufferedWriter, `<cols>`)
+		for i, width := range widths {
+			fmt.Fprintf(bufferedWriter, `<col min="%v" max="%v" width="%v" customWidth="1"/>`, i+1, i+1, min(width, maxColumnWidth)+2)
+		}
+		fmt.Fprint(bufferedWriter, `</cols>`)
+	}
+
+	fmt.Fprint(bufferedWriter, `<sheetData>`)
+	fmt.Fprint(bufferedWriter, `<row r="1">`)
+	for i, column := range sheet.Columns {
+		// Style 1 is bold.
+		fmt.Fprint(bufferedWriter, cellXML(columnName(i)+"1", column, 1))
+	}
+	fmt.Fprint(bufferedWriter, `</row>`)
+	for rowIndex, row := range sheet.Rows {
+		rowNumber := strconv.Itoa(rowIndex + 2)
+		fmt.Fprintf(bufferedWriter, `<row r="%v">`, rowNumber)
+		for i, cell := range row {
+			fmt.Fprint(bufferedWriter, cellXML(columnName(i)+rowNumber, cell, 0))
+		}
+		fmt.Fprint(bufferedWriter, `</row>`)
+	}
+	fmt.Fprint(bufferedWriter, `</sheetData>`)
+
+	if len(sheet.Columns) > 0 {
+		fmt.Fprintf(bufferedWriter, `<autoFilter ref="A1:%v"/>`, lastRef)
+	}
+	fmt.Fprint(bufferedWriter, `</worksheet>`)
+
+	return bufferedWriter.Flush()
+}
+
+const contentTypesHeader = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`
+
+const rootRelationships = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// styles has two cell formats: 0 is the default and 1 is bold.
+const styles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// Write writes a workbook of sheets to w.
+func Write(w io.Writer, sheets []Sheet) error {
+	if len(sheets) == 0 {
+		return fmt.Errorf("workbook has no sheets")
+	}
+
+	names := uniqueSheetNames(sheets)
+
+	var contentTypes, workbook, workbookRelationships strings.Builder
+	contentTypes.WriteString(contentTypesHeader)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRelationships.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	var definedNames strings.Builder
+	for i, name := range names {
+		contentTypes.WriteString(fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%v.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1))
+		workbook.WriteString(fmt.Sprintf(`<sheet name="%v" sheetId="%v" r:id="rId%v"/>`, escape(name), i+1, i+1))
+		workbookRelationships.WriteString(fmt.Sprintf(`<Relationship Id="rId%v" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%v.xml"/>`, i+1, i+1))
+		if len(sheets[i].Columns) > 0 {
+			// Excel records autofilter ranges as hidden names as well.
+			definedNames.WriteString(fmt.Sprintf(`<definedName name="_xlnm._FilterDatabase" localSheetId="%v" hidden="1">'%v'!$A$1:$%v$%v</definedName>`,
+				i, escape(strings.ReplaceAll(name, "'", "''")), columnName(len(sheets[i].Columns)-1), len(sheets[i].Rows)+1))
+		}
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets>`)
+	if definedNames.Len() > 0 {
+		workbook.WriteString(`<definedNames>` + definedNames.String() + `</definedNames>`)
+	}
+	workbook.WriteString(`</workbook>`)
+	workbookRelationships.WriteString(fmt.Sprintf(`<Relationship Id="rId%v" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(names)+1))
+	workbookRelationships.WriteString(`</Relationships>`)
+
+	zipWriter := zip.NewWriter(w)
+
+	writePart := func(name string, write func(io.Writer) error) error {
+		partWriter, err := zipWriter.Create(name)
+		if err != nil {
+			return err
+		}
+		return write(partWriter)
+	}
+	writeString := func(name string, content string) error {
+		return writePart(name, func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		})
+	}
+
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", rootRelationships},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRelationships.String()},
+		{"xl/styles.xml", styles},
+	} {
+		if err := writeString(part.name, part.content); err != nil {
+			return err
+		}
+	}
+	for i := range sheets {
+		if err := writePart(fmt.Sprintf("xl/worksheets/sheet%v.xml", i+1), func(w io.Writer) error {
+			return writeSheet(w, &sheets[i])
+		}); err != nil {
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/dhcpdconf"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// poolUsage is the utilization of the dynamic ranges of one subnet.
+type poolUsage struct {
+	subnet *net.IPNet
+	ranges []dhcpdconf.Range
+	size   uint64
+	leased uint64
+}
+
+func (usage *poolUsage) free() uint64 {
+	return usage.size - usage.leased
+}
+
+func (usage *poolUsage) percentUsed() float64 {
+	if usage.size == 0 {
+		return 0
+	}
+	return 100 * float64(usage.leased) / float64(usage.size)
+}
+
+func (usage *poolUsage) rangesString() string {
+	rangeStrings := make([]string, 0, len(usage.ranges))
+	for _, r := range usage.ranges {
+		rangeStrings = append(rangeStrings, r.String())
+	}
+	return strings.Join(rangeStrings, ",")
+}
+
+// computePoolUsage counts the Current dynamic leases in leaseList within the
+// ranges of each subnet of dhcpdConf that has ranges.
+func computePoolUsage(dhcpdConf *dhcpdconf.Config, leaseList []*leases.Lease, now time.Time) []poolUsage {
+	pools := make([]poolUsage, 0, len(dhcpdConf.Subnets))
+	for _, subnet := range dhcpdConf.Subnets {
+		if len(subnet.Ranges) == 0 {
+			continue
+		}
+
+		usage := poolUsage{
+			subnet: subnet.Network,
+			ranges: subnet.Ranges,
+		}
+		for _, r := range subnet.Ranges {
+			usage.size += r.Size()
+		}
+
+		for _, lease := range leaseList {
+			if lease.GetState(now) != leases.Current {
+				continue
+			}
+			for _, r := range subnet.Ranges {
+				if r.Contains(lease.IPAddress) {
+					usage.leased++
+					break
+				}
+			}
+		}
+
+		pools = append(pools, usage)
+	}
+	return pools
+}
+
+func printPoolUsage(pools []poolUsage) {
+	if len(pools) == 0 {
+		return
+	}
+
+	reportPrintf("")
+	reportPrintf("%v pools:", len(pools))
+	for i := range pools {
+		usage := &pools[i]
+		reportPrintf("\t%v (%v): %v/%v leased (%.1f%%), %v free",
+			usage.subnet, usage.rangesString(), usage.leased, usage.size, usage.percentUsed(), usage.free())
+	}
+}
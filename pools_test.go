@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/dhcpdconf"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+func TestComputePoolUsage(t *testing.T) {
+	config, err := dhcpdconf.Parse(strings.NewReader(`
+subnet 10.0.0.0 netmask 255.255.255.0 {
+  range 10.0.0.10 10.0.0.19;
+  range 10.0.0.30;
+}
+subnet 10.1.0.0 netmask 255.255.255.0 { }
+`))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	now := time.Date(2020, 6, 26, 22, 0, 0, 0, time.UTC)
+	// A lease with a zero endTime never ends.
+	lease := func(ip string, endTime time.Time) *leases.Lease {
+		return &leases.Lease{IPAddress: net.ParseIP(ip), StartTime: now.Add(-time.Hour), EndTime: endTime, EndsNever: endTime.IsZero()}
+	}
+	leaseList := []*leases.Lease{
+		lease("10.0.0.10", now.Add(time.Hour)),
+		lease("10.0.0.30", time.Time{}),
+		// Past leases and leases outside the ranges are not counted.
+		lease("10.0.0.11", now.Add(-time.Minute)),
+		lease("10.0.0.5", now.Add(time.Hour)),
+	}
+
+	pools := computePoolUsage(config, leaseList, now)
+	if len(pools) != 1 {
+		t.Fatalf("got %v pools, want 1 for the subnet with ranges", len(pools))
+	}
+	usage := pools[0]
+	if usage.subnet.String() != "10.0.0.0/24" || usage.size != 11 || usage.leased != 2 || usage.free() != 9 {
+		t.Errorf("got %v size %v leased %v free %v, want 10.0.0.0/24 size 11 leased 2 free 9", usage.subnet, usage.size, usage.leased, usage.free())
+	}
+	if got := usage.rangesString(); got != "10.0.0.10-10.0.0.19,10.0.0.30-10.0.0.30" {
+		t.Errorf("rangesString = %q", got)
+	}
+}
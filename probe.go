@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/ping"
+)
+
+// probeResults holds the round trip times of the addresses probed with
+// -probe that replied, by IP address string.
+type probeResults struct {
+	probed map[string]bool
+	rtts   map[string]time.Duration
+}
+
+// probeLeases probes the IPv4 addresses of the current leases in leaseList
+// with the opts.probe method.
+func probeLeases(ctx context.Context, opts *options, leaseList []*leases.Lease, now time.Time) (*probeResults, error) {
+	if opts.probe != "icmp" {
+		return nil, fmt.Errorf("unknown probe method '%v'", opts.probe)
+	}
+
+	results := &probeResults{probed: make(map[string]bool)}
+	var ipAddresses []net.IP
+	for _, lease := range leaseList {
+		if lease.IPAddress.To4() != nil && lease.GetState(now) == leases.Current && !results.probed[lease.IPAddress.String()] {
+			results.probed[lease.IPAddress.String()] = true
+			ipAddresses = append(ipAddresses, lease.IPAddress)
+		}
+	}
+
+	var err error
+	results.rtts, err = ping.Ping(ctx, ipAddresses, ping.Options{
+		Rate:    opts.probeRate,
+		Timeout: opts.probeTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("probed addresses", "replied", len(results.rtts), "probed", len(ipAddresses))
+	return results, nil
+}
+
+// setRow sets the probe results of the IP of row.
+func (results *probeResults) setRow(row *leaseReportRow) {
+	ipString := row.lease.IPAddress.String()
+	if !results.probed[ipString] {
+		return
+	}
+	row.probed = true
+	row.rtt, row.reachable = results.rtts[ipString]
+}
+
+// probeColumnGroup adds whether the IP of each row replied to -probe, and
+// its round trip time.
+var probeColumnGroup = &optionalColumnGroup{
+	columns: []string{"Ping", "RTT"},
+	values: func(row *leaseReportRow) []string {
+		switch {
+		case !row.probed:
+			return []string{"", ""}
+		case !row.reachable:
+			return []string{"down", ""}
+		}
+		return []string{"up", row.rtt.Round(10 * time.Microsecond).String()}
+	},
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// prunedLeases holds the last lease record for each address of a leases
+// file, in the order the addresses first appear.
+type prunedLeases struct {
+	addressToIndex map[string]int
+	leaseList      []*leases.Lease
+	records        int
+	// headerLines are top-level statements copied to the pruned file, such
+	// as the server-duid that dhcpd uses as its DHCPv6 server identifier.
+	headerLines []string
+}
+
+// pruneHeaderStatements are the prefixes of top-level statements kept by
+// prune.
+var pruneHeaderStatements = []string{"server-duid "}
+
+// add keeps lease as the lease of its address, since dhcpd applies the
+// records of a leases file in order and the last one for an address is
+// current.
+func (pruned *prunedLeases) add(lease *leases.Lease) {
+	pruned.records++
+
+	address := lease.AddressString()
+	if i, ok := pruned.addressToIndex[address]; ok {
+		pruned.leaseList[i] = lease
+		return
+	}
+	pruned.addressToIndex[address] = len(pruned.leaseList)
+	pruned.leaseList = append(pruned.leaseList, lease)
+}
+
+// readPrunedLeases reads the leases file at path, which must be of format,
+// keeping the last record for each address.
+func readPrunedLeases(ctx context.Context, path string, format leases.FileFormat, strict bool) (*prunedLeases, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %v: %w", path, err)
+	}
+	defer file.Close()
+
+	reader, detectedFormat, err := detectLeasesFormat(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %w", path, err)
+	}
+	if detectedFormat != format {
+		return nil, fmt.Errorf("%v is a %v leases file, not a %v leases file", path, detectedFormat, format)
+	}
+
+	pruned := &prunedLeases{
+		addressToIndex: make(map[string]int),
+	}
+
+	parser, problems := newSourceParser(path, strict)
+	parser.SkippedLine = func(lineNumber int, line string) {
+		for _, prefix := range pruneHeaderStatements {
+			if strings.HasPrefix(line, prefix) {
+				pruned.headerLines = append(pruned.headerLines, line)
+			}
+		}
+	}
+
+	slog.Info("reading leases", "source", path)
+	if err := parseLeasesAs(ctx, parser, reader, format, func(lease leases.Lease) error {
+		pruned.add(&lease)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("error parsing %v: %w", path, err)
+	}
+	problems.log()
+
+	return pruned, nil
+}
+
+// writeDhcpdLeasesFile writes headerLines and leaseList to w in dhcpd
+// leases file format.
+func writeDhcpdLeasesFile(w io.Writer, headerLines []string, leaseList []*leases.Lease) error {
+	bufferedWriter := bufio.NewWriter(w)
+
+	fmt.Fprintf(bufferedWriter, "# The format of this file is documented in the dhcpd.leases(5) manual page.\n")
+	fmt.Fprintf(bufferedWriter, "# Written by go-dhcp-leases with the last record for each address.\n")
+	fmt.Fprintf(bufferedWriter, "\n")
+	fmt.Fprintf(bufferedWriter, "authoring-byte-order little-endian;\n")
+	for _, line := range headerLines {
+		fmt.Fprintf(bufferedWriter, "%v\n", line)
+	}
+	fmt.Fprintf(bufferedWriter, "\n")
+
+	for _, lease := range leaseList {
+		if err := leases.WriteLease(bufferedWriter, lease); err != nil {
+			return err
+		}
+	}
+
+	return bufferedWriter.Flush()
+}
+
+// activeLeases returns the leases of leaseList in binding state active.
+func activeLeases(leaseList []*leases.Lease) []*leases.Lease {
+	var active []*leases.Lease
+	for _, lease := range leaseList {
+		if lease.BindingState == "active" {
+			active = append(active, lease)
+		}
+	}
+	return active
+}
+
+// sameFile reports whether path and otherPath name the same file.
+func sameFile(path string, otherPath string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	otherInfo, err := os.Stat(otherPath)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(info, otherInfo)
+}
+
+// runPrune writes the last record for each address of the leases file
+// inputPath to outputPath. outputPath is replaced atomically and may not be
+// inputPath, so the original file is never modified.
+func runPrune(ctx context.Context, opts *options, inputPath string, outputPath string, activeOnly bool) error {
+	if sameFile(inputPath, outputPath) {
+		return fmt.Errorf("refusing to overwrite the leases file %v; write the pruned file elsewhere and move it into place while dhcpd is stopped", inputPath)
+	}
+
+	pruned, err := readPrunedLeases(ctx, inputPath, leases.DhcpdFormat, opts.strict)
+	if err != nil {
+		return err
+	}
+
+	leaseList := pruned.leaseList
+	if activeOnly {
+		leaseList = activeLeases(leaseList)
+	}
+
+	if err := writeFileAtomically(outputPath, func(w io.Writer) error {
+		return writeDhcpdLeasesFile(w, pruned.headerLines, leaseList)
+	}); err != nil {
+		return fmt.Errorf("error writing %v: %w", outputPath, err)
+	}
+
+	slog.Info("wrote pruned leases file", "path", outputPath, "records", pruned.records, "leases", len(leaseList))
+	return nil
+}
+
+func setupPruneCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	flagSet.Var(&opts.leasesFiles, "leases-file", "dhcpd leases file to prune (env DHCP_LEASES_FILE, default "+defaultLeasesFile+")")
+	flagSet.BoolVar(&opts.strict, "strict", false, "fail instead of warning when the leases file has unparsable leases, which are left out of the pruned file")
+	activeOnly := flagSet.Bool("active-only", false, "write only leases in binding state active")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if flagSet.NArg() != 1 {
+			flagSet.Usage()
+			return errUsage
+		}
+
+		paths, err := opts.leasesFilePaths()
+		if err != nil {
+			return err
+		}
+		if len(paths) != 1 || strings.Contains(paths[0], "://") {
+			return errors.New("prune requires -leases-file to name one local leases file")
+		}
+
+		return runPrune(ctx, &opts, paths[0], flagSet.Arg(0), *activeOnly)
+	}
+}
@@ -0,0 +1,748 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/dhcpdconf"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/mdns"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/oui"
+)
+
+type leaseReportRow struct {
+	lease        *leases.Lease
+	state        leases.LeaseState
+	organization string
+	// randomizedMAC is true for locally administered MAC addresses, which
+	// have no OUI.
+	randomizedMAC bool
+	// deviceName is the name of the MAC in -known-devices, empty if unknown.
+	deviceName string
+	// presence is the neighbor table presence of the IP with -neighbors,
+	// empty if the table could not be read.
+	presence string
+	// probed is true if the IP was probed with -probe; reachable is true if
+	// it replied, after rtt.
+	probed    bool
+	reachable bool
+	rtt       time.Duration
+}
+
+type leaseReport struct {
+	rows              []leaseReportRow
+	leaseStateToCount map[leases.LeaseState]int
+	optionalColumns   []*optionalColumnGroup
+	pools             []poolUsage
+	randomizedMACs    int
+	// separateRandomized lists rows with randomized MACs in their own table
+	// section.
+	separateRandomized bool
+	// colorize colors table rows by lease state.
+	colorize bool
+	// formatTemplate replaces the output format if not nil.
+	formatTemplate *template.Template
+}
+
+const (
+	unknownOrganization    = "UNKNOWN"
+	randomizedOrganization = "RANDOMIZED"
+)
+
+// buildLeaseReport builds a report of leaseMap sorted by IP. If dhcpdConf is
+// not nil the report includes the utilization of its pools.
+func buildLeaseReport(ctx context.Context, opts *options, leaseMap leases.LeaseMap, dhcpdConf *dhcpdconf.Config) (*leaseReport, error) {
+	leaseList := make([]*leases.Lease, 0, len(leaseMap))
+	for _, lease := range leaseMap {
+		leaseList = append(leaseList, lease)
+	}
+
+	sort.Slice(leaseList, func(i int, j int) bool {
+		return (bytes.Compare(leaseList[i].IPAddress, leaseList[j].IPAddress) < 0)
+	})
+
+	report, err := buildLeaseReportFromList(ctx, opts, leaseList)
+	if err != nil {
+		return nil, err
+	}
+
+	if dhcpdConf != nil {
+		report.pools = computePoolUsage(dhcpdConf, leaseList, time.Now())
+	}
+
+	newAnonymizer(opts).rows(report.rows)
+
+	return report, nil
+}
+
+// buildLeaseReportFromList looks up organizations and applies opts.filters to
+// leaseList, keeping its order, then enriches the remaining rows.
+func buildLeaseReportFromList(ctx context.Context, opts *options, leaseList []*leases.Lease) (*leaseReport, error) {
+	colorize, err := useColor(opts.color)
+	if err != nil {
+		return nil, err
+	}
+	formatTemplate, err := parseFormatTemplate(opts.formatTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	ouiDB, err := openOrganizationDB(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer ouiDB.Close()
+
+	var devices knownDevices
+	if opts.knownDevicesFile != "" {
+		devices, err = loadKnownDevices(opts.knownDevicesFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &leaseReport{
+		rows:               make([]leaseReportRow, 0, len(leaseList)),
+		leaseStateToCount:  make(map[leases.LeaseState]int),
+		optionalColumns:    opts.optionalColumnGroups(),
+		separateRandomized: opts.separateRandomized,
+		colorize:           colorize,
+		formatTemplate:     formatTemplate,
+	}
+
+	now := time.Now()
+
+	// Filters are applied before the rows are enriched, so that only the
+	// leases in the report are looked up with mDNS and probed.
+	for _, lease := range leaseList {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		row := leaseReportRow{
+			lease:         lease,
+			state:         lease.GetState(now),
+			randomizedMAC: lease.RandomizedMAC(),
+			deviceName:    devices[lease.MACAddress.String()],
+		}
+
+		row.organization, err = lookupOrganization(ouiDB, lease.MACAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.includeRow(&row) {
+			report.rows = append(report.rows, row)
+		}
+	}
+
+	if err := enrichRows(ctx, opts, report.rows, now); err != nil {
+		return nil, err
+	}
+
+	for i := range report.rows {
+		if report.rows[i].randomizedMAC {
+			report.randomizedMACs++
+		}
+		report.leaseStateToCount[report.rows[i].state]++
+	}
+
+	if cachedDB, ok := ouiDB.(cachedOrganizationDB); ok {
+		hits, misses := cachedDB.cache.Stats()
+		slog.Debug("OUI lookup cache", "prefixes", cachedDB.cache.Len(), "hits", hits, "misses", misses)
+	}
+
+	return report, nil
+}
+
+// enrichRows adds the mDNS names, neighbor table presence, and probe
+// results requested by opts to rows. mDNS names are only used for rows
+// without a hostname.
+func enrichRows(ctx context.Context, opts *options, rows []leaseReportRow, now time.Time) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	leaseList := make([]*leases.Lease, 0, len(rows))
+	for i := range rows {
+		leaseList = append(leaseList, rows[i].lease)
+	}
+
+	var ipToMDNSName map[string]string
+	if opts.mdns {
+		ipToMDNSName = lookupMDNSNames(ctx, opts, leaseList, now)
+	}
+
+	var presence neighborPresence
+	if opts.neighbors {
+		presence = lookupNeighborPresence(ctx, opts)
+	}
+
+	var probeResults *probeResults
+	if opts.probe != "" {
+		var err error
+		if probeResults, err = probeLeases(ctx, opts, leaseList, now); err != nil {
+			return err
+		}
+	}
+
+	for i := range rows {
+		row := &rows[i]
+		if name, ok := ipToMDNSName[row.lease.IPAddress.String()]; ok && row.lease.Hostname == "" {
+			enriched := *row.lease
+			enriched.Hostname = name
+			row.lease = &enriched
+		}
+		if presence != nil {
+			row.presence = presence.presenceOf(row.lease.IPAddress)
+		}
+		if probeResults != nil {
+			probeResults.setRow(row)
+		}
+	}
+	return nil
+}
+
+// lookupMDNSNames returns mDNS names by IP address string for the current
+// leases in leaseList without a hostname. Errors are logged, since names are
+// only an enrichment of the report.
+func lookupMDNSNames(ctx context.Context, opts *options, leaseList []*leases.Lease, now time.Time) map[string]string {
+	var ipAddresses []net.IP
+	for _, lease := range leaseList {
+		if lease.Hostname == "" && lease.GetState(now) == leases.Current {
+			ipAddresses = append(ipAddresses, lease.IPAddress)
+		}
+	}
+	if len(ipAddresses) == 0 {
+		return nil
+	}
+
+	ipToName, err := mdns.LookupNames(ctx, ipAddresses, opts.mdnsTimeout)
+	if err != nil {
+		slog.Warn("mdns error", "err", err)
+		return nil
+	}
+	slog.Info("found mDNS names of leases without hostnames", "found", len(ipToName), "leases", len(ipAddresses))
+	return ipToName
+}
+
+// organizationDB looks up the organizations of MAC prefixes.
+type organizationDB interface {
+	Lookup(macAddress net.HardwareAddr) (string, bool, error)
+	Close() error
+}
+
+// openOrganizationDB opens opts.ouiDBFile read-only after rebuilding it if
+// opts.ouiFile changed, loads opts.ouiFile into memory if opts.ouiMemory is
+// set, or returns the OUI registry snapshot embedded in the
+// binary if the file does not exist or has no organizations because
+// createdb was never run.
+func openOrganizationDB(ctx context.Context, opts *options) (organizationDB, error) {
+	if opts.ouiMemory {
+		return loadMemoryOrganizationDB(ctx, opts)
+	}
+
+	if err := rebuildOuiDBIfChanged(ctx, opts); err != nil {
+		slog.Warn("oui db rebuild error", "err", err)
+	}
+
+	if _, err := os.Stat(opts.ouiDBFile); errors.Is(err, fs.ErrNotExist) {
+		slog.Info("OUI database not found, using embedded OUI data", "path", opts.ouiDBFile, "date", oui.EmbeddedDate)
+		warnLegacyOuiDB(opts)
+		return oui.Embedded()
+	}
+
+	ouiDB, err := oui.Open(opts.ouiDBFile, true)
+	if err != nil {
+		return nil, err
+	}
+
+	empty, err := ouiDB.Empty()
+	if err != nil {
+		ouiDB.Close()
+		return nil, err
+	}
+	if empty {
+		ouiDB.Close()
+		slog.Info("OUI database has no OUI data, using embedded OUI data", "path", opts.ouiDBFile, "date", oui.EmbeddedDate)
+		warnLegacyOuiDB(opts)
+		return oui.Embedded()
+	}
+
+	if err := checkOuiDBAge(ouiDB, opts); err != nil {
+		ouiDB.Close()
+		return nil, err
+	}
+
+	builtAt, err := ouiDBBuiltAt(ouiDB)
+	if err != nil {
+		ouiDB.Close()
+		return nil, err
+	}
+
+	return cachedOrganizationDB{
+		OUIDB: ouiDB,
+		cache: ouiLookupCacheFor(opts.ouiDBFile, builtAt),
+	}, nil
+}
+
+// ouiLookupCache caches lookups in an OUI database for the life of the
+// process, until the database is rebuilt.
+var ouiLookupCache struct {
+	mutex   sync.Mutex
+	path    string
+	builtAt time.Time
+	cache   *oui.Cache
+}
+
+// ouiLookupCacheFor returns the lookup cache of the OUI database at path
+// built at builtAt, replacing the cache of any other database.
+func ouiLookupCacheFor(path string, builtAt time.Time) *oui.Cache {
+	ouiLookupCache.mutex.Lock()
+	defer ouiLookupCache.mutex.Unlock()
+
+	if ouiLookupCache.cache == nil || ouiLookupCache.path != path || !ouiLookupCache.builtAt.Equal(builtAt) {
+		ouiLookupCache.path = path
+		ouiLookupCache.builtAt = builtAt
+		ouiLookupCache.cache = oui.NewCache(oui.DefaultCacheSize)
+	}
+	return ouiLookupCache.cache
+}
+
+// cachedOrganizationDB is an OUI database whose lookups go through cache.
+type cachedOrganizationDB struct {
+	*oui.OUIDB
+	cache *oui.Cache
+}
+
+func (db cachedOrganizationDB) Lookup(macAddress net.HardwareAddr) (string, bool, error) {
+	return db.cache.Lookup(macAddress, db.OUIDB.LookupPrefix)
+}
+
+// warnLegacyOuiDB logs a hint if opts.ouiDBFile is the default and an OUI
+// database from an earlier version, which defaulted to the working
+// directory, is in the working directory.
+func warnLegacyOuiDB(opts *options) {
+	if opts.ouiDBFile != defaultOuiDBFile {
+		return
+	}
+	if _, err := os.Stat(legacyOuiDBFile); err == nil {
+		slog.Warn(fmt.Sprintf("ignoring %v in the working directory, move it to %v or set -oui-db", legacyOuiDBFile, defaultOuiDBFile))
+	}
+}
+
+// lookupOrganization returns the organization for macAddress from ouiDB,
+// unknownOrganization if there is none, or randomizedOrganization for
+// randomized MACs, which have no OUI.
+func lookupOrganization(ouiDB organizationDB, macAddress net.HardwareAddr) (string, error) {
+	if leases.IsRandomizedMAC(macAddress) {
+		return randomizedOrganization, nil
+	}
+
+	organization, found, err := ouiDB.Lookup(macAddress)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return unknownOrganization, nil
+	}
+	return organization, nil
+}
+
+var outputFormats = []string{"table", "csv", "markdown"}
+
+// leaseOutputFormats are the output formats of lease reports.
+var leaseOutputFormats = append(append([]string(nil), outputFormats...), "influx", "prom-textfile", "xlsx", "jsonl")
+
+var reportColumns = []string{"IP", "MAC", "Count", "Hostname", "State", "End Time", "Last Transaction Time", "Organization"}
+
+// optionalColumnGroup is a set of report columns enabled by a flag.
+type optionalColumnGroup struct {
+	columns []string
+	values  func(row *leaseReportRow) []string
+}
+
+var agentInfoColumnGroup = &optionalColumnGroup{
+	columns: []string{"Circuit ID", "Remote ID"},
+	values: func(row *leaseReportRow) []string {
+		return []string{
+			leases.DataString(row.lease.AgentCircuitID),
+			leases.DataString(row.lease.AgentRemoteID),
+		}
+	},
+}
+
+var ddnsColumnGroup = &optionalColumnGroup{
+	columns: []string{"DNS Name"},
+	values: func(row *leaseReportRow) []string {
+		return []string{row.lease.DDNSForwardName()}
+	},
+}
+
+// columns returns reportColumns followed by any optional columns enabled for
+// report.
+func (report *leaseReport) columns() []string {
+	columns := append([]string(nil), reportColumns...)
+	for _, group := range report.optionalColumns {
+		columns = append(columns, group.columns...)
+	}
+	return columns
+}
+
+// optionalValues returns the values of the optional columns enabled for
+// report.
+func (report *leaseReport) optionalValues(row *leaseReportRow) []string {
+	var values []string
+	for _, group := range report.optionalColumns {
+		values = append(values, group.values(row)...)
+	}
+	return values
+}
+
+// formatEndTime formats the end time of lease, or "never" if it never ends.
+// Static leases have no times, so their end time is "".
+func formatEndTime(lease *leases.Lease) string {
+	if lease.Static {
+		return ""
+	}
+	if lease.EndsNever {
+		return "never"
+	}
+	return formatDisplayTime(lease.EndTime)
+}
+
+func (row *leaseReportRow) columnValues() []string {
+	return []string{
+		row.lease.AddressString(),
+		row.lease.MACAddress.String(),
+		strconv.Itoa(row.lease.Count),
+		row.lease.Hostname,
+		row.state.String(),
+		formatEndTime(row.lease),
+		formatDisplayTime(row.lease.ClttTime),
+		row.organization,
+	}
+}
+
+func printLeaseReport(report *leaseReport) {
+	columns := report.columns()
+	cellRows := report.cellRows()
+	layout := newTableLayout(columns, cellRows, terminalWidth())
+
+	printRows := func(randomizedMAC bool) {
+		for i := range report.rows {
+			row := &report.rows[i]
+			if report.separateRandomized && row.randomizedMAC != randomizedMAC {
+				continue
+			}
+			line := layout.formatRow(cellRows[i])
+			if report.colorize {
+				line = colorizeState(line, row.state)
+			}
+			reportPrintf("%v", line)
+		}
+	}
+
+	reportPrintf("")
+	layout.printHeader(columns)
+	printRows(false)
+
+	if report.separateRandomized && report.randomizedMACs > 0 {
+		reportPrintf("")
+		reportPrintf("Randomized MACs:")
+		layout.printHeader(columns)
+		printRows(true)
+	}
+
+	printLeaseSummary(report)
+}
+
+func printLeaseDetails(row *leaseReportRow) {
+	const formatString = "%-23v%v"
+
+	reportPrintf("")
+	reportPrintf(formatString, "IP:", row.lease.IPAddress)
+	reportPrintf(formatString, "MAC:", row.lease.MACAddress)
+	reportPrintf(formatString, "Hostname:", row.lease.Hostname)
+	if len(row.lease.UID) > 0 {
+		reportPrintf(formatString, "Client ID:", leases.DescribeClientID(row.lease.UID))
+	}
+	if dnsName := row.lease.DDNSForwardName(); dnsName != "" {
+		reportPrintf(formatString, "DNS Name:", dnsName)
+	}
+	if reverseName := row.lease.DDNSReverseName(); reverseName != "" {
+		reportPrintf(formatString, "DNS Reverse Name:", reverseName)
+	}
+	if txt := row.lease.DDNSTxt(); txt != "" {
+		reportPrintf(formatString, "DNS TXT:", txt)
+	}
+	if len(row.lease.AgentCircuitID) > 0 {
+		reportPrintf(formatString, "Agent Circuit ID:", leases.DataString(row.lease.AgentCircuitID))
+	}
+	if len(row.lease.AgentRemoteID) > 0 {
+		reportPrintf(formatString, "Agent Remote ID:", leases.DataString(row.lease.AgentRemoteID))
+	}
+	reportPrintf(formatString, "State:", row.state)
+	reportPrintf(formatString, "Abandoned:", row.lease.Abandoned)
+	reportPrintf(formatString, "Binding State:", row.lease.BindingState)
+	reportPrintf(formatString, "Next Binding State:", row.lease.NextBindingState)
+	reportPrintf(formatString, "Rewind Binding State:", row.lease.RewindBindingState)
+	reportPrintf(formatString, "Start Time:", formatDisplayTime(row.lease.StartTime))
+	reportPrintf(formatString, "End Time:", formatEndTime(row.lease))
+	reportPrintf(formatString, "Last Transaction Time:", formatDisplayTime(row.lease.ClttTime))
+	for _, failoverTime := range []struct {
+		name string
+		time time.Time
+	}{
+		{"Failover tstp:", row.lease.TstpTime},
+		{"Failover tsfp:", row.lease.TsfpTime},
+		{"Failover atsfp:", row.lease.AtsfpTime},
+	} {
+		if !failoverTime.time.IsZero() {
+			reportPrintf(formatString, failoverTime.name, formatDisplayTime(failoverTime.time))
+		}
+	}
+	variableNames := make([]string, 0, len(row.lease.Variables))
+	for name := range row.lease.Variables {
+		variableNames = append(variableNames, name)
+	}
+	sort.Strings(variableNames)
+	for _, name := range variableNames {
+		reportPrintf(formatString, "Set:", name+" = "+row.lease.Variables[name])
+	}
+	reportPrintf(formatString, "Lease Records:", row.lease.Count)
+	reportPrintf(formatString, "Organization:", row.organization)
+}
+
+func printLeaseSummary(report *leaseReport) {
+	reportPrintf("")
+	reportPrintf("%v leases with unique IPs:", len(report.rows))
+	for _, state := range leases.LeaseStates {
+		reportPrintf("\t%v %v", report.leaseStateToCount[state], state)
+	}
+	if report.randomizedMACs > 0 {
+		reportPrintf("%v leases with randomized MACs", report.randomizedMACs)
+	}
+
+	printPoolUsage(report.pools)
+}
+
+func (report *leaseReport) cellRows() [][]string {
+	cellRows := make([][]string, 0, len(report.rows))
+	for i := range report.rows {
+		cells := append(report.rows[i].columnValues(), report.optionalValues(&report.rows[i])...)
+		cellRows = append(cellRows, cells)
+	}
+	return cellRows
+}
+
+func writeCSV(w io.Writer, columns []string, cellRows [][]string) error {
+	csvWriter := csv.NewWriter(w)
+
+	if err := csvWriter.Write(columns); err != nil {
+		return err
+	}
+
+	for _, cells := range cellRows {
+		if err := csvWriter.Write(cells); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func escapeMarkdownCell(value string) string {
+	return strings.ReplaceAll(value, "|", "\\|")
+}
+
+func writeMarkdownTable(w io.Writer, columns []string, cellRows [][]string) error {
+	escapedRows := make([][]string, 0, len(cellRows)+1)
+	for _, cells := range append([][]string{columns}, cellRows...) {
+		escapedCells := make([]string, len(cells))
+		for i, cell := range cells {
+			escapedCells[i] = escapeMarkdownCell(cell)
+		}
+		escapedRows = append(escapedRows, escapedCells)
+	}
+
+	columnWidths := make([]int, len(columns))
+	for _, cells := range escapedRows {
+		for i, cell := range cells {
+			if width := utf8.RuneCountInString(cell); width > columnWidths[i] {
+				columnWidths[i] = width
+			}
+		}
+	}
+
+	writeCells := func(cells []string) error {
+		var builder strings.Builder
+		builder.WriteString("|")
+		for i, cell := range cells {
+			builder.WriteString(" ")
+			builder.WriteString(cell)
+			builder.WriteString(strings.Repeat(" ", columnWidths[i]-utf8.RuneCountInString(cell)))
+			builder.WriteString(" |")
+		}
+		builder.WriteString("\n")
+		_, err := io.WriteString(w, builder.String())
+		return err
+	}
+
+	if err := writeCells(escapedRows[0]); err != nil {
+		return err
+	}
+
+	separatorCells := make([]string, len(columns))
+	for i := range separatorCells {
+		separatorCells[i] = strings.Repeat("-", columnWidths[i])
+	}
+	if err := writeCells(separatorCells); err != nil {
+		return err
+	}
+
+	for _, cells := range escapedRows[1:] {
+		if err := writeCells(cells); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeOutput calls write with stdout, or with outputFile if it is not empty.
+func writeOutput(outputFile string, write func(io.Writer) error) error {
+	if outputFile == "" {
+		return write(os.Stdout)
+	}
+
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create file %v: %w", outputFile, err)
+	}
+
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// writeFileAtomically writes path by writing a temporary file in the same
+// directory and renaming it into place, so readers never see a partial file.
+func writeFileAtomically(path string, write func(io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %v: %w", path, err)
+	}
+	defer os.Remove(file.Name())
+
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// writeTabularOutput writes columns and cellRows in a non-table outputFormat.
+func writeTabularOutput(columns []string, cellRows [][]string, outputFormat string, outputFile string) error {
+	var writeTable func(io.Writer, []string, [][]string) error
+	switch outputFormat {
+	case "csv":
+		writeTable = writeCSV
+	case "markdown":
+		writeTable = writeMarkdownTable
+	default:
+		return fmt.Errorf("unknown output format '%v'", outputFormat)
+	}
+
+	if err := writeOutput(outputFile, func(w io.Writer) error {
+		return writeTable(w, columns, cellRows)
+	}); err != nil {
+		return fmt.Errorf("error writing %v output: %w", outputFormat, err)
+	}
+
+	return nil
+}
+
+func outputLeaseReport(report *leaseReport, outputFormat string, outputFile string) error {
+	if report.formatTemplate != nil {
+		rows := make([]*leaseReportRow, 0, len(report.rows))
+		for i := range report.rows {
+			rows = append(rows, &report.rows[i])
+		}
+		return writeTemplateOutput(report.formatTemplate, rows, outputFile)
+	}
+
+	switch outputFormat {
+	case "table":
+		printLeaseReport(report)
+		return nil
+	case "influx":
+		if err := writeOutput(outputFile, func(w io.Writer) error {
+			return writeInfluxLines(report, time.Now(), w)
+		}); err != nil {
+			return fmt.Errorf("error writing influx output: %w", err)
+		}
+		return nil
+	case "prom-textfile":
+		if outputFile == "" {
+			return errors.New("-output prom-textfile requires -out, e.g. a .prom file in the node_exporter textfile directory")
+		}
+		metrics := newLeaseMetrics(&leaseSnapshot{
+			report:      report,
+			refreshTime: time.Now(),
+		})
+		if err := writeFileAtomically(outputFile, func(w io.Writer) error {
+			return writeLeaseMetrics(metrics, w)
+		}); err != nil {
+			return fmt.Errorf("error writing prom-textfile output: %w", err)
+		}
+		return nil
+	case "jsonl":
+		if err := writeOutput(outputFile, func(w io.Writer) error {
+			return writeJSONLines(report, w)
+		}); err != nil {
+			return fmt.Errorf("error writing jsonl output: %w", err)
+		}
+		return nil
+	case "xlsx":
+		if outputFile == "" {
+			return errors.New("-output xlsx requires -out, e.g. report.xlsx")
+		}
+		if err := writeFileAtomically(outputFile, func(w io.Writer) error {
+			return writeLeaseWorkbook(report, w)
+		}); err != nil {
+			return fmt.Errorf("error writing xlsx output: %w", err)
+		}
+		return nil
+	}
+
+	return writeTabularOutput(report.columns(), report.cellRows(), outputFormat, outputFile)
+}
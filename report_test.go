@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/dhcpdconf"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const multipleFixedAddressesConf = `
+host printer {
+  hardware ethernet 00:11:22:33:44:55;
+  fixed-address 10.0.0.5, 10.0.0.6;
+  fixed-address 10.0.0.7;
+}
+`
+
+func TestStaticLeasesMultipleFixedAddresses(t *testing.T) {
+	config, err := dhcpdconf.Parse(strings.NewReader(multipleFixedAddressesConf))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	leaseMap := make(leases.LeaseMap)
+	addStaticLeases(config, leaseMap)
+
+	var addresses []string
+	for address, lease := range leaseMap {
+		addresses = append(addresses, address)
+		if !lease.Static || lease.Hostname != "printer" || lease.MACAddress.String() != "00:11:22:33:44:55" {
+			t.Errorf("lease %v = %+v, want static lease of printer", address, lease)
+		}
+	}
+	slices.Sort(addresses)
+	if want := []string{"10.0.0.5", "10.0.0.6", "10.0.0.7"}; !slices.Equal(addresses, want) {
+		t.Errorf("got addresses %v, want %v", addresses, want)
+	}
+}
+
+func TestStaticLeaseColumnValues(t *testing.T) {
+	config, err := dhcpdconf.Parse(strings.NewReader(multipleFixedAddressesConf))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	for _, lease := range staticLeases(config) {
+		row := leaseReportRow{lease: lease, state: leases.Static}
+		values := row.columnValues()
+		if endTime, clttTime := values[5], values[6]; endTime != "" || clttTime != "" {
+			t.Errorf("static lease %v times = %q, %q, want blank", lease.IPAddress, endTime, clttTime)
+		}
+	}
+}
+
+func TestLeaseJSONOmitsZeroTimes(t *testing.T) {
+	startTime := time.Date(2020, 6, 26, 21, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name  string
+		lease *leases.Lease
+		state leases.LeaseState
+		want  string
+	}{
+		{"static", &leases.Lease{IPAddress: net.ParseIP("10.0.0.5"), Static: true}, leases.Static, ""},
+		{"never ends", &leases.Lease{IPAddress: net.ParseIP("10.0.0.6"), StartTime: startTime, EndsNever: true}, leases.Current, `"startTime":"2020-06-26T21:00:00Z","endsNever":true`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			row := leaseReportRow{lease: test.lease, state: test.state}
+			encoded, err := json.Marshal(row.toJSON())
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if strings.Contains(string(encoded), "0001-01-01") || !strings.Contains(string(encoded), test.want) {
+				t.Errorf("got %s, want no zero times and %s", encoded, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildLeaseReportProbesFilteredRows(t *testing.T) {
+	now := time.Now()
+	leaseList := []*leases.Lease{
+		{IPAddress: net.ParseIP("10.0.0.1"), StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour)},
+		{IPAddress: net.ParseIP("10.0.1.1"), StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour)},
+	}
+
+	for _, test := range []struct {
+		cidr      string
+		wantProbe bool
+	}{
+		{"10.0.0.0/24", true},
+		{"10.0.2.0/24", false},
+	} {
+		cidrFilter, err := parseCIDRFilter([]string{test.cidr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// An unknown probe method fails only if some lease is probed.
+		opts := &options{
+			ouiDBFile: filepath.Join(t.TempDir(), "oui.db"),
+			filters:   []leaseFilter{cidrFilter},
+			probe:     "bogus",
+		}
+
+		_, err = buildLeaseReportFromList(context.Background(), opts, leaseList)
+		if probed := err != nil; probed != test.wantProbe {
+			t.Errorf("-cidr %v: probed = %v (err %v), want %v", test.cidr, probed, err, test.wantProbe)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/ping"
+)
+
+// maxRogueScanAddresses limits the addresses scanned by rogue, a /16.
+const maxRogueScanAddresses = 65536
+
+// rogueDevice is an address that responded on the network without an active
+// lease or static reservation.
+type rogueDevice struct {
+	ipAddress    net.IP
+	macAddress   net.HardwareAddr
+	organization string
+	// seenBy lists how the address responded: ping, arp, or both.
+	seenBy string
+}
+
+var rogueColumns = []string{"IP", "MAC", "Organization", "Seen By"}
+
+func (device *rogueDevice) columnValues() []string {
+	return []string{
+		device.ipAddress.String(),
+		device.macAddress.String(),
+		device.organization,
+		device.seenBy,
+	}
+}
+
+func setupRogueCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	flagSet.StringVar(&opts.outputFormat, "output", defaultOutputFormat, "output format: "+strings.Join(outputFormats, ", "))
+	flagSet.StringVar(&opts.outputFile, "out", "", "write non-table output to this file instead of stdout")
+	flagSet.StringVar(&opts.neighborCommand, "neighbor-command", defaultNeighborCommand, "command printing the neighbor table, in Linux ip neigh, /proc/net/arp, or BSD arp -an format")
+	flagSet.IntVar(&opts.probeRate, "probe-rate", defaultProbeRate, "maximum ping requests sent per second")
+	flagSet.DurationVar(&opts.probeTimeout, "probe-timeout", defaultProbeTimeout, "how long to wait for replies after the last ping request")
+	var allowed stringListFlag
+	flagSet.Var(&allowed, "allow", "IP address or CIDR of devices with manually set addresses that are not rogue, e.g. a router (repeatable)")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		subnets, err := parseCIDRs(flagSet.Args())
+		if err != nil {
+			return err
+		}
+		allowedNets, err := parseCIDRs(allowed)
+		if err != nil {
+			return err
+		}
+
+		return runRogue(ctx, &opts, subnets, allowedNets)
+	}
+}
+
+// parseCIDRs parses CIDRs, treating bare IP addresses as single addresses.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	ipNets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if ipAddress := net.ParseIP(cidr); ipAddress != nil {
+			bits := 8 * len(ipAddress)
+			if ip4 := ipAddress.To4(); ip4 != nil {
+				ipAddress, bits = ip4, 32
+			}
+			ipNets = append(ipNets, &net.IPNet{IP: ipAddress, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR '%v': %w", cidr, err)
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets, nil
+}
+
+func containedIn(ipNets []*net.IPNet, ipAddress net.IP) bool {
+	for _, ipNet := range ipNets {
+		if ipNet.Contains(ipAddress) {
+			return true
+		}
+	}
+	return false
+}
+
+// subnetHosts returns the IPv4 host addresses of subnets, without network
+// and broadcast addresses for subnets larger than /31.
+func subnetHosts(subnets []*net.IPNet) ([]net.IP, error) {
+	var hosts []net.IP
+	for _, subnet := range subnets {
+		network := subnet.IP.To4()
+		ones, bits := subnet.Mask.Size()
+		if network == nil || bits != 32 {
+			return nil, fmt.Errorf("only IPv4 subnets can be scanned, not %v", subnet)
+		}
+
+		size := uint64(1) << (bits - ones)
+		if uint64(len(hosts))+size > maxRogueScanAddresses {
+			return nil, fmt.Errorf("subnets have more than %v addresses to scan", maxRogueScanAddresses)
+		}
+
+		first, last := uint64(0), size-1
+		if size > 2 {
+			first, last = 1, size-2
+		}
+		start := binary.BigEndian.Uint32(network)
+		for i := first; i <= last; i++ {
+			host := make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(host, start+uint32(i))
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
+
+// localAddresses returns the addresses of this host, which answer pings but
+// are never in its neighbor table.
+func localAddresses() ([]*net.IPNet, error) {
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("net.InterfaceAddrs error: %w", err)
+	}
+
+	var local []*net.IPNet
+	for _, address := range addresses {
+		if ipNet, ok := address.(*net.IPNet); ok {
+			bits := 8 * len(ipNet.IP)
+			local = append(local, &net.IPNet{IP: ipNet.IP, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+	return local, nil
+}
+
+// runRogue pings every address of subnets, or of the subnets in
+// opts.dhcpdConfFile if none are given, and reports addresses that replied
+// or are in the neighbor table afterwards but have neither a current lease
+// nor a fixed-address reservation. Pinging makes this host resolve each
+// address with ARP, so devices that drop pings are found in the neighbor
+// table. It returns an error if any rogue devices are found.
+func runRogue(ctx context.Context, opts *options, subnets []*net.IPNet, allowed []*net.IPNet) error {
+	leaseMap, dhcpdConf, err := readLeasesFile(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(subnets) == 0 {
+		if dhcpdConf == nil {
+			return errors.New("rogue requires subnets as arguments or -dhcpd-conf")
+		}
+		for _, subnet := range dhcpdConf.Subnets {
+			if subnet.Network.IP.To4() != nil {
+				subnets = append(subnets, subnet.Network)
+			}
+		}
+	}
+
+	authorized := make(map[string]bool)
+	now := time.Now()
+	for ipString, lease := range leaseMap {
+		if lease.Static || lease.GetState(now) == leases.Current {
+			authorized[ipString] = true
+		}
+	}
+	if dhcpdConf != nil {
+		for _, host := range dhcpdConf.Hosts {
+			for _, fixedAddress := range host.FixedAddresses {
+				authorized[fixedAddress.String()] = true
+			}
+		}
+	}
+
+	local, err := localAddresses()
+	if err != nil {
+		return err
+	}
+	allowed = append(allowed, local...)
+
+	hosts, err := subnetHosts(subnets)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("scanning", "addresses", len(hosts))
+	rtts, err := ping.Ping(ctx, hosts, ping.Options{
+		Rate:    opts.probeRate,
+		Timeout: opts.probeTimeout,
+	})
+	if err != nil {
+		return err
+	}
+
+	neighbors, err := readNeighbors(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	ouiDB, err := openOrganizationDB(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer ouiDB.Close()
+
+	var rogueDevices []*rogueDevice
+	for _, host := range hosts {
+		ipString := host.String()
+		if authorized[ipString] || containedIn(allowed, host) {
+			continue
+		}
+
+		_, pinged := rtts[ipString]
+		neighbor, inNeighbors := neighbors[ipString]
+		arp := inNeighbors && neighbor.presence != presenceOffline
+		if !pinged && !arp {
+			continue
+		}
+
+		device := &rogueDevice{
+			ipAddress:  host,
+			macAddress: neighbor.macAddress,
+		}
+		switch {
+		case pinged && arp:
+			device.seenBy = "ping, arp"
+		case pinged:
+			device.seenBy = "ping"
+		default:
+			device.seenBy = "arp"
+		}
+		if len(device.macAddress) > 0 {
+			if device.organization, err = lookupOrganization(ouiDB, device.macAddress); err != nil {
+				return err
+			}
+		}
+		rogueDevices = append(rogueDevices, device)
+	}
+
+	sort.Slice(rogueDevices, func(i int, j int) bool {
+		return bytes.Compare(rogueDevices[i].ipAddress, rogueDevices[j].ipAddress) < 0
+	})
+
+	if opts.outputFormat == defaultOutputFormat {
+		printRogueDevices(rogueDevices)
+	} else {
+		cellRows := make([][]string, 0, len(rogueDevices))
+		for _, device := range rogueDevices {
+			cellRows = append(cellRows, device.columnValues())
+		}
+		if err := writeTabularOutput(rogueColumns, cellRows, opts.outputFormat, opts.outputFile); err != nil {
+			return err
+		}
+	}
+
+	if len(rogueDevices) > 0 {
+		return fmt.Errorf("%v rogue devices found", len(rogueDevices))
+	}
+	return nil
+}
+
+func printRogueDevices(rogueDevices []*rogueDevice) {
+	cellRows := make([][]string, 0, len(rogueDevices))
+	for _, device := range rogueDevices {
+		cellRows = append(cellRows, device.columnValues())
+	}
+	printTable(rogueColumns, cellRows)
+
+	reportPrintf("")
+	reportPrintf("%v rogue devices without a current lease or reservation", len(rogueDevices))
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const defaultServerAddr = ":8080"
+
+type leaseJSON struct {
+	IP            string            `json:"ip"`
+	MAC           string            `json:"mac"`
+	Count         int               `json:"count"`
+	Hostname      string            `json:"hostname"`
+	DNSName       string            `json:"dnsName,omitempty"`
+	ClientID      string            `json:"clientId,omitempty"`
+	CircuitID     string            `json:"circuitId,omitempty"`
+	RemoteID      string            `json:"remoteId,omitempty"`
+	Variables     map[string]string `json:"variables,omitempty"`
+	State         string            `json:"state"`
+	BindingState  string            `json:"bindingState,omitempty"`
+	StartTime     *time.Time        `json:"startTime,omitempty"`
+	EndTime       *time.Time        `json:"endTime,omitempty"`
+	EndsNever     bool              `json:"endsNever,omitempty"`
+	ClttTime      *time.Time        `json:"clttTime,omitempty"`
+	TstpTime      *time.Time        `json:"tstpTime,omitempty"`
+	TsfpTime      *time.Time        `json:"tsfpTime,omitempty"`
+	AtsfpTime     *time.Time        `json:"atsfpTime,omitempty"`
+	Organization  string            `json:"organization"`
+	RandomizedMAC bool              `json:"randomizedMac,omitempty"`
+	DeviceName    string            `json:"deviceName,omitempty"`
+	Presence      string            `json:"presence,omitempty"`
+	Reachable     *bool             `json:"reachable,omitempty"`
+	RTTSeconds    float64           `json:"rttSeconds,omitempty"`
+}
+
+type poolJSON struct {
+	Subnet      string   `json:"subnet"`
+	Ranges      []string `json:"ranges"`
+	Size        uint64   `json:"size"`
+	Leased      uint64   `json:"leased"`
+	Free        uint64   `json:"free"`
+	PercentUsed float64  `json:"percentUsed"`
+}
+
+type summaryJSON struct {
+	UniqueIPs int            `json:"uniqueIPs"`
+	States    map[string]int `json:"states"`
+	Pools     []poolJSON     `json:"pools,omitempty"`
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// optionalTime returns nil for the zero time so it is omitted from JSON.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (row *leaseReportRow) toJSON() leaseJSON {
+	var reachable *bool
+	if row.probed {
+		reachable = &row.reachable
+	}
+
+	return leaseJSON{
+		IP:            row.lease.AddressString(),
+		MAC:           row.lease.MACAddress.String(),
+		Count:         row.lease.Count,
+		Hostname:      row.lease.Hostname,
+		DNSName:       row.lease.DDNSForwardName(),
+		ClientID:      leases.DescribeClientID(row.lease.UID),
+		CircuitID:     leases.DataString(row.lease.AgentCircuitID),
+		RemoteID:      leases.DataString(row.lease.AgentRemoteID),
+		Variables:     row.lease.Variables,
+		State:         row.state.String(),
+		BindingState:  row.lease.BindingState,
+		StartTime:     optionalTime(row.lease.StartTime),
+		EndTime:       optionalTime(row.lease.EndTime),
+		EndsNever:     row.lease.EndsNever,
+		ClttTime:      optionalTime(row.lease.ClttTime),
+		TstpTime:      optionalTime(row.lease.TstpTime),
+		TsfpTime:      optionalTime(row.lease.TsfpTime),
+		AtsfpTime:     optionalTime(row.lease.AtsfpTime),
+		Organization:  row.organization,
+		RandomizedMAC: row.randomizedMAC,
+		DeviceName:    row.deviceName,
+		Presence:      row.presence,
+		Reachable:     reachable,
+		RTTSeconds:    row.rtt.Seconds(),
+	}
+}
+
+func (report *leaseReport) summaryJSON() summaryJSON {
+	summary := summaryJSON{
+		UniqueIPs: len(report.rows),
+		States:    make(map[string]int),
+	}
+	for _, state := range leases.LeaseStates {
+		summary.States[state.String()] = report.leaseStateToCount[state]
+	}
+	for i := range report.pools {
+		usage := &report.pools[i]
+		pool := poolJSON{
+			Subnet:      usage.subnet.String(),
+			Size:        usage.size,
+			Leased:      usage.leased,
+			Free:        usage.free(),
+			PercentUsed: usage.percentUsed(),
+		}
+		for _, r := range usage.ranges {
+			pool.Ranges = append(pool.Ranges, r.String())
+		}
+		summary.Pools = append(summary.Pools, pool)
+	}
+	return summary
+}
+
+func writeJSONResponse(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Error("error encoding json response", "err", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSONResponse(w, statusCode, errorJSON{Error: message})
+}
+
+func registerAPIHandlers(serveMux *http.ServeMux, daemon *leaseDaemon) {
+	currentLeaseReport := func() *leaseReport {
+		return daemon.currentSnapshot().report
+	}
+
+	serveMux.HandleFunc("/leases", func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseLeaseQuery(r.URL.Query(), time.Now())
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		page := query.apply(currentLeaseReport())
+
+		leases := make([]leaseJSON, 0, len(page.rows))
+		for _, row := range page.rows {
+			leases = append(leases, row.toJSON())
+		}
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(page.total))
+		if nextURL := nextPageURL(r.URL, page); nextURL != "" {
+			w.Header().Set("Link", "<"+nextURL+">; rel=\"next\"")
+		}
+		writeJSONResponse(w, http.StatusOK, leases)
+	})
+
+	serveMux.HandleFunc("/leases/", func(w http.ResponseWriter, r *http.Request) {
+		ipAddress := net.ParseIP(strings.TrimPrefix(r.URL.Path, "/leases/"))
+		if ipAddress == nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid IP address")
+			return
+		}
+
+		report := currentLeaseReport()
+
+		for i := range report.rows {
+			if report.rows[i].lease.IPAddress.Equal(ipAddress) {
+				writeJSONResponse(w, http.StatusOK, report.rows[i].toJSON())
+				return
+			}
+		}
+
+		writeJSONError(w, http.StatusNotFound, "lease not found")
+	})
+
+	serveMux.HandleFunc("/macs/", func(w http.ResponseWriter, r *http.Request) {
+		macAddress, err := net.ParseMAC(strings.TrimPrefix(r.URL.Path, "/macs/"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid MAC address")
+			return
+		}
+
+		report := currentLeaseReport()
+
+		leases := make([]leaseJSON, 0)
+		for i := range report.rows {
+			if report.rows[i].lease.MACAddress.String() == macAddress.String() {
+				leases = append(leases, report.rows[i].toJSON())
+			}
+		}
+
+		if len(leases) == 0 {
+			writeJSONError(w, http.StatusNotFound, "no leases found for MAC address")
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, leases)
+	})
+
+	serveMux.HandleFunc("/summary", func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, http.StatusOK, currentLeaseReport().summaryJSON())
+	})
+
+	serveMux.Handle("/", webUIHandler())
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/snapshots"
+)
+
+const defaultSnapshotRetention = 30 * 24 * time.Hour
+
+// recordOptions holds the snapshot record flags.
+type recordOptions struct {
+	interval     time.Duration
+	retention    time.Duration
+	maxSnapshots int
+}
+
+func setupRecordCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	var recordOpts recordOptions
+	registerFileFlags(flagSet, &opts)
+	flagSet.DurationVar(&recordOpts.interval, "interval", 0, "record a snapshot at this interval until interrupted instead of once")
+	flagSet.DurationVar(&recordOpts.retention, "retention", defaultSnapshotRetention, "delete snapshots older than this, or 0 to keep them")
+	flagSet.IntVar(&recordOpts.maxSnapshots, "max-snapshots", 0, "keep at most this many snapshots, or 0 for no limit")
+	registerTimeFlags(flagSet)
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if recordOpts.interval <= 0 {
+			return recordSnapshot(ctx, &opts, recordOpts)
+		}
+
+		ticker := time.NewTicker(recordOpts.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := recordSnapshot(ctx, &opts, recordOpts); err != nil {
+				slog.Error("record error", "err", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// snapshotLeases converts the rows of report to snapshot leases.
+func snapshotLeases(report *leaseReport) []snapshots.Lease {
+	snapshotLeases := make([]snapshots.Lease, 0, len(report.rows))
+	for i := range report.rows {
+		row := &report.rows[i]
+		snapshotLeases = append(snapshotLeases, snapshots.Lease{
+			IPAddress:  row.lease.AddressString(),
+			MACAddress: row.lease.MACAddress.String(),
+			Hostname:   row.lease.Hostname,
+			State:      row.state.String(),
+			StartTime:  row.lease.StartTime,
+			EndTime:    row.lease.EndTime,
+			EndsNever:  row.lease.EndsNever,
+		})
+	}
+	return snapshotLeases
+}
+
+// recordSnapshot stores a snapshot of the current lease map in
+// opts.ouiDBFile and prunes snapshots beyond the retention limits.
+func recordSnapshot(ctx context.Context, opts *options, recordOpts recordOptions) error {
+	report, err := readLeaseReport(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	snapshot := &snapshots.Snapshot{
+		Time:   time.Now(),
+		Leases: snapshotLeases(report),
+	}
+
+	snapshotDB, err := snapshots.Open(opts.ouiDBFile, false)
+	if err != nil {
+		return err
+	}
+	defer snapshotDB.Close()
+
+	if err := snapshotDB.Record(snapshot); err != nil {
+		return err
+	}
+
+	var cutoff time.Time
+	if recordOpts.retention > 0 {
+		cutoff = snapshot.Time.Add(-recordOpts.retention)
+	}
+	pruned, err := snapshotDB.Prune(cutoff, recordOpts.maxSnapshots)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("recorded snapshot", "leases", len(snapshot.Leases), "pruned", pruned)
+
+	return nil
+}
+
+// queryTimeFormats are the layouts accepted by history query -at, in the
+// -tz time zone unless the layout includes one.
+var queryTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseQueryTime(s string) (time.Time, error) {
+	for _, layout := range queryTimeFormats {
+		if t, err := time.ParseInLocation(layout, s, displayLocation); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%v', expected one of: %v", s, strings.Join(queryTimeFormats, ", "))
+}
+
+var historyQueryCommand = command{
+	name:          "history query",
+	usage:         "history query [flags] <ip-or-mac>",
+	description:   "print the leases of an IP or MAC from recorded snapshots",
+	setup:         setupHistoryQueryCommand,
+	outputFormats: outputFormats,
+}
+
+func setupHistoryQueryCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	flagSet.StringVar(&opts.ouiDBFile, "oui-db", envOrDefault(flagEnvVars["oui-db"], defaultOuiDBFile), "OUI database file holding the snapshots (env OUI_DB_FILE)")
+	flagSet.StringVar(&opts.outputFormat, "output", defaultOutputFormat, "output format: "+strings.Join(outputFormats, ", "))
+	flagSet.StringVar(&opts.outputFile, "out", "", "write non-table output to this file instead of stdout")
+	registerTimeFlags(flagSet)
+	at := flagSet.String("at", "", "only the leases held at this time in the -tz zone, e.g. '2026-10-13 15:00', from the latest snapshot before it")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if flagSet.NArg() != 1 {
+			flagSet.Usage()
+			return errUsage
+		}
+
+		var atTime time.Time
+		if *at != "" {
+			var err error
+			if atTime, err = parseQueryTime(*at); err != nil {
+				return err
+			}
+		}
+
+		return runHistoryQuery(ctx, &opts, flagSet.Arg(0), atTime)
+	}
+}
+
+// snapshotLeaseMatcher returns a function reporting whether a snapshot
+// lease has the IP or MAC address in address.
+func snapshotLeaseMatcher(address string) (func(lease *snapshots.Lease) bool, error) {
+	if ipAddress := net.ParseIP(address); ipAddress != nil {
+		return func(lease *snapshots.Lease) bool {
+			return ipAddress.Equal(net.ParseIP(lease.IPAddress))
+		}, nil
+	}
+	if macAddress, err := net.ParseMAC(address); err == nil {
+		macString := macAddress.String()
+		return func(lease *snapshots.Lease) bool {
+			return lease.MACAddress == macString
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid IP or MAC address '%v'", address)
+}
+
+// runHistoryQuery prints the snapshot leases matching address. If atTime is
+// not zero only leases held at atTime in the latest snapshot before it are
+// printed; otherwise every distinct lease across all snapshots is printed
+// with its state in the latest snapshot containing it.
+func runHistoryQuery(ctx context.Context, opts *options, address string, atTime time.Time) error {
+	matches, err := snapshotLeaseMatcher(address)
+	if err != nil {
+		return err
+	}
+
+	snapshotDB, err := snapshots.Open(opts.ouiDBFile, true)
+	if err != nil {
+		return err
+	}
+	defer snapshotDB.Close()
+
+	var matchingLeases []snapshots.Lease
+
+	if !atTime.IsZero() {
+		snapshot, err := snapshotDB.At(atTime)
+		if err != nil {
+			return err
+		}
+		if snapshot == nil {
+			return fmt.Errorf("no snapshot recorded before %v", atTime.Format(ouputTimeFormatString))
+		}
+		slog.Info("using snapshot", "recordedAt", formatDisplayTime(snapshot.Time))
+
+		for i := range snapshot.Leases {
+			lease := &snapshot.Leases[i]
+			if matches(lease) && lease.ActiveAt(atTime) {
+				matchingLeases = append(matchingLeases, *lease)
+			}
+		}
+	} else {
+		type leaseKey struct {
+			ipAddress  string
+			macAddress string
+			startTime  time.Time
+		}
+		keyToIndex := make(map[leaseKey]int)
+
+		if err := snapshotDB.ForEach(func(snapshot *snapshots.Snapshot) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			for i := range snapshot.Leases {
+				lease := &snapshot.Leases[i]
+				if !matches(lease) {
+					continue
+				}
+				key := leaseKey{lease.IPAddress, lease.MACAddress, lease.StartTime}
+				if index, ok := keyToIndex[key]; ok {
+					matchingLeases[index] = *lease
+				} else {
+					keyToIndex[key] = len(matchingLeases)
+					matchingLeases = append(matchingLeases, *lease)
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if len(matchingLeases) == 0 {
+		return fmt.Errorf("%w for %v", errNotFound, address)
+	}
+
+	cellRows := make([][]string, 0, len(matchingLeases))
+	for i := range matchingLeases {
+		cellRows = append(cellRows, snapshotLeaseColumnValues(&matchingLeases[i]))
+	}
+
+	if opts.outputFormat == defaultOutputFormat {
+		printSnapshotLeases(cellRows)
+		return nil
+	}
+
+	return writeTabularOutput(snapshotLeaseColumns, cellRows, opts.outputFormat, opts.outputFile)
+}
+
+var snapshotLeaseColumns = []string{"IP", "MAC", "Hostname", "State", "Start Time", "End Time"}
+
+func snapshotLeaseColumnValues(lease *snapshots.Lease) []string {
+	endTime := formatDisplayTime(lease.EndTime)
+	if lease.EndsNever {
+		endTime = "never"
+	}
+
+	return []string{
+		lease.IPAddress,
+		lease.MACAddress,
+		lease.Hostname,
+		lease.State,
+		formatDisplayTime(lease.StartTime),
+		endTime,
+	}
+}
+
+func printSnapshotLeases(cellRows [][]string) {
+	printTable(snapshotLeaseColumns, cellRows)
+
+	reportPrintf("")
+	reportPrintf("%v lease records", len(cellRows))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// leaseSource produces lease records from a leases file or lease database.
+type leaseSource interface {
+	// ParseLeases calls fn for each lease record in the source.
+	ParseLeases(ctx context.Context, fn func(leases.Lease) error) error
+	String() string
+}
+
+func newLeaseSource(opts *options) (leaseSource, error) {
+	if opts.keaDSN != "" {
+		return newKeaSQLLeaseSource(opts.keaDSN, opts.strict)
+	}
+
+	paths, err := opts.leasesFilePaths()
+	if err != nil {
+		return nil, err
+	}
+	sources := make(multiLeaseSource, 0, len(paths))
+	for _, path := range paths {
+		source, err := newPathLeaseSource(opts, path)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	if len(sources) == 1 {
+		return sources[0], nil
+	}
+	return sources, nil
+}
+
+// newPathLeaseSource returns the lease source for one -leases-file value,
+// which may be a local path or an ssh://, http://, or https:// URL.
+func newPathLeaseSource(opts *options, path string) (leaseSource, error) {
+	switch {
+	case strings.HasPrefix(path, "ssh://"):
+		return newSSHLeaseSource(path, opts.strict)
+	case strings.HasPrefix(path, "http://"), strings.HasPrefix(path, "https://"):
+		return newHTTPLeaseSource(path, opts.leasesToken, opts.strict)
+	}
+	return &fileLeaseSource{path: path, strict: opts.strict}, nil
+}
+
+// multiLeaseSource reads each of its sources in turn, such as the leases
+// files of a failover pair. Callers merging records with leases.LeaseMap
+// keep the most recent lease per IP across all sources.
+type multiLeaseSource []leaseSource
+
+func (sources multiLeaseSource) String() string {
+	names := make([]string, 0, len(sources))
+	for _, source := range sources {
+		names = append(names, source.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+func (sources multiLeaseSource) ParseLeases(ctx context.Context, fn func(leases.Lease) error) error {
+	for _, source := range sources {
+		if err := source.ParseLeases(ctx, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLeases calls fn for each lease record in the lease source selected
+// by opts.
+func parseLeases(ctx context.Context, opts *options, fn func(leases.Lease) error) error {
+	source, err := newLeaseSource(opts)
+	if err != nil {
+		return err
+	}
+
+	return source.ParseLeases(ctx, fn)
+}
+
+// fileLeaseSource reads a dhcpd leases file, a Kea memfile lease database,
+// or a udhcpd binary leases file, detecting the format from its contents.
+type fileLeaseSource struct {
+	path   string
+	strict bool
+}
+
+func (source *fileLeaseSource) String() string {
+	return source.path
+}
+
+func (source *fileLeaseSource) ParseLeases(ctx context.Context, fn func(leases.Lease) error) error {
+	leasesFile := source.path
+
+	slog.Info("reading leases", "source", leasesFile)
+	file, err := os.OpenFile(leasesFile, os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to open file %v: %w", leasesFile, err)
+	}
+	defer file.Close()
+
+	return parseLeasesReader(ctx, leasesFile, file, source.strict, fn)
+}
+
+// newSourceParser returns a parser for the lease source name. Unless strict
+// is set, unparsable leases are skipped and collected in the returned
+// parseProblems instead of stopping parsing.
+func newSourceParser(name string, strict bool) (*leases.Parser, *parseProblems) {
+	parser := leases.NewParser()
+	problems := &parseProblems{source: name}
+	if !strict {
+		parser.InvalidLease = func(err *leases.ParseError) {
+			problems.errors = append(problems.errors, err)
+		}
+	}
+	return parser, problems
+}
+
+// parseProblems holds the unparsable leases skipped while reading a lease
+// source.
+type parseProblems struct {
+	source string
+	errors []*leases.ParseError
+}
+
+// log warns with a summary of the skipped leases, if any.
+func (problems *parseProblems) log() {
+	if len(problems.errors) == 0 {
+		return
+	}
+	for _, err := range problems.errors {
+		slog.Warn("skipped unparsable lease", "source", problems.source, "line", err.Line, "reason", err.Reason)
+	}
+	slog.Warn("skipped unparsable leases; use -strict to fail instead", "source", problems.source, "count", len(problems.errors))
+}
+
+// parseLeasesReader parses a dhcpd, Kea memfile, or udhcpd leases file read
+// from r, which may be gzip or xz compressed, detecting the format from its
+// contents. name is used in messages. Unless strict is set, unparsable leases
+// are skipped and summarized once the file is read.
+func parseLeasesReader(ctx context.Context, name string, r io.Reader, strict bool, fn func(leases.Lease) error) error {
+	parser, problems := newSourceParser(name, strict)
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		parser.SkippedLine = func(lineNumber int, line string) {
+			slog.Debug("skipped line", "source", name, "line", lineNumber, "text", line)
+		}
+		parseFn := fn
+		fn = func(lease leases.Lease) error {
+			slog.Debug("parsed lease", "source", name, "line", parser.LineNumber(),
+				"ip", lease.AddressString(), "mac", lease.MACAddress.String(), "hostname", lease.Hostname,
+				"bindingState", lease.BindingState, "ends", lease.EndTime)
+			return parseFn(lease)
+		}
+	}
+
+	if err := parseLeasesFormat(ctx, parser, r, fn); err != nil {
+		return fmt.Errorf("error parsing %v: %w", name, err)
+	}
+
+	slog.Info("read leases", "source", name, "lines", parser.LineNumber())
+	problems.log()
+
+	return nil
+}
+
+// parseLeasesFormat parses r with parser as a dhcpd, Kea memfile, or
+// udhcpd leases file, which may be gzip or xz compressed, detecting the
+// format from its contents.
+func parseLeasesFormat(ctx context.Context, parser *leases.Parser, r io.Reader, fn func(leases.Lease) error) error {
+	reader, format, err := detectLeasesFormat(r)
+	if err != nil {
+		return err
+	}
+
+	return parseLeasesAs(ctx, parser, reader, format, fn)
+}
+
+// detectLeasesFormat returns a reader of the leases file r, decompressed if
+// it is gzip or xz compressed, and its format detected from its contents.
+func detectLeasesFormat(r io.Reader) (io.Reader, leases.FileFormat, error) {
+	decompressed, err := decompressingReader(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reader := bufio.NewReader(decompressed)
+	header, _ := reader.Peek(leases.FileFormatHeaderLength)
+	return reader, leases.DetectFileFormat(header), nil
+}
+
+// parseLeasesAs parses r with parser as a leases file of format.
+func parseLeasesAs(ctx context.Context, parser *leases.Parser, r io.Reader, format leases.FileFormat, fn func(leases.Lease) error) error {
+	switch format {
+	case leases.KeaFormat:
+		return parser.ParseKeaLeasesContext(ctx, r, fn)
+	case leases.UdhcpdFormat:
+		return parser.ParseUdhcpdLeasesContext(ctx, r, fn)
+	}
+	return parser.ParseLeasesContext(ctx, r, fn)
+}
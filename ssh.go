@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	defaultSSHPort    = "22"
+	sshConnectTimeout = 10 * time.Second
+)
+
+// sshPrivateKeyFiles are tried in order, relative to ~/.ssh, when no
+// ssh-agent is available or it holds no usable key.
+var sshPrivateKeyFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sshLeaseSource reads a leases file from a remote host by running cat over
+// SSH, authenticating with ssh-agent or the user's private keys and checking
+// the host key against ~/.ssh/known_hosts.
+type sshLeaseSource struct {
+	rawURL string
+	user   string
+	addr   string
+	path   string
+	strict bool
+}
+
+// newSSHLeaseSource parses a URL of the form ssh://[user@]host[:port]/path.
+func newSSHLeaseSource(rawURL string, strict bool) (*sshLeaseSource, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh url %v: %w", rawURL, err)
+	}
+	if parsedURL.Hostname() == "" || parsedURL.Path == "" {
+		return nil, fmt.Errorf("invalid ssh url %v: expected ssh://user@host/path", rawURL)
+	}
+
+	source := &sshLeaseSource{
+		rawURL: rawURL,
+		user:   parsedURL.User.Username(),
+		addr:   parsedURL.Host,
+		path:   parsedURL.Path,
+		strict: strict,
+	}
+	if parsedURL.Port() == "" {
+		source.addr = net.JoinHostPort(parsedURL.Hostname(), defaultSSHPort)
+	}
+	if source.user == "" {
+		currentUser, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("user.Current error: %w", err)
+		}
+		source.user = currentUser.Username
+	}
+	return source, nil
+}
+
+func (source *sshLeaseSource) String() string {
+	return source.rawURL
+}
+
+// sshAuthMethods returns the public key authentication methods of the keys
+// in ssh-agent and ~/.ssh. ssh-agent keys sign through the agent connection,
+// which is also returned, or nil if none, and must be closed by the caller
+// once the connection is no longer needed.
+func sshAuthMethods() ([]ssh.AuthMethod, io.Closer, error) {
+	var signers []ssh.Signer
+	var agentConn net.Conn
+
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err != nil {
+			slog.Warn("ssh-agent dial error", "err", err)
+		} else if agentSigners, err := agent.NewClient(conn).Signers(); err != nil {
+			slog.Warn("ssh-agent signers error", "err", err)
+			conn.Close()
+		} else {
+			signers = append(signers, agentSigners...)
+			agentConn = conn
+		}
+	}
+
+	// The agent connection is closed on every error return, and handed to
+	// the caller only on success.
+	defer func() {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+	}()
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil, fmt.Errorf("os.UserHomeDir error: %w", err)
+	}
+	for _, keyFile := range sshPrivateKeyFiles {
+		keyBytes, err := os.ReadFile(filepath.Join(homeDir, ".ssh", keyFile))
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(keyBytes)
+		if err != nil {
+			slog.Debug("skipping ssh key file", "path", keyFile, "err", err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+
+	if len(signers) == 0 {
+		return nil, nil, fmt.Errorf("no ssh keys found in ssh-agent or ~/.ssh")
+	}
+	if agentConn == nil {
+		return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, nil, nil
+	}
+	conn := agentConn
+	agentConn = nil
+	return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, conn, nil
+}
+
+func sshHostKeyCallback() (ssh.HostKeyCallback, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("os.UserHomeDir error: %w", err)
+	}
+	callback, err := knownhosts.New(filepath.Join(homeDir, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading known_hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (source *sshLeaseSource) ParseLeases(ctx context.Context, fn func(leases.Lease) error) error {
+	authMethods, agentConn, err := sshAuthMethods()
+	if err != nil {
+		return err
+	}
+	if agentConn != nil {
+		defer agentConn.Close()
+	}
+	hostKeyCallback, err := sshHostKeyCallback()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("reading leases", "source", source)
+
+	dialer := net.Dialer{Timeout: sshConnectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", source.addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to %v: %w", source.addr, err)
+	}
+
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, source.addr, &ssh.ClientConfig{
+		User:            source.user,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshConnectTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("ssh error for %v: %w", source.addr, err)
+	}
+	client := ssh.NewClient(sshConn, channels, requests)
+	defer client.Close()
+
+	// Closing the client unblocks the session if ctx is cancelled mid-read.
+	stop := context.AfterFunc(ctx, func() {
+		client.Close()
+	})
+	defer stop()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("ssh session error for %v: %w", source.addr, err)
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("ssh stdout error: %w", err)
+	}
+	var stderr strings.Builder
+	session.Stderr = &stderr
+
+	if err := session.Start("cat " + shellQuote(source.path)); err != nil {
+		return fmt.Errorf("ssh start error: %w", err)
+	}
+
+	if err := parseLeasesReader(ctx, source.String(), stdout, source.strict, fn); err != nil {
+		return err
+	}
+
+	if err := session.Wait(); err != nil {
+		return fmt.Errorf("error reading %v: %w %v", source, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
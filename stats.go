@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const defaultRenewalHours = 24
+
+var statsOutputFormats = []string{"table", "json"}
+
+// leaseStats holds the aggregate numbers printed by stats, in the form
+// written by stats -output json.
+type leaseStats struct {
+	Leases              int            `json:"leases"`
+	States              map[string]int `json:"states"`
+	UniqueMACs          int            `json:"uniqueMacs"`
+	RandomizedMACs      int            `json:"randomizedMacs"`
+	AverageLeaseSeconds float64        `json:"averageLeaseSeconds"`
+	MaxLeaseSeconds     float64        `json:"maxLeaseSeconds"`
+	Subnets             []subnetStats  `json:"subnets"`
+	Vendors             []vendorStats  `json:"vendors"`
+	Renewals            []renewalStats `json:"renewals"`
+}
+
+// subnetStats counts the leases in a dhcpd.conf subnet, or in a /24 or /64
+// network for leases outside the configured subnets.
+type subnetStats struct {
+	Subnet  string `json:"subnet"`
+	Leases  int    `json:"leases"`
+	Current int    `json:"current"`
+
+	network *net.IPNet
+}
+
+// vendorStats counts the leases of MACs from one organization.
+type vendorStats struct {
+	Vendor string `json:"vendor"`
+	Leases int    `json:"leases"`
+}
+
+// renewalStats counts the leases whose last transaction time is within the
+// hour starting at Hour.
+type renewalStats struct {
+	Hour     time.Time `json:"hour"`
+	Renewals int       `json:"renewals"`
+}
+
+// statsNetwork returns the pool subnet containing ipAddress, or its /24 or
+// /64 network if no pool subnet does.
+func statsNetwork(ipAddress net.IP, pools []poolUsage) *net.IPNet {
+	for i := range pools {
+		if pools[i].subnet.Contains(ipAddress) {
+			return pools[i].subnet
+		}
+	}
+	if ipv4 := ipAddress.To4(); ipv4 != nil {
+		mask := net.CIDRMask(24, 8*net.IPv4len)
+		return &net.IPNet{IP: ipv4.Mask(mask), Mask: mask}
+	}
+	mask := net.CIDRMask(64, 8*net.IPv6len)
+	return &net.IPNet{IP: ipAddress.Mask(mask), Mask: mask}
+}
+
+// computeLeaseStats aggregates the rows of report, counting renewals in
+// each of the renewalHours hours before now.
+func computeLeaseStats(report *leaseReport, renewalHours int, now time.Time) *leaseStats {
+	stats := &leaseStats{
+		Leases:         len(report.rows),
+		States:         make(map[string]int, len(leases.LeaseStates)),
+		RandomizedMACs: report.randomizedMACs,
+	}
+	for _, state := range leases.LeaseStates {
+		stats.States[state.String()] = report.leaseStateToCount[state]
+	}
+
+	firstHour := now.Truncate(time.Hour).Add(-time.Duration(renewalHours-1) * time.Hour)
+	for i := 0; i < renewalHours; i++ {
+		stats.Renewals = append(stats.Renewals, renewalStats{Hour: firstHour.Add(time.Duration(i) * time.Hour)})
+	}
+
+	macs := make(map[string]bool)
+	subnetToStats := make(map[string]*subnetStats)
+	vendorToLeases := make(map[string]int)
+	var totalDuration, maxDuration time.Duration
+	durations := 0
+
+	for i := range report.rows {
+		row := &report.rows[i]
+		lease := row.lease
+
+		if len(lease.MACAddress) > 0 {
+			macs[lease.MACAddress.String()] = true
+		}
+		vendorToLeases[row.organization]++
+
+		network := statsNetwork(lease.IPAddress, report.pools)
+		subnet := subnetToStats[network.String()]
+		if subnet == nil {
+			subnet = &subnetStats{Subnet: network.String(), network: network}
+			subnetToStats[subnet.Subnet] = subnet
+		}
+		subnet.Leases++
+		if row.state == leases.Current {
+			subnet.Current++
+		}
+
+		if !lease.Static && !lease.StartTime.IsZero() && !lease.EndsNever && lease.EndTime.After(lease.StartTime) {
+			duration := lease.EndTime.Sub(lease.StartTime)
+			totalDuration += duration
+			maxDuration = max(maxDuration, duration)
+			durations++
+		}
+
+		if hours := int(lease.ClttTime.Sub(firstHour) / time.Hour); !lease.ClttTime.Before(firstHour) && hours < renewalHours {
+			stats.Renewals[hours].Renewals++
+		}
+	}
+
+	stats.UniqueMACs = len(macs)
+	if durations > 0 {
+		stats.AverageLeaseSeconds = (totalDuration / time.Duration(durations)).Seconds()
+	}
+	stats.MaxLeaseSeconds = maxDuration.Seconds()
+
+	for _, subnet := range subnetToStats {
+		stats.Subnets = append(stats.Subnets, *subnet)
+	}
+	sort.Slice(stats.Subnets, func(i int, j int) bool {
+		return bytes.Compare(stats.Subnets[i].network.IP.To16(), stats.Subnets[j].network.IP.To16()) < 0
+	})
+
+	for vendor, count := range vendorToLeases {
+		stats.Vendors = append(stats.Vendors, vendorStats{Vendor: vendor, Leases: count})
+	}
+	sort.Slice(stats.Vendors, func(i int, j int) bool {
+		if stats.Vendors[i].Leases != stats.Vendors[j].Leases {
+			return stats.Vendors[i].Leases > stats.Vendors[j].Leases
+		}
+		return stats.Vendors[i].Vendor < stats.Vendors[j].Vendor
+	})
+
+	return stats
+}
+
+func printLeaseStats(report *leaseReport, stats *leaseStats) {
+	printLeaseSummary(report)
+
+	reportPrintf("")
+	reportPrintf("%v unique MACs", stats.UniqueMACs)
+	reportPrintf("lease duration: average %v, max %v",
+		formatShortDuration(time.Duration(stats.AverageLeaseSeconds*float64(time.Second))),
+		formatShortDuration(time.Duration(stats.MaxLeaseSeconds*float64(time.Second))))
+
+	subnetRows := make([][]string, 0, len(stats.Subnets))
+	for _, subnet := range stats.Subnets {
+		subnetRows = append(subnetRows, []string{subnet.Subnet, strconv.Itoa(subnet.Leases), strconv.Itoa(subnet.Current)})
+	}
+	printTable([]string{"Subnet", "Leases", "Current"}, subnetRows)
+
+	vendorRows := make([][]string, 0, len(stats.Vendors))
+	for _, vendor := range stats.Vendors {
+		vendorRows = append(vendorRows, []string{vendor.Vendor, strconv.Itoa(vendor.Leases)})
+	}
+	printTable([]string{"Vendor", "Leases"}, vendorRows)
+
+	renewalRows := make([][]string, 0, len(stats.Renewals))
+	for _, renewal := range stats.Renewals {
+		renewalRows = append(renewalRows, []string{formatDisplayTime(renewal.Hour), strconv.Itoa(renewal.Renewals)})
+	}
+	printTable([]string{"Hour", "Renewals"}, renewalRows)
+}
+
+func outputLeaseStats(report *leaseReport, stats *leaseStats, outputFormat string, outputFile string) error {
+	switch outputFormat {
+	case "table":
+		printLeaseStats(report, stats)
+		return nil
+	case "json":
+		if err := writeOutput(outputFile, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(stats)
+		}); err != nil {
+			return fmt.Errorf("error writing json output: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format '%v'", outputFormat)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const (
+	defaultSyslogFacility = "daemon"
+	syslogAppName         = "go-dhcp-leases"
+	syslogTimeout         = 10 * time.Second
+	// syslogSDID is the structured data ID of event and summary fields,
+	// using the enterprise number reserved for documentation.
+	syslogSDID = "lease@32473"
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+const (
+	syslogWarning = 4
+	syslogNotice  = 5
+	syslogInfo    = 6
+)
+
+// syslogLocalPaths are the local syslog sockets tried for syslog: sinks.
+var syslogLocalPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogEventSink sends events, and a summary of each report whose state
+// counts changed, as RFC 5424 messages with structured data.
+type syslogEventSink struct {
+	spec     string
+	network  string
+	address  string
+	facility int
+	hostname string
+
+	mutex       sync.Mutex
+	conn        net.Conn
+	lastSummary string
+}
+
+// newSyslogEventSink returns a sink for spec, which is syslog: for the local
+// syslog socket, syslog://host[:port] for UDP, or syslog+tcp://host[:port]
+// for TCP with octet-counting framing.
+func newSyslogEventSink(opts *options, spec string) (*syslogEventSink, error) {
+	facility, ok := syslogFacilities[opts.syslogFacility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility '%v'", opts.syslogFacility)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+
+	sink := &syslogEventSink{
+		spec:     spec,
+		facility: facility,
+		hostname: hostname,
+	}
+
+	if spec == "syslog:" {
+		sink.network = "unixgram"
+		return sink, nil
+	}
+
+	parsedURL, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog url %v: %w", spec, err)
+	}
+	if parsedURL.Hostname() == "" {
+		return nil, fmt.Errorf("invalid syslog url %v: missing host", spec)
+	}
+
+	port := parsedURL.Port()
+	switch parsedURL.Scheme {
+	case "syslog":
+		sink.network = "udp"
+		if port == "" {
+			port = "514"
+		}
+	case "syslog+tcp":
+		sink.network = "tcp"
+		if port == "" {
+			port = "601"
+		}
+	default:
+		return nil, fmt.Errorf("invalid syslog url %v: unknown scheme", spec)
+	}
+	sink.address = net.JoinHostPort(parsedURL.Hostname(), port)
+
+	return sink, nil
+}
+
+func (sink *syslogEventSink) String() string {
+	return sink.spec
+}
+
+func (sink *syslogEventSink) dial() (net.Conn, error) {
+	if sink.network != "unixgram" {
+		return net.DialTimeout(sink.network, sink.address, syslogTimeout)
+	}
+
+	var err error
+	for _, path := range syslogLocalPaths {
+		var conn net.Conn
+		if conn, err = net.Dial("unixgram", path); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, fmt.Errorf("no local syslog socket: %w", err)
+}
+
+// write sends one message, reconnecting once if the connection failed.
+func (sink *syslogEventSink) write(message string) error {
+	if sink.network == "tcp" {
+		message = fmt.Sprintf("%v %v", len(message), message)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if sink.conn == nil {
+			conn, err := sink.dial()
+			if err != nil {
+				return err
+			}
+			sink.conn = conn
+		}
+
+		sink.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		_, err := sink.conn.Write([]byte(message))
+		if err == nil {
+			return nil
+		}
+
+		sink.conn.Close()
+		sink.conn = nil
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+// Close closes the connection to the syslog server.
+func (sink *syslogEventSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
+
+// syslogParam escapes value for an RFC 5424 structured data parameter.
+func syslogParam(name string, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+	return fmt.Sprintf(` %v="%v"`, name, value)
+}
+
+// formatSyslogMessage returns an RFC 5424 message. params are name, value
+// pairs; empty values are omitted.
+func (sink *syslogEventSink) formatSyslogMessage(now time.Time, severity int, msgID string, params []string, msg string) string {
+	var structuredData strings.Builder
+	structuredData.WriteString("[" + syslogSDID)
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] != "" {
+			structuredData.WriteString(syslogParam(params[i], params[i+1]))
+		}
+	}
+	structuredData.WriteString("]")
+
+	return fmt.Sprintf("<%v>1 %v %v %v %v %v %v %v",
+		sink.facility*8+severity,
+		now.Format(time.RFC3339Nano),
+		sink.hostname,
+		syslogAppName,
+		os.Getpid(),
+		msgID,
+		structuredData.String(),
+		msg)
+}
+
+func syslogEventSeverity(eventType leaseEventType) int {
+	switch eventType {
+	case poolNearlyFull, abandonedAboveThreshold:
+		return syslogWarning
+	case newDevice, leaseAbandoned:
+		return syslogNotice
+	}
+	return syslogInfo
+}
+
+func (sink *syslogEventSink) Send(ctx context.Context, events []leaseEvent) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	for i := range events {
+		event := &events[i]
+
+		var msg string
+		switch {
+		case event.Pool != "":
+			msg = fmt.Sprintf("%v %v %.1f%% used", event.Type, event.Pool, event.PercentUsed)
+		case event.Count > 0:
+			msg = fmt.Sprintf("%v %v abandoned leases", event.Type, event.Count)
+		default:
+			msg = fmt.Sprintf("%v %v %v", event.Type, event.IP, event.MAC)
+		}
+
+		message := sink.formatSyslogMessage(event.Time, syslogEventSeverity(event.Type), string(event.Type), []string{
+			"ip", event.IP,
+			"mac", event.MAC,
+			"hostname", event.Hostname,
+			"vendor", event.Organization,
+			"state", event.State,
+			"device", event.DeviceName,
+			"pool", event.Pool,
+			"percentUsed", formatOptionalFloat(event.PercentUsed),
+			"count", formatOptionalInt(event.Count),
+		}, msg)
+
+		if err := sink.write(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PublishReport sends a summary of the lease counts by state of report if
+// they changed since the previous report.
+func (sink *syslogEventSink) PublishReport(ctx context.Context, report *leaseReport) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	params := []string{"leases", fmt.Sprint(len(report.rows))}
+	stateCounts := make([]string, 0, len(leases.LeaseStates))
+	for _, state := range leases.LeaseStates {
+		count := report.leaseStateToCount[state]
+		params = append(params, strings.ToLower(state.String()), fmt.Sprint(count))
+		stateCounts = append(stateCounts, fmt.Sprintf("%v %v", count, state))
+	}
+
+	summary := strings.Join(params, " ")
+	if summary == sink.lastSummary {
+		return nil
+	}
+
+	message := sink.formatSyslogMessage(time.Now(), syslogInfo, "summary", params,
+		fmt.Sprintf("%v leases: %v", len(report.rows), strings.Join(stateCounts, ", ")))
+	if err := sink.write(message); err != nil {
+		return err
+	}
+
+	sink.lastSummary = summary
+	return nil
+}
+
+func formatOptionalFloat(value float64) string {
+	if value == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", value)
+}
+
+func formatOptionalInt(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
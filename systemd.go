@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// sdNotify sends state, such as READY=1, to the systemd service manager of
+// a Type=notify service. It does nothing if the process was not started by
+// systemd with a notification socket.
+func sdNotify(state string) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return
+	}
+	// Names starting with @ are in the abstract namespace.
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		slog.Warn("sd_notify error", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Warn("sd_notify error", "err", err)
+	}
+}
+
+// sdWatchdogTimeout returns the WatchdogSec= of the systemd service, or 0 if
+// the watchdog is not enabled for this process.
+func sdWatchdogTimeout() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// checkWatchdogInterval warns if refreshInterval is too long for the systemd
+// watchdog, which is pinged after each successful refresh.
+func checkWatchdogInterval(refreshInterval time.Duration) {
+	timeout := sdWatchdogTimeout()
+	if timeout == 0 {
+		return
+	}
+	slog.Info("systemd watchdog enabled", "timeout", timeout)
+	if refreshInterval >= timeout {
+		slog.Warn("refresh interval is not shorter than the systemd watchdog timeout; systemd will restart the service between refreshes",
+			"refreshInterval", refreshInterval, "watchdogTimeout", timeout)
+	}
+}
+
+// sdStatus returns the systemd STATUS= line describing report.
+func sdStatus(report *leaseReport) string {
+	return fmt.Sprintf("STATUS=%v leases, %v current", len(report.rows), report.leaseStateToCount[leases.Current])
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	// tableColumnGap is the number of spaces between table columns.
+	tableColumnGap = 2
+	// minTruncatedColumnWidth is the narrowest a column is truncated to when
+	// fitting a table to the terminal.
+	minTruncatedColumnWidth = 8
+)
+
+// tableLayout holds the widths of the columns of a table.
+type tableLayout struct {
+	widths []int
+}
+
+// terminalWidth returns the width tables are fitted to: $COLUMNS if set, the
+// width of stdout if it is a terminal, or 0 for no limit.
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	return 0
+}
+
+// newTableLayout sizes each column to its widest header or cell. If the
+// table is wider than maxWidth and maxWidth is positive, the widest columns
+// are narrowed until it fits, down to minTruncatedColumnWidth.
+func newTableLayout(columns []string, cellRows [][]string, maxWidth int) *tableLayout {
+	widths := make([]int, len(columns))
+	for _, cells := range append([][]string{columns}, cellRows...) {
+		for i, cell := range cells {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	layout := &tableLayout{widths: widths}
+	if maxWidth <= 0 {
+		return layout
+	}
+
+	for excess := layout.width() - maxWidth; excess > 0; excess-- {
+		widest := 0
+		for i, width := range widths {
+			if width > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minTruncatedColumnWidth {
+			break
+		}
+		widths[widest]--
+	}
+	return layout
+}
+
+// width returns the total width of the table.
+func (layout *tableLayout) width() int {
+	width := tableColumnGap * max(len(layout.widths)-1, 0)
+	for _, columnWidth := range layout.widths {
+		width += columnWidth
+	}
+	return width
+}
+
+// truncateCell shortens cell to width runes, ending it with an ellipsis if
+// anything was removed.
+func truncateCell(cell string, width int) string {
+	if utf8.RuneCountInString(cell) <= width {
+		return cell
+	}
+	runes := []rune(cell)
+	return string(runes[:width-1]) + "…"
+}
+
+// formatRow pads and truncates cells to the column widths. The last column
+// is not padded.
+func (layout *tableLayout) formatRow(cells []string) string {
+	var builder strings.Builder
+	for i, cell := range cells {
+		cell = truncateCell(cell, layout.widths[i])
+		builder.WriteString(cell)
+		if i < len(cells)-1 {
+			builder.WriteString(strings.Repeat(" ", layout.widths[i]-utf8.RuneCountInString(cell)+tableColumnGap))
+		}
+	}
+	return builder.String()
+}
+
+// printHeader prints the column headers and a separator line.
+func (layout *tableLayout) printHeader(columns []string) {
+	reportPrintf("%v", layout.formatRow(columns))
+	reportPrintf("%v", strings.Repeat("=", layout.width()))
+}
+
+// printTable prints columns and cellRows as a table fitted to the terminal.
+func printTable(columns []string, cellRows [][]string) {
+	layout := newTableLayout(columns, cellRows, terminalWidth())
+
+	reportPrintf("")
+	layout.printHeader(columns)
+	for _, cells := range cellRows {
+		reportPrintf("%v", layout.formatRow(cells))
+	}
+}
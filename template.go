@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// leaseTemplateData is the data given to -format-template for each row: the
+// fields of the JSON API, with Vendor as another name for Organization.
+type leaseTemplateData struct {
+	leaseJSON
+	Vendor string
+}
+
+func (row *leaseReportRow) templateData() leaseTemplateData {
+	return leaseTemplateData{
+		leaseJSON: row.toJSON(),
+		Vendor:    row.organization,
+	}
+}
+
+// parseFormatTemplate parses the -format-template text, or returns nil if it
+// is empty.
+func parseFormatTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	formatTemplate, err := template.New("format").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -format-template: %w", err)
+	}
+	return formatTemplate, nil
+}
+
+// writeTemplateOutput executes formatTemplate for each row, writing one line
+// per row to stdout or outputFile. A newline is added after each row unless
+// the template ends with one.
+func writeTemplateOutput(formatTemplate *template.Template, rows []*leaseReportRow, outputFile string) error {
+	addNewline := !strings.HasSuffix(formatTemplate.Root.String(), "\n")
+
+	if err := writeOutput(outputFile, func(w io.Writer) error {
+		bufferedWriter := bufio.NewWriter(w)
+		for _, row := range rows {
+			if err := formatTemplate.Execute(bufferedWriter, row.templateData()); err != nil {
+				return err
+			}
+			if addNewline {
+				bufferedWriter.WriteString("\n")
+			}
+		}
+		return bufferedWriter.Flush()
+	}); err != nil {
+		return fmt.Errorf("error writing -format-template output: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// defaultACMECacheDir keeps ACME account keys and certificates next to the
+// default OUI database.
+var defaultACMECacheDir = filepath.Join(filepath.Dir(defaultOuiDBFile), "acme")
+
+// tlsOptions configures TLS for the HTTP server, from certificate files or
+// from an ACME certificate authority.
+type tlsOptions struct {
+	certFile      string
+	keyFile       string
+	acmeHosts     stringListFlag
+	acmeDirectory string
+	acmeEmail     string
+	acmeCacheDir  string
+}
+
+func registerTLSFlags(flagSet *flag.FlagSet, tlsOpts *tlsOptions) {
+	flagSet.StringVar(&tlsOpts.certFile, "tls-cert", "", "serve HTTPS with this PEM certificate file, followed by any intermediate certificates; requires -tls-key")
+	flagSet.StringVar(&tlsOpts.keyFile, "tls-key", "", "PEM private key file of -tls-cert")
+	flagSet.Var(&tlsOpts.acmeHosts, "acme-host", "serve HTTPS with certificates for this host name obtained with ACME TLS-ALPN-01 challenges, which the CA must be able to send to -addr on port 443 (repeatable)")
+	flagSet.StringVar(&tlsOpts.acmeDirectory, "acme-directory", autocert.DefaultACMEDirectory, "ACME directory URL, e.g. that of an internal step-ca or other ACME CA for internal host names")
+	flagSet.StringVar(&tlsOpts.acmeEmail, "acme-email", "", "contact email address registered with the ACME CA")
+	flagSet.StringVar(&tlsOpts.acmeCacheDir, "acme-cache", defaultACMECacheDir, "directory caching the ACME account key and certificates")
+}
+
+func (tlsOpts *tlsOptions) validate() error {
+	if (tlsOpts.certFile == "") != (tlsOpts.keyFile == "") {
+		return errors.New("-tls-cert and -tls-key must be set together")
+	}
+	if tlsOpts.certFile != "" && len(tlsOpts.acmeHosts) > 0 {
+		return errors.New("-tls-cert and -acme-host cannot be used together")
+	}
+	return nil
+}
+
+// listenAndServe serves httpServer with TLS if configured by tlsOpts, or
+// plain HTTP otherwise.
+func (tlsOpts *tlsOptions) listenAndServe(httpServer *http.Server) error {
+	switch {
+	case tlsOpts.certFile != "":
+		slog.Info("serving HTTPS", "cert", tlsOpts.certFile)
+		return httpServer.ListenAndServeTLS(tlsOpts.certFile, tlsOpts.keyFile)
+
+	case len(tlsOpts.acmeHosts) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tlsOpts.acmeHosts...),
+			Cache:      autocert.DirCache(tlsOpts.acmeCacheDir),
+			Email:      tlsOpts.acmeEmail,
+			Client:     &acme.Client{DirectoryURL: tlsOpts.acmeDirectory},
+		}
+		httpServer.TLSConfig = manager.TLSConfig()
+		httpServer.TLSConfig.MinVersion = tls.VersionTLS12
+		slog.Info("serving HTTPS with ACME certificates", "hosts", tlsOpts.acmeHosts.String(), "directory", tlsOpts.acmeDirectory)
+		return httpServer.ListenAndServeTLS("", "")
+	}
+
+	return httpServer.ListenAndServe()
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const defaultTopN = 10
+
+var topOutputFormats = []string{"table", "json"}
+
+// topIP is an address ranked by the number of lease records for it.
+type topIP struct {
+	IP           string `json:"ip"`
+	Records      int    `json:"records"`
+	MAC          string `json:"mac"`
+	Hostname     string `json:"hostname"`
+	Organization string `json:"organization"`
+}
+
+// topDevice is a MAC address ranked by the number of IPs it has leased or
+// by its renewal churn, the lease records written for it per day.
+type topDevice struct {
+	MAC           string    `json:"mac"`
+	CurrentIP     string    `json:"currentIp"`
+	IPs           int       `json:"ips"`
+	Records       int       `json:"records"`
+	FirstStart    time.Time `json:"firstStart"`
+	RecordsPerDay float64   `json:"recordsPerDay"`
+	Hostname      string    `json:"hostname"`
+	Organization  string    `json:"organization"`
+}
+
+// topReport holds the rankings printed by top, in the form written by top
+// -output json. Flapping clients show up with high churn, and clients
+// moving between addresses or a thrashing pool with many IPs per MAC and
+// records per IP.
+type topReport struct {
+	IPs   []topIP     `json:"ips"`
+	MACs  []topDevice `json:"macs"`
+	Churn []topDevice `json:"churn"`
+}
+
+// recordsPerDay returns the lease records of row per day from its first
+// lease start to its latest, counting spans under a day as one day.
+func recordsPerDay(row *deviceReportRow) float64 {
+	days := row.lease.StartTime.Sub(row.firstStart).Hours() / 24
+	return float64(row.leaseCount) / max(days, 1)
+}
+
+func newTopDevice(row *deviceReportRow) topDevice {
+	return topDevice{
+		MAC:           row.lease.MACAddress.String(),
+		CurrentIP:     row.lease.AddressString(),
+		IPs:           1 + len(row.previousIPs),
+		Records:       row.leaseCount,
+		FirstStart:    row.firstStart,
+		RecordsPerDay: recordsPerDay(row),
+		Hostname:      row.lease.Hostname,
+		Organization:  row.organization,
+	}
+}
+
+// buildTopReport ranks the addresses of leaseReport and the MACs of
+// deviceReport, keeping the n highest of each ranking. Addresses and MACs
+// with a single lease record or IP are not ranked.
+func buildTopReport(leaseReport *leaseReport, deviceReport *deviceReport, n int) *topReport {
+	report := &topReport{
+		IPs:   []topIP{},
+		MACs:  []topDevice{},
+		Churn: []topDevice{},
+	}
+
+	for i := range leaseReport.rows {
+		row := &leaseReport.rows[i]
+		if row.lease.Count > 1 {
+			report.IPs = append(report.IPs, topIP{
+				IP:           row.lease.AddressString(),
+				Records:      row.lease.Count,
+				MAC:          row.lease.MACAddress.String(),
+				Hostname:     row.lease.Hostname,
+				Organization: row.organization,
+			})
+		}
+	}
+	sort.SliceStable(report.IPs, func(i int, j int) bool {
+		return report.IPs[i].Records > report.IPs[j].Records
+	})
+
+	for i := range deviceReport.rows {
+		device := newTopDevice(&deviceReport.rows[i])
+		if device.IPs > 1 {
+			report.MACs = append(report.MACs, device)
+		}
+		if device.Records > 1 {
+			report.Churn = append(report.Churn, device)
+		}
+	}
+	sort.SliceStable(report.MACs, func(i int, j int) bool {
+		return report.MACs[i].IPs > report.MACs[j].IPs
+	})
+	sort.SliceStable(report.Churn, func(i int, j int) bool {
+		return report.Churn[i].RecordsPerDay > report.Churn[j].RecordsPerDay
+	})
+
+	report.IPs = report.IPs[:min(n, len(report.IPs))]
+	report.MACs = report.MACs[:min(n, len(report.MACs))]
+	report.Churn = report.Churn[:min(n, len(report.Churn))]
+
+	return report
+}
+
+func printTopReport(report *topReport) {
+	ipRows := make([][]string, 0, len(report.IPs))
+	for _, ip := range report.IPs {
+		ipRows = append(ipRows, []string{ip.IP, strconv.Itoa(ip.Records), ip.MAC, ip.Hostname, ip.Organization})
+	}
+	printTable([]string{"IP", "Records", "MAC", "Hostname", "Organization"}, ipRows)
+
+	macRows := make([][]string, 0, len(report.MACs))
+	for _, device := range report.MACs {
+		macRows = append(macRows, []string{device.MAC, strconv.Itoa(device.IPs), device.CurrentIP, device.Hostname, device.Organization})
+	}
+	printTable([]string{"MAC", "IPs", "Current IP", "Hostname", "Organization"}, macRows)
+
+	churnRows := make([][]string, 0, len(report.Churn))
+	for _, device := range report.Churn {
+		churnRows = append(churnRows, []string{
+			device.MAC,
+			strconv.FormatFloat(device.RecordsPerDay, 'f', 1, 64),
+			strconv.Itoa(device.Records),
+			formatDisplayTime(device.FirstStart),
+			device.Hostname,
+			device.Organization,
+		})
+	}
+	printTable([]string{"MAC", "Records/Day", "Records", "First Start", "Hostname", "Organization"}, churnRows)
+}
+
+func outputTopReport(report *topReport, outputFormat string, outputFile string) error {
+	switch outputFormat {
+	case "table":
+		printTopReport(report)
+		return nil
+	case "json":
+		if err := writeOutput(outputFile, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		}); err != nil {
+			return fmt.Errorf("error writing json output: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format '%v'", outputFormat)
+}
+
+func runTop(ctx context.Context, opts *options, n int) error {
+	// Parse once, keeping every record for the per-MAC rankings as well as
+	// the latest lease of each IP.
+	var records []*leases.Lease
+	leaseMap, dhcpdConf, err := readLeasesFileRecords(ctx, opts, func(lease leases.Lease) {
+		records = append(records, &lease)
+	})
+	if err != nil {
+		return err
+	}
+
+	leaseReport, err := buildLeaseReport(ctx, opts, leaseMap, dhcpdConf)
+	if err != nil {
+		return err
+	}
+
+	deviceReport, err := buildDeviceReportFromRecords(ctx, opts, records)
+	if err != nil {
+		return err
+	}
+
+	return outputTopReport(buildTopReport(leaseReport, deviceReport, n), opts.outputFormat, opts.outputFile)
+}
+
+func setupTopCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	finishFilters := registerFilterFlags(flagSet, &opts)
+	flagSet.StringVar(&opts.outputFormat, "output", defaultOutputFormat, "output format: "+strings.Join(topOutputFormats, ", "))
+	flagSet.StringVar(&opts.outputFile, "out", "", "write non-table output to this file instead of stdout")
+	registerTimeFlags(flagSet)
+	registerAnonymizeFlags(flagSet, &opts)
+	n := flagSet.Int("n", defaultTopN, "number of addresses or MACs in each ranking")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if err := finishFilters(); err != nil {
+			return err
+		}
+		if *n <= 0 {
+			return fmt.Errorf("invalid -n %v", *n)
+		}
+
+		return runTop(ctx, &opts, *n)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+// vendorNameSuffixes are legal entity suffixes dropped from organization
+// names by -normalize.
+var vendorNameSuffixes = map[string]bool{
+	"ab":           true,
+	"ag":           true,
+	"bv":           true,
+	"co":           true,
+	"company":      true,
+	"corp":         true,
+	"corporation":  true,
+	"gmbh":         true,
+	"inc":          true,
+	"incorporated": true,
+	"kg":           true,
+	"limited":      true,
+	"llc":          true,
+	"ltd":          true,
+	"oy":           true,
+	"plc":          true,
+	"pte":          true,
+	"pty":          true,
+	"sa":           true,
+	"spa":          true,
+	"srl":          true,
+}
+
+// normalizeVendorName returns the key that spellings of an organization
+// name such as "Apple, Inc." and "APPLE INC" have in common: its lowercase
+// words without punctuation or trailing legal entity suffixes.
+func normalizeVendorName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for len(words) > 1 && vendorNameSuffixes[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// vendorCount is the number of devices of an organization.
+type vendorCount struct {
+	vendor  string
+	devices int
+}
+
+// countVendors counts the rows of report by organization, sorted by count
+// descending. With normalize, organizations with the same normalized name
+// are counted together under their most common spelling.
+func countVendors(report *deviceReport, normalize bool) []vendorCount {
+	keyToSpellings := make(map[string]map[string]int)
+	for i := range report.rows {
+		organization := report.rows[i].organization
+		key := organization
+		if normalize {
+			key = normalizeVendorName(organization)
+		}
+		if keyToSpellings[key] == nil {
+			keyToSpellings[key] = make(map[string]int)
+		}
+		keyToSpellings[key][organization]++
+	}
+
+	counts := make([]vendorCount, 0, len(keyToSpellings))
+	for _, spellings := range keyToSpellings {
+		count := vendorCount{}
+		spellingDevices := 0
+		for spelling, devices := range spellings {
+			count.devices += devices
+			if devices > spellingDevices || (devices == spellingDevices && spelling < count.vendor) {
+				count.vendor = spelling
+				spellingDevices = devices
+			}
+		}
+		counts = append(counts, count)
+	}
+	sort.Slice(counts, func(i int, j int) bool {
+		if counts[i].devices != counts[j].devices {
+			return counts[i].devices > counts[j].devices
+		}
+		return counts[i].vendor < counts[j].vendor
+	})
+	return counts
+}
+
+var vendorColumns = []string{"Organization", "Devices", "Percent"}
+
+func vendorCellRows(counts []vendorCount, total int) [][]string {
+	cellRows := make([][]string, 0, len(counts))
+	for _, count := range counts {
+		cellRows = append(cellRows, []string{
+			count.vendor,
+			strconv.Itoa(count.devices),
+			strconv.FormatFloat(100*float64(count.devices)/float64(total), 'f', 1, 64),
+		})
+	}
+	return cellRows
+}
+
+// printVendors builds a device report and outputs its devices counted by
+// organization. Unless allStates is set, only devices whose latest lease
+// is Current are counted.
+func printVendors(ctx context.Context, opts *options, normalize bool, allStates bool) error {
+	if !allStates {
+		opts.filters = append(opts.filters, func(row *leaseReportRow) bool {
+			return row.state == leases.Current
+		})
+	}
+
+	report, err := buildDeviceReport(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	counts := countVendors(report, normalize)
+	cellRows := vendorCellRows(counts, len(report.rows))
+
+	if opts.outputFormat != defaultOutputFormat {
+		return writeTabularOutput(vendorColumns, cellRows, opts.outputFormat, opts.outputFile)
+	}
+
+	printTable(vendorColumns, cellRows)
+	reportPrintf("")
+	reportPrintf("%v devices from %v organizations", len(report.rows), len(counts))
+	return nil
+}
+
+func setupVendorsCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	finishFilters := registerFilterFlags(flagSet, &opts)
+	flagSet.StringVar(&opts.outputFormat, "output", defaultOutputFormat, "output format: "+strings.Join(outputFormats, ", "))
+	flagSet.StringVar(&opts.outputFile, "out", "", "write non-table output to this file instead of stdout")
+	normalize := flagSet.Bool("normalize", false, "count spellings of an organization name such as 'Apple, Inc.' and 'APPLE INC' together, ignoring case, punctuation, and legal suffixes")
+	allStates := flagSet.Bool("all", false, "count devices whose latest lease is in any state, not only current")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		if err := finishFilters(); err != nil {
+			return err
+		}
+
+		return printVendors(ctx, &opts, *normalize, *allStates)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+)
+
+const (
+	watchDebounceDelay = 500 * time.Millisecond
+	// watchRewriteRetryDelay and watchRewriteRetries bound how long a missing
+	// or empty leases file is taken to be one dhcpd is rewriting, rather
+	// than reported as having no leases.
+	watchRewriteRetryDelay = time.Second
+	watchRewriteRetries    = 5
+)
+
+// countLeaseRecords returns the number of leases in leaseMap from lease
+// records, excluding static leases from dhcpd.conf.
+func countLeaseRecords(leaseMap leases.LeaseMap) int {
+	count := 0
+	for _, lease := range leaseMap {
+		if !lease.Static {
+			count++
+		}
+	}
+	return count
+}
+
+func watchLeasesFile(ctx context.Context, opts *options) error {
+	// Only local files can be watched for changes; serve polls other
+	// sources instead.
+	if opts.keaDSN != "" {
+		return errors.New("watch requires local leases files; use serve to poll -kea-dsn")
+	}
+	paths, err := opts.leasesFilePaths()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if strings.Contains(path, "://") {
+			return fmt.Errorf("watch requires local leases files, not %v; use serve to poll it", path)
+		}
+	}
+
+	dispatcher, err := newEventDispatcher(opts)
+	if err != nil {
+		return err
+	}
+	defer dispatcher.close()
+
+	var cache leaseFileCache
+	lastRecordCount := 0
+	rewriteRetries := 0
+	// transient reports whether a leases file that is missing or has no
+	// leases, after the last report had some, may be one dhcpd is still
+	// rewriting, so reporting it should be retried.
+	transient := func(reason string) bool {
+		if lastRecordCount == 0 || rewriteRetries == watchRewriteRetries {
+			return false
+		}
+		rewriteRetries++
+		slog.Warn("leases file "+reason+", waiting for it to be rewritten", "retry", rewriteRetries, "delay", watchRewriteRetryDelay)
+		return true
+	}
+
+	// printReport reports the leases, or returns false if it should be
+	// retried after watchRewriteRetryDelay.
+	printReport := func() bool {
+		leaseMap, dhcpdConf, err := cache.read(ctx, opts)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && transient("missing") {
+				return false
+			}
+			slog.Error("report error", "err", err)
+			return true
+		}
+		recordCount := countLeaseRecords(leaseMap)
+		if recordCount == 0 && transient("empty") {
+			return false
+		}
+		lastRecordCount = recordCount
+		rewriteRetries = 0
+
+		report, err := buildLeaseReport(ctx, opts, leaseMap, dhcpdConf)
+		if err != nil {
+			slog.Error("report error", "err", err)
+			return true
+		}
+		if err := printCheckedLeaseReport(ctx, report, opts); err != nil {
+			slog.Error("report error", "err", err)
+		}
+		dispatcher.observe(ctx, report)
+		return true
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("fsnotify.NewWatcher error: %w", err)
+	}
+	defer watcher.Close()
+
+	// dhcpd periodically rewrites the leases file by renaming a new file into
+	// place, so watch the containing directories rather than the files.
+	leasesFiles := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		leasesFile := filepath.Clean(path)
+		leasesFiles[leasesFile] = true
+		if err := watcher.Add(filepath.Dir(leasesFile)); err != nil {
+			return fmt.Errorf("watcher.Add error: %w", err)
+		}
+	}
+
+	slog.Info("watching", "paths", strings.Join(paths, ", "))
+
+	printReport()
+
+	debounceTimer := time.NewTimer(watchDebounceDelay)
+	debounceTimer.Stop()
+	var changedFile string
+	retrying := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !leasesFiles[filepath.Clean(event.Name)] {
+				continue
+			}
+			// dhcpd renames a new leases file into place when it rewrites
+			// it; the new file is opened by the next read.
+			if event.Op&fsnotify.Create != 0 {
+				slog.Info("leases file replaced", "path", filepath.Clean(event.Name))
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				changedFile = filepath.Clean(event.Name)
+				debounceTimer.Reset(watchDebounceDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Error("watcher error", "err", err)
+		case <-debounceTimer.C:
+			if !retrying {
+				slog.Info("leases file changed", "path", changedFile)
+			}
+			retrying = !printReport()
+			if retrying {
+				debounceTimer.Reset(watchRewriteRetryDelay)
+			}
+		}
+	}
+}
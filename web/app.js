@@ -0,0 +1,152 @@
+'use strict';
+
+const leaseStates = ['Current', 'Future', 'Past', 'Released', 'Backup', 'Static', 'Abandoned'];
+
+let leases = [];
+let sortKey = 'ip';
+let sortAscending = true;
+
+const ipToNumber = (ip) => {
+  const octets = ip.split('.');
+  if (octets.length !== 4) {
+    return 0;
+  }
+  return octets.reduce((value, octet) => (value * 256) + Number(octet), 0);
+};
+
+// Unknown times, such as the end time of leases that never end and the times
+// of static leases, are omitted.
+const isMissingTime = (timeString) => !timeString;
+
+// timeValue returns a sortable value of a time of lease, sorting leases that
+// never end last and missing times first.
+const timeValue = (lease, key) => {
+  if ((key === 'endTime') && lease.endsNever) {
+    return Infinity;
+  }
+  if (isMissingTime(lease[key])) {
+    return -Infinity;
+  }
+  return Date.parse(lease[key]);
+};
+
+const compareLeases = (a, b) => {
+  let result;
+  if (sortKey === 'ip') {
+    result = ipToNumber(a.ip) - ipToNumber(b.ip);
+  } else if (sortKey === 'count') {
+    result = a.count - b.count;
+  } else if ((sortKey === 'endTime') || (sortKey === 'clttTime')) {
+    const aValue = timeValue(a, sortKey);
+    const bValue = timeValue(b, sortKey);
+    result = (aValue === bValue) ? 0 : ((aValue < bValue) ? -1 : 1);
+  } else {
+    result = String(a[sortKey]).localeCompare(String(b[sortKey]));
+  }
+  return sortAscending ? result : -result;
+};
+
+const formatTime = (timeString) => (isMissingTime(timeString) ? '' : new Date(timeString).toLocaleString());
+
+const formatEndTime = (lease) => (lease.endsNever ? 'never' : formatTime(lease.endTime));
+
+const selectedStates = () => new Set(
+  Array.from(document.querySelectorAll('#states input:checked')).map((input) => input.value));
+
+const render = () => {
+  const search = document.getElementById('search').value.trim().toLowerCase();
+  const vendor = document.getElementById('vendor').value;
+  const states = selectedStates();
+
+  const filteredLeases = leases.filter((lease) => {
+    if (!states.has(lease.state)) {
+      return false;
+    }
+    if (vendor && (lease.organization !== vendor)) {
+      return false;
+    }
+    if (search) {
+      const text = [lease.ip, lease.mac, lease.hostname, lease.organization].join(' ').toLowerCase();
+      return text.includes(search);
+    }
+    return true;
+  });
+
+  filteredLeases.sort(compareLeases);
+
+  const tbody = document.getElementById('leases');
+  tbody.replaceChildren(...filteredLeases.map((lease) => {
+    const tr = document.createElement('tr');
+    tr.className = lease.state;
+    [
+      lease.ip,
+      lease.mac,
+      lease.count,
+      lease.hostname,
+      lease.state,
+      formatEndTime(lease),
+      formatTime(lease.clttTime),
+      lease.organization,
+    ].forEach((value) => {
+      const td = document.createElement('td');
+      td.textContent = value;
+      tr.appendChild(td);
+    });
+    return tr;
+  }));
+
+  document.getElementById('summary').textContent =
+    `Showing ${filteredLeases.length} of ${leases.length} leases with unique IPs`;
+};
+
+const populateControls = () => {
+  const vendorSelect = document.getElementById('vendor');
+  const vendors = Array.from(new Set(leases.map((lease) => lease.organization))).sort();
+  vendors.forEach((vendor) => {
+    const option = document.createElement('option');
+    option.value = vendor;
+    option.textContent = vendor;
+    vendorSelect.appendChild(option);
+  });
+
+  const statesSpan = document.getElementById('states');
+  leaseStates.forEach((state) => {
+    const label = document.createElement('label');
+    const input = document.createElement('input');
+    input.type = 'checkbox';
+    input.value = state;
+    input.checked = true;
+    input.addEventListener('change', render);
+    label.appendChild(input);
+    label.appendChild(document.createTextNode(` ${state}`));
+    statesSpan.appendChild(label);
+  });
+
+  document.getElementById('search').addEventListener('input', render);
+  vendorSelect.addEventListener('change', render);
+
+  document.querySelectorAll('th').forEach((th) => {
+    th.addEventListener('click', () => {
+      if (sortKey === th.dataset.key) {
+        sortAscending = !sortAscending;
+      } else {
+        sortKey = th.dataset.key;
+        sortAscending = true;
+      }
+      render();
+    });
+  });
+};
+
+const loadLeases = async () => {
+  const response = await fetch('leases');
+  if (!response.ok) {
+    document.getElementById('summary').textContent = `Error loading leases: ${response.status}`;
+    return;
+  }
+  leases = await response.json();
+  populateControls();
+  render();
+};
+
+loadLeases();
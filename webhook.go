@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultPoolFullThreshold = 90.0
+	defaultWebhookEvents     = "new-device,pool-nearly-full,lease-abandoned"
+	defaultWebhookRetries    = 3
+	webhookTimeout           = 10 * time.Second
+	webhookInitialBackoff    = time.Second
+)
+
+// webhookEventSink POSTs each event as a JSON object to a URL, retrying
+// failed requests with exponential backoff.
+type webhookEventSink struct {
+	url        *url.URL
+	eventTypes map[leaseEventType]bool
+	retries    int
+	client     *http.Client
+}
+
+func newWebhookEventSink(opts *options, rawURL string) (*webhookEventSink, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook url %v: %w", rawURL, err)
+	}
+	if parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %v: missing host", rawURL)
+	}
+
+	eventTypes, err := parseLeaseEventTypes(opts.webhookEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhookEventSink{
+		url:        parsedURL,
+		eventTypes: eventTypes,
+		retries:    opts.webhookRetries,
+		client:     &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+func (sink *webhookEventSink) String() string {
+	return sink.url.Redacted()
+}
+
+// Send POSTs each of events, continuing with the rest when one fails so a
+// failing event does not drop the others, and returns the errors joined.
+func (sink *webhookEventSink) Send(ctx context.Context, events []leaseEvent) error {
+	var errs []error
+	for i := range events {
+		event := &events[i]
+		if sink.eventTypes != nil && !sink.eventTypes[event.Type] {
+			continue
+		}
+
+		body, err := json.Marshal(event)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("json.Marshal error: %w", err))
+			continue
+		}
+
+		if err := sink.postWithRetry(ctx, body); err != nil {
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// postWithRetry POSTs body, retrying network errors, 429 responses, and 5xx
+// responses up to sink.retries times.
+func (sink *webhookEventSink) postWithRetry(ctx context.Context, body []byte) error {
+	backoff := webhookInitialBackoff
+
+	for attempt := 0; ; attempt++ {
+		retryable, err := sink.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= sink.retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post POSTs body once, returning whether a failure may succeed on retry.
+func (sink *webhookEventSink) post(ctx context.Context, body []byte) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.url.String(), bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("http.NewRequestWithContext error: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := sink.client.Do(request)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("error posting to %v: %w", sink, err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		retryable := response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+		return retryable, fmt.Errorf("error posting to %v: %v", sink, response.Status)
+	}
+
+	return false, nil
+}
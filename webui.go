@@ -0,0 +1,19 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed web
+var webFS embed.FS
+
+func webUIHandler() http.Handler {
+	webRootFS, err := fs.Sub(webFS, "web")
+	if err != nil {
+		panic(fmt.Sprintf("fs.Sub error %v", err))
+	}
+	return http.FileServer(http.FS(webRootFS))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/leases"
+	"github.com/aaronriekenberg/go-dhcp-leases/pkg/xlsx"
+)
+
+// countColumn is the index of the Count column in reportColumns, written
+// as a number in workbooks.
+const countColumn = 2
+
+// workbookRow returns the cells of row for a workbook sheet.
+func (report *leaseReport) workbookRow(row *leaseReportRow) []any {
+	cells := make([]any, 0, len(reportColumns))
+	for i, cell := range append(row.columnValues(), report.optionalValues(row)...) {
+		if i == countColumn {
+			cells = append(cells, row.lease.Count)
+		} else {
+			cells = append(cells, cell)
+		}
+	}
+	return cells
+}
+
+// summarySheet returns the lease counts by state and the pool utilization
+// of report.
+func summarySheet(report *leaseReport) xlsx.Sheet {
+	sheet := xlsx.Sheet{
+		Name:    "Summary",
+		Columns: []string{"Statistic", "Value"},
+	}
+	sheet.Rows = append(sheet.Rows, []any{"Leases", len(report.rows)})
+	for _, state := range leases.LeaseStates {
+		sheet.Rows = append(sheet.Rows, []any{state.String() + " leases", report.leaseStateToCount[state]})
+	}
+	sheet.Rows = append(sheet.Rows, []any{"Leases with randomized MACs", report.randomizedMACs})
+	for i := range report.pools {
+		usage := &report.pools[i]
+		prefix := "Pool " + usage.subnet.String() + " "
+		sheet.Rows = append(sheet.Rows,
+			[]any{prefix + "size", usage.size},
+			[]any{prefix + "leased", usage.leased},
+			[]any{prefix + "percent used", usage.percentUsed()},
+		)
+	}
+	return sheet
+}
+
+// leaseWorkbookSheets returns the sheets of the workbook of report: all
+// leases, the summary, and the leases of each subnet, using the dhcpd.conf
+// subnets or /24 and /64 networks as in stats.
+func leaseWorkbookSheets(report *leaseReport) []xlsx.Sheet {
+	columns := report.columns()
+
+	leasesSheet := xlsx.Sheet{
+		Name:    "Leases",
+		Columns: columns,
+		Rows:    make([][]any, 0, len(report.rows)),
+	}
+	subnetToSheet := make(map[string]*xlsx.Sheet)
+	// The rows are sorted by IP, so subnets are added in order too.
+	var subnetSheets []*xlsx.Sheet
+
+	for i := range report.rows {
+		row := &report.rows[i]
+		cells := report.workbookRow(row)
+		leasesSheet.Rows = append(leasesSheet.Rows, cells)
+
+		network := statsNetwork(row.lease.IPAddress, report.pools)
+		sheet := subnetToSheet[network.String()]
+		if sheet == nil {
+			sheet = &xlsx.Sheet{
+				Name:    network.String(),
+				Columns: columns,
+			}
+			subnetToSheet[network.String()] = sheet
+			subnetSheets = append(subnetSheets, sheet)
+		}
+		sheet.Rows = append(sheet.Rows, cells)
+	}
+
+	sheets := []xlsx.Sheet{leasesSheet, summarySheet(report)}
+	for _, sheet := range subnetSheets {
+		sheets = append(sheets, *sheet)
+	}
+	return sheets
+}
+
+func writeLeaseWorkbook(report *leaseReport, w io.Writer) error {
+	return xlsx.Write(w, leaseWorkbookSheets(report))
+}
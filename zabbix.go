@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// zabbixDiscoveryEntry is one pool in Zabbix low-level discovery JSON.
+type zabbixDiscoveryEntry struct {
+	Subnet string `json:"{#SUBNET}"`
+	Ranges string `json:"{#RANGES}"`
+}
+
+// zabbixPoolValues are the metrics of one pool returned by zabbix values.
+type zabbixPoolValues struct {
+	Size        uint64  `json:"size"`
+	Leased      uint64  `json:"leased"`
+	Free        uint64  `json:"free"`
+	PercentUsed float64 `json:"percentUsed"`
+}
+
+func writeZabbixJSON(outputFile string, value interface{}) error {
+	if err := writeOutput(outputFile, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(value)
+	}); err != nil {
+		return fmt.Errorf("error writing zabbix output: %w", err)
+	}
+	return nil
+}
+
+// runZabbix prints the pools of the dhcpd.conf as Zabbix low-level
+// discovery JSON for mode discovery, or their metrics for mode values: an
+// object keyed by subnet, or only the metrics of subnet if not empty.
+func runZabbix(ctx context.Context, opts *options, mode string, subnet string) error {
+	if opts.dhcpdConfFile == "" {
+		return errors.New("zabbix requires -dhcpd-conf to find configured pools")
+	}
+
+	report, err := readLeaseReport(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case "discovery":
+		entries := make([]zabbixDiscoveryEntry, 0, len(report.pools))
+		for i := range report.pools {
+			usage := &report.pools[i]
+			entries = append(entries, zabbixDiscoveryEntry{
+				Subnet: usage.subnet.String(),
+				Ranges: usage.rangesString(),
+			})
+		}
+		return writeZabbixJSON(opts.outputFile, map[string]interface{}{"data": entries})
+
+	case "values":
+		subnetToValues := make(map[string]zabbixPoolValues, len(report.pools))
+		for i := range report.pools {
+			usage := &report.pools[i]
+			subnetToValues[usage.subnet.String()] = zabbixPoolValues{
+				Size:        usage.size,
+				Leased:      usage.leased,
+				Free:        usage.free(),
+				PercentUsed: usage.percentUsed(),
+			}
+		}
+
+		if subnet == "" {
+			return writeZabbixJSON(opts.outputFile, subnetToValues)
+		}
+		values, ok := subnetToValues[subnet]
+		if !ok {
+			return fmt.Errorf("no pool for subnet %v in %v", subnet, opts.dhcpdConfFile)
+		}
+		return writeZabbixJSON(opts.outputFile, values)
+	}
+
+	return fmt.Errorf("unknown zabbix mode '%v'", mode)
+}
+
+func setupZabbixCommand(flagSet *flag.FlagSet) commandFunc {
+	var opts options
+	registerFileFlags(flagSet, &opts)
+	flagSet.StringVar(&opts.outputFile, "out", "", "write output to this file instead of stdout")
+
+	return func(ctx context.Context, flagSet *flag.FlagSet) error {
+		switch {
+		case flagSet.NArg() == 1 && flagSet.Arg(0) == "discovery":
+			return runZabbix(ctx, &opts, "discovery", "")
+		case flagSet.NArg() >= 1 && flagSet.NArg() <= 2 && flagSet.Arg(0) == "values":
+			return runZabbix(ctx, &opts, "values", flagSet.Arg(1))
+		}
+		flagSet.Usage()
+		return errUsage
+	}
+}